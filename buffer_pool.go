@@ -0,0 +1,113 @@
+package zstd
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// minBufferClass and maxBufferClass bound the power-of-two size classes
+	// of the buffer pools: 1KB to 1GB. Larger buffers are allocated directly
+	// and never pooled.
+	minBufferClass = 10
+	maxBufferClass = 30
+)
+
+// bufferPools holds one pool per size class. Pools store pointers to slices
+// to avoid the extra allocation of storing the slice as a value.
+var bufferPools [maxBufferClass + 1]sync.Pool
+
+// poolingEnabled is set by EnablePooling.
+var poolingEnabled int32
+
+// EnablePooling makes Decompress take the buffers it allocates from the
+// buffer pools. Callers can then give the returned slices back with
+// PutDecompressBuffer once they are done with them. Disabled by default.
+func EnablePooling(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&poolingEnabled, v)
+}
+
+func isPoolingEnabled() bool {
+	return atomic.LoadInt32(&poolingEnabled) == 1
+}
+
+// bufferClass returns the size class holding buffers of n bytes, or -1 when n
+// is too large to be pooled.
+func bufferClass(n int) int {
+	if n <= 1<<minBufferClass {
+		return minBufferClass
+	}
+	class := bits.Len(uint(n - 1))
+	if class > maxBufferClass {
+		return -1
+	}
+	return class
+}
+
+func getBuffer(n int) []byte {
+	class := bufferClass(n)
+	if class < 0 {
+		return make([]byte, n)
+	}
+	if p, ok := bufferPools[class].Get().(*[]byte); ok {
+		atomic.AddInt64(&pooledBuffers, -1)
+		return (*p)[:n]
+	}
+	return make([]byte, n, 1<<uint(class))
+}
+
+func putBuffer(buf []byte) {
+	c := cap(buf)
+	// Only keep buffers with the exact capacity of a class, so that a buffer
+	// taken from a class is always large enough
+	if c < 1<<minBufferClass || c&(c-1) != 0 {
+		return
+	}
+	class := bits.Len(uint(c)) - 1
+	if class > maxBufferClass {
+		return
+	}
+	buf = buf[:0]
+	atomic.AddInt64(&pooledBuffers, 1)
+	bufferPools[class].Put(&buf)
+}
+
+// GetCompressBuffer returns a buffer of length CompressBound(srcSize) from the
+// size-class pools, large enough to compress srcSize bytes without
+// reallocation. Return it with PutCompressBuffer when done.
+func GetCompressBuffer(srcSize int) []byte {
+	return getBuffer(CompressBound(srcSize))
+}
+
+// PutCompressBuffer returns a buffer to the pools. Buffers that did not come
+// from the pools are accepted if their capacity matches a size class, and
+// silently dropped otherwise. The buffer must not be used after the call.
+func PutCompressBuffer(buf []byte) {
+	putBuffer(buf)
+}
+
+// GetDecompressBuffer returns a buffer of length hint from the size-class
+// pools, e.g. to be passed as dst to Decompress. Return it with
+// PutDecompressBuffer when done.
+func GetDecompressBuffer(hint int) []byte {
+	return getBuffer(hint)
+}
+
+// PutDecompressBuffer returns a buffer to the pools, see PutCompressBuffer.
+func PutDecompressBuffer(buf []byte) {
+	putBuffer(buf)
+}
+
+// allocDecompressBuffer allocates the dst buffer of Decompress, from the
+// pools when enabled.
+func allocDecompressBuffer(n int) []byte {
+	if isPoolingEnabled() {
+		return getBuffer(n)
+	}
+	return make([]byte, n)
+}
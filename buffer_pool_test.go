@@ -0,0 +1,108 @@
+package zstd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBufferClass(t *testing.T) {
+	tests := []struct {
+		size  int
+		class int
+	}{
+		{0, minBufferClass},
+		{1, minBufferClass},
+		{1024, minBufferClass},
+		{1025, 11},
+		{2048, 11},
+		{1 << 20, 20},
+		{1<<20 + 1, 21},
+		{1 << maxBufferClass, maxBufferClass},
+		{1<<maxBufferClass + 1, -1},
+	}
+	for _, test := range tests {
+		if class := bufferClass(test.size); class != test.class {
+			t.Errorf("bufferClass(%d) = %d, want %d", test.size, class, test.class)
+		}
+	}
+}
+
+func TestGetPutCompressBuffer(t *testing.T) {
+	for _, size := range []int{0, 100, 5000, 200000} {
+		buf := GetCompressBuffer(size)
+		if len(buf) != CompressBound(size) {
+			t.Fatalf("size=%d: len = %d, want %d", size, len(buf), CompressBound(size))
+		}
+		if c := cap(buf); c&(c-1) != 0 {
+			t.Fatalf("size=%d: capacity %d is not a power of two", size, c)
+		}
+		PutCompressBuffer(buf)
+	}
+
+	// Buffers with a capacity not matching a class are dropped, never handed out
+	PutCompressBuffer(make([]byte, 3000))
+	for i := 0; i < 10; i++ {
+		if buf := GetDecompressBuffer(3000); cap(buf) != 4096 {
+			t.Fatalf("got a buffer of capacity %d from class 4096", cap(buf))
+		}
+	}
+}
+
+func TestDecompressWithPooling(t *testing.T) {
+	EnablePooling(true)
+	defer EnablePooling(false)
+
+	for _, size := range []int{10, 3000, 70000} {
+		input := []byte(strings.Repeat("x", size))
+		compressed, err := Compress(nil, input)
+		if err != nil {
+			t.Fatalf("Error while compressing: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			decompressed, err := Decompress(nil, compressed)
+			if err != nil {
+				t.Fatalf("Error while decompressing: %v", err)
+			}
+			if !bytes.Equal(decompressed, input) {
+				t.Fatalf("size=%d: decompressed does not match", size)
+			}
+			PutDecompressBuffer(decompressed)
+		}
+	}
+}
+
+func benchmarkDecompressVaryingSizes(b *testing.B, pooling bool) {
+	var payloads [][]byte
+	for _, size := range []int{1000, 10000, 50000, 200000} {
+		compressed, err := Compress(nil, []byte(strings.Repeat("Hello World! ", size/13)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		payloads = append(payloads, compressed)
+	}
+	EnablePooling(pooling)
+	defer EnablePooling(false)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, p := range payloads {
+			out, err := Decompress(nil, p)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if pooling {
+				PutDecompressBuffer(out)
+			}
+		}
+	}
+}
+
+func BenchmarkDecompressNoPooling(b *testing.B) {
+	benchmarkDecompressVaryingSizes(b, false)
+}
+
+func BenchmarkDecompressPooling(b *testing.B) {
+	benchmarkDecompressVaryingSizes(b, true)
+}
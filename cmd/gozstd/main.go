@@ -0,0 +1,299 @@
+//go:build cgo
+// +build cgo
+
+// Command gozstd compresses and decompresses data with the zstd package, to
+// reproduce offline what a node does, e.g. the compression of scroll batches.
+//
+// Usage:
+//
+//	gozstd compress [-l level] [-o output] [file]
+//	gozstd decompress [-o output] [file]
+//	gozstd scroll-compress [-hex] [-o output] [files...]
+//	gozstd scroll-decompress [-hex] [-o output] [file]
+//	gozstd inspect [-magicless] [file]
+//
+// Input is read from stdin when no file is given, and output is written to
+// stdout unless -o is set. scroll-compress prints the size and keccak hash of
+// each compressed batch in the format of testdata/input.txt.
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/colinlyguo/zstd"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const usage = `usage: gozstd <command> [flags] [files]
+
+commands:
+  compress           compress with a compression level
+  decompress         decompress zstd frames
+  scroll-compress    compress scroll batches, printing their size and hash
+  scroll-decompress  decompress a scroll batch
+  inspect            print the frames and blocks of compressed data
+`
+
+// errUsage is returned when the command line is invalid, the flag package
+// already reported why.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	commands := map[string]func(*flag.FlagSet, []string, io.Reader, io.Writer) error{
+		"compress":          compress,
+		"decompress":        decompress,
+		"scroll-compress":   scrollCompress,
+		"scroll-decompress": scrollDecompress,
+		"inspect":           inspect,
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "gozstd: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+	fs := flag.NewFlagSet("gozstd "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := command(fs, args[1:], stdin, stdout); err != nil {
+		if err == errUsage {
+			return 2
+		}
+		fmt.Fprintf(stderr, "gozstd %s: %s\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// parse parses the flags of a command, which takes at most maxFiles files.
+func parse(fs *flag.FlagSet, args []string, maxFiles int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage // Already reported by fs
+	}
+	if maxFiles >= 0 && fs.NArg() > maxFiles {
+		fmt.Fprintf(fs.Output(), "too many files: %s\n", strings.Join(fs.Args(), " "))
+		return errUsage
+	}
+	return nil
+}
+
+// readInput reads the file named name, or stdin if name is empty. With
+// hexInput the content is hex decoded, ignoring surrounding whitespace.
+func readInput(name string, stdin io.Reader, hexInput bool) ([]byte, error) {
+	var data []byte
+	var err error
+	if name == "" {
+		data, err = ioutil.ReadAll(stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	if err != nil || !hexInput {
+		return data, err
+	}
+	return hex.DecodeString(strings.TrimSpace(string(data)))
+}
+
+// writeOutput writes data to the file named name, or to stdout if name is
+// empty. With hexOutput the data is hex encoded, followed by a newline.
+func writeOutput(name string, stdout io.Writer, data []byte, hexOutput bool) error {
+	if hexOutput {
+		data = []byte(hex.EncodeToString(data) + "\n")
+	}
+	if name == "" {
+		_, err := stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+func compress(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	level := zstd.SpeedDefault
+	fs.Var(&level, "l", "compression level, a number or one of fastest, default, better, best")
+	output := fs.String("o", "", "output file")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	src, err := readInput(fs.Arg(0), stdin, false)
+	if err != nil {
+		return err
+	}
+	out, err := zstd.CompressWithLevel(nil, src, level)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*output, stdout, out, false)
+}
+
+func decompress(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	output := fs.String("o", "", "output file")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	src, err := readInput(fs.Arg(0), stdin, false)
+	if err != nil {
+		return err
+	}
+	out, err := zstd.Decompress(nil, src)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*output, stdout, out, false)
+}
+
+func scrollCompress(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	hexIO := fs.Bool("hex", false, "read batches and write the compressed batch hex encoded")
+	output := fs.String("o", "", "write the compressed batch to this file, with a single input")
+	if err := parse(fs, args, -1); err != nil {
+		return err
+	}
+	if *output != "" && fs.NArg() > 1 {
+		fmt.Fprintln(fs.Output(), "-o requires a single input")
+		return errUsage
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{""}
+	}
+	for _, file := range files {
+		src, err := readInput(file, stdin, *hexIO)
+		if err != nil {
+			return err
+		}
+		out, err := zstd.CompressScrollBatchBytes(src)
+		if err != nil {
+			return fmt.Errorf("%s: %v", batchName(file), err)
+		}
+		hash := crypto.Keccak256(out)
+		fmt.Fprintf(stdout, "%s, raw_size=%6d, compr_size=%6d, compr_keccak_hash=%x\n", batchName(file), len(src), len(out), hash)
+		if *output != "" {
+			if err := writeOutput(*output, stdout, out, *hexIO); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// batchName returns the name of a batch in the scroll-compress report, which
+// is its file name without extension.
+func batchName(file string) string {
+	if file == "" {
+		return "stdin"
+	}
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func scrollDecompress(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	hexIO := fs.Bool("hex", false, "read the compressed batch and write the batch hex encoded")
+	output := fs.String("o", "", "output file")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	src, err := readInput(fs.Arg(0), stdin, *hexIO)
+	if err != nil {
+		return err
+	}
+	out, err := zstd.DecompressScrollBatchBytes(src)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*output, stdout, out, *hexIO)
+}
+
+func inspect(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	magicless := fs.Bool("magicless", false, "parse a single frame without magic number, e.g. a scroll batch")
+	hexInput := fs.Bool("hex", false, "read hex encoded input")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	src, err := readInput(fs.Arg(0), stdin, *hexInput)
+	if err != nil {
+		return err
+	}
+	if *magicless {
+		return printBlocks(stdout, src, 0)
+	}
+
+	info, infoErr := zstd.Info(src)
+	fmt.Fprintf(stdout, "frames: %d (%d skippable), compressed: %d bytes", len(info.Frames), info.SkippableFrames, info.CompressedSize)
+	if info.DecompressedSize >= 0 {
+		fmt.Fprintf(stdout, ", decompressed: %d bytes, ratio: %.3f", info.DecompressedSize, info.Ratio())
+	}
+	fmt.Fprintln(stdout)
+	for i, frame := range info.Frames {
+		if frame.Skippable {
+			fmt.Fprintf(stdout, "frame %d: offset %d, skippable, %d bytes\n", i, frame.Offset, frame.CompressedSize)
+			continue
+		}
+		fmt.Fprintf(stdout, "frame %d: offset %d, compressed %d bytes, decompressed %d bytes, window %d, dict %d, checksum %v\n",
+			i, frame.Offset, frame.CompressedSize, frame.DecompressedSize, frame.WindowSize, frame.DictID, frame.HasChecksum)
+		if err := printBlocks(stdout, src[frame.Offset:frame.Offset+frame.CompressedSize], 4); err != nil {
+			return err
+		}
+	}
+	return infoErr
+}
+
+var blockTypes = [...]string{"raw", "rle", "compressed", "reserved"}
+
+// printBlocks prints the blocks of the frame in src, whose header starts at
+// offset, i.e. after the magic number if any. See RFC 8878 for the format.
+func printBlocks(w io.Writer, src []byte, offset int) error {
+	if offset >= len(src) {
+		return fmt.Errorf("truncated frame header")
+	}
+	descriptor := src[offset]
+	singleSegment := descriptor&0x20 != 0
+	offset++
+	if !singleSegment {
+		offset++ // Window descriptor
+	}
+	offset += [...]int{0, 1, 2, 4}[descriptor&3] // Dictionary ID
+	fcsSize := [...]int{0, 2, 4, 8}[descriptor>>6]
+	if fcsSize == 0 && singleSegment {
+		fcsSize = 1
+	}
+	offset += fcsSize
+
+	for i := 0; ; i++ {
+		if offset+3 > len(src) {
+			return fmt.Errorf("truncated block header at offset %d", offset)
+		}
+		header := uint32(src[offset]) | uint32(src[offset+1])<<8 | uint32(src[offset+2])<<16
+		last, blockType, size := header&1 != 0, header>>1&3, int(header>>3)
+		fmt.Fprintf(w, "  block %d: offset %d, %s, size %d, last %v\n", i, offset, blockTypes[blockType], size, last)
+		offset += 3
+		if blockType == 1 {
+			offset++ // A RLE block holds a single byte
+		} else {
+			offset += size
+		}
+		if last {
+			break
+		}
+	}
+	if descriptor&4 != 0 {
+		if offset+4 > len(src) {
+			return fmt.Errorf("truncated checksum at offset %d", offset)
+		}
+		fmt.Fprintf(w, "  checksum: %08x\n", binary.LittleEndian.Uint32(src[offset:]))
+	}
+	return nil
+}
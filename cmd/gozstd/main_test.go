@@ -0,0 +1,130 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gozstd is the path of the binary built by TestMain
+var gozstd string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "gozstd")
+	if err != nil {
+		panic(err)
+	}
+	gozstd = filepath.Join(dir, "gozstd")
+	if out, err := exec.Command("go", "build", "-o", gozstd, ".").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		panic("failed to build gozstd: " + err.Error() + "\n" + string(out))
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// runGozstd runs the binary with stdin and returns its stdout.
+func runGozstd(t *testing.T, stdin []byte, args ...string) []byte {
+	t.Helper()
+	cmd := exec.Command(gozstd, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("gozstd %s failed: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return out
+}
+
+func TestScrollCompressGolden(t *testing.T) {
+	golden, err := ioutil.ReadFile("../../testdata/input.txt")
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	files, err := filepath.Glob("../../testdata/batch*.hex")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("failed to list batches: %v", err)
+	}
+
+	out := runGozstd(t, nil, append([]string{"scroll-compress", "-hex"}, files...)...)
+	want := strings.Split(strings.TrimSpace(string(golden)), "\n")
+	got := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("expected %d lines, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d mismatch:\nwant %s\ngot  %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestScrollRoundTrip(t *testing.T) {
+	batch, err := ioutil.ReadFile("../../testdata/batch000.hex")
+	if err != nil {
+		t.Fatalf("failed to read batch: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "gozstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	compressed := filepath.Join(dir, "batch000.zst")
+	report := runGozstd(t, batch, "scroll-compress", "-hex", "-o", compressed)
+	if !strings.HasPrefix(string(report), "stdin, raw_size= 13996, compr_size=  3739, ") {
+		t.Fatalf("unexpected report %q", report)
+	}
+	out := runGozstd(t, nil, "scroll-decompress", "-hex", compressed)
+	if strings.TrimSpace(string(out)) != strings.TrimSpace(string(batch)) {
+		t.Fatal("decompressed batch does not match")
+	}
+
+	blocks := runGozstd(t, nil, "inspect", "-magicless", "-hex", compressed)
+	if !strings.Contains(string(blocks), "block 0: offset") || !strings.Contains(string(blocks), "last true") {
+		t.Fatalf("unexpected inspect output:\n%s", blocks)
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	src := bytes.Repeat([]byte("Hello, World! "), 10000)
+	for _, level := range []string{"fastest", "best", "3"} {
+		compressed := runGozstd(t, src, "compress", "-l", level)
+		if out := runGozstd(t, compressed, "decompress"); !bytes.Equal(out, src) {
+			t.Fatalf("level %s: decompressed data does not match", level)
+		}
+		info := runGozstd(t, compressed, "inspect")
+		if !strings.HasPrefix(string(info), "frames: 1 (0 skippable)") || !strings.Contains(string(info), "block 0:") {
+			t.Fatalf("level %s: unexpected inspect output:\n%s", level, info)
+		}
+	}
+}
+
+func TestInvalidUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"compress", "-l", "fast"},
+		{"decompress", "a", "b"},
+	} {
+		var stderr bytes.Buffer
+		if code := run(args, nil, ioutil.Discard, &stderr); code != 2 {
+			t.Errorf("%v: expected exit code 2, got %d", args, code)
+		}
+		if stderr.Len() == 0 {
+			t.Errorf("%v: expected a usage message", args)
+		}
+	}
+	if code := run([]string{"decompress"}, strings.NewReader("not zstd"), ioutil.Discard, ioutil.Discard); code != 1 {
+		t.Errorf("expected exit code 1 for invalid data, got %d", code)
+	}
+}
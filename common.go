@@ -0,0 +1,181 @@
+package zstd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Defines best and standard values for zstd cli
+const (
+	BestSpeed          = 1
+	BestCompression    = 20
+	DefaultCompression = 5
+)
+
+var (
+	// ErrEmptySlice is returned when there is nothing to decompress.
+	//
+	// All decompression functions follow the same contract: an empty or nil
+	// src returns (nil, ErrEmptySlice), a nil dst is treated as a zero
+	// capacity buffer, and a valid frame of empty content decodes to a non-nil
+	// empty slice.
+	ErrEmptySlice = errors.New("Bytes slice is empty")
+	// ErrNotSupported is returned when a feature is not available in the
+	// current build, e.g. when it requires the C library and cgo is disabled
+	ErrNotSupported = errors.New("Not supported by this build")
+	// ErrFrameTruncated is returned when src ends before the end of a frame
+	ErrFrameTruncated = errors.New("Frame is truncated")
+)
+
+const (
+	// decompressSizeBufferLimit is the limit we set on creating a decompression buffer for the Decompress API
+	// This is made to prevent DOS from maliciously-created payloads (aka zipbomb).
+	// For large payloads with a compression ratio > 10, you can do your own allocation and pass it to the method:
+	// dst := make([]byte, 1GB)
+	// decompressed, err := zstd.Decompress(dst, src)
+	decompressSizeBufferLimit = 1000 * 1000
+
+	zstdFrameHeaderSizeMin = 2  // From zstd.h. Since it's experimental API, hardcoding it
+	zstdFrameHeaderSizeMax = 18 // ZSTD_FRAMEHEADERSIZE_MAX from zstd.h
+
+	maxInt = int(^uint(0) >> 1)
+)
+
+// CompressBound returns the worst case size needed for a destination buffer,
+// which can be used to preallocate a destination buffer or select a previously
+// allocated buffer from a pool.
+// See zstd.h to mirror implementation of ZSTD_COMPRESSBOUND
+// The bound of sizes close to the largest int does not fit in an int, it is
+// then the largest int.
+func CompressBound(srcSize int) int {
+	lowLimit := 128 << 10 // 128 kB
+	var margin int
+	if srcSize < lowLimit {
+		margin = (lowLimit - srcSize) >> 11
+	}
+	bound := srcSize + (srcSize >> 8) + margin
+	if bound < srcSize {
+		return maxInt
+	}
+	return bound
+}
+
+// ParameterBoundsError is returned when a parameter value is outside of the
+// bounds supported by the linked libzstd.
+type ParameterBoundsError struct {
+	Parameter string
+	Value     int
+	Min       int
+	Max       int
+}
+
+func (e *ParameterBoundsError) Error() string {
+	return fmt.Sprintf("zstd: %s %d is out of bounds [%d, %d]", e.Parameter, e.Value, e.Min, e.Max)
+}
+
+// checkBounds returns a ParameterBoundsError if value is not in [min, max].
+func checkBounds(name string, value, min, max int) error {
+	if value < min || value > max {
+		return &ParameterBoundsError{Parameter: name, Value: value, Min: min, Max: max}
+	}
+	return nil
+}
+
+// VersionError is returned when a feature requires a more recent libzstd than
+// the one linked, which can only happen when building against an external
+// libzstd.
+type VersionError struct {
+	// Feature is the feature which is not available
+	Feature string
+	// Required is the minimum version of the feature, e.g. 10506 for 1.5.6
+	Required int
+	// Linked is the version of the linked libzstd
+	Linked int
+}
+
+func (e *VersionError) Error() string {
+	if e.Feature == "" {
+		return fmt.Sprintf("zstd: libzstd %s or later is required, linked against %s",
+			versionString(e.Required), versionString(e.Linked))
+	}
+	return fmt.Sprintf("zstd: %s requires libzstd %s or later, linked against %s",
+		e.Feature, versionString(e.Required), versionString(e.Linked))
+}
+
+// versionString formats a ZSTD_VERSION_NUMBER value as major.minor.release.
+func versionString(v int) string {
+	return fmt.Sprintf("%d.%d.%d", v/10000, v/100%100, v%100)
+}
+
+// LibraryCapabilities describes the features of the linked libzstd, see
+// Capabilities.
+type LibraryCapabilities struct {
+	// Multithread is set when compressing with workers is supported, see
+	// HasMultithreadSupport
+	Multithread bool
+	// Legacy is set when frames of zstd versions before 0.8 are decoded
+	Legacy bool
+	// Magicless is set when the magicless format of the scroll blobs is
+	// supported
+	Magicless bool
+	// DedicatedDictSearch is set when BulkProcessor supports
+	// WithDedicatedDictSearch
+	DedicatedDictSearch bool
+	// Version is the version of the linked libzstd, e.g. 10506 for 1.5.6, or
+	// 0 without it
+	Version uint
+}
+
+// DstSizeTooSmallError is returned by DecompressInto when dst cannot hold the
+// decompressed payload. It carries the size dst needs, when the frame headers
+// record it, so that callers can allocate once and retry.
+type DstSizeTooSmallError struct {
+	// RequiredSize is the total decompressed size, only valid if SizeKnown
+	RequiredSize int
+	// SizeKnown is false when a frame header does not record its content size
+	SizeKnown bool
+}
+
+func (e *DstSizeTooSmallError) Error() string {
+	if !e.SizeKnown {
+		return "Destination buffer is too small"
+	}
+	return fmt.Sprintf("Destination buffer is too small, %d bytes required", e.RequiredSize)
+}
+
+// ErrDictionaryRequired is returned when decompressing without a dictionary a
+// frame whose header records the ID of the dictionary it was compressed with,
+// so that the right dictionary can be fetched before retrying. Frames
+// compressed with a raw content dictionary carry no ID and fail with the
+// generic zstd error instead.
+type ErrDictionaryRequired struct {
+	DictID uint32
+}
+
+func (e ErrDictionaryRequired) Error() string {
+	return fmt.Sprintf("Dictionary %d is required", e.DictID)
+}
+
+// IsDstSizeTooSmallError returns whether the error correspond to zstd standard sDstSizeTooSmall error
+func IsDstSizeTooSmallError(e error) bool {
+	if e == nil {
+		// Spares the allocations of errors.As on the success path
+		return false
+	}
+	// An *Error, which only exists with cgo, compares its code, the
+	// DstSizeTooSmallError it may wrap being the cause of the failure, not the
+	// failure
+	var codeErr interface{ zstdCode() error }
+	if errors.As(e, &codeErr) {
+		e = codeErr.zstdCode()
+	} else {
+		var sizeErr *DstSizeTooSmallError
+		if errors.As(e, &sizeErr) {
+			return true
+		}
+	}
+	if e != nil && e.Error() == "Destination buffer is too small" {
+		return true
+	}
+	return false
+}
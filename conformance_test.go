@@ -0,0 +1,155 @@
+package zstd
+
+// Tests in this file only use the API shared by the cgo and the pure-Go
+// backends, and run against both:
+//   go test .
+//   CGO_ENABLED=0 go test .
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/colinlyguo/zstd/zstdtest"
+)
+
+var conformanceInputs = [][]byte{
+	nil,
+	{},
+	{0},
+	[]byte("Hello World!"),
+	[]byte(strings.Repeat("Hello World! ", 10000)),
+}
+
+func TestConformanceCompressDecompress(t *testing.T) {
+	for _, input := range conformanceInputs {
+		for _, level := range []int{BestSpeed, DefaultCompression, BestCompression} {
+			out, err := CompressLevel(nil, input, level)
+			if err != nil {
+				t.Fatalf("len=%d level=%d CompressLevel failed: %s", len(input), level, err)
+			}
+			if len(out) > CompressBound(len(input)) {
+				t.Errorf("len=%d level=%d output %d is larger than CompressBound %d", len(input), level, len(out), CompressBound(len(input)))
+			}
+			orig, err := Decompress(nil, out)
+			if err != nil {
+				t.Fatalf("len=%d level=%d Decompress failed: %s", len(input), level, err)
+			}
+			if orig == nil || !bytes.Equal(orig, input) {
+				t.Fatalf("len=%d level=%d orig does not match (len %d)", len(input), level, len(orig))
+			}
+		}
+	}
+}
+
+func TestConformanceRoundTrip(t *testing.T) {
+	zstdtest.RoundTrip(t, Compress, Decompress)
+	zstdtest.RoundTrip(t, func(dst, src []byte) ([]byte, error) {
+		return CompressLevel(dst, src, BestSpeed)
+	}, Decompress)
+}
+
+func TestConformanceGoldenFrames(t *testing.T) {
+	for _, g := range zstdtest.GoldenFrames() {
+		out, err := Decompress(nil, g.Frame)
+		if err != nil {
+			t.Fatalf("Failed to decompress %s: %s", g.Name, err)
+		}
+		if !bytes.Equal(out, g.Content) {
+			t.Errorf("Content of %s does not match", g.Name)
+		}
+		r := NewReader(bytes.NewReader(g.Frame))
+		out, err = ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Failed to stream %s: %s", g.Name, err)
+		}
+		if !bytes.Equal(out, g.Content) {
+			t.Errorf("Streamed content of %s does not match", g.Name)
+		}
+		r.Close()
+	}
+}
+
+func TestConformanceDecompressInto(t *testing.T) {
+	payload := []byte(strings.Repeat("Hello World! ", 100))
+	compressed, err := Compress(nil, payload)
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+
+	decompressed := make([]byte, len(payload))
+	n, err := DecompressInto(decompressed, compressed)
+	if err != nil {
+		t.Fatalf("DecompressInto failed: %v", err)
+	}
+	if n != len(payload) || !bytes.Equal(decompressed, payload) {
+		t.Fatalf("DecompressInto = %d bytes, want %d", n, len(payload))
+	}
+
+	small := make([]byte, len(payload)-1, len(payload)*2)
+	_, err = DecompressInto(small, compressed)
+	if !IsDstSizeTooSmallError(err) {
+		t.Fatalf("DecompressInto with a small buffer returned %v, want dst size too small", err)
+	}
+	var sizeErr *DstSizeTooSmallError
+	if !errors.As(err, &sizeErr) || !sizeErr.SizeKnown || sizeErr.RequiredSize != len(payload) {
+		t.Fatalf("DecompressInto returned %#v, want a required size of %d", err, len(payload))
+	}
+}
+
+func TestConformanceEmptySliceDecompress(t *testing.T) {
+	if out, err := Decompress(nil, []byte{}); err != ErrEmptySlice || out != nil {
+		t.Fatalf("Did not get the correct error: %s", err)
+	}
+	if n, err := DecompressInto(nil, nil); err != ErrEmptySlice || n != 0 {
+		t.Fatalf("Did not get the correct error: %s", err)
+	}
+}
+
+func TestConformanceReader(t *testing.T) {
+	for _, input := range conformanceInputs {
+		compressed, err := Compress(nil, input)
+		if err != nil {
+			t.Fatalf("Error while compressing: %v", err)
+		}
+		r := NewReader(bytes.NewReader(compressed))
+		decompressed, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("len=%d failed to read: %s", len(input), err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatalf("len=%d failed to close: %s", len(input), err)
+		}
+		if !bytes.Equal(decompressed, input) {
+			t.Fatalf("len=%d decompressed does not match (len %d)", len(input), len(decompressed))
+		}
+	}
+}
+
+func TestConformanceCrossBackendFrame(t *testing.T) {
+	// Frame produced by the C library at the default level, both backends must decode it
+	frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x20, 0x0c, 0x61, 0x00, 0x00, 0x48, 0x65, 0x6c, 0x6c, 0x6f, 0x20, 0x57, 0x6f, 0x72, 0x6c, 0x64, 0x21}
+	out, err := Decompress(nil, frame)
+	if err != nil {
+		t.Fatalf("Decompress failed: %s", err)
+	}
+	if string(out) != "Hello World!" {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
+
+func TestConformanceUnsupportedFeatures(t *testing.T) {
+	// Legacy frames and the scroll encoder are only available with the C library
+	legacy := []byte("%\xb5/\xfd\x00@\x00\x1bcompressed with legacy zstd\xc0\x00\x00")
+	if _, err := Decompress(nil, legacy); err != nil && err != ErrNotSupported {
+		t.Fatalf("legacy Decompress returned %v", err)
+	}
+	if _, err := CompressScrollBatchBytes([]byte(strings.Repeat("batch", 100))); err != nil && err != ErrNotSupported {
+		t.Fatalf("CompressScrollBatchBytes returned %v", err)
+	}
+	if _, err := DecompressScrollBatchBytes([]byte(strings.Repeat("batch", 100))); err == nil {
+		t.Fatal("DecompressScrollBatchBytes of garbage should fail")
+	}
+}
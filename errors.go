@@ -2,8 +2,14 @@ package zstd
 
 /*
 #include "zstd.h"
+#include "zstd_errors.h"
 */
 import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+)
 
 // ErrorCode is an error returned by the zstd library.
 type ErrorCode int
@@ -13,6 +19,70 @@ func (e ErrorCode) Error() string {
 	return C.GoString(C.ZSTD_getErrorName(C.size_t(e)))
 }
 
+// Error is an error returned by the zstd library with the context of the
+// failing call. Error gives the failing function and the zstd message, %+v
+// also prints the buffer sizes, the numeric code and the cause if any.
+//
+// errors.Is matches it against an ErrorCode of the same code and against the
+// errors of this package mapped from a code, such as ErrWindowTooLarge and
+// ErrChecksumMismatch. Errors of truncated input match ErrFrameTruncated and
+// io.ErrUnexpectedEOF, whether they come from the one-shot functions or from
+// the Reader.
+type Error struct {
+	// Op is the zstd function that failed, e.g. ZSTD_decompress.
+	Op string
+	// SrcLen and DstLen are the sizes of the input and output buffers passed
+	// to Op, 0 if it has none.
+	SrcLen int
+	DstLen int
+	// Code is the error returned by Op.
+	Code ErrorCode
+	// Err is the error that led to the call, if any, e.g. the one of the
+	// one-shot decompression from which Decompress fell back to streaming.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return "zstd: " + e.Op + ": " + e.Code.Error()
+}
+
+// Format implements fmt.Formatter, %+v prints all the fields.
+func (e *Error) Format(s fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && s.Flag('+'):
+		fmt.Fprintf(s, "zstd: %s (src %d bytes, dst %d bytes, code %d): %s",
+			e.Op, e.SrcLen, e.DstLen, int(C.ZSTD_getErrorCode(C.size_t(e.Code))), e.Code.Error())
+		if e.Err != nil {
+			fmt.Fprintf(s, ", after: %+v", e.Err)
+		}
+	case verb == 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	default:
+		io.WriteString(s, e.Error())
+	}
+}
+
+// Unwrap returns the cause of the error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) zstdCode() error {
+	return e.Code
+}
+
+// Is reports whether the code of e is target.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrWindowTooLarge, ErrChecksumMismatch, ErrFrameTruncated:
+		return frameError(int(e.Code)) == target
+	case io.ErrUnexpectedEOF:
+		return frameError(int(e.Code)) == ErrFrameTruncated
+	}
+	code, ok := target.(ErrorCode)
+	return ok && C.ZSTD_getErrorCode(C.size_t(code)) == C.ZSTD_getErrorCode(C.size_t(e.Code))
+}
+
 func cIsError(code int) bool {
 	return int(C.ZSTD_isError(C.size_t(code))) != 0
 }
@@ -20,15 +90,48 @@ func cIsError(code int) bool {
 // getError returns an error for the return code, or nil if it's not an error
 func getError(code int) error {
 	if code < 0 && cIsError(code) {
+		if C.ZSTD_getErrorCode(C.size_t(code)) == C.ZSTD_error_memory_allocation && isNativeMemoryLimited() {
+			return ErrNativeMemoryLimit
+		}
 		return ErrorCode(code)
 	}
 	return nil
 }
 
-// IsDstSizeTooSmallError returns whether the error correspond to zstd standard sDstSizeTooSmall error
-func IsDstSizeTooSmallError(e error) bool {
-	if e != nil && e.Error() == "Destination buffer is too small" {
-		return true
+// opError returns err, in an *Error with the context of the call if it is an
+// ErrorCode returned by op.
+func opError(op string, srcLen, dstLen int, err error) error {
+	code, ok := err.(ErrorCode)
+	if !ok {
+		return err
+	}
+	return &Error{Op: op, SrcLen: srcLen, DstLen: dstLen, Code: code}
+}
+
+// truncatedError returns the error of op for a stream ending within a frame
+// with srcLen bytes pending, the same as the one of ZSTD_decompress for a
+// truncated frame.
+func truncatedError(op string, srcLen int) error {
+	return &Error{Op: op, SrcLen: srcLen, Code: ErrorCode(-int(C.ZSTD_error_srcSize_wrong))}
+}
+
+// withCause sets cause as the Err of err if it is an *Error without one.
+func withCause(err, cause error) error {
+	var zerr *Error
+	if errors.As(err, &zerr) && zerr.Err == nil {
+		zerr.Err = cause
+	}
+	return err
+}
+
+// errorCode returns the zstd code of err, an ErrorCode or an *Error.
+func errorCode(err error) (ErrorCode, bool) {
+	if code, ok := err.(ErrorCode); ok {
+		return code, true
+	}
+	var zerr *Error
+	if errors.As(err, &zerr) {
+		return zerr.Code, true
 	}
-	return false
+	return 0, false
 }
@@ -1,6 +1,15 @@
+//go:build cgo
+// +build cgo
+
 package zstd
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -27,3 +36,133 @@ func TestFindIsDstSizeTooSmallError(t *testing.T) {
 		t.Fatal("IsDstSizeTooSmallError found multiple error codes matching, this shouldn't be the case")
 	}
 }
+
+func TestErrorContext(t *testing.T) {
+	compressed, err := Compress(nil, bytes.Repeat([]byte("context "), 1000))
+	failOnError(t, "Failed to compress", err)
+	compressed = compressed[:len(compressed)-2]
+	dst := make([]byte, 0, 1<<20)
+	_, err = Decompress(dst, compressed)
+	var zerr *Error
+	if !errors.As(err, &zerr) {
+		t.Fatalf("Expected an *Error, got %#v", err)
+	}
+	if zerr.Op != "ZSTD_decompress" || zerr.SrcLen != len(compressed) || zerr.DstLen != cap(dst) {
+		t.Errorf("Unexpected context %#v", zerr)
+	}
+	if expected := "zstd: ZSTD_decompress: " + zerr.Code.Error(); err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+	full := fmt.Sprintf("%+v", err)
+	if !strings.Contains(full, fmt.Sprintf("src %d bytes, dst %d bytes, code ", len(compressed), cap(dst))) {
+		t.Errorf("Expected the sizes in %q", full)
+	}
+	if !errors.Is(err, zerr.Code) || errors.Is(err, ErrorCode(-1)) {
+		t.Error("Expected errors.Is to compare the codes")
+	}
+}
+
+func TestErrorIsSentinel(t *testing.T) {
+	compressed, err := CompressWithParams(nil, []byte("checksummed"), CParams{Checksum: true})
+	failOnError(t, "Failed to compress", err)
+	compressed[len(compressed)-1] ^= 0xff
+	_, err = Decompress(nil, compressed)
+	var zerr *Error
+	if !errors.As(err, &zerr) || !errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrWindowTooLarge) {
+		t.Fatalf("Expected an *Error matching ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestErrorFallbackCause(t *testing.T) {
+	// Without a content size, the payload exceeds the size hint and the
+	// stream fallback fails on the corrupted last block
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	_, err := w.Write(bytes.Repeat([]byte("0123456789abcdef"), 1<<18))
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	src := b.Bytes()
+	src[len(src)-1] ^= 0xff
+
+	_, err = Decompress(nil, src)
+	var zerr *Error
+	if !errors.As(err, &zerr) || zerr.Op != "ZSTD_decompressStream" {
+		t.Fatalf("Expected an *Error of the stream, got %v", err)
+	}
+	if !IsDstSizeTooSmallError(zerr.Err) || !IsDstSizeTooSmallError(errors.Unwrap(err)) {
+		t.Fatalf("Expected the error of the one-shot call as the cause, got %v", zerr.Err)
+	}
+	if IsDstSizeTooSmallError(err) {
+		t.Fatalf("The cause must not classify the error, got %v", err)
+	}
+	if full := fmt.Sprintf("%+v", err); !strings.HasSuffix(full, ", after: "+zerr.Err.Error()) {
+		t.Errorf("Expected the cause in %q", full)
+	}
+}
+
+// errorClass classifies err as the predicates of the package see it.
+func errorClass(err error) string {
+	var zerr *Error
+	var notZstd ErrNotZstd
+	var dictErr ErrDictionaryRequired
+	switch {
+	case err == nil:
+		return "nil"
+	case IsDstSizeTooSmallError(err):
+		return "dst size too small"
+	case errors.Is(err, ErrChecksumMismatch):
+		return "checksum mismatch"
+	case errors.Is(err, ErrFrameTruncated) && errors.Is(err, io.ErrUnexpectedEOF):
+		return "truncated"
+	case errors.As(err, &notZstd):
+		return "not zstd"
+	case errors.As(err, &dictErr):
+		return "dictionary required"
+	case errors.As(err, &zerr):
+		return zerr.Code.Error()
+	}
+	return "unclassified: " + err.Error()
+}
+
+func TestErrorClassification(t *testing.T) {
+	payload := bytes.Repeat([]byte("classified the same way "), 10000)
+	frame, err := CompressWithParams(nil, payload, CParams{Checksum: true})
+	failOnError(t, "Failed to compress", err)
+	// Without a content size, Decompress falls back to the stream API
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	_, err = w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	stream := b.Bytes()
+	corrupt := func(src []byte, i int) []byte {
+		src = append([]byte(nil), src...)
+		src[i] ^= 0xff
+		return src
+	}
+
+	for _, test := range []struct {
+		name string
+		src  []byte
+		want string
+	}{
+		{"truncated frame", frame[:len(frame)-10], "truncated"},
+		{"truncated header", frame[:3], "truncated"},
+		{"truncated stream", stream[:len(stream)-10], "truncated"},
+		{"checksum", corrupt(frame, len(frame)-1), "checksum mismatch"},
+		{"corrupted stream", corrupt(stream, len(stream)-1), "Data corruption detected"},
+		{"not zstd", []byte("plain text, not compressed at all"), "not zstd"},
+		{"dictionary", compressedPayload, "dictionary required"},
+	} {
+		errs := map[string]error{}
+		_, errs["Decompress"] = Decompress(nil, test.src)
+		_, errs["DecompressInto"] = DecompressInto(make([]byte, len(payload)), test.src)
+		_, errs["Reader"] = ioutil.ReadAll(NewReader(bytes.NewReader(test.src)))
+		_, errs["DecompressFromReaderInto"] = DecompressFromReaderInto(make([]byte, len(payload)), bytes.NewReader(test.src))
+		for api, err := range errs {
+			if got := errorClass(err); got != test.want {
+				t.Errorf("%s: %s returned %v, classified as %q instead of %q", test.name, api, err, got, test.want)
+			}
+		}
+	}
+}
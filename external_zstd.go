@@ -1,8 +1,11 @@
-//go:build external_libzstd
-// +build external_libzstd
+//go:build external_libzstd || libzstd_external
+// +build external_libzstd libzstd_external
 
 package zstd
 
+// The vendored sources are all guarded by USE_EXTERNAL_ZSTD, which leaves them
+// empty in this build.
+
 // #cgo CFLAGS: -DUSE_EXTERNAL_ZSTD
 // #cgo pkg-config: libzstd
 /*
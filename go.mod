@@ -2,4 +2,8 @@ module github.com/colinlyguo/zstd
 
 go 1.14
 
-require github.com/ethereum/go-ethereum v1.13.15
+require (
+	github.com/ethereum/go-ethereum v1.13.15
+	github.com/klauspost/compress v1.15.15
+	golang.org/x/crypto v0.17.0
+)
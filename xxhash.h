@@ -7020,4 +7020,21 @@ XXH3_generateSecret_fromSeed(XXH_NOESCAPE void* secretBuffer, XXH64_hash_t seed)
 } /* extern "C" */
 #endif
 
+#else /* USE_EXTERNAL_ZSTD */
+/* libzstd does not install xxhash.h but exports XXH64 with its namespace */
+#include <stddef.h>
+typedef unsigned long long XXH64_hash_t;
+typedef struct XXH64_state_s XXH64_state_t;
+XXH64_hash_t ZSTD_XXH64(const void* input, size_t length, XXH64_hash_t seed);
+XXH64_state_t* ZSTD_XXH64_createState(void);
+int ZSTD_XXH64_freeState(XXH64_state_t* statePtr);
+int ZSTD_XXH64_reset(XXH64_state_t* statePtr, XXH64_hash_t seed);
+int ZSTD_XXH64_update(XXH64_state_t* statePtr, const void* input, size_t length);
+XXH64_hash_t ZSTD_XXH64_digest(const XXH64_state_t* statePtr);
+#define XXH64 ZSTD_XXH64
+#define XXH64_createState ZSTD_XXH64_createState
+#define XXH64_freeState ZSTD_XXH64_freeState
+#define XXH64_reset ZSTD_XXH64_reset
+#define XXH64_update ZSTD_XXH64_update
+#define XXH64_digest ZSTD_XXH64_digest
 #endif /* USE_EXTERNAL_ZSTD */
@@ -474,4 +474,6 @@ size_t ZDICT_addEntropyTablesFromBuffer(void* dictBuffer, size_t dictContentSize
 }
 #endif
 
+#else /* USE_EXTERNAL_ZSTD */
+#include_next <zdict.h>
 #endif /* USE_EXTERNAL_ZSTD */
@@ -4,102 +4,100 @@ package zstd
 // support decoding of "legacy" zstd payloads from versions [0.4, 0.8], matching the
 // default configuration of the zstd command line tool:
 // https://github.com/facebook/zstd/blob/dev/programs/README.md
-#cgo CFLAGS: -DZSTD_LEGACY_SUPPORT=4 -DZSTD_MULTITHREAD=1 -DZSTD_STATIC_LINKING_ONLY
+#cgo CFLAGS: -DZSTD_LEGACY_SUPPORT=4 -DZSTD_STATIC_LINKING_ONLY
 
 #include "zstd.h"
+#include "zstd_errors.h"
 */
 import "C"
 import (
 	"bytes"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"runtime"
 	"unsafe"
 )
 
-// Defines best and standard values for zstd cli
-const (
-	BestSpeed          = 1
-	BestCompression    = 20
-	DefaultCompression = 5
-)
-
-var (
-	// ErrEmptySlice is returned when there is nothing to compress
-	ErrEmptySlice = errors.New("Bytes slice is empty")
-)
-
-const (
-	// decompressSizeBufferLimit is the limit we set on creating a decompression buffer for the Decompress API
-	// This is made to prevent DOS from maliciously-created payloads (aka zipbomb).
-	// For large payloads with a compression ratio > 10, you can do your own allocation and pass it to the method:
-	// dst := make([]byte, 1GB)
-	// decompressed, err := zstd.Decompress(dst, src)
-	decompressSizeBufferLimit = 1000 * 1000
-
-	zstdFrameHeaderSizeMin = 2 // From zstd.h. Since it's experimental API, hardcoding it
-)
-
-var scrollCParams *C.ZSTD_CCtx
-
-func init() {
-	scrollCParams = C.ZSTD_createCCtx()
-	if scrollCParams == nil {
-		panic("ZSTD_createCCtx() failed")
-	}
-
-	// Set compression level to compression level (22)
-	if err := checkError(C.ZSTD_CCtx_setParameter(scrollCParams, C.ZSTD_c_compressionLevel, C.int(22))); err != nil {
-		panic(fmt.Errorf("failed to set compression level: %v", err))
-	}
-
-	// Disable compression of literals
-	if err := checkError(C.ZSTD_CCtx_setParameter(scrollCParams, C.ZSTD_c_literalCompressionMode, C.ZSTD_ps_disable)); err != nil {
-		panic(fmt.Errorf("failed to disable literal compression: %v", err))
-	}
-
-	// Set target block size
-	if err := checkError(C.ZSTD_CCtx_setParameter(scrollCParams, C.ZSTD_c_targetCBlockSize, C.int(124*1024))); err != nil {
-		panic(fmt.Errorf("failed to set target block size: %v", err))
-	}
+// ErrSizeHintExceeded is returned by DecompressStrict when the payload does
+// not fit in the buffer sized from the decompression hint
+var ErrSizeHintExceeded = errors.New("Decompressed size exceeds the size hint")
 
-	// Set windows log to 17
-	if err := checkError(C.ZSTD_CCtx_setParameter(scrollCParams, C.ZSTD_c_windowLog, C.int(17))); err != nil {
-		panic(fmt.Errorf("failed to set window log: %v", err))
+// scrollPool keeps the contexts configured for the scroll batch encoding,
+// one per concurrent compression. scrollPoolErr is set instead if the linked
+// libzstd cannot produce the blobs.
+var scrollPool, scrollPoolErr = func() (*CtxPool, error) {
+	if err := checkScrollCapabilities(); err != nil {
+		return nil, err
 	}
+	return newCtxPool(setScrollCParams, runtime.NumCPU())
+}()
+
+// scrollCParams are the parameters of the scroll batch encoding, in the order
+// they are set, with what setting them does for the error messages. Changing
+// any of them changes the blobs, which the other implementations of the
+// protocol must reproduce byte for byte.
+var scrollCParams = []struct {
+	ParamValue
+	action string
+}{
+	{ParamValue{C.ZSTD_c_compressionLevel, 22}, "set compression level"},
+	// Literals are stored raw
+	{ParamValue{C.ZSTD_c_literalCompressionMode, C.ZSTD_ps_disable}, "disable literal compression"},
+	{ParamValue{C.ZSTD_c_targetCBlockSize, 124 * 1024}, "set target block size"},
+	{ParamValue{C.ZSTD_c_windowLog, 17}, "set window log"},
+	// No dictionary ID, checksum, magic bytes nor content size in the header
+	{ParamValue{C.ZSTD_c_dictIDFlag, 0}, "disable dictionary ID"},
+	{ParamValue{C.ZSTD_c_checksumFlag, 0}, "disable checksum"},
+	{ParamValue{C.ZSTD_c_format, C.ZSTD_f_zstd1_magicless}, "set magicless format"},
+	{ParamValue{C.ZSTD_c_contentSizeFlag, 0}, "enable content size flag"},
+	// Compress on the calling thread rather than relying on the default of
+	// the build, which defines ZSTD_MULTITHREAD
+	{ParamValue{C.ZSTD_c_nbWorkers, 0}, "disable workers"},
+}
 
-	// Do not include dictionary
-	if err := checkError(C.ZSTD_CCtx_setParameter(scrollCParams, C.ZSTD_c_dictIDFlag, 0)); err != nil {
-		panic(fmt.Errorf("failed to disable dictionary ID: %v", err))
-	}
+// ParamValue is a compression parameter with its value.
+type ParamValue struct {
+	Param CParameter
+	Value int
+}
 
-	// Do not include checksum
-	if err := checkError(C.ZSTD_CCtx_setParameter(scrollCParams, C.ZSTD_c_checksumFlag, 0)); err != nil {
-		panic(fmt.Errorf("failed to disable checksum: %v", err))
-	}
+// ScrollParams are the compression parameters of the scroll batch encoding.
+type ScrollParams []ParamValue
 
-	// Do not include magic bytes
-	if err := checkError(C.ZSTD_CCtx_setParameter(scrollCParams, C.ZSTD_c_format, C.ZSTD_f_zstd1_magicless)); err != nil {
-		panic(fmt.Errorf("failed to set magicless format: %v", err))
+// ScrollBatchParams returns the parameters CompressScrollBatchBytes sets on
+// its compression contexts, in the order it sets them.
+func ScrollBatchParams() ScrollParams {
+	params := make(ScrollParams, len(scrollCParams))
+	for i, p := range scrollCParams {
+		params[i] = p.ParamValue
 	}
+	return params
+}
 
-	// Do not include content size
-	if err := checkError(C.ZSTD_CCtx_setParameter(scrollCParams, C.ZSTD_c_contentSizeFlag, 0)); err != nil {
-		panic(fmt.Errorf("failed to enable content size flag: %v", err))
+// IsDeterministicProfile reports whether p explicitly pins down the
+// parameters the output could otherwise depend on beyond the input and the
+// libzstd version: the compression level and window log, and nbWorkers at 0,
+// since the output of the workers depends on the size of their jobs.
+func (p ScrollParams) IsDeterministicProfile() bool {
+	set := make(map[CParameter]int, len(p))
+	for _, pv := range p {
+		set[pv.Param] = pv.Value
 	}
+	_, level := set[CParamCompressionLevel]
+	_, windowLog := set[CParamWindowLog]
+	nbWorkers, ok := set[CParamNbWorkers]
+	return level && windowLog && ok && nbWorkers == 0
 }
 
-// CompressBound returns the worst case size needed for a destination buffer,
-// which can be used to preallocate a destination buffer or select a previously
-// allocated buffer from a pool.
-// See zstd.h to mirror implementation of ZSTD_COMPRESSBOUND
-func CompressBound(srcSize int) int {
-	lowLimit := 128 << 10 // 128 kB
-	var margin int
-	if srcSize < lowLimit {
-		margin = (lowLimit - srcSize) >> 11
+// setScrollCParams sets the parameters of the scroll batch encoding on cctx.
+func setScrollCParams(cctx *C.ZSTD_CCtx) error {
+	for _, p := range scrollCParams {
+		if err := checkError(C.ZSTD_CCtx_setParameter(cctx, C.ZSTD_cParameter(p.Param), C.int(p.Value))); err != nil {
+			return fmt.Errorf("failed to %s: %w", p.action, err)
+		}
 	}
-	return srcSize + (srcSize >> 8) + margin
+	return nil
 }
 
 // cCompressBound is a cgo call to check the go implementation above against the c code.
@@ -111,17 +109,32 @@ func cCompressBound(srcSize int) int {
 // based on zstd frame descriptors. To prevent DOS from maliciously-created payloads, limit the size
 func decompressSizeHint(src []byte) int {
 	// 1 MB or 10x input size
-	upperBound := 10 * len(src)
+	upperBound := maxInt
+	if len(src) <= maxInt/10 {
+		upperBound = 10 * len(src)
+	}
 	if upperBound < decompressSizeBufferLimit {
 		upperBound = decompressSizeBufferLimit
 	}
 
+	// A seek table gives the exact size of all the frames. It is not verified
+	// against them, so it is only trusted up to upperBound, see decompress.
+	if size, ok := seekTableContentSize(src); ok && size <= uint64(upperBound) {
+		if size == 0 {
+			return 1
+		}
+		return int(size)
+	}
+
 	hint := upperBound
 	if len(src) >= zstdFrameHeaderSizeMin {
-		hint = int(C.ZSTD_getFrameContentSize(unsafe.Pointer(&src[0]), C.size_t(len(src))))
-		if hint < 0 { // On error, just use upperBound
-			hint = upperBound
+		// Compare before converting, the unknown and error sizes or a size
+		// above maxInt would not fit in an int
+		size := uint64(C.ZSTD_getFrameContentSize(unsafe.Pointer(&src[0]), C.size_t(len(src))))
+		if size >= uint64(C.ZSTD_CONTENTSIZE_ERROR) || size > uint64(upperBound) { // On error, just use upperBound
+			size = uint64(upperBound)
 		}
+		hint = int(size)
 		if hint == 0 { // When compressing the empty slice, we need an output of at least 1 to pass down to the C lib
 			hint = 1
 		}
@@ -136,40 +149,136 @@ func decompressSizeHint(src []byte) int {
 
 // Compress src into dst.  If you have a buffer to use, you can pass it to
 // prevent allocation.  If it is too small, or if nil is passed, a new buffer
-// will be allocated and returned.
+// will be allocated and returned. It compresses at DefaultLevel(), see
+// SetDefaultCompressionLevel.
 func Compress(dst, src []byte) ([]byte, error) {
-	return CompressLevel(dst, src, DefaultCompression)
+	return CompressLevel(dst, src, DefaultLevel())
 }
 
-// CompressScrollBatchBytes compresses batch bytes into blob bytes.
+// CompressScrollBatchBytes compresses batch bytes into blob bytes. The blob is
+// never larger than the batch: batches which do not compress fail with an
+// error for which IsDstSizeTooSmallError returns true. It returns an error
+// when built against an external libzstd lacking the capabilities of the
+// scroll encoder, e.g. a *VersionError if it is older than 1.5.6.
 func CompressScrollBatchBytes(src []byte) ([]byte, error) {
 	if len(src) == 0 {
 		return []byte{}, nil
 	}
+	if scrollPoolErr != nil {
+		return nil, scrollPoolErr
+	}
+
+	hook, start := startTelemetry()
+	out, err := compressScrollBatch(src)
+	if hook != nil {
+		endTelemetry(hook, OpCompressScrollBatch, start, len(src), len(out), err)
+	}
+	return out, err
+}
+
+// compressScrollBatch compresses src with a context of scrollPool into a blob
+// of at most len(src) bytes.
+func compressScrollBatch(src []byte) ([]byte, error) {
+	c, err := scrollPool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer scrollPool.Put(c)
+	return compress2Into(c.cctx, make([]byte, len(src)), src)
+}
+
+// CompressScrollBatchVectored is like CompressScrollBatchBytes but compresses
+// the concatenation of srcs, e.g. the block bytes of a batch, without
+// assembling them in a contiguous buffer first. The output is a valid blob but
+// may differ from the one of CompressScrollBatchBytes for the same data. It is
+// never larger than the batch either.
+func CompressScrollBatchVectored(srcs [][]byte) ([]byte, error) {
+	total := 0
+	for _, src := range srcs {
+		total += len(src)
+	}
+	if total == 0 {
+		return []byte{}, nil
+	}
+	if scrollPoolErr != nil {
+		return nil, scrollPoolErr
+	}
 
-	dst := make([]byte, len(src))
-	result := C.ZSTD_compress2(
-		scrollCParams,
-		unsafe.Pointer(&dst[0]), C.size_t(len(dst)),
-		unsafe.Pointer(&src[0]), C.size_t(len(src)),
-	)
+	c, err := scrollPool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer scrollPool.Put(c)
+	out, err := compressVectored(c.cctx, nil, srcs)
+	if err == nil && len(out) > total {
+		return nil, opError("ZSTD_compressStream2", total, total, ErrorCode(-int(C.ZSTD_error_dstSize_tooSmall)))
+	}
+	return out, err
+}
 
-	if err := checkError(result); err != nil {
+// DecompressScrollBatchBytes decompresses blob bytes produced by
+// CompressScrollBatchBytes back into batch bytes. As the frames do not start
+// with a magic number, they cannot be decompressed with Decompress. If a frame
+// header declares its content size, the decompressed size is checked against
+// it and ErrContentSizeMismatch is returned if they differ.
+func DecompressScrollBatchBytes(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return nil, ErrEmptySlice
+	}
+	if err := checkMagicless(); err != nil {
 		return nil, err
 	}
 
-	return dst[:result], nil
+	r := newReader(bytes.NewReader(src), nil)
+	defer r.Close()
+	if r.firstError != nil {
+		return nil, r.firstError
+	}
+	if err := setDParameter(r.ctx, DParamFormat, C.ZSTD_f_zstd1_magicless); err != nil {
+		return nil, err
+	}
+	out, err := readAllInto(make([]byte, 0, decompressSizeHint(src)), r)
+	if err != nil {
+		return nil, err
+	}
+
+	var header C.ZSTD_frameHeader
+	code := C.ZSTD_getFrameHeader_advanced(&header, unsafe.Pointer(&src[0]), C.size_t(len(src)), C.ZSTD_f_zstd1_magicless)
+	if code == 0 && header.frameType != C.ZSTD_skippableFrame && uint64(header.frameContentSize) != uint64(C.ZSTD_CONTENTSIZE_UNKNOWN) &&
+		uint64(header.frameContentSize) != uint64(len(out)) {
+		return nil, ErrContentSizeMismatch{Declared: uint64(header.frameContentSize), Actual: uint64(len(out))}
+	}
+	return out, nil
 }
 
+// checkError returns the error of ZSTD_CCtx_setParameter, if code is one.
 func checkError(code C.size_t) error {
-	if C.ZSTD_isError(code) != 0 {
-		return fmt.Errorf("zstd error: %s", C.GoString(C.ZSTD_getErrorName(code)))
-	}
-	return nil
+	return opError("ZSTD_CCtx_setParameter", 0, 0, getError(int(code)))
 }
 
-// CompressLevel is the same as Compress but you can pass a compression level
+// CompressLevel is the same as Compress but you can pass a compression level.
+//
+// Inputs of 64MB or more are compressed in chunks with the streaming API into
+// the same frame, so that the goroutine does not stay in C for the whole input
+// and dst does not need to hold CompressBound(len(src)) bytes upfront. This
+// requires runtime.Pinner (Go 1.21) to read the input in place: older
+// toolchains compress it in a single call rather than copying it. See
+// CompressWithContext to cancel the compression of large inputs.
 func CompressLevel(dst, src []byte, level int) ([]byte, error) {
+	hook, start := startTelemetry()
+	out, err := compressLevel(dst, src, level)
+	if hook != nil {
+		endTelemetry(hook, OpCompress, start, len(src), len(out), err)
+	}
+	return out, err
+}
+
+func compressLevel(dst, src []byte, level int) ([]byte, error) {
+	if pinSupported && len(src) >= chunkedCompressThreshold {
+		// Pinning src makes it escape, so that the inputs of CompressLevel
+		// are on the heap even when they are small
+		return compressChunked(dst, src, level)
+	}
 	bound := CompressBound(len(src))
 	if cap(dst) >= bound {
 		dst = dst[0:bound] // Reuse dst buffer
@@ -180,6 +289,7 @@ func CompressLevel(dst, src []byte, level int) ([]byte, error) {
 	// We need unsafe.Pointer(&src[0]) in the Cgo call to avoid "Go pointer to Go pointer" panics.
 	// This means we need to special case empty input. See:
 	// https://github.com/golang/go/issues/14210#issuecomment-346402945
+	hook, start := startTrace()
 	var cWritten C.size_t
 	if len(src) == 0 {
 		cWritten = C.ZSTD_compress(
@@ -198,9 +308,13 @@ func CompressLevel(dst, src []byte, level int) ([]byte, error) {
 	}
 
 	written := int(cWritten)
+	if hook != nil {
+		endTrace(hook, start, Event{Op: "ZSTD_compress", Level: level, SrcSize: len(src), DstSize: len(dst),
+			Consumed: len(src), Written: written, Err: getError(written)})
+	}
 	// Check if the return is an Error code
 	if err := getError(written); err != nil {
-		return nil, err
+		return nil, opError("ZSTD_compress", len(src), len(dst), err)
 	}
 	return dst[:written], nil
 }
@@ -208,30 +322,142 @@ func CompressLevel(dst, src []byte, level int) ([]byte, error) {
 // Decompress src into dst.  If you have a buffer to use, you can pass it to
 // prevent allocation.  If it is too small, or if nil is passed, a new buffer
 // will be allocated and returned.
+//
+// When the payload is larger than the size hint (the content size from the
+// frame header, at most 10x the input size or 1MB), Decompress switches to the
+// stream API, which still decodes into dst as long as its capacity suffices,
+// then doubles the capacity of the buffer whenever it is full.
 func Decompress(dst, src []byte) ([]byte, error) {
+	hook, start := startTelemetry()
+	out, err := decompress(dst, src, false, DecompressOptions{})
+	if hook != nil {
+		endTelemetry(hook, OpDecompress, start, len(src), len(out), err)
+	}
+	return out, err
+}
+
+// DecompressStrict is like Decompress but never switches to the slower stream
+// API: if the payload does not fit in the buffer sized from the frame header
+// hint (and at most 10x the input size, or 1MB), it returns
+// ErrSizeHintExceeded. This can be used to reject payloads whose compression
+// ratio exceeds a policy.
+func DecompressStrict(dst, src []byte) ([]byte, error) {
+	return decompress(dst, src, true, DecompressOptions{})
+}
+
+func decompress(dst, src []byte, strict bool, opts DecompressOptions) ([]byte, error) {
 	if len(src) == 0 {
-		return []byte{}, ErrEmptySlice
+		return nil, ErrEmptySlice
+	}
+	opts = opts.withLimits(GlobalLimits())
+	if err := opts.check(src); err != nil {
+		return nil, err
 	}
 
+	orig := dst
 	bound := decompressSizeHint(src)
+	if !strict && opts.MaxSize > 0 {
+		// A seek table may declare more than the hint, which can be
+		// trusted as long as the limit bounds what it makes us allocate
+		if size, ok := seekTableContentSize(src); ok && size > uint64(bound) && size <= uint64(opts.MaxSize) {
+			bound = int(size)
+		}
+	}
+	if opts.MaxSize > 0 && opts.MaxSize < maxInt && bound > opts.MaxSize+1 {
+		// One more byte tells payloads exceeding the limit apart
+		bound = opts.MaxSize + 1
+	}
+	allocated := false
 	if cap(dst) >= bound {
 		dst = dst[0:cap(dst)]
 	} else {
-		dst = make([]byte, bound)
+		dst = allocDecompressBuffer(bound)
+		allocated = true
 	}
 
-	written, err := DecompressInto(dst, src)
+	written, err := decompressInto(dst, src)
+	if err == nil && opts.MaxSize > 0 && written > opts.MaxSize {
+		return nil, ErrSizeLimitExceeded
+	}
 	if err == nil {
+		if err := opts.verify(src, written, nil); err != nil {
+			return nil, err
+		}
+		if opts.ContentHash != nil {
+			opts.ContentHash.Write(dst[:written])
+		}
 		return dst[:written], nil
 	}
+	if allocated && isPoolingEnabled() {
+		putBuffer(dst)
+	}
 	if !IsDstSizeTooSmallError(err) {
-		return nil, err
+		return nil, opts.verify(src, 0, notZstdError(src, dictionaryError(src, err)))
+	}
+	if strict {
+		return nil, ErrSizeHintExceeded
 	}
 
 	// We failed getting a dst buffer of correct size, use stream API
-	r := NewReader(bytes.NewReader(src))
+	out, streamErr := decompressStream(orig, src, bound, opts)
+	if err := opts.verify(src, len(out), withCause(streamErr, err)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// decompressStream decompresses src with the stream API into dst, see
+// readAllInto. The buffer starts with a capacity of at least sizeHint.
+func decompressStream(dst, src []byte, sizeHint int, opts DecompressOptions) ([]byte, error) {
+	if cap(dst) < sizeHint {
+		dst = make([]byte, 0, sizeHint)
+	}
+
+	r := newReader(bytes.NewReader(src), nil)
 	defer r.Close()
-	return ioutil.ReadAll(r)
+	if r.firstError != nil {
+		return nil, r.firstError
+	}
+	if err := opts.apply(r.ctx); err != nil {
+		return nil, err
+	}
+	r.hasher = opts.ContentHash
+	if opts.MaxSize <= 0 {
+		return readAllInto(dst, r)
+	}
+	out, err := readAllInto(dst, io.LimitReader(r, int64(opts.MaxSize)+1))
+	if err == nil && len(out) > opts.MaxSize {
+		return nil, ErrSizeLimitExceeded
+	}
+	return out, err
+}
+
+// readAllInto reads r until EOF into dst, reusing it as long as its capacity
+// suffices and doubling its capacity whenever it is full.
+func readAllInto(dst []byte, r io.Reader) ([]byte, error) {
+	dst = dst[:0]
+	var probe [bytes.MinRead]byte
+	for {
+		buf := dst[len(dst):cap(dst)]
+		if len(buf) == 0 {
+			// dst is full, only grow it if there is more data
+			buf = probe[:]
+		}
+		n, err := r.Read(buf)
+		if len(dst) == cap(dst) && n > 0 {
+			grown := make([]byte, len(dst), 2*cap(dst)+bytes.MinRead)
+			copy(grown, dst)
+			dst = append(grown, probe[:n]...)
+		} else {
+			dst = dst[:len(dst)+n]
+		}
+		if err == io.EOF {
+			return dst, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
 }
 
 // DecompressInto decompresses src into dst. Unlike Decompress, DecompressInto
@@ -240,12 +466,88 @@ func Decompress(dst, src []byte) ([]byte, error) {
 // payload before attempting decompression.
 //
 // It returns the number of bytes copied and an error if any is encountered. If
-// dst is too small, DecompressInto errors.
+// dst is too small, DecompressInto returns a *DstSizeTooSmallError with the
+// required size when the frame headers record it. An empty src returns
+// ErrEmptySlice.
 func DecompressInto(dst, src []byte) (int, error) {
+	hook, start := startTelemetry()
+	n, err := decompressIntoWithOptions(dst, src, DecompressOptions{})
+	if hook != nil {
+		endTelemetry(hook, OpDecompressInto, start, len(src), n, err)
+	}
+	return n, err
+}
+
+// DecompressIntoWithOptions is like DecompressInto but decompresses with
+// options.
+func DecompressIntoWithOptions(dst, src []byte, opts DecompressOptions) (int, error) {
+	return decompressIntoWithOptions(dst, src, opts.withDefaults())
+}
+
+func decompressIntoWithOptions(dst, src []byte, opts DecompressOptions) (int, error) {
+	if len(src) == 0 {
+		return 0, ErrEmptySlice
+	}
+	opts = opts.withLimits(GlobalLimits())
+	if err := opts.check(src); err != nil {
+		return 0, err
+	}
+	limited := dst
+	if opts.MaxSize > 0 && opts.MaxSize < maxInt && len(dst) > opts.MaxSize+1 {
+		// One more byte tells payloads exceeding the limit apart
+		limited = dst[:opts.MaxSize+1]
+	}
+	written, err := decompressInto(limited, src)
+	if opts.MaxSize > 0 && (written > opts.MaxSize || IsDstSizeTooSmallError(err) && len(limited) < len(dst)) {
+		return 0, ErrSizeLimitExceeded
+	}
+	if IsDstSizeTooSmallError(err) {
+		return 0, err
+	}
+	if err != nil {
+		err = notZstdError(src, dictionaryError(src, err))
+	}
+	if err := opts.verify(src, written, err); err != nil {
+		return 0, err
+	}
+	if opts.ContentHash != nil {
+		opts.ContentHash.Write(dst[:written])
+	}
+	return written, nil
+}
+
+// decompressInto is DecompressInto without the checks on src.
+func decompressInto(dst, src []byte) (int, error) {
+	var dstPtr *byte // Do not point anywhere, if dst is empty
+	if len(dst) > 0 {
+		dstPtr = &dst[0]
+	}
+	hook, start := startTrace()
 	written := int(C.ZSTD_decompress(
-		unsafe.Pointer(&dst[0]),
+		unsafe.Pointer(dstPtr),
 		C.size_t(len(dst)),
 		unsafe.Pointer(&src[0]),
 		C.size_t(len(src))))
-	return written, getError(written)
+	if hook != nil {
+		endTrace(hook, start, Event{Op: "ZSTD_decompress", SrcSize: len(src), DstSize: len(dst),
+			Consumed: len(src), Written: written, Err: getError(written)})
+	}
+	if err := getError(written); err != nil {
+		if IsDstSizeTooSmallError(err) {
+			return 0, dstSizeTooSmallError(src, len(dst))
+		}
+		return 0, opError("ZSTD_decompress", len(src), len(dst), err)
+	}
+	return written, nil
+}
+
+// dstSizeTooSmallError returns a DstSizeTooSmallError with the decompressed
+// size of all the frames of src, unknown if the frames declare a size fitting
+// in the dstSize bytes that were too small, i.e. if they lie about it.
+func dstSizeTooSmallError(src []byte, dstSize int) error {
+	size := C.ZSTD_findDecompressedSize(unsafe.Pointer(&src[0]), C.size_t(len(src)))
+	if size == C.ZSTD_CONTENTSIZE_UNKNOWN || size == C.ZSTD_CONTENTSIZE_ERROR || uint64(size) > uint64(maxInt) || int(size) <= dstSize {
+		return &DstSizeTooSmallError{}
+	}
+	return &DstSizeTooSmallError{RequiredSize: int(size), SizeKnown: true}
 }
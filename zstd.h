@@ -3091,4 +3091,32 @@ ZSTDLIB_STATIC_API size_t ZSTD_insertBlock    (ZSTD_DCtx* dctx, const void* bloc
 
 #else /* USE_EXTERNAL_ZSTD */
 #include_next <zstd.h>
+
+/* An external libzstd may predate some of the experimental parameters and
+ * enums used by the binding, give them the values they have since. Older
+ * versions reject them at runtime, the features which depend on them check
+ * the linked version first. */
+#if ZSTD_VERSION_NUMBER < 10506 && !defined(ZSTD_c_targetCBlockSize)
+#define ZSTD_c_targetCBlockSize 1003
+#endif
+#ifndef ZSTD_c_literalCompressionMode
+#define ZSTD_c_literalCompressionMode 1002
+#endif
+#ifndef ZSTD_c_srcSizeHint
+#define ZSTD_c_srcSizeHint 1004
+#endif
+#ifndef ZSTD_c_stableInBuffer
+#define ZSTD_c_stableInBuffer 1006
+#endif
+#ifndef ZSTD_c_blockDelimiters
+#define ZSTD_c_blockDelimiters 1008
+#endif
+#ifndef ZSTD_c_validateSequences
+#define ZSTD_c_validateSequences 1009
+#endif
+#if ZSTD_VERSION_NUMBER < 10501
+#define ZSTD_ps_disable 2 /* ZSTD_lcm_uncompressed */
+#define ZSTD_sf_noBlockDelimiters 0
+#define ZSTD_sf_explicitBlockDelimiters 1
+#endif
 #endif /* USE_EXTERNAL_ZSTD */
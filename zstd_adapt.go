@@ -0,0 +1,109 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"time"
+)
+
+// WithAdaptiveLevel lets the Writer adjust its compression level between min
+// and max depending on the sink: when writes to the underlying io.Writer
+// block longer than compression takes, the sink is the bottleneck and the
+// level is raised to make use of the idle CPU; when compression dominates,
+// the level is lowered to keep up. The level of a frame cannot change once
+// it started, so the adjustment happens on Flush: when the level changes,
+// Flush ends the current frame and the next one is compressed with the new
+// level. The output is then a concatenation of frames, which Decompress and
+// NewReader handle transparently.
+//
+// The initial level of the Writer is clamped to [min, max], Stats reports
+// the effective level.
+func WithAdaptiveLevel(min, max int) WriterOption {
+	return func(w *Writer) error {
+		lower, upper, err := ParamBounds(CParamCompressionLevel)
+		if err != nil {
+			return err
+		}
+		if err := checkBounds("adaptive min level", min, lower, max); err != nil {
+			return err
+		}
+		if err := checkBounds("adaptive max level", max, min, upper); err != nil {
+			return err
+		}
+		level := w.CompressionLevel
+		if level < min {
+			level = min
+		} else if level > max {
+			level = max
+		}
+		if err := setCParameter(w.ctx, CParamCompressionLevel, level); err != nil {
+			return err
+		}
+		w.adapt = &adaptiveLevel{min: min, max: max, level: level}
+		return nil
+	}
+}
+
+// adaptiveLevel measures the time a Writer spends compressing versus blocked
+// on the underlying io.Writer. Its methods are no-ops on a nil receiver so
+// that the Writer only pays for the clock when the option is set.
+type adaptiveLevel struct {
+	min, max int
+	level    int
+
+	compressing time.Duration
+	blocking    time.Duration
+}
+
+func (a *adaptiveLevel) now() time.Time {
+	if a == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (a *adaptiveLevel) compressed(since time.Time) {
+	if a != nil {
+		a.compressing += time.Since(since)
+	}
+}
+
+func (a *adaptiveLevel) blocked(since time.Time) {
+	if a != nil {
+		a.blocking += time.Since(since)
+	}
+}
+
+// next returns the level to use from the time measured since the last call,
+// moving by one step at most to avoid oscillations.
+func (a *adaptiveLevel) next() int {
+	level := a.level
+	switch {
+	case a.blocking > a.compressing && level < a.max:
+		level++
+	case a.compressing > 2*a.blocking && level > a.min:
+		level--
+	}
+	a.compressing, a.blocking = 0, 0
+	return level
+}
+
+// adaptiveFlush flushes the Writer, ending the frame to switch to a new level
+// if the measurements call for it.
+func (w *Writer) adaptiveFlush() error {
+	level := w.adapt.next()
+	if level == w.adapt.level {
+		return w.flush(false)
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	// The frame is complete, the new level applies to the next one
+	if err := setCParameter(w.ctx, CParamCompressionLevel, level); err != nil {
+		w.firstError = err
+		return err
+	}
+	w.adapt.level = level
+	return nil
+}
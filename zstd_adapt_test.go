@@ -0,0 +1,105 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// slowWriter simulates a slow sink, e.g. a throttled network connection.
+type slowWriter struct {
+	bytes.Buffer
+	delay time.Duration
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.Buffer.Write(p)
+}
+
+func TestAdaptiveLevelSlowSink(t *testing.T) {
+	var sink slowWriter
+	sink.delay = 5 * time.Millisecond
+	w, err := NewWriterOptions(&sink, 1, WithAdaptiveLevel(1, 4))
+	failOnError(t, "Failed to create writer", err)
+
+	chunk := bytes.Repeat([]byte("Hello, World! "), 100)
+	var payload []byte
+	for i := 0; i < 6; i++ {
+		_, err := w.Write(chunk)
+		failOnError(t, "Failed to write", err)
+		failOnError(t, "Failed to flush", w.Flush())
+		payload = append(payload, chunk...)
+	}
+	// The sink is the bottleneck, the level goes up to max
+	if level := w.Stats().Level; level != 4 {
+		t.Fatalf("Expected level 4 on a slow sink, got %d", level)
+	}
+	failOnError(t, "Failed to close", w.Close())
+
+	decompressed, err := Decompress(nil, sink.Bytes())
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(decompressed, payload) {
+		t.Fatal("Round trip over multiple frames does not match")
+	}
+}
+
+func TestAdaptiveLevelFastSink(t *testing.T) {
+	w, err := NewWriterOptions(ioutil.Discard, 19, WithAdaptiveLevel(3, 19))
+	failOnError(t, "Failed to create writer", err)
+	defer w.Close()
+
+	chunk := make([]byte, 1<<20)
+	for i := range chunk {
+		chunk[i] = byte(i % 251 * i)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := w.Write(chunk)
+		failOnError(t, "Failed to write", err)
+		failOnError(t, "Failed to flush", w.Flush())
+	}
+	// Compression is the bottleneck, the level goes down
+	stats := w.Stats()
+	if stats.Level != 16 {
+		t.Fatalf("Expected level 16 after 3 flushes, got %d", stats.Level)
+	}
+	if stats.BytesIn != 3<<20 || stats.BytesOut == 0 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestAdaptiveLevelNext(t *testing.T) {
+	a := adaptiveLevel{min: 1, max: 3, level: 2}
+	for _, tc := range []struct {
+		compressing, blocking time.Duration
+		want                  int
+	}{
+		{0, 0, 2},
+		{time.Millisecond, 10 * time.Millisecond, 3},
+		{time.Millisecond, 10 * time.Millisecond, 3}, // capped at max
+		{10 * time.Millisecond, 6 * time.Millisecond, 3},
+		{10 * time.Millisecond, time.Millisecond, 2},
+		{10 * time.Millisecond, time.Millisecond, 1},
+		{10 * time.Millisecond, 0, 1}, // capped at min
+	} {
+		a.compressing, a.blocking = tc.compressing, tc.blocking
+		a.level = a.next()
+		if a.level != tc.want {
+			t.Fatalf("%v compressing, %v blocking: expected level %d, got %d",
+				tc.compressing, tc.blocking, tc.want, a.level)
+		}
+	}
+}
+
+func TestAdaptiveLevelInvalid(t *testing.T) {
+	if _, err := NewWriterOptions(ioutil.Discard, 3, WithAdaptiveLevel(5, 2)); err == nil {
+		t.Fatal("Expected an error for min > max")
+	}
+	if _, err := NewWriterOptions(ioutil.Discard, 3, WithAdaptiveLevel(1, 100)); err == nil {
+		t.Fatal("Expected an error for max out of bounds")
+	}
+}
@@ -0,0 +1,106 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrPartialFrame is returned by AppendWriter when the file ends within a
+// frame, e.g. after a crash while the frame was written.
+var ErrPartialFrame = errors.New("File ends within a frame")
+
+// AppendOption configures AppendWriter.
+type AppendOption func(*appendOptions)
+
+type appendOptions struct {
+	truncate bool
+}
+
+// WithTruncatePartialFrame makes AppendWriter remove the frame the file ends
+// within, instead of failing with ErrPartialFrame. The content of that frame
+// is lost.
+func WithTruncatePartialFrame() AppendOption {
+	return func(o *appendOptions) {
+		o.truncate = true
+	}
+}
+
+// AppendWriter returns a Writer compressing at level into a new frame
+// appended to f, an existing zstd file opened for reading and writing, so
+// that the file remains a valid stream of several frames, e.g. for log
+// rotation or incremental archives. An empty file is a valid stream of no
+// frames.
+//
+// The frames of f are found with ZSTD_findFrameCompressedSize, without
+// decoding them, to check that the file ends at the end of a frame. Only the
+// frames larger than 64MB are decoded to find their end. If the file does not
+// end at the end of a frame, it fails with ErrPartialFrame, unless
+// WithTruncatePartialFrame is given. The Writer does not close f.
+func AppendWriter(f *os.File, level int, opts ...AppendOption) (*Writer, error) {
+	var o appendOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	s := frameScanner{src: f, size: size}
+	offset := int64(0)
+	for offset < size {
+		frame, _, err := s.next(offset)
+		length := int64(len(frame))
+		if err == errFrameTooLarge {
+			length, err = decodeFrameLength(f, offset, size)
+		}
+		if err == ErrFrameTruncated {
+			if !o.truncate {
+				return nil, ErrPartialFrame
+			}
+			if err := f.Truncate(offset); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset += length
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return NewWriterOptions(f, level)
+}
+
+// decodeFrameLength returns the size of the frame at offset in the size bytes
+// of src by decoding it, for the frames too large for a frameScanner.
+func decodeFrameLength(src io.ReaderAt, offset, size int64) (int64, error) {
+	length := int64(-1)
+	r, err := NewReaderOptions(io.NewSectionReader(src, offset, size-offset),
+		WithFrameCallback(func(fs FrameStats) {
+			if length < 0 {
+				length = fs.CompressedSize
+			}
+		}))
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	buf := make([]byte, 32<<10)
+	for length < 0 {
+		if _, err := r.Read(buf); err != nil {
+			if errors.Is(err, ErrFrameTruncated) {
+				return 0, ErrFrameTruncated
+			}
+			return 0, err
+		}
+	}
+	return length, nil
+}
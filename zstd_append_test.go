@@ -0,0 +1,129 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/colinlyguo/zstd/zstdtest"
+)
+
+// appendFile creates a temporary file holding content and opens it for
+// appending.
+func appendFile(t *testing.T, content []byte) *os.File {
+	f, err := ioutil.TempFile("", "append*.zst")
+	failOnError(t, "Failed to create the file", err)
+	_, err = f.Write(content)
+	failOnError(t, "Failed to write the file", err)
+	return f
+}
+
+// appendFrame appends a frame of content to f with AppendWriter.
+func appendFrame(t *testing.T, f *os.File, content []byte, opts ...AppendOption) error {
+	w, err := AppendWriter(f, BestSpeed, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	return nil
+}
+
+// checkAppended checks that f decompresses to want, in frames frames.
+func checkAppended(t *testing.T, f *os.File, want []byte, frames int) {
+	compressed, err := ioutil.ReadFile(f.Name())
+	failOnError(t, "Failed to read the file", err)
+	r, err := NewReaderOptions(bytes.NewReader(compressed))
+	failOnError(t, "Failed to create the reader", err)
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	failOnError(t, "Failed to decompress the file", err)
+	if !bytes.Equal(got, want) || r.Stats().Frames != frames {
+		t.Fatalf("Expected %q in %d frames, got %q in %d", want, frames, got, r.Stats().Frames)
+	}
+}
+
+func TestAppendWriter(t *testing.T) {
+	first, err := Compress(nil, []byte("first rotation\n"))
+	failOnError(t, "Failed to compress", err)
+	skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 2, 0, 0, 0, 'h', 'i'}
+
+	for _, test := range []struct {
+		name    string
+		content []byte
+		want    string
+		frames  int
+	}{
+		{"empty", nil, "", 0},
+		{"frame", first, "first rotation\n", 1},
+		{"skippable", append(append([]byte(nil), first...), skippable...), "first rotation\n", 2},
+	} {
+		f := appendFile(t, test.content)
+		defer os.Remove(f.Name())
+		failOnError(t, test.name+": failed to append", appendFrame(t, f, []byte("second rotation\n")))
+		failOnError(t, test.name+": failed to append", appendFrame(t, f, []byte("third rotation\n")))
+		checkAppended(t, f, []byte(test.want+"second rotation\nthird rotation\n"), test.frames+2)
+		f.Close()
+	}
+}
+
+func TestAppendWriterLargeFrame(t *testing.T) {
+	// Frames larger than the window of the scanner are decoded
+	defer func(n int) { maxScanWindow = n }(maxScanWindow)
+	maxScanWindow = 1024
+	content := zstdtest.Random(1, 4096)
+	large, err := Compress(nil, content)
+	failOnError(t, "Failed to compress", err)
+
+	f := appendFile(t, large)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	failOnError(t, "Failed to append", appendFrame(t, f, []byte("appended")))
+	checkAppended(t, f, append(content, "appended"...), 2)
+
+	g := appendFile(t, large[:len(large)-1])
+	defer os.Remove(g.Name())
+	defer g.Close()
+	if err := appendFrame(t, g, []byte("lost")); err != ErrPartialFrame {
+		t.Fatalf("Expected ErrPartialFrame, got %v", err)
+	}
+}
+
+func TestAppendWriterPartialFrame(t *testing.T) {
+	first, err := Compress(nil, []byte("first rotation\n"))
+	failOnError(t, "Failed to compress", err)
+	second, err := Compress(nil, bytes.Repeat([]byte("cut by a crash "), 1000))
+	failOnError(t, "Failed to compress", err)
+
+	for _, cut := range []int{1, 3, len(second) / 2, len(second) - 1} {
+		content := append(append([]byte(nil), first...), second[:cut]...)
+		f := appendFile(t, content)
+		defer os.Remove(f.Name())
+		if err := appendFrame(t, f, []byte("lost")); err != ErrPartialFrame {
+			t.Fatalf("cut=%d: expected ErrPartialFrame, got %v", cut, err)
+		}
+		if got, err := ioutil.ReadFile(f.Name()); err != nil || !bytes.Equal(got, content) {
+			t.Fatalf("cut=%d: the file was modified", cut)
+		}
+		failOnError(t, "Failed to append", appendFrame(t, f, []byte("after the crash\n"), WithTruncatePartialFrame()))
+		checkAppended(t, f, []byte("first rotation\nafter the crash\n"), 2)
+		f.Close()
+	}
+
+	// Data which is not zstd is not truncated
+	content := append(append([]byte(nil), first...), "not zstd at all"...)
+	f := appendFile(t, content)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := appendFrame(t, f, []byte("lost"), WithTruncatePartialFrame()); err == nil || err == ErrPartialFrame {
+		t.Fatalf("Expected the error of the header, got %v", err)
+	}
+	if got, err := ioutil.ReadFile(f.Name()); err != nil || !bytes.Equal(got, content) {
+		t.Fatal("The file was modified")
+	}
+}
@@ -0,0 +1,103 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// Block types of the block headers
+const (
+	rawBlock = iota
+	rleBlock
+	compressedBlock
+)
+
+// MaxDecompressedSize returns an upper bound of the size src decompresses to,
+// without decompressing it. src may contain several concatenated frames,
+// including skippable and legacy ones. Unlike the content size declared by
+// the frame headers, which whoever made src controls and may omit, the bound
+// is computed from the block headers: the size of raw blocks, the expansion
+// of RLE blocks, and the maximum block size, at most 128KB, for compressed
+// blocks. A frame decompressing to more than the bound fails to decompress.
+//
+// The block headers are walked until the bound exceeds capBytes, in which
+// case exceeded is true and bound is the size counted so far, more than
+// capBytes: this rejects decompression bombs before any decompression work.
+// A negative capBytes sets no cap.
+//
+// It returns ErrEmptySlice, ErrNotZstd or ErrFrameTruncated if src is not a
+// valid sequence of frames.
+func MaxDecompressedSize(src []byte, capBytes int64) (bound int64, exceeded bool, err error) {
+	if len(src) == 0 {
+		return 0, false, ErrEmptySlice
+	}
+	for offset := 0; offset < len(src); {
+		size, err := FindFrameCompressedSize(src[offset:])
+		if err != nil {
+			return bound, false, notZstdError(src[offset:], err)
+		}
+		frameBound, err := maxFrameSize(src[offset:offset+size], bound, capBytes)
+		bound += frameBound
+		if err != nil {
+			return bound, false, err
+		}
+		if capBytes >= 0 && bound > capBytes {
+			return bound, true, nil
+		}
+		offset += size
+	}
+	return bound, false, nil
+}
+
+// maxFrameSize returns the upper bound of the size frame, a whole frame,
+// decompresses to, walking its blocks until counted plus the bound exceeds
+// capBytes.
+func maxFrameSize(frame []byte, counted, capBytes int64) (int64, error) {
+	if isLegacyFrame(frame) {
+		// Legacy frames do not declare their content size: the bound is the
+		// number of blocks times the maximum block size
+		return int64(C.ZSTD_decompressBound(unsafe.Pointer(&frame[0]), C.size_t(len(frame)))), nil
+	}
+	header, err := getFrameHeader(frame)
+	if err != nil {
+		return 0, err
+	}
+	if header.frameType == C.ZSTD_skippableFrame {
+		return 0, nil
+	}
+	var bound int64
+	// FindFrameCompressedSize checked that the blocks are within frame
+	for offset := int(header.headerSize); ; {
+		bh := uint32(frame[offset]) | uint32(frame[offset+1])<<8 | uint32(frame[offset+2])<<16
+		offset += 3
+		blockSize := int(bh >> 3)
+		switch (bh >> 1) & 3 {
+		case rawBlock:
+			bound += int64(blockSize)
+			offset += blockSize
+		case rleBlock:
+			bound += int64(blockSize)
+			offset++
+		case compressedBlock:
+			bound += int64(header.blockSizeMax)
+			offset += blockSize
+		}
+		if bh&1 != 0 || capBytes >= 0 && counted+bound > capBytes {
+			return bound, nil
+		}
+	}
+}
+
+// isLegacyFrame returns whether src starts with the magic number of a frame
+// of a zstd version older than 0.8.
+func isLegacyFrame(src []byte) bool {
+	if len(src) < 4 {
+		return false
+	}
+	magic := binary.LittleEndian.Uint32(src)
+	return magic >= 0xFD2FB51E && magic < frameMagic
+}
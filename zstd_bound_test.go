@@ -0,0 +1,133 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"errors"
+	"testing"
+)
+
+// rleFrame builds a frame of n RLE blocks of blockSize bytes, declaring
+// contentSize unless it is negative.
+func rleFrame(contentSize int64, n, blockSize int) []byte {
+	frame := appendUint32(nil, frameMagic)
+	if contentSize < 0 {
+		frame = append(frame, 0, storedWindowDescriptor)
+	} else {
+		frame = append(frame, 0xC0, storedWindowDescriptor)
+		frame = appendUint64(frame, uint64(contentSize))
+	}
+	for i := 0; i < n; i++ {
+		bh := uint32(blockSize)<<3 | rleBlock<<1
+		if i == n-1 {
+			bh |= 1
+		}
+		frame = append(frame, byte(bh), byte(bh>>8), byte(bh>>16), 'a')
+	}
+	return frame
+}
+
+func TestMaxDecompressedSize(t *testing.T) {
+	payload := make([]byte, 3*maxBlockSize+1234)
+	for i := range payload {
+		payload[i] = byte(i % 251 * i)
+	}
+	for _, size := range []int{0, 1, 100, maxBlockSize, len(payload)} {
+		for _, level := range []int{BestSpeed, BestCompression} {
+			compressed, err := CompressLevel(nil, payload[:size], level)
+			failOnError(t, "Error while compressing", err)
+			bound, exceeded, err := MaxDecompressedSize(compressed, -1)
+			failOnError(t, "Error while computing the bound", err)
+			blocks := (size + maxBlockSize - 1) / maxBlockSize
+			if exceeded || bound < int64(size) || bound > int64(blocks*maxBlockSize) {
+				t.Fatalf("size=%d level=%d: unexpected bound %d (exceeded=%v)", size, level, bound, exceeded)
+			}
+		}
+		stored, err := CompressStored(nil, payload[:size])
+		failOnError(t, "Error while compressing", err)
+		if bound, _, err := MaxDecompressedSize(stored, -1); err != nil || bound != int64(size) {
+			t.Fatalf("size=%d: expected the exact size of raw blocks, got %d, %v", size, bound, err)
+		}
+	}
+}
+
+func TestMaxDecompressedSizeIgnoresContentSize(t *testing.T) {
+	// The header declares 1TB but the blocks only hold 4000 bytes
+	lying := rleFrame(1<<40, 4, 1000)
+	info, err := Info(lying)
+	failOnError(t, "Error while parsing the frame", err)
+	if info.DecompressedSize != 1<<40 {
+		t.Fatalf("Expected the declared size, got %d", info.DecompressedSize)
+	}
+	if bound, exceeded, err := MaxDecompressedSize(lying, 1<<20); err != nil || exceeded || bound != 4000 {
+		t.Fatalf("Expected a bound of 4000, got %d, %v, %v", bound, exceeded, err)
+	}
+
+	// Without a declared size, the RLE blocks decompress to the bound
+	undeclared := rleFrame(-1, 4, 1000)
+	bound, _, err := MaxDecompressedSize(undeclared, -1)
+	failOnError(t, "Error while computing the bound", err)
+	out, err := Decompress(nil, undeclared)
+	failOnError(t, "Error while decompressing", err)
+	if bound != int64(len(out)) || !bytes.Equal(out, bytes.Repeat([]byte("a"), 4000)) {
+		t.Fatalf("Expected 4000 bytes matching the bound %d, got %d", bound, len(out))
+	}
+
+	// The existing zip bomb declares 52TB with no block at all
+	bomb, _ := b64.StdEncoding.DecodeString("KLUv/dcwMDAwMDAwMDAwMAAA")
+	if _, _, err := MaxDecompressedSize(bomb, 1<<20); err != ErrFrameTruncated {
+		t.Fatalf("Expected ErrFrameTruncated for the zip bomb, got %v", err)
+	}
+}
+
+func TestMaxDecompressedSizeCap(t *testing.T) {
+	compressed, err := Compress(nil, make([]byte, 64<<20))
+	failOnError(t, "Error while compressing", err)
+	bound, exceeded, err := MaxDecompressedSize(compressed, 1<<20)
+	failOnError(t, "Error while computing the bound", err)
+	if !exceeded || bound <= 1<<20 || bound > 1<<20+maxBlockSize {
+		t.Fatalf("Expected to stop past the 1MB cap, got %d (exceeded=%v)", bound, exceeded)
+	}
+	if bound, exceeded, err := MaxDecompressedSize(compressed, 64<<20); err != nil || exceeded || bound != 64<<20 {
+		t.Fatalf("Expected a bound of 64MB within the cap, got %d, %v, %v", bound, exceeded, err)
+	}
+
+	// The cap applies to the sum over all the frames
+	frames := append(rleFrame(-1, 1, 1000), rleFrame(-1, 1, 1000)...)
+	if bound, exceeded, err := MaxDecompressedSize(frames, 1500); err != nil || !exceeded || bound != 2000 {
+		t.Fatalf("Expected the second frame to exceed the cap, got %d, %v, %v", bound, exceeded, err)
+	}
+	if _, exceeded, _ := MaxDecompressedSize(frames, 2000); exceeded {
+		t.Fatalf("Expected a bound equal to the cap not to exceed it")
+	}
+}
+
+func TestMaxDecompressedSizeFrames(t *testing.T) {
+	legacy := []byte("%\xb5/\xfd\x00@\x00\x1bcompressed with legacy zstd\xc0\x00\x00")
+	bound, _, err := MaxDecompressedSize(legacy, -1)
+	failOnError(t, "Error while computing the bound", err)
+	if bound < int64(len("compressed with legacy zstd")) {
+		t.Fatalf("Expected the legacy bound to cover its content, got %d", bound)
+	}
+
+	src := append(skippableFrame(0, []byte("metadata")), rleFrame(-1, 2, 100)...)
+	src = append(src, legacy...)
+	if got, _, err := MaxDecompressedSize(src, -1); err != nil || got != bound+200 {
+		t.Fatalf("Expected %d for the concatenation, got %d, %v", bound+200, got, err)
+	}
+
+	if _, _, err := MaxDecompressedSize(nil, -1); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+	var notZstd ErrNotZstd
+	if _, _, err := MaxDecompressedSize([]byte("not a zstd frame at all"), -1); !errors.As(err, &notZstd) {
+		t.Fatalf("Expected ErrNotZstd, got %v", err)
+	}
+	frame := rleFrame(-1, 3, 100)
+	if _, _, err := MaxDecompressedSize(frame[:len(frame)-1], -1); err != ErrFrameTruncated {
+		t.Fatalf("Expected ErrFrameTruncated, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import "bytes"
+
+// DecompressBuffer decompresses src, a sequence of frames such as Decompress
+// accepts, and appends the content to buf. It grows buf once to the size hint
+// of Decompress and decodes into its spare capacity, without an intermediate
+// slice. Content beyond the hint is decoded with the stream API, like
+// Decompress does.
+//
+// It returns the errors of Decompress, including the ones of the limits set
+// by SetGlobalLimits, in which case buf holds its previous content only. An
+// empty src returns ErrEmptySlice.
+func DecompressBuffer(buf *bytes.Buffer, src []byte) error {
+	if len(src) == 0 {
+		return ErrEmptySlice
+	}
+	buf.Grow(decompressSizeHint(src))
+	start := buf.Len()
+	// The spare capacity of buf, which writing back to buf does not copy
+	dst := buf.Bytes()[start:start]
+	out, err := decompress(dst, src, false, DecompressOptions{})
+	if err != nil {
+		return err
+	}
+	buf.Write(out)
+	return nil
+}
@@ -0,0 +1,110 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecompressBuffer(t *testing.T) {
+	payload := bytes.Repeat([]byte("appended to the buffer "), 10000)
+	compressed, err := Compress(nil, payload)
+	failOnError(t, "Error while compressing", err)
+	streamed := writerCompress(t, WriterParams{}, payload)
+	zeros, err := Compress(nil, make([]byte, 8<<20))
+	failOnError(t, "Error while compressing", err)
+	empty, err := Compress(nil, nil)
+	failOnError(t, "Error while compressing", err)
+
+	for name, test := range map[string]struct {
+		src      []byte
+		expected []byte
+	}{
+		"frame":           {compressed, payload},
+		"frames":          {append(append(skippableFrame(0, []byte("skipped")), compressed...), compressed...), append(payload, payload...)},
+		"no content size": {streamed, payload},
+		"beyond the hint": {zeros, make([]byte, 8<<20)},
+		"empty content":   {empty, nil},
+	} {
+		var buf bytes.Buffer
+		buf.WriteString("existing content")
+		// A partially read buffer keeps its unread content
+		buf.Next(len("existing "))
+		if err := DecompressBuffer(&buf, test.src); err != nil {
+			t.Fatalf("%s: error while decompressing: %s", name, err)
+		}
+		if !bytes.Equal(buf.Bytes(), append([]byte("content"), test.expected...)) {
+			t.Fatalf("%s: expected the content after the existing one, got %d bytes", name, buf.Len())
+		}
+	}
+}
+
+func TestDecompressBufferErrors(t *testing.T) {
+	payload := bytes.Repeat([]byte("appended to the buffer "), 10000)
+	compressed, err := Compress(nil, payload)
+	failOnError(t, "Error while compressing", err)
+	streamed := writerCompress(t, WriterParams{}, payload)
+	// Decoded with the stream API beyond the hint
+	zeros, err := Compress(nil, make([]byte, 8<<20))
+	failOnError(t, "Error while compressing", err)
+
+	var buf bytes.Buffer
+	buf.WriteString("existing content")
+	for _, src := range [][]byte{compressed[:len(compressed)-1], streamed[:len(streamed)-1], zeros[:len(zeros)-1]} {
+		if err := DecompressBuffer(&buf, src); err == nil {
+			t.Fatalf("Expected an error for a truncated frame")
+		}
+		if buf.String() != "existing content" {
+			t.Fatalf("Expected the existing content only, got %d bytes", buf.Len())
+		}
+	}
+	var notZstd ErrNotZstd
+	if err := DecompressBuffer(&buf, []byte("not a zstd frame")); !errors.As(err, &notZstd) {
+		t.Fatalf("Expected ErrNotZstd, got %v", err)
+	}
+	if err := DecompressBuffer(&buf, nil); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+}
+
+func TestDecompressBufferAllocs(t *testing.T) {
+	payload := bytes.Repeat([]byte("decoded in the spare capacity "), 1000)
+	compressed, err := Compress(nil, payload)
+	failOnError(t, "Error while compressing", err)
+	buf := bytes.NewBuffer(make([]byte, 0, 2*len(payload)))
+	allocs := testing.AllocsPerRun(100, func() {
+		buf.Reset()
+		if err := DecompressBuffer(buf, compressed); err != nil {
+			t.Fatalf("Error while decompressing: %s", err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("Expected no allocation, got %v", allocs)
+	}
+	if !bytes.Equal(buf.Bytes(), payload) {
+		t.Fatalf("Unexpected content of %d bytes", buf.Len())
+	}
+}
+
+func TestDecompressBufferLimits(t *testing.T) {
+	defer SetGlobalLimits(Limits{})
+	payload := bytes.Repeat([]byte("over the limit "), 1000)
+	declared, err := Compress(nil, payload)
+	failOnError(t, "Error while compressing", err)
+	streamed := writerCompress(t, WriterParams{}, payload)
+
+	// Whether the frame declares its content size or not
+	SetGlobalLimits(Limits{MaxSize: len(payload) - 1})
+	for name, src := range map[string][]byte{"declared": declared, "streamed": streamed} {
+		var buf bytes.Buffer
+		if err := DecompressBuffer(&buf, src); err != ErrSizeLimitExceeded {
+			t.Fatalf("%s: expected ErrSizeLimitExceeded, got %v", name, err)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("%s: expected nothing written, got %d bytes", name, buf.Len())
+		}
+	}
+}
@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package zstd
 
 import (
@@ -7,6 +10,8 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+
+	"github.com/colinlyguo/zstd/zstdtest"
 )
 
 var dictBase64 string = `
@@ -275,3 +280,66 @@ func BenchmarkBulkDecompress(b *testing.B) {
 		}
 	}
 }
+
+func TestBulkDedicatedDictSearch(t *testing.T) {
+	records := zstdtest.Records(1, 2000, 500)
+	trained, err := trainDictionary(records, 16<<10)
+	if err != nil {
+		t.Fatalf("Failed to train the dictionary: %v", err)
+	}
+	for _, level := range []int{BestSpeed, 5, 9, BestCompression} {
+		p, err := NewBulkProcessor(trained, level, WithDedicatedDictSearch())
+		if err != nil {
+			t.Fatalf("Failed to create a BulkProcessor at level %d: %v", level, err)
+		}
+		for _, record := range records[:100] {
+			compressed, err := p.Compress(nil, record)
+			if err != nil {
+				t.Fatalf("Failed to compress at level %d: %v", level, err)
+			}
+			// The frames do not depend on the dictionary search structure
+			decompressed, err := newBulkProcessor(t, trained, level).Decompress(nil, compressed)
+			if err != nil {
+				t.Fatalf("Failed to decompress at level %d: %v", level, err)
+			}
+			if !bytes.Equal(decompressed, record) {
+				t.Fatalf("Round trip does not match at level %d", level)
+			}
+		}
+	}
+	if _, err := NewBulkProcessor(nil, 5, WithDedicatedDictSearch()); err != ErrEmptyDictionary {
+		t.Fatalf("Expected ErrEmptyDictionary, got %v", err)
+	}
+}
+
+func BenchmarkBulkCompressDedicatedDictSearch(b *testing.B) {
+	records := zstdtest.Records(1, 100000, 500)
+	trained, err := trainDictionary(records[:2000], 16<<10)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bench := range []struct {
+		name string
+		opts []BulkOption
+	}{
+		{"Default", nil},
+		{"DedicatedDictSearch", []BulkOption{WithDedicatedDictSearch()}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			p, err := NewBulkProcessor(trained, 5, bench.opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			dst := make([]byte, CompressBound(500))
+			b.SetBytes(int64(500 * len(records)))
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for _, record := range records {
+					if _, err := p.Compress(dst, record); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotFrameBoundary is returned by Checkpoint when the Reader is within a
+// frame.
+var ErrNotFrameBoundary = errors.New("Reader is not at a frame boundary")
+
+// ReaderCheckpoint records the position of a Reader between two frames, from
+// which ResumeReader continues decoding.
+type ReaderCheckpoint struct {
+	// InputOffset is the offset of the next frame in the compressed stream
+	InputOffset int64
+
+	// OutputOffset is the size of the content of the frames completed
+	OutputOffset int64
+
+	// Frames is the number of frames completed, including skippable ones
+	Frames int
+}
+
+// Checkpoint returns the position of the Reader, e.g. to be saved by long
+// running restores so that they can resume after a crash with ResumeReader
+// instead of decoding the stream from its start. It is only valid between
+// frames, once the content of the frames decoded has been returned entirely
+// by Read, and returns ErrNotFrameBoundary otherwise. Reading exactly the
+// content of a frame, e.g. written by a Writer closed after each chunk, ends
+// on a frame boundary.
+func (r *Reader) Checkpoint() (ReaderCheckpoint, error) {
+	if r.firstError != nil {
+		return ReaderCheckpoint{}, r.firstError
+	}
+	if r.frameIn != 0 || r.OutputOffset() != r.stats.DecompressedSize {
+		return ReaderCheckpoint{}, ErrNotFrameBoundary
+	}
+	return ReaderCheckpoint{
+		InputOffset:  r.InputOffset(),
+		OutputOffset: r.OutputOffset(),
+		Frames:       r.stats.Frames,
+	}, nil
+}
+
+// ResumeReader seeks r, which holds the compressed stream from its start, to
+// the frame following the checkpoint cp and returns a Reader decoding from
+// there, configured with opts as by NewReaderOptions. The content of the
+// frames before cp is not returned again. The offsets and the statistics of
+// the Reader continue from cp, but ContentSize is unknown.
+func ResumeReader(r io.ReadSeeker, cp ReaderCheckpoint, opts ...ReaderOption) (*Reader, error) {
+	if _, err := r.Seek(cp.InputOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	zr, err := NewReaderOptions(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	zr.totalIn = cp.InputOffset
+	zr.totalOut = cp.OutputOffset
+	zr.stats.Frames = cp.Frames
+	zr.stats.CompressedSize = cp.InputOffset
+	zr.stats.DecompressedSize = cp.OutputOffset
+	zr.contentSizeParsed = true
+	zr.contentSize = -1
+	return zr, nil
+}
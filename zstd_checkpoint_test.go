@@ -0,0 +1,72 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestReaderCheckpoint(t *testing.T) {
+	var src bytes.Buffer
+	var sizes []int
+	for i := 0; i < 50; i++ {
+		w := NewWriter(&src)
+		_, err := w.Write(bytes.Repeat([]byte(fmt.Sprintf("chunk %d of a long restore ", i)), 100*(i%7+1)))
+		failOnError(t, "Failed to write", err)
+		failOnError(t, "Failed to close", w.Close())
+		sizes = append(sizes, int(w.Stats().BytesIn))
+	}
+	straightReader := NewReader(bytes.NewReader(src.Bytes()))
+	straight, err := ioutil.ReadAll(straightReader)
+	failOnError(t, "Failed to decode", err)
+	straightReader.Close()
+
+	for _, crash := range []int{0, 1, 17, 49, 50} {
+		// Decode the first frames, then crash
+		r, err := NewReaderOptions(bytes.NewReader(src.Bytes()))
+		failOnError(t, "Failed to create reader", err)
+		var out []byte
+		for _, size := range sizes[:crash] {
+			frame := make([]byte, size)
+			_, err := io.ReadFull(r, frame)
+			failOnError(t, "Failed to read", err)
+			out = append(out, frame...)
+		}
+		cp, err := r.Checkpoint()
+		failOnError(t, "Failed to checkpoint", err)
+		if cp.Frames != crash || cp.OutputOffset != int64(len(out)) {
+			t.Fatalf("Crash after %d frames: unexpected checkpoint %+v", crash, cp)
+		}
+		r.Close()
+
+		r, err = ResumeReader(bytes.NewReader(src.Bytes()), cp)
+		failOnError(t, "Failed to resume", err)
+		rest, err := ioutil.ReadAll(r)
+		failOnError(t, "Failed to read after resuming", err)
+		if !bytes.Equal(append(out, rest...), straight) {
+			t.Fatalf("Crash after %d frames: the output differs from a straight decode", crash)
+		}
+		stats := r.Stats()
+		if r.InputOffset() != int64(src.Len()) || r.OutputOffset() != int64(len(straight)) ||
+			stats.Frames != 50 || stats.DecompressedSize != int64(len(straight)) {
+			t.Fatalf("Crash after %d frames: unexpected offsets %d %d and stats %+v",
+				crash, r.InputOffset(), r.OutputOffset(), stats)
+		}
+		r.Close()
+	}
+
+	// Within a frame, there is no checkpoint
+	r, err := NewReaderOptions(bytes.NewReader(src.Bytes()))
+	failOnError(t, "Failed to create reader", err)
+	defer r.Close()
+	_, err = io.ReadFull(r, make([]byte, sizes[0]/2))
+	failOnError(t, "Failed to read", err)
+	if _, err := r.Checkpoint(); err != ErrNotFrameBoundary {
+		t.Fatalf("Expected ErrNotFrameBoundary, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"errors"
+	"time"
+)
+
+// ErrTargetUnreachable is returned by ChooseLevel when even the fastest level
+// tried does not meet the throughput target.
+var ErrTargetUnreachable = errors.New("No level meets the throughput target")
+
+// chooseLevels is the spread of levels tried by ChooseLevel, from the fastest
+// to the strongest. Levels above 19 need much more memory and are rarely a
+// sensible answer to a throughput question.
+var chooseLevels = []int{-5, -1, 1, 2, 3, 5, 7, 9, 12, 15, 19}
+
+// chooseLevelBudget caps the total time spent trial-compressing.
+const chooseLevelBudget = time.Second
+
+// chooseLevelMinTrial is the minimum duration of the trial of a level, over
+// which the sample is compressed repeatedly so that small samples are timed
+// accurately.
+const chooseLevelMinTrial = 10 * time.Millisecond
+
+// LevelReport is the result of the trial compression of a sample at a level.
+type LevelReport struct {
+	Level int
+
+	// CompressedSize is the size of the sample once compressed
+	CompressedSize int
+
+	// Ratio is the uncompressed size divided by the compressed size
+	Ratio float64
+
+	// ThroughputMBps is the compression speed in MB/s (10^6 bytes) of input
+	ThroughputMBps float64
+}
+
+// trialTimer times the trial of a level, returning the total time spent and
+// the number of times compress was called. Tests replace it to get
+// deterministic timings.
+var trialTimer = func(level int, compress func() error) (time.Duration, int, error) {
+	start := time.Now()
+	runs := 0
+	for {
+		if err := compress(); err != nil {
+			return 0, 0, err
+		}
+		runs++
+		if d := time.Since(start); d >= chooseLevelMinTrial {
+			return d, runs, nil
+		}
+	}
+}
+
+// ChooseLevel trial-compresses sample at a spread of levels and returns the
+// highest one compressing at least targetThroughputMBps, along with the
+// report of every level tried, e.g. for logging. Levels are tried from the
+// fastest to the strongest, the trial stops at the first level missing the
+// target or once about a second was spent, so the result is an estimate for
+// this machine and this kind of data. A target of 0 selects the highest
+// level tried within the time budget.
+//
+// If no level meets the target, the fastest level is returned along with
+// ErrTargetUnreachable.
+func ChooseLevel(sample []byte, targetThroughputMBps float64) (level int, report []LevelReport, err error) {
+	if len(sample) == 0 {
+		return 0, nil, ErrEmptySlice
+	}
+	cctx, err := newCCtx()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer freeCCtx(cctx)
+
+	dst := make([]byte, CompressBound(len(sample)))
+	level = chooseLevels[0]
+	met := false
+	var spent time.Duration
+	for _, l := range chooseLevels {
+		if err := setCParameter(cctx, CParamCompressionLevel, l); err != nil {
+			return 0, nil, err
+		}
+		var compressed []byte
+		d, runs, err := trialTimer(l, func() (err error) {
+			compressed, err = compress2(cctx, dst, sample)
+			return err
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+		r := LevelReport{
+			Level:          l,
+			CompressedSize: len(compressed),
+			Ratio:          float64(len(sample)) / float64(len(compressed)),
+		}
+		if d > 0 {
+			r.ThroughputMBps = float64(len(sample)*runs) / d.Seconds() / 1e6
+		}
+		report = append(report, r)
+		if d > 0 && r.ThroughputMBps < targetThroughputMBps {
+			break
+		}
+		level, met = l, true
+		spent += d
+		if spent >= chooseLevelBudget {
+			break
+		}
+	}
+	if !met {
+		return level, report, ErrTargetUnreachable
+	}
+	return level, report, nil
+}
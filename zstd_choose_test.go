@@ -0,0 +1,83 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// fakeTrialTimer reports each level as taking the given time to compress the
+// sample once, the trial still compresses it for real to measure the ratio.
+func fakeTrialTimer(t *testing.T, perLevel map[int]time.Duration) func() {
+	orig := trialTimer
+	trialTimer = func(level int, compress func() error) (time.Duration, int, error) {
+		d, ok := perLevel[level]
+		if !ok {
+			t.Fatalf("Unexpected trial of level %d", level)
+		}
+		return d, 1, compress()
+	}
+	return func() { trialTimer = orig }
+}
+
+func TestChooseLevel(t *testing.T) {
+	sample := bytes.Repeat([]byte("Hello, World! "), 1000) // 14 KB
+	perLevel := map[int]time.Duration{}
+	for i, l := range chooseLevels {
+		// From 14 MB/s at level -5, each level is twice as slow as the previous
+		perLevel[l] = time.Millisecond << uint(i)
+	}
+	defer fakeTrialTimer(t, perLevel)()
+
+	level, report, err := ChooseLevel(sample, 3)
+	failOnError(t, "Failed to choose level", err)
+	if level != 1 {
+		t.Fatalf("Expected level 1 (3.5 MB/s), got %d", level)
+	}
+	// The trial stops at the first level missing the target
+	if len(report) != 4 || report[3].Level != 2 || report[3].ThroughputMBps != 1.75 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	for _, r := range report {
+		if r.CompressedSize == 0 || r.Ratio <= 1 {
+			t.Fatalf("Unexpected ratio for level %d: %+v", r.Level, r)
+		}
+	}
+
+	level, report, err = ChooseLevel(sample, 100)
+	if err != ErrTargetUnreachable {
+		t.Fatalf("Expected ErrTargetUnreachable, got %v", err)
+	}
+	if level != chooseLevels[0] || len(report) != 1 {
+		t.Fatalf("Expected the fastest level only, got %d and %+v", level, report)
+	}
+}
+
+func TestChooseLevelBudget(t *testing.T) {
+	perLevel := map[int]time.Duration{}
+	for _, l := range chooseLevels {
+		perLevel[l] = chooseLevelBudget / 2
+	}
+	defer fakeTrialTimer(t, perLevel)()
+
+	level, report, err := ChooseLevel([]byte("Hello, World!"), 0)
+	failOnError(t, "Failed to choose level", err)
+	if level != chooseLevels[1] || len(report) != 2 {
+		t.Fatalf("Expected the trial to stop after 2 levels, got %d and %+v", level, report)
+	}
+}
+
+func TestChooseLevelReal(t *testing.T) {
+	sample := bytes.Repeat([]byte("Hello, World! "), 1000)
+	level, report, err := ChooseLevel(sample, 1)
+	failOnError(t, "Failed to choose level", err)
+	if len(report) == 0 || report[len(report)-1].Level < level {
+		t.Fatalf("Unexpected report %+v for level %d", report, level)
+	}
+	if _, _, err := ChooseLevel(nil, 1); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package zstd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+// errChunkSize is returned by DecompressChunks and the error function of
+// NewChunkedReader for a chunkSize that is not positive.
+var errChunkSize = errors.New("Chunk size must be positive")
+
+// NewChunkedReader decompresses r in a goroutine and delivers the content
+// over the returned channel, in chunks of chunkSize bytes except for the last
+// one. At most buffered chunks are decompressed ahead of the consumer.
+//
+// The channel is closed at the end of the stream or on the first error. The
+// returned function then reports that error, nil at the end of the stream;
+// it waits for the channel to be closed, so the consumer must read the
+// channel until it is closed before calling it.
+//
+// The chunks come from the buffer pools: the consumer hands each of them back
+// with ReleaseChunk once done with it, instead of leaving it to the garbage
+// collector, so that the decoder reuses them.
+func NewChunkedReader(r io.Reader, chunkSize int, buffered int) (<-chan []byte, func() error) {
+	return NewChunkedReaderContext(context.Background(), r, chunkSize, buffered)
+}
+
+// NewChunkedReaderContext is like NewChunkedReader but stops decompressing
+// once ctx is done, in which case the error function reports the ctx error.
+// The chunks sent before remain in the channel until the consumer drains it.
+// A Read of r in progress then is not interrupted: the goroutine exits once
+// it returns, without reading further.
+func NewChunkedReaderContext(ctx context.Context, r io.Reader, chunkSize int, buffered int) (<-chan []byte, func() error) {
+	if buffered < 0 {
+		buffered = 0
+	}
+	chunks := make(chan []byte, buffered)
+	done := make(chan struct{})
+	var err error
+	wait := func() error {
+		<-done
+		return err
+	}
+	if chunkSize <= 0 {
+		err = errChunkSize
+		close(chunks)
+		close(done)
+		return chunks, wait
+	}
+	go func() {
+		defer close(done)
+		defer close(chunks)
+		err = readChunks(ctx, &contextReader{ctx: ctx, r: r}, chunkSize, chunks)
+	}()
+	return chunks, wait
+}
+
+// readChunks sends the content r decompresses to over chunks, until the end
+// of the stream or ctx is done.
+func readChunks(ctx context.Context, r io.Reader, chunkSize int, chunks chan<- []byte) error {
+	zr := NewReader(r)
+	defer zr.Close()
+	for {
+		buf := getBuffer(chunkSize)
+		n, err := fillChunk(zr, buf)
+		if n > 0 {
+			select {
+			case chunks <- buf[:n]:
+			case <-ctx.Done():
+				putBuffer(buf)
+				return ctx.Err()
+			}
+		} else {
+			putBuffer(buf)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return err
+		}
+	}
+}
+
+// DecompressChunks decompresses src, a sequence of frames such as Decompress
+// accepts, and calls fn with the content in chunks of chunkSize bytes except
+// for the last one, so that memory stays bounded whatever the decompressed
+// size. The chunks share a single buffer: they are only valid during the call
+// to fn. It stops at the first error of fn, which it returns.
+//
+// It returns ErrEmptySlice for an empty src, and the errors of the Reader for
+// invalid frames, after calling fn with the content decoded before them.
+func DecompressChunks(src []byte, chunkSize int, fn func(chunk []byte) error) error {
+	if len(src) == 0 {
+		return ErrEmptySlice
+	}
+	if chunkSize <= 0 {
+		return errChunkSize
+	}
+	r := NewReader(bytes.NewReader(src))
+	defer r.Close()
+	buf := getBuffer(chunkSize)
+	defer putBuffer(buf)
+	for {
+		n, err := fillChunk(r, buf)
+		if n > 0 {
+			if err := fn(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// fillChunk reads from r until buf is full or r fails. Unlike io.ReadFull, it
+// returns io.EOF at the end of the stream whatever was read, leaving the
+// errors of truncated streams apart.
+func fillChunk(r io.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReleaseChunk hands a chunk delivered by NewChunkedReader back to the buffer
+// pools. The chunk must not be used after the call.
+func ReleaseChunk(chunk []byte) {
+	putBuffer(chunk)
+}
+
+// contextReader fails the reads once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,187 @@
+package zstd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestChunkedReader(t *testing.T) {
+	payload := make([]byte, 1<<20+1234)
+	for i := range payload {
+		payload[i] = byte(i % 251 * i)
+	}
+	compressed, err := Compress(nil, payload)
+	if err != nil {
+		t.Fatalf("Error while compressing: %s", err)
+	}
+	// Several frames are delivered as one stream
+	compressed = append(compressed, compressed...)
+	expected := append(payload, payload...)
+
+	for _, chunkSize := range []int{1000, 64 << 10, 4 << 20} {
+		chunks, wait := NewChunkedReader(bytes.NewReader(compressed), chunkSize, 2)
+		var out []byte
+		for chunk := range chunks {
+			if len(chunk) > chunkSize {
+				t.Fatalf("chunkSize=%d: got a chunk of %d bytes", chunkSize, len(chunk))
+			}
+			if len(out)+len(chunk) < len(expected) && len(chunk) != chunkSize {
+				t.Fatalf("chunkSize=%d: expected full chunks but the last, got %d bytes", chunkSize, len(chunk))
+			}
+			out = append(out, chunk...)
+			ReleaseChunk(chunk)
+		}
+		if err := wait(); err != nil {
+			t.Fatalf("Error while reading the chunks: %s", err)
+		}
+		if !bytes.Equal(out, expected) {
+			t.Fatalf("chunkSize=%d: round trip mismatch", chunkSize)
+		}
+	}
+
+	// An empty stream closes the channel without any chunk
+	empty, err := Compress(nil, nil)
+	if err != nil {
+		t.Fatalf("Error while compressing: %s", err)
+	}
+	chunks, wait := NewChunkedReader(bytes.NewReader(empty), 100, 0)
+	for chunk := range chunks {
+		t.Fatalf("Expected no chunk, got %d bytes", len(chunk))
+	}
+	if err := wait(); err != nil {
+		t.Fatalf("Error while reading the chunks: %s", err)
+	}
+}
+
+func TestChunkedReaderErrors(t *testing.T) {
+	compressed, err := Compress(nil, bytes.Repeat([]byte("chunk "), 100000))
+	if err != nil {
+		t.Fatalf("Error while compressing: %s", err)
+	}
+	chunks, wait := NewChunkedReader(bytes.NewReader(compressed[:len(compressed)/2]), 1000, 1)
+	for chunk := range chunks {
+		ReleaseChunk(chunk)
+	}
+	if err := wait(); err == nil {
+		t.Fatalf("Expected an error for a truncated stream")
+	}
+
+	chunks, wait = NewChunkedReader(bytes.NewReader(compressed), 0, 1)
+	if _, ok := <-chunks; ok || wait() != errChunkSize {
+		t.Fatalf("Expected errChunkSize, got %v", wait())
+	}
+}
+
+func TestChunkedReaderCancel(t *testing.T) {
+	compressed, err := Compress(nil, make([]byte, 64<<20))
+	if err != nil {
+		t.Fatalf("Error while compressing: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks, wait := NewChunkedReaderContext(ctx, bytes.NewReader(compressed), 64<<10, 2)
+	<-chunks
+	cancel()
+
+	stopped := make(chan int)
+	go func() {
+		n := 0
+		for chunk := range chunks {
+			n += len(chunk)
+			ReleaseChunk(chunk)
+		}
+		stopped <- n
+	}()
+	select {
+	case n := <-stopped:
+		if n > 4*64<<10 {
+			t.Fatalf("Expected the decoder to stop, got %d more bytes", n)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected the channel to be closed once canceled")
+	}
+	if err := wait(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDecompressChunks(t *testing.T) {
+	// 64 frames of 16MB decompress to 1GB
+	frame := make([]byte, 16<<20)
+	for i := range frame {
+		frame[i] = byte(i / 4096 % 251 * i)
+	}
+	compressed, err := CompressLevel(nil, frame, BestSpeed)
+	if err != nil {
+		t.Fatalf("Error while compressing: %s", err)
+	}
+	compressed = bytes.Repeat(compressed, 64)
+
+	const chunkSize = 1 << 20
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var total, chunks int
+	err = DecompressChunks(compressed, chunkSize, func(chunk []byte) error {
+		// The chunks are aligned with the frames
+		offset := total % len(frame)
+		if len(chunk) != chunkSize || !bytes.Equal(chunk, frame[offset:offset+chunkSize]) {
+			return fmt.Errorf("chunk %d of %d bytes differs", chunks, len(chunk))
+		}
+		total += len(chunk)
+		chunks++
+		return nil
+	})
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatalf("Error while decompressing: %s", err)
+	}
+	if total != 1<<30 || chunks != 1<<10 {
+		t.Fatalf("Expected 1GB in 1024 chunks, got %d bytes in %d chunks", total, chunks)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 32<<20 {
+		t.Fatalf("Expected constant memory, allocated %d bytes", allocated)
+	}
+}
+
+func TestDecompressChunksErrors(t *testing.T) {
+	payload := bytes.Repeat([]byte("chunk "), 100000)
+	compressed, err := Compress(nil, payload)
+	if err != nil {
+		t.Fatalf("Error while compressing: %s", err)
+	}
+
+	// The error of fn stops the decompression
+	stop := errors.New("stop")
+	calls := 0
+	err = DecompressChunks(compressed, 1000, func(chunk []byte) error {
+		calls++
+		if calls == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || calls != 3 {
+		t.Fatalf("Expected the error of fn after 3 calls, got %v after %d", err, calls)
+	}
+
+	// The content before a truncation is delivered
+	var out []byte
+	err = DecompressChunks(compressed[:len(compressed)-1], 1000, func(chunk []byte) error {
+		out = append(out, chunk...)
+		return nil
+	})
+	if err == nil || !bytes.HasPrefix(payload, out) {
+		t.Fatalf("Expected an error for a truncated frame, got %v after %d bytes", err, len(out))
+	}
+
+	if err := DecompressChunks(nil, 1000, nil); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+	if err := DecompressChunks(compressed, 0, nil); err != errChunkSize {
+		t.Fatalf("Expected errChunkSize, got %v", err)
+	}
+}
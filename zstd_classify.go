@@ -0,0 +1,121 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// PayloadKind is the kind of data ClassifyPayload recognizes.
+type PayloadKind int
+
+const (
+	// Unknown is data of no recognized kind
+	Unknown PayloadKind = iota
+	// ScrollFrame is a blob of the scroll batch encoding, see
+	// CompressScrollBatchBytes
+	ScrollFrame
+	// StandardFrame is a zstd frame
+	StandardFrame
+	// LegacyFrame is a frame of a zstd version older than 0.8
+	LegacyFrame
+	// Skippable is a skippable frame, holding user data
+	Skippable
+)
+
+func (k PayloadKind) String() string {
+	switch k {
+	case ScrollFrame:
+		return "scroll"
+	case StandardFrame:
+		return "zstd"
+	case LegacyFrame:
+		return "legacy zstd"
+	case Skippable:
+		return "skippable"
+	default:
+		return "unknown"
+	}
+}
+
+// scrollMaxWindowLog is the window log of the scroll batch encoding
+const scrollMaxWindowLog = 17
+
+// ClassifyPayload returns the kind of the frame starting src, e.g. to tell
+// scroll blobs, which have no magic number, from standard zstd frames in
+// blobs of unknown provenance. Frames with a magic number are recognized by
+// it. Other data is a ScrollFrame if it parses as a single magicless frame
+// with the parameters of the scroll batch encoding: a window of at most
+// 128KB, no checksum, dictionary ID nor content size, and raw literals in all
+// its compressed blocks. This is a heuristic: random data rarely, but may,
+// pass it. Nothing is decompressed.
+//
+// It returns ErrEmptySlice for an empty src, and the error of parsing the
+// header of a frame with a magic number, along with its kind. Data of no
+// recognized kind is Unknown, without error.
+func ClassifyPayload(src []byte) (PayloadKind, error) {
+	if len(src) == 0 {
+		return Unknown, ErrEmptySlice
+	}
+	if len(src) >= 4 {
+		magic := binary.LittleEndian.Uint32(src)
+		switch {
+		case magic == frameMagic:
+			_, err := getFrameHeader(src)
+			return StandardFrame, err
+		case isLegacyFrame(src):
+			return LegacyFrame, nil
+		case IsSkippableFrame(src):
+			_, err := getFrameHeader(src)
+			return Skippable, err
+		}
+	}
+	if isScrollFrame(src) {
+		return ScrollFrame, nil
+	}
+	return Unknown, nil
+}
+
+// isScrollFrame returns whether src is exactly one magicless frame with the
+// parameters of the scroll batch encoding, walking its block headers.
+func isScrollFrame(src []byte) bool {
+	var header C.ZSTD_frameHeader
+	code := C.ZSTD_getFrameHeader_advanced(&header, unsafe.Pointer(&src[0]), C.size_t(len(src)), C.ZSTD_f_zstd1_magicless)
+	if code != 0 || header.frameType == C.ZSTD_skippableFrame {
+		return false
+	}
+	if uint64(header.windowSize) > 1<<scrollMaxWindowLog || header.checksumFlag != 0 || header.dictID != 0 ||
+		uint64(header.frameContentSize) != uint64(C.ZSTD_CONTENTSIZE_UNKNOWN) {
+		return false
+	}
+	for offset := int(header.headerSize); offset+3 <= len(src); {
+		bh := uint32(src[offset]) | uint32(src[offset+1])<<8 | uint32(src[offset+2])<<16
+		offset += 3
+		blockSize := int(bh >> 3)
+		if blockSize > int(header.blockSizeMax) {
+			return false
+		}
+		switch (bh >> 1) & 3 {
+		case rawBlock:
+			offset += blockSize
+		case rleBlock:
+			offset++
+		case compressedBlock:
+			// The literals section starts the block, its type in the 2 low
+			// bits of its header, 0 for raw literals
+			if blockSize == 0 || offset >= len(src) || src[offset]&3 != 0 {
+				return false
+			}
+			offset += blockSize
+		default:
+			return false
+		}
+		if bh&1 != 0 {
+			return offset == len(src)
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestClassifyPayloadScroll(t *testing.T) {
+	for i, test := range loadScrollGoldens(t) {
+		if i%10 != 0 {
+			continue
+		}
+		blob, err := CompressScrollBatchBytes(readScrollBatch(t, test))
+		failOnError(t, "Error while compressing the batch", err)
+		if kind, err := ClassifyPayload(blob); err != nil || kind != ScrollFrame {
+			t.Fatalf("%s: expected a scroll frame, got %s, %v", test.filename, kind, err)
+		}
+		// A truncated blob does not parse any more
+		if kind, err := ClassifyPayload(blob[:len(blob)-1]); err != nil || kind != Unknown {
+			t.Fatalf("%s: expected a truncated blob to be unknown, got %s, %v", test.filename, kind, err)
+		}
+		// Neither does a blob with trailing data
+		if kind, _ := ClassifyPayload(append(blob, 0)); kind != Unknown {
+			t.Fatalf("%s: expected trailing data to be unknown, got %s", test.filename, kind)
+		}
+	}
+}
+
+func TestClassifyPayload(t *testing.T) {
+	payload := bytes.Repeat([]byte("classify this payload "), 10000)
+	for _, level := range []int{BestSpeed, DefaultCompression, BestCompression} {
+		frame, err := CompressLevel(nil, payload, level)
+		failOnError(t, "Error while compressing", err)
+		if kind, err := ClassifyPayload(frame); err != nil || kind != StandardFrame {
+			t.Fatalf("level=%d: expected a standard frame, got %s, %v", level, kind, err)
+		}
+		// Without its magic number, the frame declares its content size
+		if kind, err := ClassifyPayload(frame[4:]); err != nil || kind != Unknown {
+			t.Fatalf("level=%d: expected a magicless standard frame to be unknown, got %s, %v", level, kind, err)
+		}
+	}
+	stored, err := CompressStored(nil, payload)
+	failOnError(t, "Error while compressing", err)
+	if kind, _ := ClassifyPayload(stored); kind != StandardFrame {
+		t.Fatalf("Expected a standard frame, got %s", kind)
+	}
+
+	legacy := []byte("%\xb5/\xfd\x00@\x00\x1bcompressed with legacy zstd\xc0\x00\x00")
+	if kind, err := ClassifyPayload(legacy); err != nil || kind != LegacyFrame {
+		t.Fatalf("Expected a legacy frame, got %s, %v", kind, err)
+	}
+	if kind, err := ClassifyPayload(skippableFrame(3, []byte("metadata"))); err != nil || kind != Skippable {
+		t.Fatalf("Expected a skippable frame, got %s, %v", kind, err)
+	}
+
+	if kind, err := ClassifyPayload(stored[:5]); kind != StandardFrame || err != ErrFrameTruncated {
+		t.Fatalf("Expected a truncated standard frame, got %s, %v", kind, err)
+	}
+	if _, err := ClassifyPayload(nil); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	for _, src := range [][]byte{[]byte("just some text"), {0x1F, 0x8B, 8, 0}, random} {
+		if kind, err := ClassifyPayload(src); err != nil || kind != Unknown {
+			t.Fatalf("Expected %q to be unknown, got %s, %v", src[:4], kind, err)
+		}
+	}
+}
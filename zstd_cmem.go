@@ -0,0 +1,18 @@
+package zstd
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import "unsafe"
+
+// cMalloc allocates n bytes of C memory, freed with cFree. The tests, which
+// cannot use cgo, use it to get memory that Go does not manage.
+func cMalloc(n int) unsafe.Pointer {
+	return C.malloc(C.size_t(n))
+}
+
+// cFree frees memory allocated by cMalloc.
+func cFree(p unsafe.Pointer) {
+	C.free(p)
+}
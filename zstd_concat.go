@@ -0,0 +1,148 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// ErrNotFrame is returned when data does not start with a zstd frame magic
+// number.
+var ErrNotFrame = errors.New("Data does not start with a frame")
+
+// ErrNoConcatIndex is returned by ReadConcatIndex when src does not end with
+// an index frame.
+var ErrNoConcatIndex = errors.New("No concatenation index frame")
+
+// ConcatError reports the part which failed the validation of ConcatFrames.
+type ConcatError struct {
+	Part int
+	Err  error
+}
+
+func (e *ConcatError) Error() string {
+	return fmt.Sprintf("zstd: invalid part %d: %s", e.Part, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ConcatError) Unwrap() error {
+	return e.Err
+}
+
+// ConcatOptions holds the options of ConcatFramesWithOptions.
+type ConcatOptions struct {
+	// Verify checks that every part is made of complete frames, parsing them
+	// without decoding them, instead of only checking that it starts with a
+	// frame magic number.
+	Verify bool
+
+	// Index appends a skippable frame recording the offset of every part in
+	// the output, read back by ReadConcatIndex for random access. Decoders
+	// unaware of it skip it.
+	Index bool
+}
+
+const (
+	// concatIndexMagic is the skippable frame magic number of index frames,
+	// ZSTD_MAGIC_SKIPPABLE_START with variant 0xD
+	concatIndexMagic = 0x184D2A5D
+	// concatIndexTag ends the content of index frames, after the offsets of
+	// the parts and their count
+	concatIndexTag = "ZIDX"
+)
+
+// ConcatFrames writes parts to dst in order, e.g. compressed shards merged
+// into a single stream, once it checked that each of them starts with a frame
+// magic number (regular, legacy or skippable). It returns the number of bytes
+// written. If a part is invalid nothing is written and a *ConcatError reports
+// which one.
+func ConcatFrames(dst io.Writer, parts ...[]byte) (int64, error) {
+	return ConcatFramesWithOptions(dst, ConcatOptions{}, parts...)
+}
+
+// ConcatFramesWithOptions is like ConcatFrames but with options.
+func ConcatFramesWithOptions(dst io.Writer, opts ConcatOptions, parts ...[]byte) (int64, error) {
+	for i, part := range parts {
+		if err := checkConcatPart(part, opts.Verify); err != nil {
+			return 0, &ConcatError{Part: i, Err: err}
+		}
+	}
+	var written int64
+	offsets := make([]uint64, 0, len(parts))
+	for _, part := range parts {
+		offsets = append(offsets, uint64(written))
+		n, err := dst.Write(part)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	if !opts.Index {
+		return written, nil
+	}
+	n, err := dst.Write(concatIndexFrame(offsets))
+	return written + int64(n), err
+}
+
+// checkConcatPart checks that part starts with a frame magic number, and is
+// made of complete frames if verify is set.
+func checkConcatPart(part []byte, verify bool) error {
+	if len(part) == 0 {
+		return ErrEmptySlice
+	}
+	if C.ZSTD_isFrame(unsafe.Pointer(&part[0]), C.size_t(len(part))) == 0 {
+		return ErrNotFrame
+	}
+	if verify {
+		if _, err := FrameCount(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// concatIndexFrame returns the index frame of parts at offsets: the offsets
+// as little endian uint64, their count as a uint32, then the tag, so that it
+// can be found from the end of the stream.
+func concatIndexFrame(offsets []uint64) []byte {
+	size := 8*len(offsets) + 4 + len(concatIndexTag)
+	frame := make([]byte, 8+size)
+	binary.LittleEndian.PutUint32(frame[0:], concatIndexMagic)
+	binary.LittleEndian.PutUint32(frame[4:], uint32(size))
+	for i, offset := range offsets {
+		binary.LittleEndian.PutUint64(frame[8+8*i:], offset)
+	}
+	binary.LittleEndian.PutUint32(frame[8+8*len(offsets):], uint32(len(offsets)))
+	copy(frame[len(frame)-len(concatIndexTag):], concatIndexTag)
+	return frame
+}
+
+// ReadConcatIndex returns the offsets of the parts written by
+// ConcatFramesWithOptions with Index set, from the index frame ending src. It
+// returns ErrNoConcatIndex if src does not end with an index frame.
+func ReadConcatIndex(src []byte) ([]int64, error) {
+	tail := len(concatIndexTag) + 4
+	if len(src) < 8+tail || string(src[len(src)-len(concatIndexTag):]) != concatIndexTag {
+		return nil, ErrNoConcatIndex
+	}
+	count := uint64(binary.LittleEndian.Uint32(src[len(src)-tail:]))
+	size := 8*count + uint64(tail)
+	if 8+size > uint64(len(src)) {
+		return nil, ErrNoConcatIndex
+	}
+	frame := src[uint64(len(src))-8-size:]
+	if binary.LittleEndian.Uint32(frame) != concatIndexMagic || uint64(binary.LittleEndian.Uint32(frame[4:])) != size {
+		return nil, ErrNoConcatIndex
+	}
+	offsets := make([]int64, count)
+	for i := range offsets {
+		offsets[i] = int64(binary.LittleEndian.Uint64(frame[8+8*i:]))
+	}
+	return offsets, nil
+}
@@ -0,0 +1,90 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func concatParts(t *testing.T) ([][]byte, []byte) {
+	var parts [][]byte
+	var payload []byte
+	for i, s := range []string{"first shard ", "second shard ", "third shard "} {
+		content := bytes.Repeat([]byte(s), 100*(i+1))
+		part, err := Compress(nil, content)
+		failOnError(t, "Failed to compress", err)
+		parts = append(parts, part)
+		payload = append(payload, content...)
+	}
+	// A skippable frame is a valid part too
+	parts = append(parts, []byte{0x50, 0x2a, 0x4d, 0x18, 2, 0, 0, 0, 'h', 'i'})
+	return parts, payload
+}
+
+func TestConcatFrames(t *testing.T) {
+	parts, payload := concatParts(t)
+	for _, opts := range []ConcatOptions{{}, {Verify: true}, {Index: true}} {
+		var buf bytes.Buffer
+		n, err := ConcatFramesWithOptions(&buf, opts, parts...)
+		failOnError(t, "Failed to concatenate", err)
+		if n != int64(buf.Len()) {
+			t.Fatalf("%+v: reported %d bytes, wrote %d", opts, n, buf.Len())
+		}
+		out, err := Decompress(nil, buf.Bytes())
+		failOnError(t, "Failed to decompress", err)
+		if !bytes.Equal(out, payload) {
+			t.Fatalf("%+v: round trip does not match", opts)
+		}
+
+		offsets, err := ReadConcatIndex(buf.Bytes())
+		if !opts.Index {
+			if err != ErrNoConcatIndex {
+				t.Fatalf("Expected ErrNoConcatIndex, got %v", err)
+			}
+			continue
+		}
+		failOnError(t, "Failed to read the index", err)
+		if len(offsets) != len(parts) {
+			t.Fatalf("Expected %d offsets, got %v", len(parts), offsets)
+		}
+		for i, offset := range offsets {
+			if !bytes.HasPrefix(buf.Bytes()[offset:], parts[i]) {
+				t.Fatalf("Offset %d of part %d does not point to it", offset, i)
+			}
+		}
+	}
+}
+
+func TestConcatFramesInvalid(t *testing.T) {
+	parts, _ := concatParts(t)
+	truncated := parts[1][:len(parts[1])-3]
+	cases := []struct {
+		name   string
+		part   []byte
+		verify bool
+		err    error
+	}{
+		{"empty", nil, false, ErrEmptySlice},
+		{"plain", []byte("plain text"), false, ErrNotFrame},
+		{"truncated", truncated, true, ErrFrameTruncated},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		_, err := ConcatFramesWithOptions(&buf, ConcatOptions{Verify: c.verify}, parts[0], c.part, parts[2])
+		var concatErr *ConcatError
+		if !errors.As(err, &concatErr) || concatErr.Part != 1 || !errors.Is(err, c.err) {
+			t.Fatalf("%s: expected a ConcatError on part 1 wrapping %v, got %v", c.name, c.err, err)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("%s: expected nothing written, got %d bytes", c.name, buf.Len())
+		}
+	}
+
+	// Without Verify, only the magic number is checked
+	var buf bytes.Buffer
+	_, err := ConcatFrames(&buf, parts[0], truncated)
+	failOnError(t, "Failed to concatenate", err)
+}
@@ -0,0 +1,287 @@
+package zstd
+
+/*
+#include <stdlib.h>
+#include <string.h>
+#include "zstd.h"
+
+// ZSTD_compressStream2_positions runs ZSTD_compressStream2 with positions
+// kept by the caller. It is used with ZSTD_c_stableInBuffer, so libzstd keeps
+// src between calls: it must be pinned or C memory, and the function must not
+// be annotated with #cgo noescape.
+static size_t ZSTD_compressStream2_positions(ZSTD_CCtx* ctx,
+		void* dst, size_t dstSize, size_t* dstPos,
+		const void* src, size_t srcSize, size_t* srcPos, ZSTD_EndDirective endOp) {
+	ZSTD_outBuffer outBuffer = { dst, dstSize, *dstPos };
+	ZSTD_inBuffer inBuffer = { src, srcSize, *srcPos };
+	size_t retCode = ZSTD_compressStream2(ctx, &outBuffer, &inBuffer, endOp);
+	*dstPos = outBuffer.pos;
+	*srcPos = inBuffer.pos;
+	return retCode;
+}
+*/
+import "C"
+import (
+	"context"
+	"io"
+	"unsafe"
+)
+
+// contextChunkSize is the amount of input compressed between two checks of
+// the context in CompressWithContext
+const contextChunkSize = 1 << 20
+
+// chunkedCompressThreshold is the input size from which CompressLevel
+// compresses in chunks, so that the goroutine does not stay in a single C call
+// for the whole input.
+var chunkedCompressThreshold = 64 << 20
+
+// cStreamOutSize is the size of the output buffer of CompressToWriter, the
+// one libzstd recommends to flush a whole block.
+var cStreamOutSize = int(C.ZSTD_CStreamOutSize())
+
+// CompressWithContext is like CompressLevel but stops early with the context
+// error if ctx is done. The input is compressed in chunks with the streaming
+// API, ctx being checked between chunks, into the same single frame
+// CompressLevel produces.
+//
+// The compressor reads the input in place when runtime.Pinner is available
+// (Go 1.21), from a stable native copy filled chunk by chunk otherwise, so
+// that it sees the input exactly as in one-shot compression. That copy is as
+// large as the input, which doubles the memory held for it.
+func CompressWithContext(ctx context.Context, dst, src []byte, level int) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cctx, err := newCCtx()
+	if err != nil {
+		return nil, err
+	}
+	defer freeCCtx(cctx)
+	if err := setCParameter(cctx, CParamCompressionLevel, level); err != nil {
+		return nil, err
+	}
+	return compressWithContext(ctx, cctx, dst, src, nil)
+}
+
+// CompressWithContextParams is like CompressWithContext but compresses with
+// advanced parameters, reporting progress to params.Progress if set.
+func CompressWithContextParams(ctx context.Context, dst, src []byte, params CParams) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cctx, err := newCCtx()
+	if err != nil {
+		return nil, err
+	}
+	defer freeCCtx(cctx)
+	if err := params.apply(cctx); err != nil {
+		return nil, err
+	}
+	return compressWithContext(ctx, cctx, dst, src, params.Progress)
+}
+
+// compressChunked is CompressLevel for inputs of at least
+// chunkedCompressThreshold bytes, compressed in chunks into the same frame,
+// with a context from the pool of CompressMany.
+func compressChunked(dst, src []byte, level int) ([]byte, error) {
+	c := manyCtxPool.Get().(*ctx)
+	defer putManyCtx(c)
+	if c.err != nil {
+		return nil, c.err
+	}
+	// The pool expects contexts with their default parameters
+	defer C.ZSTD_CCtx_reset(c.cctx, C.ZSTD_reset_session_and_parameters)
+	// ZSTD_compress clamps the level instead of failing
+	if min, max := levelBounds(); level > max {
+		level = max
+	} else if level < min {
+		level = min
+	}
+	if err := setCParameter(c.cctx, CParamCompressionLevel, level); err != nil {
+		return nil, err
+	}
+	return compressWithContext(context.Background(), c.cctx, dst, src, nil)
+}
+
+// compressWithContext compresses src into dst in chunks with the parameters
+// already set on cctx, checking ctx and calling progress, if not nil, between
+// chunks, then once at completion.
+//
+// Unless dst can hold CompressBound(len(src)) bytes, the output starts in a
+// buffer of contextChunkSize bytes, or dst if larger, which doubles whenever
+// it is full, so that well compressed large inputs do not need a destination
+// as large as them.
+func compressWithContext(ctx context.Context, cctx *C.ZSTD_CCtx, dst, src []byte, progress func(consumed, produced int64)) ([]byte, error) {
+	if err := getError(int(C.ZSTD_CCtx_setParameter(cctx, C.ZSTD_c_stableInBuffer, 1))); err != nil {
+		return nil, opError("ZSTD_CCtx_setParameter", 0, 0, err)
+	}
+	// Declare the size so that the frame header and parameters match the
+	// one-shot compression
+	if err := getError(int(C.ZSTD_CCtx_setPledgedSrcSize(cctx, C.ulonglong(len(src))))); err != nil {
+		return nil, opError("ZSTD_CCtx_setPledgedSrcSize", len(src), 0, err)
+	}
+
+	bound := CompressBound(len(src))
+	switch {
+	case cap(dst) >= bound:
+		dst = dst[0:bound] // Reuse dst buffer
+	case cap(dst) > contextChunkSize:
+		dst = dst[0:cap(dst)]
+	case bound > contextChunkSize:
+		dst = make([]byte, contextChunkSize)
+	default:
+		dst = make([]byte, bound)
+	}
+	var cSrc unsafe.Pointer // Do not point anywhere, if src is empty
+	copied := false
+	if len(src) > 0 {
+		if unpin, err := pin(src); err == nil {
+			defer unpin()
+			cSrc = unsafe.Pointer(&src[0])
+		} else {
+			cSrc = C.malloc(C.size_t(len(src)))
+			defer C.free(cSrc)
+			copied = true
+		}
+	}
+
+	var dstPos, srcPos C.size_t
+	for available := 0; ; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if int(srcPos) == available && available < len(src) {
+			// The previous chunk is consumed, add the next one
+			end := available + contextChunkSize
+			if end > len(src) {
+				end = len(src)
+			}
+			if copied {
+				C.memcpy(unsafe.Pointer(uintptr(cSrc)+uintptr(available)), unsafe.Pointer(&src[available]), C.size_t(end-available))
+			}
+			available = end
+		}
+		endOp := C.ZSTD_EndDirective(C.ZSTD_e_continue)
+		if available == len(src) {
+			endOp = C.ZSTD_e_end
+		}
+		if int(dstPos) == len(dst) {
+			dst = growCompressBuffer(dst, bound)
+		}
+		remaining := int(C.ZSTD_compressStream2_positions(
+			cctx,
+			unsafe.Pointer(&dst[0]),
+			C.size_t(len(dst)),
+			&dstPos,
+			cSrc,
+			C.size_t(available),
+			&srcPos,
+			endOp))
+		if err := getError(remaining); err != nil {
+			return nil, opError("ZSTD_compressStream2", len(src), len(dst), err)
+		}
+		if endOp == C.ZSTD_e_end && remaining == 0 {
+			if progress != nil {
+				progress(int64(len(src)), int64(dstPos))
+			}
+			return dst[:dstPos], nil
+		}
+		if progress != nil && endOp == C.ZSTD_e_continue && int(srcPos) == available {
+			// Once per chunk, the last one is only reported at completion
+			progress(int64(srcPos), int64(dstPos))
+		}
+	}
+}
+
+// growCompressBuffer returns a buffer twice as large as dst, at most bound
+// bytes, starting with its content.
+func growCompressBuffer(dst []byte, bound int) []byte {
+	size := bound
+	if len(dst) < bound/2 {
+		size = 2 * len(dst)
+	}
+	grown := make([]byte, size)
+	copy(grown, dst)
+	return grown
+}
+
+// CompressToWriter compresses src at level and writes the frame to w as it
+// is produced, returning the number of bytes written. Unlike CompressLevel,
+// the frame is never held in memory as a whole, only a buffer of about
+// 128KB, which suits writing an in-memory payload to a
+// file or a socket. The frame is the one CompressLevel produces.
+//
+// src is read in place when runtime.Pinner is available (Go 1.21), from a
+// native copy otherwise. The context comes from the pool of CompressMany.
+func CompressToWriter(w io.Writer, src []byte, level int) (int64, error) {
+	c := manyCtxPool.Get().(*ctx)
+	defer putManyCtx(c)
+	if c.err != nil {
+		return 0, c.err
+	}
+	cctx := c.cctx
+	// The pool expects contexts with their default parameters
+	defer C.ZSTD_CCtx_reset(cctx, C.ZSTD_reset_session_and_parameters)
+	if err := setCParameter(cctx, CParamCompressionLevel, level); err != nil {
+		return 0, err
+	}
+	if err := getError(int(C.ZSTD_CCtx_setParameter(cctx, C.ZSTD_c_stableInBuffer, 1))); err != nil {
+		return 0, opError("ZSTD_CCtx_setParameter", 0, 0, err)
+	}
+	if err := getError(int(C.ZSTD_CCtx_setPledgedSrcSize(cctx, C.ulonglong(len(src))))); err != nil {
+		return 0, opError("ZSTD_CCtx_setPledgedSrcSize", len(src), 0, err)
+	}
+
+	var cSrc unsafe.Pointer // Do not point anywhere, if src is empty
+	if len(src) > 0 {
+		if unpin, err := pin(src); err == nil {
+			defer unpin()
+			cSrc = unsafe.Pointer(&src[0])
+		} else {
+			cSrc = C.CBytes(src)
+			defer C.free(cSrc)
+		}
+	}
+	dst := getBuffer(cStreamOutSize)
+	defer putBuffer(dst)
+
+	var written int64
+	var srcPos C.size_t
+	for available := 0; ; {
+		end, endOp := available+contextChunkSize, C.ZSTD_EndDirective(C.ZSTD_e_continue)
+		if end >= len(src) {
+			end, endOp = len(src), C.ZSTD_e_end
+		}
+		available = end
+		// Compress the chunk, writing the output whenever dst is full
+		for {
+			var dstPos C.size_t
+			remaining := int(C.ZSTD_compressStream2_positions(
+				cctx,
+				unsafe.Pointer(&dst[0]),
+				C.size_t(len(dst)),
+				&dstPos,
+				cSrc,
+				C.size_t(available),
+				&srcPos,
+				endOp))
+			if err := getError(remaining); err != nil {
+				return written, opError("ZSTD_compressStream2", len(src), len(dst), err)
+			}
+			if dstPos > 0 {
+				n, err := w.Write(dst[:dstPos])
+				written += int64(n)
+				if err != nil {
+					return written, err
+				}
+			}
+			if endOp == C.ZSTD_e_end && remaining == 0 {
+				return written, nil
+			}
+			if endOp == C.ZSTD_e_continue && int(srcPos) == available && dstPos < C.size_t(len(dst)) {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// countdownContext is a context whose Err starts returning context.Canceled
+// after a number of checks, emulating a cancellation in the middle of the
+// compression.
+type countdownContext struct {
+	context.Context
+	checks int
+}
+
+func (c *countdownContext) Err() error {
+	if c.checks <= 0 {
+		return context.Canceled
+	}
+	c.checks--
+	return nil
+}
+
+func TestCompressWithContext(t *testing.T) {
+	inputs := [][]byte{
+		nil,
+		[]byte("Hello World!"),
+		bytes.Join(jsonDocuments(5000), nil), // several chunks
+	}
+	for _, input := range inputs {
+		for _, level := range []int{BestSpeed, DefaultCompression, 15} {
+			want, err := CompressLevel(nil, input, level)
+			if err != nil {
+				t.Fatalf("CompressLevel failed: %s", err)
+			}
+			got, err := CompressWithContext(context.Background(), nil, input, level)
+			if err != nil {
+				t.Fatalf("len=%d level=%d CompressWithContext failed: %s", len(input), level, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("len=%d level=%d output differs from CompressLevel", len(input), level)
+			}
+		}
+	}
+}
+
+func TestCompressWithContextCancel(t *testing.T) {
+	input := bytes.Join(jsonDocuments(5000), nil)
+	if len(input) < 3*contextChunkSize {
+		t.Fatalf("input of %d bytes is too small for this test", len(input))
+	}
+
+	// Cancelled after the first two chunks
+	ctx := &countdownContext{Context: context.Background(), checks: 3}
+	if _, err := CompressWithContext(ctx, nil, input, DefaultCompression); err != context.Canceled {
+		t.Fatalf("CompressWithContext returned %v, want context.Canceled", err)
+	}
+	if ctx.checks != 0 {
+		t.Fatalf("compression did not stop at the cancellation")
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CompressWithContext(cancelled, nil, input, DefaultCompression); err != context.Canceled {
+		t.Fatalf("CompressWithContext returned %v, want context.Canceled", err)
+	}
+}
+
+func TestCompressProgress(t *testing.T) {
+	input := bytes.Repeat([]byte("progress of a long compression "), (5*contextChunkSize)/31)
+	for _, compress := range []func(params CParams) ([]byte, error){
+		func(params CParams) ([]byte, error) { return CompressWithParams(nil, input, params) },
+		func(params CParams) ([]byte, error) {
+			return CompressWithContextParams(context.Background(), nil, input, params)
+		},
+	} {
+		var calls [][2]int64
+		progress := func(consumed, produced int64) {
+			calls = append(calls, [2]int64{consumed, produced})
+		}
+		out, err := compress(CParams{Level: 3, Progress: progress})
+		if err != nil {
+			t.Fatalf("Failed to compress: %s", err)
+		}
+		if len(calls) != 5 {
+			t.Fatalf("Expected a call per chunk, got %v", calls)
+		}
+		for i, call := range calls[:len(calls)-1] {
+			if call[0] != int64(i+1)*contextChunkSize || call[1] > int64(len(out)) {
+				t.Fatalf("Unexpected progress %v at chunk %d", call, i)
+			}
+		}
+		if last := calls[len(calls)-1]; last != [2]int64{int64(len(input)), int64(len(out))} {
+			t.Fatalf("Expected the final progress to be (%d, %d), got %v", len(input), len(out), last)
+		}
+		decompressed, err := Decompress(nil, out)
+		if err != nil || !bytes.Equal(decompressed, input) {
+			t.Fatalf("Failed to round trip: %v", err)
+		}
+	}
+
+	var calls int
+	progress := func(consumed, produced int64) { calls++ }
+	if _, err := CompressWithContextParams(&countdownContext{context.Background(), 2}, nil, input, CParams{Progress: progress}); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected progress to stop at the cancellation, got %d calls", calls)
+	}
+
+	calls = 0
+	if _, err := CompressWithParams(nil, nil, CParams{Progress: progress}); err != nil || calls != 1 {
+		t.Fatalf("Expected a single call for an empty input, got %d calls, %v", calls, err)
+	}
+}
+
+func TestCompressLevelChunked(t *testing.T) {
+	defer func(threshold int) { chunkedCompressThreshold = threshold }(chunkedCompressThreshold)
+	input := bytes.Join(jsonDocuments(5000), nil)
+	// Incompressible data grows the output buffer up to the bound
+	random := make([]byte, 3*contextChunkSize)
+	rand.New(rand.NewSource(1)).Read(random)
+	threshold := 2*contextChunkSize + 12345
+	if len(input) <= threshold+1 {
+		t.Fatalf("input of %d bytes is too small for this test", len(input))
+	}
+	min, _ := levelBounds()
+
+	for _, src := range [][]byte{input[:threshold-1], input[:threshold], input[:threshold+1], input, random} {
+		for _, level := range []int{min - 1, -5, BestSpeed, DefaultCompression, 9} {
+			chunkedCompressThreshold = maxInt
+			want, err := CompressLevel(nil, src, level)
+			failOnError(t, "Failed to compress in one shot", err)
+			chunkedCompressThreshold = threshold
+			got, err := CompressLevel(nil, src, level)
+			failOnError(t, "Failed to compress in chunks", err)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("len=%d level=%d: the output differs from the one-shot compression", len(src), level)
+			}
+			if len(src) < threshold {
+				continue
+			}
+			// dst is reused when large enough for the frame, even if smaller
+			// than the bound
+			dst := make([]byte, 0, contextChunkSize+len(want))
+			got, err = CompressLevel(dst, src, level)
+			failOnError(t, "Failed to compress in chunks", err)
+			if !bytes.Equal(got, want) || &got[:1][0] != &dst[:1][0] {
+				t.Fatalf("len=%d level=%d: the output differs or does not reuse dst", len(src), level)
+			}
+		}
+	}
+
+	// The highest levels use the optimal parsers, compare them on two chunks
+	// as they are much slower
+	src := input[:contextChunkSize+12345]
+	for _, level := range []int{19, BestCompression, 21, 22} {
+		chunkedCompressThreshold = maxInt
+		want, err := CompressLevel(nil, src, level)
+		failOnError(t, "Failed to compress in one shot", err)
+		chunkedCompressThreshold = len(src)
+		got, err := CompressLevel(nil, src, level)
+		failOnError(t, "Failed to compress in chunks", err)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("len=%d level=%d: the output differs from the one-shot compression", len(src), level)
+		}
+	}
+}
+
+// chunkWriter records the size of the largest write, failing once limit
+// bytes were written if limit is positive.
+type chunkWriter struct {
+	bytes.Buffer
+	largest int
+	limit   int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	if len(p) > w.largest {
+		w.largest = len(p)
+	}
+	if w.limit > 0 && w.Len()+len(p) > w.limit {
+		return 0, errors.New("disk full")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestCompressToWriter(t *testing.T) {
+	inputs := [][]byte{
+		nil,
+		[]byte("Hello World!"),
+		bytes.Join(jsonDocuments(5000), nil), // several chunks
+		bytes.Join(jsonDocuments(5000), []byte(strings.Repeat("x", 1000))),
+	}
+	for _, input := range inputs {
+		for _, level := range []int{BestSpeed, DefaultCompression, 15} {
+			want, err := CompressLevel(nil, input, level)
+			if err != nil {
+				t.Fatalf("CompressLevel failed: %s", err)
+			}
+			var w chunkWriter
+			n, err := CompressToWriter(&w, input, level)
+			if err != nil {
+				t.Fatalf("len=%d level=%d CompressToWriter failed: %s", len(input), level, err)
+			}
+			if !bytes.Equal(w.Bytes(), want) || n != int64(len(want)) {
+				t.Fatalf("len=%d level=%d output differs from CompressLevel", len(input), level)
+			}
+			if w.largest > cStreamOutSize {
+				t.Fatalf("len=%d level=%d expected writes of at most %d bytes, got %d", len(input), level, cStreamOutSize, w.largest)
+			}
+		}
+	}
+
+	input := bytes.Join(jsonDocuments(5000), nil)
+	w := chunkWriter{limit: 1000}
+	if n, err := CompressToWriter(&w, input, DefaultCompression); err == nil || n != int64(w.Len()) {
+		t.Fatalf("Expected the error of the writer after %d bytes, got %v after %d bytes", w.Len(), err, n)
+	}
+	// The context given back to the pool compresses as before
+	if _, err := CompressToWriter(&chunkWriter{}, input, 100); err == nil {
+		t.Fatalf("Expected an error for an invalid level")
+	}
+	results, errs := CompressMany(nil, [][]byte{input}, BestSpeed)
+	want, _ := CompressLevel(nil, input, BestSpeed)
+	if errs != nil || !bytes.Equal(results[0], want) {
+		t.Fatalf("Expected the pooled context to be reset, got %v", errs)
+	}
+}
@@ -5,8 +5,6 @@ package zstd
 */
 import "C"
 import (
-	"bytes"
-	"io/ioutil"
 	"runtime"
 	"unsafe"
 )
@@ -26,9 +24,24 @@ type Ctx interface {
 	Decompress(dst, src []byte) ([]byte, error)
 }
 
+// SrcSizeHinter is implemented by the Ctx returned by NewCtx and NewStaticCtx,
+// which can be checked with a type assertion:
+//
+//	if h, ok := c.(zstd.SrcSizeHinter); ok {
+//		err = h.SetSrcSizeHint(1024)
+//	}
+type SrcSizeHinter interface {
+	// SetSrcSizeHint sets the expected size of the inputs to compress, see
+	// CParams.SrcSizeHint. libzstd only uses it when the input size is
+	// unknown, one-shot compressions know it already. 0 removes the hint.
+	SetSrcSizeHint(hint int) error
+}
+
 type ctx struct {
-	cctx *C.ZSTD_CCtx
-	dctx *C.ZSTD_DCtx
+	cctx        *C.ZSTD_CCtx
+	dctx        *C.ZSTD_DCtx
+	err         error
+	srcSizeHint int
 }
 
 // Create a new ZStd Context.
@@ -40,21 +53,58 @@ type ctx struct {
 //  Note 2 : In multi-threaded environments,
 //         use one different context per thread for parallel execution.
 //
+// If the contexts cannot be allocated, e.g. because of SetNativeMemoryLimit,
+// every call to the returned Ctx fails with the allocation error.
 func NewCtx() Ctx {
-	c := &ctx{
-		cctx: C.ZSTD_createCCtx(),
-		dctx: C.ZSTD_createDCtx(),
-	}
+	return newCtx()
+}
 
+func newCtx() *ctx {
+	c := &ctx{}
+	var err error
+	if c.cctx, err = newCCtx(); err == nil {
+		c.dctx, err = newDCtx()
+	}
+	c.err = err
 	runtime.SetFinalizer(c, finalizeCtx)
 	return c
 }
 
 func (c *ctx) Compress(dst, src []byte) ([]byte, error) {
-	return c.CompressLevel(dst, src, DefaultCompression)
+	return c.CompressLevel(dst, src, DefaultLevel())
+}
+
+// SetSrcSizeHint implements SrcSizeHinter.
+func (c *ctx) SetSrcSizeHint(hint int) error {
+	if c.err != nil {
+		return c.err
+	}
+	if hint != 0 {
+		// Validate now rather than on the next compression
+		if err := setCParameter(c.cctx, CParamSrcSizeHint, hint); err != nil {
+			return err
+		}
+	}
+	c.srcSizeHint = hint
+	return nil
 }
 
 func (c *ctx) CompressLevel(dst, src []byte, level int) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.srcSizeHint != 0 {
+		// ZSTD_compressCCtx ignores advanced parameters, use ZSTD_compress2
+		C.ZSTD_CCtx_reset(c.cctx, C.ZSTD_reset_parameters)
+		if err := setCParameter(c.cctx, CParamCompressionLevel, level); err != nil {
+			return nil, err
+		}
+		if err := setCParameter(c.cctx, CParamSrcSizeHint, c.srcSizeHint); err != nil {
+			return nil, err
+		}
+		return compress2(c.cctx, dst, src)
+	}
+
 	bound := CompressBound(len(src))
 	if cap(dst) >= bound {
 		dst = dst[0:bound] // Reuse dst buffer
@@ -87,21 +137,31 @@ func (c *ctx) CompressLevel(dst, src []byte, level int) ([]byte, error) {
 	written := int(cWritten)
 	// Check if the return is an Error code
 	if err := getError(written); err != nil {
-		return nil, err
+		return nil, opError("ZSTD_compressCCtx", len(src), len(dst), err)
 	}
 	return dst[:written], nil
 }
 
 func (c *ctx) Decompress(dst, src []byte) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
 	if len(src) == 0 {
-		return []byte{}, ErrEmptySlice
+		return nil, ErrEmptySlice
+	}
+	l, err := checkLimits(src)
+	if err != nil {
+		return nil, err
 	}
 
-	bound := decompressSizeHint(src)
+	orig := dst
+	bound := l.bound(decompressSizeHint(src))
+	allocated := false
 	if cap(dst) >= bound {
 		dst = dst[0:cap(dst)]
 	} else {
-		dst = make([]byte, bound)
+		dst = allocDecompressBuffer(bound)
+		allocated = true
 	}
 
 	written := int(C.ZSTD_decompressDCtx(
@@ -111,21 +171,31 @@ func (c *ctx) Decompress(dst, src []byte) ([]byte, error) {
 		unsafe.Pointer(&src[0]),
 		C.size_t(len(src))))
 
-	err := getError(written)
+	err = getError(written)
 	if err == nil {
+		if err := l.checkSize(uint64(written)); err != nil {
+			return nil, err
+		}
 		return dst[:written], nil
 	}
+	if allocated && isPoolingEnabled() {
+		putBuffer(dst)
+	}
+	err = opError("ZSTD_decompressDCtx", len(src), len(dst), err)
 	if !IsDstSizeTooSmallError(err) {
-		return nil, err
+		return nil, dictionaryError(src, err)
 	}
 
 	// We failed getting a dst buffer of correct size, use stream API
-	r := NewReader(bytes.NewReader(src))
-	defer r.Close()
-	return ioutil.ReadAll(r)
+	out, streamErr := decompressStream(orig, src, bound, DecompressOptions{})
+	return out, withCause(streamErr, err)
 }
 
 func finalizeCtx(c *ctx) {
-	C.ZSTD_freeCCtx(c.cctx)
-	C.ZSTD_freeDCtx(c.dctx)
+	if c.cctx != nil {
+		freeCCtx(c.cctx)
+	}
+	if c.dctx != nil {
+		freeDCtx(c.dctx)
+	}
 }
@@ -0,0 +1,148 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"sync/atomic"
+)
+
+// CtxPool keeps compression contexts configured with a parameter profile, so
+// that services using a few distinct profiles do not pay for the context
+// allocation and parameter setup of every compression. It is safe for
+// concurrent use.
+type CtxPool struct {
+	setup func(*C.ZSTD_CCtx) error
+	idle  chan *C.ZSTD_CCtx
+
+	created   int64
+	reused    int64
+	discarded int64
+	inUse     int64
+}
+
+// CtxPoolStats reports the activity of a CtxPool.
+type CtxPoolStats struct {
+	// Idle is the number of contexts waiting in the pool
+	Idle int
+	// InUse is the number of contexts taken and not given back yet
+	InUse int64
+	// Created is the number of contexts created, Reused the number of Get
+	// calls served by an idle context
+	Created int64
+	Reused  int64
+	// Discarded is the number of contexts freed on Put as the pool was full
+	Discarded int64
+}
+
+// PooledCtx is a compression context taken from a CtxPool, which must be
+// given back with CtxPool.Put. It must not be used concurrently.
+type PooledCtx struct {
+	cctx *C.ZSTD_CCtx
+}
+
+// Compress is like CompressWithParams with the parameters of the pool.
+func (c *PooledCtx) Compress(dst, src []byte) ([]byte, error) {
+	return compress2(c.cctx, dst, src)
+}
+
+// NewCtxPool creates a pool of contexts configured with params, keeping at
+// most maxIdle of them between uses. The parameters are validated upfront.
+func NewCtxPool(params CParams, maxIdle int) (*CtxPool, error) {
+	return newCtxPool(params.apply, maxIdle)
+}
+
+// newCtxPool creates a pool of contexts configured by setup, checking that
+// it succeeds on a first context kept in the pool.
+func newCtxPool(setup func(*C.ZSTD_CCtx) error, maxIdle int) (*CtxPool, error) {
+	if maxIdle < 1 {
+		maxIdle = 1
+	}
+	p := &CtxPool{setup: setup, idle: make(chan *C.ZSTD_CCtx, maxIdle)}
+	c, err := p.Get()
+	if err != nil {
+		return nil, err
+	}
+	p.Put(c)
+	return p, nil
+}
+
+// Get returns an idle context, or a new one if none is idle.
+func (p *CtxPool) Get() (*PooledCtx, error) {
+	select {
+	case cctx := <-p.idle:
+		atomic.AddInt64(&p.reused, 1)
+		atomic.AddInt64(&p.inUse, 1)
+		return &PooledCtx{cctx: cctx}, nil
+	default:
+	}
+
+	cctx, err := newCCtx()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.setup(cctx); err != nil {
+		freeCCtx(cctx)
+		return nil, err
+	}
+	atomic.AddInt64(&p.created, 1)
+	atomic.AddInt64(&p.inUse, 1)
+	return &PooledCtx{cctx: cctx}, nil
+}
+
+// Put gives a context back to the pool, resetting its session while keeping
+// its parameters. The context must not be used after the call.
+func (p *CtxPool) Put(c *PooledCtx) {
+	cctx := c.cctx
+	if cctx == nil {
+		return
+	}
+	c.cctx = nil
+	atomic.AddInt64(&p.inUse, -1)
+	if getError(int(C.ZSTD_CCtx_reset(cctx, C.ZSTD_reset_session_only))) != nil {
+		freeCCtx(cctx)
+		atomic.AddInt64(&p.discarded, 1)
+		return
+	}
+	select {
+	case p.idle <- cctx:
+	default:
+		freeCCtx(cctx)
+		atomic.AddInt64(&p.discarded, 1)
+	}
+}
+
+// Compress compresses src into dst with a context of the pool.
+func (p *CtxPool) Compress(dst, src []byte) ([]byte, error) {
+	c, err := p.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer p.Put(c)
+	return c.Compress(dst, src)
+}
+
+// Stats returns the statistics of the pool.
+func (p *CtxPool) Stats() CtxPoolStats {
+	return CtxPoolStats{
+		Idle:      len(p.idle),
+		InUse:     atomic.LoadInt64(&p.inUse),
+		Created:   atomic.LoadInt64(&p.created),
+		Reused:    atomic.LoadInt64(&p.reused),
+		Discarded: atomic.LoadInt64(&p.discarded),
+	}
+}
+
+// Close frees the idle contexts. Contexts put back afterwards are kept as
+// long as the pool is not full, call Close again to free them.
+func (p *CtxPool) Close() {
+	for {
+		select {
+		case cctx := <-p.idle:
+			freeCCtx(cctx)
+		default:
+			return
+		}
+	}
+}
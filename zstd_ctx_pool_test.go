@@ -0,0 +1,98 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCtxPool(t *testing.T) {
+	pool, err := NewCtxPool(CParams{Level: 3, Checksum: true}, 2)
+	failOnError(t, "Failed to create pool", err)
+	defer pool.Close()
+	if stats := pool.Stats(); stats.Created != 1 || stats.Idle != 1 {
+		t.Fatalf("Expected the validated context to be idle, got %+v", stats)
+	}
+
+	payload := bytes.Repeat([]byte("Hello, World! "), 1000)
+	want, err := CompressWithParams(nil, payload, CParams{Level: 3, Checksum: true})
+	failOnError(t, "Failed to compress", err)
+
+	// The parameters persist across uses
+	for i := 0; i < 3; i++ {
+		got, err := pool.Compress(nil, payload)
+		failOnError(t, "Failed to compress with the pool", err)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Use %d: output differs from CompressWithParams", i)
+		}
+		info, err := Info(got)
+		failOnError(t, "Failed to get info", err)
+		if !info.HasChecksum {
+			t.Fatalf("Use %d: expected a checksum", i)
+		}
+	}
+
+	// Beyond maxIdle, contexts are freed
+	ctxs := make([]*PooledCtx, 4)
+	for i := range ctxs {
+		ctxs[i], err = pool.Get()
+		failOnError(t, "Failed to get a context", err)
+	}
+	if stats := pool.Stats(); stats.InUse != 4 || stats.Idle != 0 {
+		t.Fatalf("Expected 4 contexts in use, got %+v", stats)
+	}
+	for _, c := range ctxs {
+		pool.Put(c)
+	}
+	stats := pool.Stats()
+	if stats.InUse != 0 || stats.Idle != 2 || stats.Discarded != 2 || stats.Created != 4 || stats.Reused != 4 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestCtxPoolInvalidParams(t *testing.T) {
+	if _, err := NewCtxPool(CParams{WindowLog: 100}, 1); err == nil {
+		t.Fatal("Expected an error for invalid parameters")
+	}
+}
+
+func TestCompressScrollBatchBytesConcurrent(t *testing.T) {
+	files := []string{"testdata/batch000.hex", "testdata/batch001.hex", "testdata/batch002.hex"}
+	batches := make([][]byte, len(files))
+	expected := make([][]byte, len(files))
+	for i, file := range files {
+		data, err := ioutil.ReadFile(file)
+		failOnError(t, "Failed to read batch", err)
+		batches[i], err = hex.DecodeString(strings.TrimSpace(string(data)))
+		failOnError(t, "Failed to decode batch", err)
+		expected[i], err = CompressScrollBatchBytes(batches[i])
+		failOnError(t, "Failed to compress batch", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 16*len(files))
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := range batches {
+				i := (i + g) % len(batches)
+				out, err := CompressScrollBatchBytes(batches[i])
+				if err != nil || !bytes.Equal(out, expected[i]) {
+					errs <- files[i]
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for file := range errs {
+		t.Errorf("Concurrent compression of %s differs", file)
+	}
+}
@@ -0,0 +1,103 @@
+package zstd
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrNativeMemoryLimit is returned when creating a context or compressing
+// would exceed the limit set by SetNativeMemoryLimit.
+var ErrNativeMemoryLimit = errors.New("Native memory limit exceeded")
+
+// Counters of the native resources reported by DebugStats.
+var (
+	liveCCtxs     int64
+	liveDCtxs     int64
+	liveWriters   int64
+	liveReaders   int64
+	liveDicts     int64
+	pooledBuffers int64
+)
+
+// allocationTracking is set by EnableAllocationTracking.
+var allocationTracking int32
+
+// nativeMemoryLimit is set by SetNativeMemoryLimit, 0 if unlimited.
+var nativeMemoryLimit int64
+
+// EnableAllocationTracking makes the contexts created afterwards account
+// for the memory libzstd allocates for them, reported by
+// DebugStats().NativeBytes. It costs a few bytes and an atomic operation per
+// native allocation. Contexts created while tracking was disabled stay
+// untracked. Disabled by default, it has no effect without cgo.
+func EnableAllocationTracking(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&allocationTracking, v)
+}
+
+func isAllocationTrackingEnabled() bool {
+	return atomic.LoadInt32(&allocationTracking) == 1
+}
+
+// SetNativeMemoryLimit bounds the memory libzstd holds outside of the Go
+// heap, which GOMEMLIMIT does not account for. Once the budget is exhausted,
+// creating Writers, Readers and contexts, and the allocations they make as
+// they go, e.g. for a large window, fail with ErrNativeMemoryLimit instead of
+// getting the process killed. A limit of 0 or less removes it.
+//
+// The limit is best-effort: it applies to the contexts created while it is
+// set, which track their allocations as with EnableAllocationTracking, while
+// the one-shot functions without context such as Compress and Decompress
+// allocate directly in libzstd and bypass it. It has no effect without cgo.
+func SetNativeMemoryLimit(bytes int64) {
+	if bytes < 0 {
+		bytes = 0
+	}
+	atomic.StoreInt64(&nativeMemoryLimit, bytes)
+	setNativeLimit(bytes)
+}
+
+func isNativeMemoryLimited() bool {
+	return atomic.LoadInt64(&nativeMemoryLimit) > 0
+}
+
+// Stats reports the native resources alive at some point in time, e.g. to
+// find leaks in long-running services.
+type Stats struct {
+	// CCtxs and DCtxs are the numbers of live compression and decompression
+	// contexts, including the ones of Writers, Readers and Ctx, and the
+	// internal ones of the package
+	CCtxs int64
+	DCtxs int64
+	// Writers and Readers are the numbers of streams not closed yet
+	Writers int64
+	Readers int64
+	// Dicts is the number of digested dictionaries held by BulkProcessors
+	Dicts int64
+	// PooledBuffers is the number of buffers put back in the pools of
+	// PutCompressBuffer and PutDecompressBuffer and not taken since. It is an
+	// upper bound, as the garbage collector may drop pooled buffers.
+	PooledBuffers int64
+	// NativeBytes is the memory held by libzstd for the contexts created with
+	// allocation tracking enabled, see EnableAllocationTracking. Digested
+	// dictionaries are not included.
+	NativeBytes int64
+}
+
+// DebugStats returns the counts of live native resources. The counters are
+// maintained as resources are created and freed, so DebugStats is cheap
+// enough to be exported as metrics.
+func DebugStats() Stats {
+	return Stats{
+		CCtxs:         atomic.LoadInt64(&liveCCtxs),
+		DCtxs:         atomic.LoadInt64(&liveDCtxs),
+		Writers:       atomic.LoadInt64(&liveWriters),
+		Readers:       atomic.LoadInt64(&liveReaders),
+		Dicts:         atomic.LoadInt64(&liveDicts),
+		PooledBuffers: atomic.LoadInt64(&pooledBuffers),
+		NativeBytes:   nativeBytes(),
+	}
+}
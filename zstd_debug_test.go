@@ -0,0 +1,165 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDebugStatsStreams(t *testing.T) {
+	const n = 10
+	payload := bytes.Repeat([]byte("Hello, World! "), 1000)
+	compressed, err := Compress(nil, payload)
+	failOnError(t, "Failed to compress", err)
+
+	base := DebugStats()
+	writers := make([]*Writer, n)
+	readers := make([]interface{ Close() error }, n)
+	for i := range writers {
+		writers[i] = NewWriter(ioutil.Discard)
+		readers[i] = NewReader(bytes.NewReader(compressed))
+	}
+	stats := DebugStats()
+	if stats.Writers != base.Writers+n || stats.Readers != base.Readers+n {
+		t.Fatalf("Expected %d more writers and readers, got %+v from %+v", n, stats, base)
+	}
+	if stats.CCtxs < base.CCtxs+n-1 || stats.DCtxs < base.DCtxs+n-1 {
+		t.Fatalf("Expected the contexts of the streams to be counted, got %+v from %+v", stats, base)
+	}
+
+	for i := range writers {
+		failOnError(t, "Failed to close writer", writers[i].Close())
+		failOnError(t, "Failed to close reader", readers[i].Close())
+	}
+	stats = DebugStats()
+	if stats.Writers != base.Writers || stats.Readers != base.Readers {
+		t.Fatalf("Expected the counters to return to %+v, got %+v", base, stats)
+	}
+}
+
+func TestDebugStatsNativeBytes(t *testing.T) {
+	EnableAllocationTracking(true)
+	defer EnableAllocationTracking(false)
+
+	base := DebugStats()
+	payload := bytes.Repeat([]byte("Hello, World! "), 100000)
+	var buf bytes.Buffer
+	w := NewWriterLevel(&buf, 19)
+	_, err := w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	// Reads from buf once the writer is closed, so that the frame is complete
+	r := NewReader(&buf)
+	stats := DebugStats()
+	if stats.NativeBytes <= base.NativeBytes {
+		t.Fatalf("Expected native memory to be tracked, got %d bytes from %d", stats.NativeBytes, base.NativeBytes)
+	}
+
+	failOnError(t, "Failed to close writer", w.Close())
+	_, err = ioutil.ReadAll(r)
+	failOnError(t, "Failed to read", err)
+	failOnError(t, "Failed to close reader", r.Close())
+	if stats = DebugStats(); stats.NativeBytes != base.NativeBytes {
+		t.Fatalf("Expected native memory to return to %d bytes, got %d", base.NativeBytes, stats.NativeBytes)
+	}
+
+	// One-shot calls free their contexts before returning
+	if _, err := CompressWithParams(nil, payload, CParams{Level: 3}); err != nil {
+		t.Fatalf("Failed to compress: %s", err)
+	}
+	if stats = DebugStats(); stats.NativeBytes != base.NativeBytes {
+		t.Fatalf("Expected native memory to return to %d bytes, got %d", base.NativeBytes, stats.NativeBytes)
+	}
+}
+
+func TestDebugStatsPooledBuffers(t *testing.T) {
+	base := DebugStats()
+	PutCompressBuffer(make([]byte, 4096))
+	PutCompressBuffer(make([]byte, 1000)) // Not a size class, dropped
+	if stats := DebugStats(); stats.PooledBuffers != base.PooledBuffers+1 {
+		t.Fatalf("Expected one more pooled buffer, got %d from %d", stats.PooledBuffers, base.PooledBuffers)
+	}
+}
+
+func TestDebugStatsBulkProcessor(t *testing.T) {
+	base := DebugStats()
+	p, err := NewBulkProcessor(dict, BestSpeed)
+	failOnError(t, "Failed to create bulk processor", err)
+	if stats := DebugStats(); stats.Dicts != base.Dicts+2 {
+		t.Fatalf("Expected the dictionaries of the processor to be counted, got %d from %d", stats.Dicts, base.Dicts)
+	}
+	finalizeBulkProcessor(p)
+	p.cDict, p.dDict = nil, nil
+	if stats := DebugStats(); stats.Dicts != base.Dicts {
+		t.Fatalf("Expected the dictionaries to be released, got %d from %d", stats.Dicts, base.Dicts)
+	}
+}
+
+func TestNativeMemoryLimit(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello, World! "), 100000)
+	SetNativeMemoryLimit(1 << 10)
+	defer SetNativeMemoryLimit(0)
+
+	base := DebugStats()
+	w := NewWriter(ioutil.Discard)
+	if _, err := w.Write(payload); err != ErrNativeMemoryLimit {
+		t.Fatalf("Expected ErrNativeMemoryLimit creating a Writer, got %v", err)
+	}
+	if err := w.Close(); err != ErrNativeMemoryLimit {
+		t.Fatalf("Expected ErrNativeMemoryLimit closing the Writer, got %v", err)
+	}
+	if _, err := CompressWithParams(nil, payload, CParams{Level: 3}); err != ErrNativeMemoryLimit {
+		t.Fatalf("Expected ErrNativeMemoryLimit, got %v", err)
+	}
+	if _, err := NewCtx().Compress(nil, payload); err != ErrNativeMemoryLimit {
+		t.Fatalf("Expected ErrNativeMemoryLimit from a Ctx, got %v", err)
+	}
+	if stats := DebugStats(); stats.Writers != base.Writers || stats.NativeBytes != base.NativeBytes {
+		t.Fatalf("Expected nothing to be held after failures, got %+v from %+v", stats, base)
+	}
+
+	// A context fits, but not the window of a high level
+	SetNativeMemoryLimit(1 << 20)
+	w = NewWriterLevel(ioutil.Discard, 19)
+	if _, err := w.Write(payload); err != ErrNativeMemoryLimit {
+		t.Fatalf("Expected ErrNativeMemoryLimit compressing, got %v", err)
+	}
+	w.Close()
+
+	// With workers, the buffers of the jobs are only allocated when the frame
+	// ends, the context must still be freed
+	if HasMultithreadSupport() {
+		SetNativeMemoryLimit(64 << 20)
+		base = DebugStats()
+		w = NewWriterLevel(ioutil.Discard, 3)
+		failOnError(t, "Failed to set the workers", w.SetNbWorkers(2))
+		_, err := w.Write([]byte("Hello, World!"))
+		failOnError(t, "Failed to write", err)
+		SetNativeMemoryLimit(1 << 10)
+		if err := w.Close(); err == nil {
+			t.Fatal("Expected closing the Writer to fail")
+		}
+		if stats := DebugStats(); stats.Writers != base.Writers {
+			t.Fatalf("Expected the Writer to be freed, got %+v from %+v", stats, base)
+		}
+	}
+
+	// Within budget
+	SetNativeMemoryLimit(64 << 20)
+	var buf bytes.Buffer
+	w = NewWriterLevel(&buf, 3)
+	_, err := w.Write(payload)
+	failOnError(t, "Failed to write within the budget", err)
+	failOnError(t, "Failed to close within the budget", w.Close())
+	if stats := DebugStats(); stats.NativeBytes != base.NativeBytes {
+		t.Fatalf("Expected native memory to return to %d bytes, got %d", base.NativeBytes, stats.NativeBytes)
+	}
+
+	// The one-shot functions bypass the limit
+	SetNativeMemoryLimit(1 << 10)
+	if _, err := Compress(nil, payload); err != nil {
+		t.Fatalf("Expected one-shot compression to bypass the limit, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package zstd
+
+/*
+#include "zstd.h"
+#include "zdict.h"
+#include "xxhash.h"
+
+static unsigned long long ZSTD_dictXXH64(const void* src, size_t srcSize) {
+	return XXH64(src, srcSize, 0);
+}
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unsafe"
+)
+
+// ErrDictionaryCorrupted is returned by LoadDictionary when the file is
+// truncated or its content does not match the checksum written by
+// SaveDictionary.
+var ErrDictionaryCorrupted = errors.New("Dictionary file is corrupted")
+
+// dictMagic starts the dictionaries produced by the ZDICT trainer.
+const dictMagic = 0xEC30A437
+
+// dictFooterMagic ends the files written by SaveDictionary, after the XXH64
+// of the dictionary.
+const dictFooterMagic = 0x5A444654 // "TFDZ"
+
+const dictFooterSize = 12
+
+// GetDictIDFromDict returns the ID of a dictionary in the ZDICT format, or 0
+// if dict is not such a dictionary, e.g. raw content.
+func GetDictIDFromDict(dict []byte) uint32 {
+	if len(dict) == 0 {
+		return 0
+	}
+	return uint32(C.ZSTD_getDictID_fromDict(unsafe.Pointer(&dict[0]), C.size_t(len(dict))))
+}
+
+// SaveDictionary writes dict to path followed by a small footer holding its
+// checksum, which LoadDictionary verifies. The file is written to a temporary
+// file renamed once complete, so that path either holds the previous version
+// or the new one, never a partial one.
+func SaveDictionary(path string, dict []byte) error {
+	if len(dict) == 0 {
+		return ErrEmptyDictionary
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := writeDictionary(f, dict); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+func writeDictionary(f *os.File, dict []byte) error {
+	var footer [dictFooterSize]byte
+	binary.LittleEndian.PutUint64(footer[:8], dictChecksum(dict))
+	binary.LittleEndian.PutUint32(footer[8:], dictFooterMagic)
+	if _, err := f.Write(dict); err != nil {
+		return err
+	}
+	if _, err := f.Write(footer[:]); err != nil {
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// DictionaryOption configures LoadDictionary.
+type DictionaryOption func(*dictionaryOptions)
+
+type dictionaryOptions struct {
+	rawContent bool
+}
+
+// WithRawContent lets LoadDictionary load a raw content dictionary, i.e. any
+// data used as a prefix instead of a dictionary produced by the trainer.
+func WithRawContent() DictionaryOption {
+	return func(o *dictionaryOptions) {
+		o.rawContent = true
+	}
+}
+
+// LoadDictionary reads a dictionary written by SaveDictionary, verifying its
+// checksum, and that it is a dictionary produced by the ZDICT trainer unless
+// WithRawContent is given. It returns ErrDictionaryCorrupted if the file is
+// truncated or altered, and ErrBadDictionary if it is not a ZDICT dictionary.
+func LoadDictionary(path string, opts ...DictionaryOption) ([]byte, error) {
+	var o dictionaryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= dictFooterSize {
+		return nil, ErrDictionaryCorrupted
+	}
+	dict, footer := data[:len(data)-dictFooterSize], data[len(data)-dictFooterSize:]
+	if binary.LittleEndian.Uint32(footer[8:]) != dictFooterMagic ||
+		binary.LittleEndian.Uint64(footer[:8]) != dictChecksum(dict) {
+		return nil, ErrDictionaryCorrupted
+	}
+	if !o.rawContent {
+		if len(dict) < 8 || binary.LittleEndian.Uint32(dict) != dictMagic || GetDictIDFromDict(dict) == 0 {
+			return nil, ErrBadDictionary
+		}
+	}
+	return dict, nil
+}
+
+// dictChecksum returns the XXH64 of dict with a seed of 0.
+func dictChecksum(dict []byte) uint64 {
+	return uint64(C.ZSTD_dictXXH64(unsafe.Pointer(&dict[0]), C.size_t(len(dict))))
+}
+
+// trainDictionary trains a dictionary of at most maxDictSize bytes from
+// samples with the ZDICT trainer.
+func trainDictionary(samples [][]byte, maxDictSize int) ([]byte, error) {
+	if maxDictSize <= 0 || len(samples) == 0 {
+		return nil, ErrEmptySlice
+	}
+	// The trainer takes the samples concatenated along with their sizes
+	total := 0
+	for _, s := range samples {
+		total += len(s)
+	}
+	if total == 0 {
+		return nil, ErrEmptySlice
+	}
+	buf := make([]byte, 0, total)
+	sizes := make([]C.size_t, len(samples))
+	for i, s := range samples {
+		buf = append(buf, s...)
+		sizes[i] = C.size_t(len(s))
+	}
+
+	dict := make([]byte, maxDictSize)
+	size := int(C.ZDICT_trainFromBuffer(
+		unsafe.Pointer(&dict[0]),
+		C.size_t(len(dict)),
+		unsafe.Pointer(&buf[0]),
+		&sizes[0],
+		C.unsigned(len(samples))))
+	if err := getError(size); err != nil {
+		return nil, opError("ZDICT_trainFromBuffer", len(buf), len(dict), err)
+	}
+	return dict[:size], nil
+}
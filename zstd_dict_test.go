@@ -0,0 +1,128 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSampleCollectorTrain(t *testing.T) {
+	c := NewSampleCollector(2000, 1<<20)
+	payload := func(i int) []byte {
+		return []byte(fmt.Sprintf(`{"id":%d,"method":"eth_getBlockByNumber","params":["0x%x",true],"jsonrpc":"2.0"}`, i, i*7919))
+	}
+	for i := 0; i < 5000; i++ {
+		c.Add(payload(i))
+	}
+	dict, err := c.Train(4096)
+	failOnError(t, "Failed to train dictionary", err)
+	if len(dict) == 0 || len(dict) > 4096 {
+		t.Fatalf("Unexpected dictionary size %d", len(dict))
+	}
+	if magic := binary.LittleEndian.Uint32(dict); magic != 0xEC30A437 {
+		t.Fatalf("Unexpected dictionary magic %x", magic)
+	}
+
+	// The dictionary helps on similar payloads
+	p, err := NewBulkProcessor(dict, DefaultCompression)
+	failOnError(t, "Failed to load dictionary", err)
+	src := payload(123456)
+	withDict, err := p.Compress(nil, src)
+	failOnError(t, "Failed to compress with dictionary", err)
+	without, err := Compress(nil, src)
+	failOnError(t, "Failed to compress", err)
+	if len(withDict) >= len(without) {
+		t.Fatalf("Expected the dictionary to help: %d >= %d", len(withDict), len(without))
+	}
+	out, err := p.Decompress(nil, withDict)
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(out, src) {
+		t.Fatal("Round trip does not match")
+	}
+}
+
+func TestSampleCollectorTrainEmpty(t *testing.T) {
+	if _, err := NewSampleCollector(10, 100).Train(1024); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+}
+
+func trainTestDictionary(t *testing.T) []byte {
+	c := NewSampleCollector(1000, 1<<20)
+	for i := 0; i < 1000; i++ {
+		c.Add([]byte(fmt.Sprintf(`{"id":%d,"method":"eth_blockNumber","jsonrpc":"2.0"}`, i)))
+	}
+	dict, err := c.Train(2048)
+	failOnError(t, "Failed to train dictionary", err)
+	return dict
+}
+
+func TestSaveLoadDictionary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zstd-dict")
+	failOnError(t, "Failed to create temp dir", err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dict")
+
+	dict := trainTestDictionary(t)
+	if GetDictIDFromDict(dict) == 0 {
+		t.Fatal("Expected a trained dictionary to have an ID")
+	}
+	failOnError(t, "Failed to save dictionary", SaveDictionary(path, dict))
+	loaded, err := LoadDictionary(path)
+	failOnError(t, "Failed to load dictionary", err)
+	if !bytes.Equal(loaded, dict) {
+		t.Fatal("Loaded dictionary differs")
+	}
+	// No temporary file is left behind
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("Expected a single file, got %d", len(files))
+	}
+
+	// Truncated and altered files are detected
+	data, err := ioutil.ReadFile(path)
+	failOnError(t, "Failed to read dictionary", err)
+	failOnError(t, "Failed to truncate", ioutil.WriteFile(path, data[:len(data)/2], 0644))
+	if _, err := LoadDictionary(path); err != ErrDictionaryCorrupted {
+		t.Fatalf("Expected ErrDictionaryCorrupted for a truncated file, got %v", err)
+	}
+	data[len(data)/2] ^= 1
+	failOnError(t, "Failed to alter", ioutil.WriteFile(path, data, 0644))
+	if _, err := LoadDictionary(path); err != ErrDictionaryCorrupted {
+		t.Fatalf("Expected ErrDictionaryCorrupted for an altered file, got %v", err)
+	}
+
+	if _, err := LoadDictionary(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("Expected a not exist error, got %v", err)
+	}
+	if err := SaveDictionary(path, nil); err != ErrEmptyDictionary {
+		t.Fatalf("Expected ErrEmptyDictionary, got %v", err)
+	}
+}
+
+func TestLoadDictionaryRawContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zstd-dict")
+	failOnError(t, "Failed to create temp dir", err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dict")
+
+	raw := []byte(`{"id":0,"method":"eth_blockNumber","jsonrpc":"2.0"}`)
+	if GetDictIDFromDict(raw) != 0 {
+		t.Fatal("Expected raw content to have no ID")
+	}
+	failOnError(t, "Failed to save dictionary", SaveDictionary(path, raw))
+	if _, err := LoadDictionary(path); err != ErrBadDictionary {
+		t.Fatalf("Expected ErrBadDictionary for raw content, got %v", err)
+	}
+	loaded, err := LoadDictionary(path, WithRawContent())
+	failOnError(t, "Failed to load raw content", err)
+	if !bytes.Equal(loaded, raw) {
+		t.Fatal("Loaded raw content differs")
+	}
+}
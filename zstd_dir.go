@@ -0,0 +1,222 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// dirSuffix is the suffix of the outputs of CompressDir
+const dirSuffix = ".zst"
+
+// DirOptions holds the options of CompressDir. The zero value compresses
+// every file at DefaultLevel() with one worker per CPU.
+type DirOptions struct {
+	// Level is the compression level, 0 means DefaultLevel()
+	Level int
+
+	// Workers is the number of files compressed concurrently, 0 means the
+	// number of CPUs
+	Workers int
+
+	// Include, if not empty, restricts the files compressed to the ones
+	// matching one of the patterns, and Exclude skips the files matching one
+	// of its patterns. A pattern, see filepath.Match, matches a file if it
+	// matches either its path relative to the root, with slashes, or its
+	// name.
+	Include []string
+	Exclude []string
+
+	// DeleteSource removes each file once it is compressed
+	DeleteSource bool
+}
+
+// Summary reports the work of CompressDir.
+type Summary struct {
+	// Files is the number of files compressed, Skipped the number of files
+	// whose output was newer than them
+	Files   int
+	Skipped int
+	// BytesIn and BytesOut are the total sizes of the files compressed and
+	// of their outputs
+	BytesIn  int64
+	BytesOut int64
+	// Errors holds the errors of the files which could not be compressed, by
+	// path relative to the root
+	Errors map[string]error
+}
+
+// CompressDir compresses every regular file under root, "foo" into
+// "foo.zst", with opts.Workers files compressed concurrently. Files ending in
+// ".zst" are never compressed, and files whose output is newer than them are
+// skipped, so that running CompressDir again only compresses the files
+// changed since.
+//
+// Each file is streamed through a Writer, so that the memory used does not
+// depend on the size of the files. Outputs are written to a temporary file
+// renamed once complete, so that "foo.zst" is never partial.
+//
+// The errors of the files are reported in the Summary, the error returned is
+// the one walking root, or the one of ctx, which stops the compression of the
+// files in progress, leaving their outputs untouched.
+func CompressDir(ctx context.Context, root string, opts DirOptions) (Summary, error) {
+	summary := Summary{Errors: map[string]error{}}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return summary, err
+		}
+	}
+	if opts.Level == 0 {
+		opts.Level = DefaultLevel()
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	paths := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				in, out, skipped, err := compressDirFile(ctx, path, opts)
+				if err != nil && ctx.Err() != nil {
+					// Interrupted, not failed
+					continue
+				}
+				rel, _ := filepath.Rel(root, path)
+				mu.Lock()
+				switch {
+				case err != nil:
+					summary.Errors[filepath.ToSlash(rel)] = err
+				case skipped:
+					summary.Skipped++
+				default:
+					summary.Files++
+					summary.BytesIn += in
+					summary.BytesOut += out
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || strings.HasSuffix(path, dirSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if !dirOptionsMatch(opts, filepath.ToSlash(rel)) {
+			return nil
+		}
+		select {
+		case paths <- path:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(paths)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return summary, err
+}
+
+// dirOptionsMatch returns whether the file at rel, relative to the root,
+// passes the patterns of opts.
+func dirOptionsMatch(opts DirOptions, rel string) bool {
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, rel); ok {
+				return true
+			}
+			if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(opts.Include) == 0 || matches(opts.Include)) && !matches(opts.Exclude)
+}
+
+// compressDirFile compresses the file at path into path.zst, unless the
+// output is newer, and returns the sizes of the file and of its output.
+func compressDirFile(ctx context.Context, path string, opts DirOptions) (in, out int64, skipped bool, err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	dstPath := path + dirSuffix
+	if dstInfo, err := os.Stat(dstPath); err == nil && dstInfo.Mode().IsRegular() && dstInfo.ModTime().After(info.ModTime()) {
+		return 0, 0, true, nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(dstPath)+".tmp")
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if out, err = compressDirFileTo(ctx, f, src, opts.Level); err == nil {
+		err = f.Chmod(info.Mode().Perm())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), dstPath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, 0, false, err
+	}
+	if opts.DeleteSource {
+		if err := os.Remove(path); err != nil {
+			return 0, 0, false, err
+		}
+	}
+	return info.Size(), out, false, nil
+}
+
+// compressDirFileTo compresses src into f at level and returns the size of
+// the output.
+func compressDirFileTo(ctx context.Context, f *os.File, src io.Reader, level int) (int64, error) {
+	w := NewWriterLevel(f, level)
+	if _, err := io.Copy(w, &contextReader{ctx: ctx, r: src}); err != nil {
+		// Closing would end a well-formed frame of the truncated input
+		w.Abort()
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	return f.Seek(0, io.SeekCurrent)
+}
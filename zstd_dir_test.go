@@ -0,0 +1,161 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree creates the files under root with their content.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		failOnError(t, "Failed to create the directory", os.MkdirAll(filepath.Dir(path), 0755))
+		failOnError(t, "Failed to write the file", ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+// listTree returns the paths of the files under root, relative to it.
+func listTree(t *testing.T, root string) []string {
+	var names []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			rel, _ := filepath.Rel(root, path)
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	failOnError(t, "Failed to list the files", err)
+	sort.Strings(names)
+	return names
+}
+
+func TestCompressDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "compressdir")
+	failOnError(t, "Failed to create the directory", err)
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		"a.log":           string(bytes.Repeat([]byte("a log line\n"), 10000)),
+		"sub/b.log":       "another log",
+		"sub/deep/c.txt":  "a text",
+		"sub/keep.tmp":    "excluded",
+		"done.zst":        "already compressed",
+		"sub/empty.log":   "",
+		"sub/failing.txt": "its output is a directory",
+	}
+	writeTree(t, root, files)
+	failOnError(t, "Failed to create the directory", os.Mkdir(filepath.Join(root, "sub", "failing.txt.zst"), 0755))
+
+	summary, err := CompressDir(context.Background(), root, DirOptions{Level: BestSpeed, Workers: 2, Exclude: []string{"*.tmp"}})
+	failOnError(t, "Failed to compress the directory", err)
+	if summary.Files != 4 || summary.Skipped != 0 || len(summary.Errors) != 1 || summary.Errors["sub/failing.txt"] == nil {
+		t.Fatalf("Unexpected summary %+v", summary)
+	}
+	var in, out int64
+	for _, name := range []string{"a.log", "sub/b.log", "sub/deep/c.txt", "sub/empty.log"} {
+		compressed, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(name)+".zst"))
+		failOnError(t, "Failed to read the output", err)
+		decompressed, err := Decompress(nil, compressed)
+		failOnError(t, "Failed to decompress the output", err)
+		if string(decompressed) != files[name] {
+			t.Fatalf("%s: the round trip differs", name)
+		}
+		in += int64(len(files[name]))
+		out += int64(len(compressed))
+	}
+	if summary.BytesIn != in || summary.BytesOut != out {
+		t.Fatalf("Expected %d bytes in and %d out, got %+v", in, out, summary)
+	}
+
+	// Only the files changed since are compressed again
+	past := time.Now().Add(-time.Hour)
+	failOnError(t, "Failed to change the time", os.Chtimes(filepath.Join(root, "a.log"), past, past))
+	failOnError(t, "Failed to change the time", os.Chtimes(filepath.Join(root, "sub", "b.log.zst"), past, past))
+	summary, err = CompressDir(context.Background(), root, DirOptions{Include: []string{"*.log", "sub/deep/*"}, DeleteSource: true})
+	failOnError(t, "Failed to compress the directory", err)
+	if summary.Files != 1 || summary.Skipped != 3 || len(summary.Errors) != 0 {
+		t.Fatalf("Unexpected summary %+v", summary)
+	}
+	want := []string{"a.log", "a.log.zst", "done.zst", "sub/b.log.zst", "sub/deep/c.txt", "sub/deep/c.txt.zst",
+		"sub/empty.log", "sub/empty.log.zst", "sub/failing.txt", "sub/keep.tmp"}
+	if got := listTree(t, root); !equalStrings(got, want) {
+		t.Fatalf("Expected the files %v, got %v", want, got)
+	}
+}
+
+func TestCompressDirCancel(t *testing.T) {
+	root, err := ioutil.TempDir("", "compressdir")
+	failOnError(t, "Failed to create the directory", err)
+	defer os.RemoveAll(root)
+	writeTree(t, root, map[string]string{"a": "a", "b": "b"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary, err := CompressDir(ctx, root, DirOptions{})
+	if err != context.Canceled || summary.Files != 0 || len(summary.Errors) != 0 {
+		t.Fatalf("Expected nothing compressed and context.Canceled, got %+v and %v", summary, err)
+	}
+	if got := listTree(t, root); !equalStrings(got, []string{"a", "b"}) {
+		t.Fatalf("Expected no output, got %v", got)
+	}
+	if _, err := CompressDir(context.Background(), root, DirOptions{Include: []string{"["}}); err != filepath.ErrBadPattern {
+		t.Fatalf("Expected filepath.ErrBadPattern, got %v", err)
+	}
+}
+
+// failAfterReader reads r, then fails with err instead of io.EOF.
+type failAfterReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *failAfterReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		err = r.err
+	}
+	return n, err
+}
+
+func TestCompressDirFileToReadError(t *testing.T) {
+	f, err := ioutil.TempFile("", "compressdir*.zst")
+	failOnError(t, "Failed to create the file", err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	readErr := errors.New("read failed")
+	src := &failAfterReader{r: strings.NewReader("Hello World!"), err: readErr}
+	if _, err := compressDirFileTo(context.Background(), f, src, DefaultCompression); err != readErr {
+		t.Fatalf("Expected the error of the input, got %v", err)
+	}
+	content, err := ioutil.ReadFile(f.Name())
+	failOnError(t, "Failed to read the file", err)
+	if len(content) > 0 {
+		if _, err := Decompress(nil, content); err == nil {
+			t.Fatalf("Expected an incomplete frame for a truncated input")
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -114,4 +114,6 @@ ZSTDERRORLIB_API const char* ZSTD_getErrorString(ZSTD_ErrorCode code);   /**< Sa
 
 #endif /* ZSTD_ERRORS_H_398273423 */
 
+#else /* USE_EXTERNAL_ZSTD */
+#include_next <zstd_errors.h>
 #endif /* USE_EXTERNAL_ZSTD */
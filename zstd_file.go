@@ -0,0 +1,94 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"os"
+)
+
+// DecompressFileInto decompresses the zstd file at path into dst, like
+// DecompressInto. The file is memory-mapped and handed to the stream decoder
+// in one go, so that multi-GB archives are decoded without being read into a
+// Go buffer or copied through a staging buffer. It returns the number of bytes
+// written, or a *DstSizeTooSmallError if dst cannot hold the decompressed
+// content. An empty file returns ErrEmptySlice.
+func DecompressFileInto(dst []byte, path string) (int, error) {
+	var n int
+	err := withMappedFile(path, func(src []byte) error {
+		var err error
+		n, err = decompressMapped(dst, src)
+		return err
+	})
+	return n, err
+}
+
+// DecompressFile is like DecompressFileInto but returns a newly allocated
+// buffer holding the decompressed content. The buffer is allocated once when
+// the frame headers record the content size, and grown as needed otherwise.
+func DecompressFile(path string) ([]byte, error) {
+	var out []byte
+	err := withMappedFile(path, func(src []byte) error {
+		// A 4 bytes RLE block decodes to at most 128KB, larger declared sizes
+		// are bogus and must not be allocated upfront
+		size, ok := declaredContentSize(src)
+		if ok {
+			// Nor can sizes exceeding the global limit
+			if err := GlobalLimits().checkSize(size); err != nil {
+				return err
+			}
+		}
+		if !ok || size > uint64(maxInt) || size > uint64(len(src))<<15 {
+			var err error
+			out, err = decompressStream(nil, src, decompressSizeHint(src), DecompressOptions{})
+			return err
+		}
+		out = make([]byte, int(size))
+		n, err := decompressMapped(out, src)
+		out = out[:n]
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// decompressMapped decompresses src, a mapped file, into dst. The mapping is
+// not Go memory, so the cgo pointer rules do not restrict passing it to C, and
+// it stays valid until withMappedFile unmaps it after the last call returns.
+func decompressMapped(dst, src []byte) (int, error) {
+	return DecompressVectored([][]byte{dst}, src)
+}
+
+// withMappedFile calls fn with the content of the file at path mapped in
+// memory, and unmaps it once fn returns, whether it failed or not. fn must not
+// retain the slice.
+func withMappedFile(path string, fn func([]byte) error) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size == 0 {
+		return ErrEmptySlice
+	}
+	if size > int64(maxInt) {
+		return &os.PathError{Op: "mmap", Path: path, Err: ErrNotSupported}
+	}
+	data, err := mmapFile(f, int(size))
+	if err != nil {
+		return &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+	defer func() {
+		if uerr := munmapFile(data); err == nil {
+			err = uerr
+		}
+	}()
+	return fn(data)
+}
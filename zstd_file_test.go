@@ -0,0 +1,98 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCompressedFile writes payload compressed in dir, with the content size
+// in the frame header if oneShot is set.
+func writeCompressedFile(t *testing.T, dir, name string, payload []byte, oneShot bool) string {
+	var compressed []byte
+	if oneShot {
+		var err error
+		compressed, err = Compress(nil, payload)
+		failOnError(t, "Failed to compress", err)
+	} else {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		_, err := w.Write(payload)
+		failOnError(t, "Failed to write", err)
+		failOnError(t, "Failed to close", w.Close())
+		compressed = buf.Bytes()
+	}
+	path := filepath.Join(dir, name)
+	failOnError(t, "Failed to write file", ioutil.WriteFile(path, compressed, 0644))
+	return path
+}
+
+func TestDecompressFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zstd-file")
+	failOnError(t, "Failed to create temp dir", err)
+	defer os.RemoveAll(dir)
+
+	// Barely compressible, so that the file is much larger than the staging
+	// buffer of the stream decoder
+	payload := make([]byte, 8*cSize)
+	rand.New(rand.NewSource(1)).Read(payload)
+	for i := 0; i < len(payload); i += 7 {
+		payload[i] = 0
+	}
+
+	for _, oneShot := range []bool{true, false} {
+		path := writeCompressedFile(t, dir, "payload.zst", payload, oneShot)
+		if info, err := os.Stat(path); err != nil || info.Size() <= int64(cSize) {
+			t.Fatalf("Expected a file larger than %d bytes, got %v %v", cSize, info, err)
+		}
+
+		dst := make([]byte, len(payload)+10)
+		n, err := DecompressFileInto(dst, path)
+		failOnError(t, "Failed to decompress into", err)
+		if !bytes.Equal(dst[:n], payload) {
+			t.Fatalf("oneShot=%v: DecompressFileInto does not match", oneShot)
+		}
+
+		out, err := DecompressFile(path)
+		failOnError(t, "Failed to decompress", err)
+		if !bytes.Equal(out, payload) {
+			t.Fatalf("oneShot=%v: DecompressFile does not match", oneShot)
+		}
+
+		_, err = DecompressFileInto(make([]byte, len(payload)-1), path)
+		if !IsDstSizeTooSmallError(err) {
+			t.Fatalf("oneShot=%v: expected a DstSizeTooSmallError, got %v", oneShot, err)
+		}
+	}
+}
+
+func TestDecompressFileErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zstd-file")
+	failOnError(t, "Failed to create temp dir", err)
+	defer os.RemoveAll(dir)
+
+	empty := filepath.Join(dir, "empty.zst")
+	failOnError(t, "Failed to write file", ioutil.WriteFile(empty, nil, 0644))
+	if _, err := DecompressFile(empty); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+
+	if _, err := DecompressFileInto(nil, filepath.Join(dir, "missing.zst")); !os.IsNotExist(err) {
+		t.Fatalf("Expected a missing file error, got %v", err)
+	}
+
+	payload := []byte("Hello, World!")
+	path := writeCompressedFile(t, dir, "truncated.zst", payload, true)
+	compressed, err := ioutil.ReadFile(path)
+	failOnError(t, "Failed to read file", err)
+	failOnError(t, "Failed to truncate", ioutil.WriteFile(path, compressed[:len(compressed)-2], 0644))
+	if _, err := DecompressFile(path); err == nil {
+		t.Fatal("Expected an error decompressing a truncated file")
+	}
+}
@@ -0,0 +1,263 @@
+package zstd
+
+/*
+#include "zstd.h"
+#include "zstd_errors.h"
+
+// ZSTD_verifyFrame_wrapper decodes a whole frame into scratch, overwriting it
+// as it goes, and returns 0 once the frame and its checksum are verified.
+static size_t ZSTD_verifyFrame_wrapper(ZSTD_DCtx* ctx, void* scratch, size_t scratchSize,
+		const void* src, size_t srcSize) {
+	ZSTD_inBuffer inBuffer = { src, srcSize, 0 };
+	for (;;) {
+		ZSTD_outBuffer outBuffer = { scratch, scratchSize, 0 };
+		size_t retCode = ZSTD_decompressStream(ctx, &outBuffer, &inBuffer);
+		if (ZSTD_isError(retCode) || retCode == 0) {
+			return retCode;
+		}
+		if (inBuffer.pos == inBuffer.size && outBuffer.pos < outBuffer.size) {
+			return (size_t)-ZSTD_error_srcSize_wrong;
+		}
+	}
+}
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+var (
+	// ErrOffsetOutOfRange is returned when an offset is outside of src
+	ErrOffsetOutOfRange = errors.New("Offset is out of range")
+	// ErrChecksumMismatch is returned when the checksum of a frame does not
+	// match its content
+	ErrChecksumMismatch = errors.New("Frame checksum does not match")
+	// ErrNoChecksum is returned when verifying a frame written without checksum
+	ErrNoChecksum = errors.New("Frame has no checksum")
+)
+
+// FrameError reports the offset at which parsing a buffer of concatenated
+// frames failed, e.g. because of a truncated or corrupted tail.
+type FrameError struct {
+	Offset int
+	Err    error
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("zstd: invalid frame at offset %d: %s", e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+// FindFrameCompressedSize returns the size of the first frame of src, which
+// must start at the beginning of a zstd frame (regular, legacy or skippable).
+// src may contain more data after the frame. It returns ErrFrameTruncated if
+// src ends before the end of the frame.
+func FindFrameCompressedSize(src []byte) (int, error) {
+	if len(src) == 0 {
+		return 0, ErrEmptySlice
+	}
+	size := int(C.ZSTD_findFrameCompressedSize(unsafe.Pointer(&src[0]), C.size_t(len(src))))
+	if err := frameError(size); err != nil {
+		return 0, opError("ZSTD_findFrameCompressedSize", len(src), 0, err)
+	}
+	return size, nil
+}
+
+// frameError converts a zstd return code to an error, mapping the codes with
+// a dedicated error in this package.
+func frameError(code int) error {
+	err := getError(code)
+	if err == nil {
+		return nil
+	}
+	switch C.ZSTD_getErrorCode(C.size_t(code)) {
+	case C.ZSTD_error_srcSize_wrong:
+		return ErrFrameTruncated
+	case C.ZSTD_error_checksum_wrong:
+		return ErrChecksumMismatch
+	case C.ZSTD_error_frameParameter_windowTooLarge:
+		return ErrWindowTooLarge
+	}
+	return err
+}
+
+// dictionaryError returns ErrDictionaryRequired instead of err when zstd
+// failed because the frame starting src needs a dictionary whose ID its header
+// records.
+func dictionaryError(src []byte, err error) error {
+	code, ok := errorCode(err)
+	if !ok || len(src) == 0 || C.ZSTD_getErrorCode(C.size_t(code)) != C.ZSTD_error_dictionary_wrong {
+		return err
+	}
+	if id := uint32(C.ZSTD_getDictID_fromFrame(unsafe.Pointer(&src[0]), C.size_t(len(src)))); id != 0 {
+		return ErrDictionaryRequired{DictID: id}
+	}
+	return err
+}
+
+// getFrameHeader parses the header of the frame starting src.
+func getFrameHeader(src []byte) (C.ZSTD_frameHeader, error) {
+	var header C.ZSTD_frameHeader
+	if len(src) == 0 {
+		return header, ErrEmptySlice
+	}
+	code := int(C.ZSTD_getFrameHeader(&header, unsafe.Pointer(&src[0]), C.size_t(len(src))))
+	if err := getError(code); err != nil {
+		return header, opError("ZSTD_getFrameHeader", len(src), 0, err)
+	}
+	if code > 0 {
+		return header, ErrFrameTruncated
+	}
+	return header, nil
+}
+
+// IsSkippableFrame returns whether src starts with a skippable frame magic
+// number. Skippable frames carry user data and decompress to nothing.
+func IsSkippableFrame(src []byte) bool {
+	// Checked here as ZSTD_isSkippableFrame only exists since zstd 1.5.0
+	return len(src) >= 4 && binary.LittleEndian.Uint32(src)&0xFFFFFFF0 == 0x184D2A50
+}
+
+// SplitFrames returns the frames of src, which may contain several
+// concatenated frames including skippable ones (use IsSkippableFrame to
+// classify them). The frames are sub-slices of src, not copies. On a
+// truncated or corrupted tail it returns the frames parsed so far and a
+// *FrameError with the offset of the invalid frame.
+func SplitFrames(src []byte) ([][]byte, error) {
+	var frames [][]byte
+	for offset := 0; offset < len(src); {
+		size, err := FindFrameCompressedSize(src[offset:])
+		if err != nil {
+			return frames, &FrameError{Offset: offset, Err: err}
+		}
+		frames = append(frames, src[offset:offset+size:offset+size])
+		offset += size
+	}
+	return frames, nil
+}
+
+// FrameCount returns the number of frames, including skippable frames, in
+// src. See SplitFrames for the errors.
+func FrameCount(src []byte) (int, error) {
+	count := 0
+	for offset := 0; offset < len(src); {
+		size, err := FindFrameCompressedSize(src[offset:])
+		if err != nil {
+			return count, &FrameError{Offset: offset, Err: err}
+		}
+		count++
+		offset += size
+	}
+	return count, nil
+}
+
+// DecompressFrameAt decompresses the single frame starting at offset in src
+// into dst, see Decompress for how dst is used. It returns the decompressed
+// data and the number of compressed bytes consumed, anything after the frame
+// is left untouched. A skippable frame returns an empty output.
+//
+// A frame cut short by the end of src returns ErrFrameTruncated, while a
+// corrupted frame returns the error reported by zstd.
+func DecompressFrameAt(dst, src []byte, offset int) (out []byte, consumed int, err error) {
+	if offset < 0 || offset > len(src) {
+		return nil, 0, ErrOffsetOutOfRange
+	}
+	src = src[offset:]
+	size, err := FindFrameCompressedSize(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	if IsSkippableFrame(src) {
+		if dst == nil {
+			return []byte{}, size, nil
+		}
+		return dst[:0], size, nil
+	}
+	out, err = Decompress(dst, src[:size])
+	if err != nil {
+		return nil, 0, err
+	}
+	return out, size, nil
+}
+
+// VerifyFrame checks the checksum of the frame starting src without keeping
+// the decompressed data: the frame is decoded into a small scratch buffer, so
+// memory use is bounded by the window size whatever the content size is.
+//
+// It returns ErrNoChecksum if the frame was written without checksum,
+// ErrChecksumMismatch if the checksum does not match, and ErrFrameTruncated or
+// the error reported by zstd for truncated or corrupted frames.
+func VerifyFrame(src []byte) error {
+	header, err := getFrameHeader(src)
+	if err != nil {
+		return err
+	}
+	if header.frameType == C.ZSTD_skippableFrame || header.checksumFlag == 0 {
+		return ErrNoChecksum
+	}
+	size, err := FindFrameCompressedSize(src)
+	if err != nil {
+		return err
+	}
+
+	dctx, err := newDCtx()
+	if err != nil {
+		return err
+	}
+	defer freeDCtx(dctx)
+	return verifyFrame(dctx, make([]byte, int(C.ZSTD_DStreamOutSize())), src[:size])
+}
+
+// ValidateFrame checks that src, a sequence of frames (regular, legacy or
+// skippable) such as Decompress accepts, decodes without error, without
+// keeping the decompressed data: each frame is decoded into a small scratch
+// buffer, so memory use is bounded by the window size whatever the content
+// size is. This checks the block structure, the declared content sizes and
+// the checksums of the frames which have one.
+//
+// It returns nil for a valid src, and otherwise the error decompressing it
+// would return: ErrEmptySlice, ErrNotZstd, ErrFrameTruncated,
+// ErrChecksumMismatch, ErrDictionaryRequired or the *Error reported by zstd.
+// Like the streaming Reader, it returns ErrWindowTooLarge for frames needing
+// a window larger than 128MB, even though Decompress may accept them.
+func ValidateFrame(src []byte) error {
+	if len(src) == 0 {
+		return ErrEmptySlice
+	}
+	dctx, err := newDCtx()
+	if err != nil {
+		return err
+	}
+	defer freeDCtx(dctx)
+	scratch := make([]byte, int(C.ZSTD_DStreamOutSize()))
+	for offset := 0; offset < len(src); {
+		size, err := FindFrameCompressedSize(src[offset:])
+		if err != nil {
+			return notZstdError(src[offset:], err)
+		}
+		if err := verifyFrame(dctx, scratch, src[offset:offset+size]); err != nil {
+			return dictionaryError(src[offset:], err)
+		}
+		offset += size
+	}
+	return nil
+}
+
+// verifyFrame decodes frame, a whole frame, with dctx into scratch,
+// overwriting it as it goes.
+func verifyFrame(dctx *C.ZSTD_DCtx, scratch, frame []byte) error {
+	err := frameError(int(C.ZSTD_verifyFrame_wrapper(
+		dctx,
+		unsafe.Pointer(&scratch[0]),
+		C.size_t(len(scratch)),
+		unsafe.Pointer(&frame[0]),
+		C.size_t(len(frame)))))
+	return opError("ZSTD_decompressStream", len(frame), len(scratch), err)
+}
@@ -0,0 +1,286 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// skippableFrame builds a skippable frame with the given magic variant (0-15)
+func skippableFrame(variant byte, payload []byte) []byte {
+	frame := []byte{0x50 | variant, 0x2A, 0x4D, 0x18, 0, 0, 0, 0}
+	frame[4] = byte(len(payload))
+	frame[5] = byte(len(payload) >> 8)
+	frame[6] = byte(len(payload) >> 16)
+	frame[7] = byte(len(payload) >> 24)
+	return append(frame, payload...)
+}
+
+func concatFrames(t *testing.T) ([]byte, [][]byte) {
+	var parts [][]byte
+	for _, s := range []string{"first frame", "", "third frame"} {
+		compressed, err := Compress(nil, []byte(s))
+		if err != nil {
+			t.Fatalf("Error while compressing: %v", err)
+		}
+		parts = append(parts, compressed)
+	}
+	parts = append(parts[:1], append([][]byte{skippableFrame(3, []byte("metadata"))}, parts[1:]...)...)
+	return bytes.Join(parts, nil), parts
+}
+
+func TestSplitFrames(t *testing.T) {
+	src, parts := concatFrames(t)
+
+	count, err := FrameCount(src)
+	if err != nil || count != len(parts) {
+		t.Fatalf("FrameCount = (%d, %v), want %d", count, err, len(parts))
+	}
+	frames, err := SplitFrames(src)
+	if err != nil {
+		t.Fatalf("SplitFrames failed: %s", err)
+	}
+	if len(frames) != len(parts) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(parts))
+	}
+	offset := 0
+	for i, frame := range frames {
+		if !bytes.Equal(frame, parts[i]) {
+			t.Fatalf("frame %d does not match", i)
+		}
+		if &frame[0] != &src[offset] {
+			t.Fatalf("frame %d is not a sub-slice of src", i)
+		}
+		offset += len(frame)
+		if IsSkippableFrame(frame) != (i == 1) {
+			t.Fatalf("frame %d: wrong skippable classification", i)
+		}
+	}
+
+	if count, err := FrameCount(nil); count != 0 || err != nil {
+		t.Fatalf("FrameCount(nil) = (%d, %v)", count, err)
+	}
+}
+
+func TestSplitFramesTruncatedTail(t *testing.T) {
+	src, parts := concatFrames(t)
+	truncatedAt := len(src) - len(parts[len(parts)-1])
+	for _, bad := range [][]byte{src[:len(src)-2], append(src[:truncatedAt:truncatedAt], []byte("garbage!")...)} {
+		frames, err := SplitFrames(bad)
+		var frameErr *FrameError
+		if !errors.As(err, &frameErr) {
+			t.Fatalf("expected a FrameError, got %v", err)
+		}
+		if frameErr.Offset != truncatedAt {
+			t.Fatalf("error offset = %d, want %d", frameErr.Offset, truncatedAt)
+		}
+		if len(frames) != len(parts)-1 {
+			t.Fatalf("expected the %d valid frames, got %d", len(parts)-1, len(frames))
+		}
+		if count, err := FrameCount(bad); count != len(parts)-1 || err == nil {
+			t.Fatalf("FrameCount = (%d, %v)", count, err)
+		}
+	}
+}
+
+func TestDecompressFrameAt(t *testing.T) {
+	src, parts := concatFrames(t)
+	container := append([]byte("header"), src...)
+	container = append(container, []byte("trailer")...)
+
+	offset := len("header")
+	for i, want := range []string{"first frame", "", "", "third frame"} {
+		out, consumed, err := DecompressFrameAt(nil, container, offset)
+		if err != nil {
+			t.Fatalf("frame %d: DecompressFrameAt failed: %s", i, err)
+		}
+		if consumed != len(parts[i]) {
+			t.Fatalf("frame %d: consumed %d, want %d", i, consumed, len(parts[i]))
+		}
+		if out == nil || string(out) != want {
+			t.Fatalf("frame %d: got %q, want %q", i, out, want)
+		}
+		offset += consumed
+	}
+	if string(container[offset:]) != "trailer" {
+		t.Fatalf("unexpected trailing data %q", container[offset:])
+	}
+
+	if _, _, err := DecompressFrameAt(nil, container, offset); err == nil || err == ErrFrameTruncated {
+		t.Fatalf("expected a corruption error, got %v", err)
+	}
+	if _, _, err := DecompressFrameAt(nil, src[:len(parts[0])-1], 0); err != ErrFrameTruncated {
+		t.Fatalf("expected ErrFrameTruncated, got %v", err)
+	}
+	if _, _, err := DecompressFrameAt(nil, src, len(src)+1); err != ErrOffsetOutOfRange {
+		t.Fatalf("expected ErrOffsetOutOfRange, got %v", err)
+	}
+}
+
+func TestVerifyFrame(t *testing.T) {
+	payload := []byte(strings.Repeat("Hello World! ", 100000))
+	compressed, err := CompressWithParams(nil, payload, CParams{Checksum: true})
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	if err := VerifyFrame(compressed); err != nil {
+		t.Fatalf("VerifyFrame failed: %s", err)
+	}
+
+	corrupted := append([]byte{}, compressed...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+	if err := VerifyFrame(corrupted); err != ErrChecksumMismatch {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if err := VerifyFrame(compressed[:len(compressed)-1]); err != ErrFrameTruncated {
+		t.Fatalf("expected ErrFrameTruncated, got %v", err)
+	}
+
+	noChecksum, err := Compress(nil, payload)
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	if err := VerifyFrame(noChecksum); err != ErrNoChecksum {
+		t.Fatalf("expected ErrNoChecksum, got %v", err)
+	}
+	if err := VerifyFrame(skippableFrame(0, []byte("metadata"))); err != ErrNoChecksum {
+		t.Fatalf("expected ErrNoChecksum for a skippable frame, got %v", err)
+	}
+	if err := VerifyFrame(nil); err != ErrEmptySlice {
+		t.Fatalf("expected ErrEmptySlice, got %v", err)
+	}
+}
+
+func TestValidateFrame(t *testing.T) {
+	payload := []byte(strings.Repeat("Hello World! ", 100000))
+	compressed, err := CompressWithParams(nil, payload, CParams{Checksum: true})
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	noChecksum, err := Compress(nil, payload)
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	legacy := []byte("%\xb5/\xfd\x00@\x00\x1bcompressed with legacy zstd\xc0\x00\x00")
+
+	valid := map[string][]byte{
+		"checksum":    compressed,
+		"no checksum": noChecksum,
+		"skippable":   skippableFrame(0, []byte("metadata")),
+		"legacy":      legacy,
+		"concatenated": append(append(append([]byte{}, noChecksum...),
+			skippableFrame(3, []byte("metadata"))...), compressed...),
+	}
+	for name, src := range valid {
+		if err := ValidateFrame(src); err != nil {
+			t.Errorf("ValidateFrame(%s) failed: %s", name, err)
+		}
+	}
+
+	corrupted := append([]byte{}, compressed...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+	if err := ValidateFrame(corrupted); err != ErrChecksumMismatch {
+		t.Fatalf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	for _, truncated := range [][]byte{compressed[:len(compressed)-1], noChecksum[:len(noChecksum)/2], legacy[:len(legacy)-3]} {
+		if err := ValidateFrame(truncated); err != ErrFrameTruncated {
+			t.Fatalf("Expected ErrFrameTruncated, got %v", err)
+		}
+	}
+	if err := ValidateFrame(append(append([]byte{}, compressed...), noChecksum[:10]...)); err != ErrFrameTruncated {
+		t.Fatalf("Expected ErrFrameTruncated for a truncated second frame, got %v", err)
+	}
+
+	// Flip a byte in the middle of the first block: the block structure or
+	// its entropy tables no longer decode, or the output no longer matches
+	// the checksum
+	damaged := append([]byte{}, compressed...)
+	damaged[len(damaged)/2] ^= 0xFF
+	err = ValidateFrame(damaged)
+	var zerr *Error
+	if err == nil || (err != ErrChecksumMismatch && !errors.As(err, &zerr)) {
+		t.Fatalf("Expected a decoding error for a corrupted block, got %v", err)
+	}
+	if _, derr := Decompress(nil, damaged); derr == nil {
+		t.Fatalf("Decompress accepted the frame ValidateFrame rejected")
+	}
+
+	var notZstd ErrNotZstd
+	if err := ValidateFrame([]byte("not a zstd frame at all")); !errors.As(err, &notZstd) {
+		t.Fatalf("Expected ErrNotZstd, got %v", err)
+	}
+	if err := ValidateFrame(nil); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+	var dictRequired ErrDictionaryRequired
+	if err := ValidateFrame(compressedPayload); !errors.As(err, &dictRequired) {
+		t.Fatalf("Expected ErrDictionaryRequired, got %v", err)
+	}
+}
+
+func TestValidateFrameMemory(t *testing.T) {
+	// 256MB of content in a frame of a few KB: decoding it in memory would
+	// need the whole content, validating it only the window
+	w := bytes.NewBuffer(nil)
+	zw := NewWriterLevel(w, BestSpeed)
+	chunk := make([]byte, 1<<20)
+	for i := 0; i < 256; i++ {
+		if _, err := zw.Write(chunk); err != nil {
+			t.Fatalf("Failed writing to compress object: %s", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close compress object: %s", err)
+	}
+	src := w.Bytes()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if err := ValidateFrame(src); err != nil {
+		t.Fatalf("ValidateFrame failed: %s", err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Fatalf("ValidateFrame allocated %d bytes for %d bytes of content", allocated, 256<<20)
+	}
+}
+
+func benchmarkVerifyInput(b *testing.B) ([]byte, []byte) {
+	payload := []byte(strings.Repeat("Hello World! ", 1000000))
+	compressed, err := CompressWithParams(nil, payload, CParams{Checksum: true})
+	if err != nil {
+		b.Fatalf("Error while compressing: %v", err)
+	}
+	return payload, compressed
+}
+
+// BenchmarkVerifyFrame should run at about the speed of BenchmarkVerifyDecompress
+// while allocating a constant amount of memory.
+func BenchmarkVerifyFrame(b *testing.B) {
+	payload, compressed := benchmarkVerifyInput(b)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := VerifyFrame(compressed); err != nil {
+			b.Fatalf("VerifyFrame failed: %s", err)
+		}
+	}
+}
+
+func BenchmarkVerifyDecompress(b *testing.B) {
+	payload, compressed := benchmarkVerifyInput(b)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Decompress(nil, compressed); err != nil {
+			b.Fatalf("Decompress failed: %s", err)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+//go:build go1.16
+// +build go1.16
+
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// fsSuffix is the suffix of the files decompressed by the file system of
+// NewFS
+const fsSuffix = ".zst"
+
+// FSOption configures a file system created by NewFS.
+type FSOption func(*zstdFS)
+
+// WithCountedSize makes the file infos of NewFS report the decompressed size
+// of files whose frames do not declare it by decoding them entirely, instead
+// of reporting a size of -1.
+func WithCountedSize() FSOption {
+	return func(fsys *zstdFS) {
+		fsys.countSize = true
+	}
+}
+
+// NewFS returns a file system serving the files of base, where a compressed
+// file "foo.txt.zst" is served as "foo.txt": Open("foo.txt") returns a file
+// whose Read streams the decompressed content, and ReadDir lists it without
+// its suffix. Its file info reports the decompressed size when its frames
+// declare it and are at most 64MB each, so that they are found without
+// decoding them, see WithCountedSize otherwise.
+//
+// A file of base takes precedence over a compressed file of the same name:
+// when both "foo.txt" and "foo.txt.zst" exist, "foo.txt" is served as is and
+// "foo.txt.zst" is listed and served under its own name, compressed.
+// Directories are never renamed.
+func NewFS(base fs.FS, opts ...FSOption) fs.FS {
+	fsys := &zstdFS{base: base}
+	for _, opt := range opts {
+		opt(fsys)
+	}
+	return fsys
+}
+
+type zstdFS struct {
+	base      fs.FS
+	countSize bool
+}
+
+func (fsys *zstdFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := fsys.base.Open(name)
+	if err == nil {
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if info.IsDir() {
+			return &zstdDir{File: f, fsys: fsys, name: name}, nil
+		}
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) || name == "." {
+		return nil, err
+	}
+
+	f, cerr := fsys.base.Open(name + fsSuffix)
+	if cerr != nil {
+		// Report the name which was asked for
+		return nil, err
+	}
+	info, cerr := f.Stat()
+	if cerr != nil || info.IsDir() {
+		f.Close()
+		return nil, err
+	}
+	return &zstdFile{file: f, fsys: fsys, path: name + fsSuffix, info: info, r: NewReader(f)}, nil
+}
+
+// ReadDir lists the directory name of base, with the compressed files renamed.
+func (fsys *zstdFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(fsys.base, name)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		names[e.Name()] = true
+	}
+	out := make([]fs.DirEntry, len(entries))
+	for i, e := range entries {
+		out[i] = e
+		stem := strings.TrimSuffix(e.Name(), fsSuffix)
+		if !e.IsDir() && stem != e.Name() && stem != "" && !names[stem] {
+			out[i] = &zstdDirEntry{DirEntry: e, fsys: fsys, path: path.Join(name, stem)}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+// contentSize returns the decompressed size of the size bytes of f, from its
+// frames or by decoding it if countSize is set, or -1. f is read with ReadAt
+// if it is an io.ReaderAt, entirely otherwise.
+func (fsys *zstdFS) contentSize(f fs.File, size int64) (int64, error) {
+	src, ok := f.(io.ReaderAt)
+	if !ok {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return 0, err
+		}
+		src = bytes.NewReader(data)
+	}
+	if n, known := streamContentSize(src, size); known {
+		return n, nil
+	}
+	if !fsys.countSize {
+		return -1, nil
+	}
+	r := NewReader(io.NewSectionReader(src, 0, size))
+	defer r.Close()
+	return io.Copy(ioutil.Discard, r)
+}
+
+// streamContentSize sums the content sizes declared by the frames of the size
+// bytes of src, found without decoding them. It returns false if a frame does
+// not declare its content size or cannot be found.
+func streamContentSize(src io.ReaderAt, size int64) (int64, bool) {
+	s := frameScanner{src: src, size: size}
+	var total int64
+	for offset := int64(0); offset < size; {
+		frame, skippable, err := s.next(offset)
+		if err != nil {
+			return 0, false
+		}
+		if !skippable {
+			h, err := getFrameHeader(frame)
+			if err != nil || uint64(h.frameContentSize) == uint64(C.ZSTD_CONTENTSIZE_UNKNOWN) {
+				return 0, false
+			}
+			total += int64(h.frameContentSize)
+		}
+		offset += int64(len(frame))
+	}
+	return total, true
+}
+
+// zstdFile is a compressed file of base, served decompressed.
+type zstdFile struct {
+	file fs.File
+	fsys *zstdFS
+	path string
+	info fs.FileInfo
+	r    io.ReadCloser
+	stat fs.FileInfo
+}
+
+func (f *zstdFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+// Stat returns the info of the compressed file, with the name and size of its
+// decompressed content.
+func (f *zstdFile) Stat() (fs.FileInfo, error) {
+	if f.stat != nil {
+		return f.stat, nil
+	}
+	src := f.file
+	if _, ok := src.(io.ReaderAt); !ok {
+		// Reading the file would consume the content served by Read
+		g, err := f.fsys.base.Open(f.path)
+		if err != nil {
+			return nil, err
+		}
+		defer g.Close()
+		src = g
+	}
+	size, err := f.fsys.contentSize(src, f.info.Size())
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: strings.TrimSuffix(f.path, fsSuffix), Err: err}
+	}
+	f.stat = &zstdFileInfo{FileInfo: f.info, name: strings.TrimSuffix(f.info.Name(), fsSuffix), size: size}
+	return f.stat, nil
+}
+
+func (f *zstdFile) Close() error {
+	f.r.Close()
+	return f.file.Close()
+}
+
+// zstdFileInfo is the info of a compressed file, with its decompressed name
+// and size.
+type zstdFileInfo struct {
+	fs.FileInfo
+	name string
+	size int64
+}
+
+func (i *zstdFileInfo) Name() string { return i.name }
+func (i *zstdFileInfo) Size() int64  { return i.size }
+
+// zstdDirEntry is a compressed file listed by ReadDir, under the path it is
+// served as.
+type zstdDirEntry struct {
+	fs.DirEntry
+	fsys *zstdFS
+	path string
+}
+
+func (e *zstdDirEntry) Name() string {
+	return path.Base(e.path)
+}
+
+func (e *zstdDirEntry) Info() (fs.FileInfo, error) {
+	f, err := e.fsys.Open(e.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// zstdDir is a directory of base, listing its entries like zstdFS.ReadDir.
+type zstdDir struct {
+	fs.File
+	fsys    *zstdFS
+	name    string
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *zstdDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
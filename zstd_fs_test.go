@@ -0,0 +1,111 @@
+//go:build cgo && go1.16
+// +build cgo,go1.16
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS(t *testing.T) (fstest.MapFS, map[string][]byte) {
+	content := map[string][]byte{
+		"a.txt":      []byte("plain file"),
+		"b.txt":      bytes.Repeat([]byte("compressed file "), 1000),
+		"dir/c.json": []byte(`{"compressed": "without content size"}`),
+		"dir/d.txt":  []byte("plain file shadowing a compressed one"),
+		"e.zst":      []byte("compressed under its stem"),
+	}
+	b, err := Compress(nil, content["b.txt"])
+	failOnError(t, "Failed to compress", err)
+	dZst, err := Compress(nil, []byte("shadowed"))
+	failOnError(t, "Failed to compress", err)
+	e, err := Compress(nil, content["e.zst"])
+	failOnError(t, "Failed to compress", err)
+	// Shadowed by dir/d.txt, served as is
+	content["dir/d.txt.zst"] = dZst
+	base := fstest.MapFS{
+		"a.txt":          {Data: content["a.txt"]},
+		"b.txt.zst":      {Data: b},
+		"dir/c.json.zst": {Data: writerCompress(t, WriterParams{}, content["dir/c.json"])},
+		"dir/d.txt":      {Data: content["dir/d.txt"]},
+		"dir/d.txt.zst":  {Data: dZst},
+		"e.zst.zst":      {Data: e},
+		"f.zst":          {Mode: fs.ModeDir},
+	}
+	return base, content
+}
+
+func TestFS(t *testing.T) {
+	base, content := testFS(t)
+	fsys := NewFS(base)
+	for name, expected := range content {
+		data, err := fs.ReadFile(fsys, name)
+		failOnError(t, "Failed to read "+name, err)
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("Unexpected content of %s: %q", name, data)
+		}
+	}
+	if err := fstest.TestFS(fsys, "a.txt", "b.txt", "dir/c.json", "dir/d.txt", "dir/d.txt.zst", "e.zst", "f.zst"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := fs.ReadDir(fsys, "dir")
+	failOnError(t, "Failed to read dir", err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if expected := []string{"c.json", "d.txt", "d.txt.zst"}; len(names) != 3 || names[0] != expected[0] || names[1] != expected[1] || names[2] != expected[2] {
+		t.Fatalf("Expected entries %v, got %v", expected, names)
+	}
+
+	_, err = fsys.Open("missing.txt")
+	if pathErr, ok := err.(*fs.PathError); !ok || pathErr.Path != "missing.txt" || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected a not exist error for missing.txt, got %v", err)
+	}
+}
+
+func TestFSStat(t *testing.T) {
+	base, content := testFS(t)
+	for _, count := range []bool{false, true} {
+		var opts []FSOption
+		if count {
+			opts = append(opts, WithCountedSize())
+		}
+		fsys := NewFS(base, opts...)
+
+		info, err := fs.Stat(fsys, "b.txt")
+		failOnError(t, "Failed to stat", err)
+		if info.Name() != "b.txt" || info.Size() != int64(len(content["b.txt"])) {
+			t.Fatalf("Unexpected info %s %d", info.Name(), info.Size())
+		}
+
+		f, err := fsys.Open("dir/c.json")
+		failOnError(t, "Failed to open", err)
+		// Stat does not disturb Read
+		head := make([]byte, 5)
+		_, err = io.ReadFull(f, head)
+		failOnError(t, "Failed to read", err)
+		info, err = f.Stat()
+		failOnError(t, "Failed to stat", err)
+		rest, err := ioutil.ReadAll(f)
+		failOnError(t, "Failed to read", err)
+		f.Close()
+		if data := append(head, rest...); !bytes.Equal(data, content["dir/c.json"]) {
+			t.Fatalf("Unexpected content %q", data)
+		}
+		expected := int64(-1)
+		if count {
+			expected = int64(len(content["dir/c.json"]))
+		}
+		if info.Size() != expected {
+			t.Fatalf("count=%v: expected a size of %d, got %d", count, expected, info.Size())
+		}
+	}
+}
@@ -0,0 +1,199 @@
+//go:build go1.18 && cgo
+// +build go1.18,cgo
+
+package zstd
+
+// Native fuzz targets, e.g.:
+//   go test -run NONE -fuzz FuzzDecompress -fuzztime 1m .
+// The inputs they found are kept in testdata/fuzz and run by go test.
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/colinlyguo/zstd/zstdtest"
+)
+
+// fuzzMaxInput bounds the fuzzed inputs, each byte may decode to up to 32KB
+// with RLE blocks.
+const fuzzMaxInput = 1 << 10
+
+// fuzzMaxSize bounds the decompressed size of the fuzzed inputs.
+const fuzzMaxSize = 64 << 20
+
+// fuzzSeeds returns the payloads of the other tests: golden, legacy,
+// skippable, magicless, truncated and oversized frames.
+func fuzzSeeds(f *testing.F) [][]byte {
+	var seeds [][]byte
+	for _, g := range zstdtest.GoldenFrames() {
+		seeds = append(seeds, g.Frame, g.Frame[:len(g.Frame)/2])
+	}
+	seeds = append(seeds,
+		[]byte("%\xb5/\xfd\x00@\x00\x1bcompressed with legacy zstd\xc0\x00\x00"),
+		[]byte("KLUv/dcwMDAwMDAwMDAwMAAA"),
+		[]byte("(\xb5/\xfd\xd70000000000\x00\x00"),
+		skippableFrame(0, []byte("meta")),
+		[]byte("not zstd"),
+	)
+	compressed, err := Compress(nil, zstdtest.Structured(1, 300))
+	if err != nil {
+		f.Fatal(err)
+	}
+	seeds = append(seeds, compressed, appendSeekTable(append([]byte(nil), compressed...),
+		[][2]uint32{{uint32(len(compressed)), 300}}, false))
+
+	data, err := ioutil.ReadFile("testdata/batch000.hex")
+	if err != nil {
+		f.Fatal(err)
+	}
+	batch, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		f.Fatal(err)
+	}
+	blob, err := CompressScrollBatchBytes(batch[:500])
+	if err != nil {
+		f.Fatal(err)
+	}
+	return append(seeds, blob)
+}
+
+func addSeeds(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+}
+
+func FuzzDecompress(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, src []byte) {
+		if len(src) > fuzzMaxInput {
+			return
+		}
+		opts := DecompressOptions{MaxSize: fuzzMaxSize}
+		out, err := DecompressWithOptions(nil, src, opts)
+		if err != nil {
+			return
+		}
+		// Every path decoding src agrees on the output
+		for _, dst := range [][]byte{make([]byte, 0, len(out)), make([]byte, 1), nil} {
+			again, err := DecompressWithOptions(dst, src, opts)
+			if err != nil || !bytes.Equal(again, out) {
+				t.Fatalf("Decompression into a buffer of capacity %d differs: %v", cap(dst), err)
+			}
+		}
+		// Streams are stricter, they limit the window and libzstd checks the
+		// size of RLE blocks only when streaming, so only their output is
+		// compared
+		streamed, err := ioutil.ReadAll(NewReader(bytes.NewReader(src)))
+		if err == nil && !bytes.Equal(streamed, out) {
+			t.Fatalf("Streamed decompression differs: %v", err)
+		}
+	})
+}
+
+func FuzzDecompressScrollBatch(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, src []byte) {
+		if len(src) > fuzzMaxInput {
+			return
+		}
+		DecompressScrollBatchBytes(src)
+	})
+}
+
+func FuzzDecompressInto(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, src []byte) {
+		if len(src) > fuzzMaxInput {
+			return
+		}
+		for _, size := range []int{0, 1, 1 << 10, 1 << 20} {
+			dst := make([]byte, size)
+			n, err := DecompressInto(dst, src)
+			if err != nil {
+				if tooSmall, ok := err.(*DstSizeTooSmallError); ok && tooSmall.SizeKnown && tooSmall.RequiredSize <= size {
+					t.Fatalf("Required size %d fits in %d bytes", tooSmall.RequiredSize, size)
+				}
+				continue
+			}
+			if n > size {
+				t.Fatalf("Wrote %d bytes into %d", n, size)
+			}
+		}
+		if margin, err := DecompressionMargin(src); err == nil {
+			buf := make([]byte, margin+len(src)+1<<10)
+			copy(buf[len(buf)-len(src):], src)
+			DecompressInPlace(buf, len(src))
+		}
+	})
+}
+
+func FuzzReader(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, src []byte) {
+		if len(src) > fuzzMaxInput {
+			return
+		}
+		var progressed int64
+		r, err := NewReaderOptions(bytes.NewReader(src), WithMaxFrames(64), WithProgress(func(_, written int64) {
+			if written < progressed {
+				t.Fatalf("Progress went back from %d to %d", progressed, written)
+			}
+			progressed = written
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		// Small reads go through the staging buffer, large ones decode in
+		// place
+		for _, size := range []int{1, 100, 1 << 20} {
+			buf := make([]byte, size)
+			for i := 0; i < 4; i++ {
+				n, err := r.Read(buf)
+				if n < 0 || n > size {
+					t.Fatalf("Read returned %d for a %d bytes buffer", n, size)
+				}
+				if err != nil {
+					return
+				}
+			}
+		}
+		io.Copy(ioutil.Discard, io.LimitReader(r, fuzzMaxSize))
+		r.ContentSize()
+	})
+}
+
+func FuzzFrameInspect(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, src []byte) {
+		info, err := Info(src)
+		if err == nil && info.CompressedSize != len(src) {
+			t.Fatalf("Frames cover %d bytes out of %d", info.CompressedSize, len(src))
+		}
+		if size, err := FindFrameCompressedSize(src); err == nil && (size <= 0 || size > len(src)) {
+			t.Fatalf("Frame size %d out of %d bytes", size, len(src))
+		}
+		if frames, err := SplitFrames(src); err == nil {
+			if !bytes.Equal(bytes.Join(frames, nil), src) {
+				t.Fatal("Frames do not add up to the input")
+			}
+			if n, err := FrameCount(src); err != nil || n != len(frames) {
+				t.Fatalf("FrameCount returned %d, %v for %d frames", n, err, len(frames))
+			}
+		}
+		IsSkippableFrame(src)
+		VerifyFrame(src)
+		declaredContentSize(src)
+		seekTableContentSize(src)
+		decompressSizeHint(src)
+		if len(src) > 0 {
+			DecompressionMargin(src)
+			sniffFormat(src)
+		}
+	})
+}
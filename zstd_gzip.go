@@ -0,0 +1,179 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNoGzipHeader is returned by GzipHeaderFromFrame when the frame is not a
+// gzip header frame.
+var ErrNoGzipHeader = errors.New("No gzip header frame")
+
+const (
+	// gzipHeaderMagic is the skippable frame magic number of gzip header
+	// frames, ZSTD_MAGIC_SKIPPABLE_START with variant 0xC
+	gzipHeaderMagic = 0x184D2A5C
+	// gzipHeaderTag starts the content of gzip header frames
+	gzipHeaderTag = "ZGZH"
+	// transcodeBufferSize is the size of the staging buffer between the gzip
+	// decoder and the Writer, ZSTD_CStreamInSize
+	transcodeBufferSize = 128 << 10
+)
+
+// TranscodeOptions holds the options of TranscodeGzipToZstdWithOptions.
+type TranscodeOptions struct {
+	// Level is the compression level, 0 means DefaultCompression
+	Level int
+
+	// GzipHeaders precedes the frame of each gzip member with a skippable
+	// frame holding its header: name, comment, modification time and OS,
+	// read back by GzipHeaderFromFrame. Decoders unaware of it skip it.
+	GzipHeaders bool
+}
+
+// TranscodeStats reports the sizes of a transcoding.
+type TranscodeStats struct {
+	// GzipBytes is the number of bytes read from src
+	GzipBytes int64
+	// ContentBytes is the size of the content
+	ContentBytes int64
+	// ZstdBytes is the number of bytes written to dst
+	ZstdBytes int64
+	// Members is the number of gzip members, each becoming a zstd frame
+	Members int
+}
+
+// TranscodeGzipToZstd converts the gzip stream src to zstd at level, written
+// to dst, decompressing and compressing in a single pass through a shared
+// staging buffer. Each member of a multi-member gzip stream becomes a frame.
+// It returns the number of bytes written to dst.
+func TranscodeGzipToZstd(dst io.Writer, src io.Reader, level int) (int64, error) {
+	stats, err := TranscodeGzipToZstdWithOptions(dst, src, TranscodeOptions{Level: level})
+	return stats.ZstdBytes, err
+}
+
+// TranscodeGzipToZstdWithOptions is like TranscodeGzipToZstd but with options,
+// and reports the sizes of both sides.
+func TranscodeGzipToZstdWithOptions(dst io.Writer, src io.Reader, opts TranscodeOptions) (stats TranscodeStats, err error) {
+	level := opts.Level
+	if level == 0 {
+		level = DefaultCompression
+	}
+	in := &countingReader{r: src}
+	// gzip reads byte by byte from an io.ByteReader, which also keeps it from
+	// reading past a member
+	br := bufio.NewReader(in)
+	out := &countingWriter{w: dst}
+	defer func() {
+		stats.GzipBytes = in.n - int64(br.Buffered())
+		stats.ZstdBytes = out.n
+	}()
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return stats, err
+	}
+	defer gz.Close()
+	buf := make([]byte, transcodeBufferSize)
+	for {
+		gz.Multistream(false)
+		if opts.GzipHeaders {
+			if _, err := out.Write(gzipHeaderFrame(gz.Header)); err != nil {
+				return stats, err
+			}
+		}
+		zw := NewWriterLevel(out, level)
+		n, err := io.CopyBuffer(zw, gz, buf)
+		stats.ContentBytes += n
+		if err == nil {
+			err = zw.Close()
+		} else {
+			zw.Abort()
+		}
+		if err != nil {
+			return stats, err
+		}
+		stats.Members++
+		if err := gz.Reset(br); err == io.EOF {
+			return stats, nil
+		} else if err != nil {
+			return stats, err
+		}
+	}
+}
+
+// gzipHeaderFrame returns the skippable frame holding header: the tag, the
+// modification time in seconds and the OS, then the name and the comment,
+// each preceded by its length.
+func gzipHeaderFrame(header gzip.Header) []byte {
+	content := []byte(gzipHeaderTag)
+	var mtime int64
+	if !header.ModTime.IsZero() {
+		mtime = header.ModTime.Unix()
+	}
+	content = appendUint64(content, uint64(mtime))
+	content = append(content, header.OS)
+	for _, s := range []string{header.Name, header.Comment} {
+		content = appendUint32(content, uint32(len(s)))
+		content = append(content, s...)
+	}
+	frame := make([]byte, 8, 8+len(content))
+	binary.LittleEndian.PutUint32(frame[0:], gzipHeaderMagic)
+	binary.LittleEndian.PutUint32(frame[4:], uint32(len(content)))
+	return append(frame, content...)
+}
+
+// GzipHeaderFromFrame returns the gzip header held by the skippable frame
+// starting src, written by TranscodeGzipToZstdWithOptions with GzipHeaders
+// set. It returns ErrNoGzipHeader if src does not start with such a frame.
+func GzipHeaderFromFrame(src []byte) (gzip.Header, error) {
+	var header gzip.Header
+	if len(src) < 8 || binary.LittleEndian.Uint32(src) != gzipHeaderMagic {
+		return header, ErrNoGzipHeader
+	}
+	size := uint64(binary.LittleEndian.Uint32(src[4:]))
+	if size > uint64(len(src)-8) {
+		return header, ErrFrameTruncated
+	}
+	content := src[8 : 8+size]
+	if len(content) < len(gzipHeaderTag)+9 || string(content[:len(gzipHeaderTag)]) != gzipHeaderTag {
+		return header, ErrNoGzipHeader
+	}
+	content = content[len(gzipHeaderTag):]
+	if mtime := int64(binary.LittleEndian.Uint64(content)); mtime != 0 {
+		header.ModTime = time.Unix(mtime, 0)
+	}
+	header.OS = content[8]
+	content = content[9:]
+	for _, s := range []*string{&header.Name, &header.Comment} {
+		if len(content) < 4 {
+			return header, ErrFrameTruncated
+		}
+		n := uint64(binary.LittleEndian.Uint32(content))
+		if n > uint64(len(content)-4) {
+			return header, ErrFrameTruncated
+		}
+		*s = string(content[4 : 4+n])
+		content = content[4+n:]
+	}
+	return header, nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
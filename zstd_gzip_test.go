@@ -0,0 +1,87 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"time"
+)
+
+func gzipMember(t *testing.T, name string, mtime time.Time, content []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Name = name
+	gz.Comment = "comment of " + name
+	gz.ModTime = mtime
+	_, err := gz.Write(content)
+	failOnError(t, "Failed to write gzip", err)
+	failOnError(t, "Failed to close gzip", gz.Close())
+	return buf.Bytes()
+}
+
+func TestTranscodeGzipToZstd(t *testing.T) {
+	first := bytes.Repeat([]byte("first member "), 50000)
+	second := []byte("second member")
+	mtime := time.Date(2015, 6, 7, 8, 9, 10, 0, time.UTC)
+	src := append(gzipMember(t, "first.txt", mtime, first), gzipMember(t, "second.txt", time.Time{}, second)...)
+
+	var out bytes.Buffer
+	n, err := TranscodeGzipToZstd(&out, bytes.NewReader(src), 3)
+	failOnError(t, "Failed to transcode", err)
+	if n != int64(out.Len()) {
+		t.Fatalf("Reported %d bytes, wrote %d", n, out.Len())
+	}
+	decompressed, err := Decompress(nil, out.Bytes())
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(decompressed, append(first, second...)) {
+		t.Fatal("Transcoded content does not match")
+	}
+	if count, err := FrameCount(out.Bytes()); err != nil || count != 2 {
+		t.Fatalf("Expected a frame per member, got %d %v", count, err)
+	}
+
+	out.Reset()
+	stats, err := TranscodeGzipToZstdWithOptions(&out, bytes.NewReader(src), TranscodeOptions{Level: 3, GzipHeaders: true})
+	failOnError(t, "Failed to transcode", err)
+	expected := TranscodeStats{GzipBytes: int64(len(src)), ContentBytes: int64(len(first) + len(second)), ZstdBytes: int64(out.Len()), Members: 2}
+	if stats != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, stats)
+	}
+	frames, err := SplitFrames(out.Bytes())
+	failOnError(t, "Failed to split frames", err)
+	if len(frames) != 4 {
+		t.Fatalf("Expected 4 frames, got %d", len(frames))
+	}
+	for i, name := range []string{"first.txt", "second.txt"} {
+		header, err := GzipHeaderFromFrame(frames[2*i])
+		failOnError(t, "Failed to read the gzip header", err)
+		if header.Name != name || header.Comment != "comment of "+name {
+			t.Fatalf("Unexpected header %+v", header)
+		}
+		if i == 0 && !header.ModTime.Equal(mtime) || i == 1 && !header.ModTime.IsZero() {
+			t.Fatalf("Unexpected modification time %v", header.ModTime)
+		}
+	}
+	if _, err := GzipHeaderFromFrame(frames[1]); err != ErrNoGzipHeader {
+		t.Fatalf("Expected ErrNoGzipHeader, got %v", err)
+	}
+	decompressed, err = Decompress(nil, out.Bytes())
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(decompressed, append(first, second...)) {
+		t.Fatal("Transcoded content does not match")
+	}
+}
+
+func TestTranscodeGzipToZstdInvalid(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := TranscodeGzipToZstd(&out, bytes.NewReader([]byte("not gzip at all")), 3); err != gzip.ErrHeader {
+		t.Fatalf("Expected gzip.ErrHeader, got %v", err)
+	}
+	member := gzipMember(t, "a", time.Time{}, bytes.Repeat([]byte("a"), 10000))
+	if _, err := TranscodeGzipToZstd(&out, bytes.NewReader(member[:len(member)-10]), 3); err == nil {
+		t.Fatal("Expected an error on a truncated member")
+	}
+}
@@ -0,0 +1,108 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+
+// FrameInfo describes a single frame, as listed by `zstd -l -v`.
+type FrameInfo struct {
+	// Offset is the position of the frame in the archive
+	Offset int
+	// CompressedSize is the size of the frame, header included
+	CompressedSize int
+	// DecompressedSize is the content size, or -1 if the frame header does not
+	// record it. It is 0 for skippable frames.
+	DecompressedSize int64
+	// WindowSize is the memory needed to decompress the frame in streaming
+	// mode
+	WindowSize uint64
+	// DictID is the ID of the dictionary needed to decompress the frame, 0 if
+	// none or not recorded
+	DictID uint32
+	// HasChecksum is whether the frame ends with a checksum of its content
+	HasChecksum bool
+	// Skippable is whether this is a skippable frame holding user data
+	Skippable bool
+}
+
+// ArchiveInfo describes all the frames of a buffer, with totals.
+type ArchiveInfo struct {
+	Frames []FrameInfo
+	// SkippableFrames is the number of skippable frames in Frames
+	SkippableFrames int
+	// CompressedSize is the total size of the frames
+	CompressedSize int
+	// DecompressedSize is the total content size, or -1 if at least one frame
+	// does not record its content size
+	DecompressedSize int64
+	// HasChecksum is whether all the non-skippable frames have a checksum
+	HasChecksum bool
+}
+
+// Ratio returns the compression ratio, or 0 if the decompressed size is
+// unknown or the archive is empty.
+func (a ArchiveInfo) Ratio() float64 {
+	if a.DecompressedSize <= 0 || a.CompressedSize == 0 {
+		return 0
+	}
+	return float64(a.DecompressedSize) / float64(a.CompressedSize)
+}
+
+// Info returns what `zstd -l -v` prints about src, which may contain several
+// concatenated frames including skippable ones. On a truncated or corrupted
+// tail it returns the info about the frames parsed so far and a *FrameError
+// with the offset of the invalid frame.
+func Info(src []byte) (ArchiveInfo, error) {
+	info := ArchiveInfo{HasChecksum: true}
+	for offset := 0; offset < len(src); {
+		frame, err := frameInfo(src[offset:])
+		if err != nil {
+			return info, &FrameError{Offset: offset, Err: err}
+		}
+		frame.Offset = offset
+		info.Frames = append(info.Frames, frame)
+		info.CompressedSize += frame.CompressedSize
+		if frame.Skippable {
+			info.SkippableFrames++
+		} else {
+			info.HasChecksum = info.HasChecksum && frame.HasChecksum
+		}
+		if frame.DecompressedSize < 0 || info.DecompressedSize < 0 {
+			info.DecompressedSize = -1
+		} else {
+			info.DecompressedSize += frame.DecompressedSize
+		}
+		offset += frame.CompressedSize
+	}
+	if len(info.Frames) == info.SkippableFrames {
+		info.HasChecksum = false
+	}
+	return info, nil
+}
+
+// frameInfo describes the frame starting src.
+func frameInfo(src []byte) (FrameInfo, error) {
+	header, err := getFrameHeader(src)
+	if err != nil {
+		return FrameInfo{}, err
+	}
+	size, err := FindFrameCompressedSize(src)
+	if err != nil {
+		return FrameInfo{}, err
+	}
+	frame := FrameInfo{CompressedSize: size}
+	if header.frameType == C.ZSTD_skippableFrame {
+		frame.Skippable = true
+		return frame, nil
+	}
+	frame.WindowSize = uint64(header.windowSize)
+	frame.DictID = uint32(header.dictID)
+	frame.HasChecksum = header.checksumFlag != 0
+	if uint64(header.frameContentSize) == uint64(C.ZSTD_CONTENTSIZE_UNKNOWN) {
+		frame.DecompressedSize = -1
+	} else {
+		frame.DecompressedSize = int64(header.frameContentSize)
+	}
+	return frame, nil
+}
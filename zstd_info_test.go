@@ -0,0 +1,80 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	payload := []byte(strings.Repeat("Hello World! ", 1000))
+	withChecksum, err := CompressWithParams(nil, payload, CParams{Checksum: true})
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	var streamed bytes.Buffer
+	w := NewWriter(&streamed)
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("Failed writing: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close: %s", err)
+	}
+	skippable := skippableFrame(1, []byte("metadata"))
+	src := bytes.Join([][]byte{withChecksum, skippable, streamed.Bytes()}, nil)
+
+	info, err := Info(src)
+	if err != nil {
+		t.Fatalf("Info failed: %s", err)
+	}
+	if len(info.Frames) != 3 || info.SkippableFrames != 1 {
+		t.Fatalf("got %d frames with %d skippable, want 3 with 1", len(info.Frames), info.SkippableFrames)
+	}
+	if info.CompressedSize != len(src) {
+		t.Fatalf("CompressedSize = %d, want %d", info.CompressedSize, len(src))
+	}
+
+	first := info.Frames[0]
+	if first.Offset != 0 || first.CompressedSize != len(withChecksum) ||
+		first.DecompressedSize != int64(len(payload)) || !first.HasChecksum || first.WindowSize == 0 {
+		t.Fatalf("unexpected first frame info %+v", first)
+	}
+	if second := info.Frames[1]; !second.Skippable || second.Offset != len(withChecksum) || second.CompressedSize != len(skippable) {
+		t.Fatalf("unexpected skippable frame info %+v", second)
+	}
+	if third := info.Frames[2]; third.DecompressedSize != -1 || third.HasChecksum {
+		t.Fatalf("unexpected streamed frame info %+v", third)
+	}
+	if info.DecompressedSize != -1 || info.HasChecksum || info.Ratio() != 0 {
+		t.Fatalf("unexpected totals %+v", info)
+	}
+
+	info, err = Info(withChecksum)
+	if err != nil {
+		t.Fatalf("Info failed: %s", err)
+	}
+	if info.DecompressedSize != int64(len(payload)) || !info.HasChecksum || info.Ratio() <= 1 {
+		t.Fatalf("unexpected totals %+v", info)
+	}
+}
+
+func TestInfoTruncatedTail(t *testing.T) {
+	compressed, err := Compress(nil, []byte("Hello World!"))
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	src := append(append([]byte{}, compressed...), compressed[:len(compressed)-1]...)
+
+	info, err := Info(src)
+	var frameErr *FrameError
+	if !errors.As(err, &frameErr) || frameErr.Offset != len(compressed) || frameErr.Err != ErrFrameTruncated {
+		t.Fatalf("expected a truncation FrameError at %d, got %v", len(compressed), err)
+	}
+	if len(info.Frames) != 1 || info.DecompressedSize != int64(len("Hello World!")) {
+		t.Fatalf("expected the info of the first frame, got %+v", info)
+	}
+}
@@ -0,0 +1,113 @@
+package zstd
+
+/*
+#include "zstd.h"
+#include "zstd_errors.h"
+
+// ZSTD_decompressionMargin only exists since zstd 1.5.4, which an external
+// libzstd may predate. The version is checked before calling it.
+static size_t ZSTD_decompressionMargin_compat(const void* src, size_t srcSize) {
+#if ZSTD_VERSION_NUMBER >= 10504
+	return ZSTD_decompressionMargin(src, srcSize);
+#else
+	return (size_t)-ZSTD_error_version_unsupported;
+#endif
+}
+*/
+import "C"
+import "unsafe"
+
+// DecompressionMargin returns the number of bytes by which a buffer must be
+// larger than the decompressed content of src to decompress src in place,
+// i.e. with the compressed data stored in the same buffer as the output,
+// which saves a copy of the payload in memory-constrained services. src may
+// hold several frames, including skippable ones.
+//
+// To decompress in place, allocate a buffer of the decompressed size plus
+// the margin, and copy the compressed data at its very end:
+//
+//	buf := make([]byte, contentSize+margin)
+//	src := buf[len(buf)-len(compressed):]
+//	copy(src, compressed)
+//
+// then decompress src into buf[:contentSize], which the decoder fills from
+// the start without overwriting the input it has not read yet. This only
+// holds for one-shot decompression. The decompressed size must be known
+// upfront, e.g. from the content size declared by the frames.
+//
+// It returns a *VersionError when linked against an external libzstd older
+// than 1.5.4.
+func DecompressionMargin(src []byte) (int, error) {
+	if len(src) == 0 {
+		return 0, ErrEmptySlice
+	}
+	if err := requireVersion("decompression margin", minVersionDecompressionMargin); err != nil {
+		return 0, err
+	}
+	margin := int(C.ZSTD_decompressionMargin_compat(unsafe.Pointer(&src[0]), C.size_t(len(src))))
+	if err := frameError(margin); err != nil {
+		return 0, notZstdError(src, opError("ZSTD_decompressionMargin", len(src), 0, err))
+	}
+	return margin, nil
+}
+
+// DecompressInPlace decompresses the last compressedLen bytes of buf into the
+// start of buf, without allocating, and returns the decompressed content, a
+// prefix of buf. It lays out the buffer as described for
+// DecompressionMargin, which the caller can use to size buf.
+//
+// If the frames declare their content size, DecompressInPlace checks upfront
+// that len(buf) is at least that size plus the margin, and otherwise returns
+// a *DstSizeTooSmallError whose RequiredSize is the length buf needs, leaving
+// buf untouched. If they do not, the content may take up to len(buf) minus
+// the margin, and a larger one fails with a *DstSizeTooSmallError after the
+// compressed data has been partially overwritten. The global limits apply,
+// see SetGlobalLimits.
+func DecompressInPlace(buf []byte, compressedLen int) ([]byte, error) {
+	if err := checkBounds("compressed length", compressedLen, 0, len(buf)); err != nil {
+		return nil, err
+	}
+	if compressedLen == 0 {
+		return nil, ErrEmptySlice
+	}
+	src := buf[len(buf)-compressedLen:]
+	l, err := checkLimits(src)
+	if err != nil {
+		return nil, err
+	}
+	margin, err := DecompressionMargin(src)
+	if err != nil {
+		return nil, err
+	}
+	capacity := len(buf) - margin
+	if size, ok := declaredContentSize(src); ok {
+		if err := l.checkSize(size); err != nil {
+			return nil, err
+		}
+		if capacity < 0 || size > uint64(capacity) {
+			required := uint64(margin) + size
+			if required > uint64(maxInt) {
+				return nil, &DstSizeTooSmallError{}
+			}
+			return nil, &DstSizeTooSmallError{RequiredSize: int(required), SizeKnown: true}
+		}
+		capacity = int(size)
+	} else if capacity < 0 {
+		return nil, &DstSizeTooSmallError{}
+	}
+	limited := l.bound(capacity)
+	n, err := decompressInto(buf[:limited], src)
+	if IsDstSizeTooSmallError(err) {
+		if limited < capacity {
+			return nil, ErrSizeLimitExceeded
+		}
+		return nil, &DstSizeTooSmallError{}
+	}
+	if err != nil {
+		return nil, notZstdError(src, err)
+	}
+	if err := l.checkSize(uint64(n)); err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,147 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecompressionMargin(t *testing.T) {
+	payload := bytes.Repeat([]byte("decompressed in place "), 50000)
+	compressed, err := CompressWithParams(nil, payload, CParams{Level: 3, Checksum: true})
+	failOnError(t, "Failed to compress", err)
+	skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 2, 0, 0, 0, 'h', 'i'}
+
+	for _, src := range [][]byte{compressed, append(append([]byte(nil), skippable...), compressed...)} {
+		margin, err := DecompressionMargin(src)
+		failOnError(t, "Failed to get the margin", err)
+		if margin <= 0 || margin > len(src)+maxBlockSize {
+			t.Fatalf("Unexpected margin %d for %d bytes", margin, len(src))
+		}
+
+		// Lay out the compressed data at the end of a single buffer
+		buf := make([]byte, len(payload)+margin)
+		in := buf[len(buf)-len(src):]
+		copy(in, src)
+		n, err := DecompressInto(buf[:len(payload)], in)
+		failOnError(t, "Failed to decompress in place", err)
+		if !bytes.Equal(buf[:n], payload) {
+			t.Fatal("In place decompression does not match")
+		}
+	}
+
+	if _, err := DecompressionMargin(nil); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+	if _, err := DecompressionMargin([]byte("not zstd")); err != (ErrNotZstd{Detected: "text"}) {
+		t.Fatalf("Expected ErrNotZstd, got %v", err)
+	}
+	if _, err := DecompressionMargin(compressed[:len(compressed)/2]); err == nil {
+		t.Fatal("Expected an error for a truncated frame")
+	}
+}
+
+func TestDecompressInPlace(t *testing.T) {
+	for _, size := range []int{0, 1, 100, 64 << 10, 1 << 20} {
+		payload := bytes.Repeat([]byte("in place "), size/9+1)[:size]
+		compressed, err := Compress(nil, payload)
+		failOnError(t, "Failed to compress", err)
+		margin, err := DecompressionMargin(compressed)
+		failOnError(t, "Failed to get the margin", err)
+
+		// Right at the margin boundary
+		buf := make([]byte, size+margin)
+		copy(buf[len(buf)-len(compressed):], compressed)
+		out, err := DecompressInPlace(buf, len(compressed))
+		failOnError(t, "Failed to decompress in place", err)
+		if !bytes.Equal(out, payload) {
+			t.Fatalf("In place decompression of %d bytes does not match", size)
+		}
+		if size > 0 && &out[0] != &buf[0] {
+			t.Fatal("Expected the output to start at the beginning of the buffer")
+		}
+
+		// One byte short of it, unless the compressed data would not fit
+		if size+margin-1 < len(compressed) {
+			continue
+		}
+		buf = make([]byte, size+margin-1)
+		copy(buf[len(buf)-len(compressed):], compressed)
+		_, err = DecompressInPlace(buf, len(compressed))
+		tooSmall, ok := err.(*DstSizeTooSmallError)
+		if !ok || !tooSmall.SizeKnown || tooSmall.RequiredSize != size+margin {
+			t.Fatalf("Expected a DstSizeTooSmallError requiring %d bytes, got %v", size+margin, err)
+		}
+		if !bytes.Equal(buf[len(buf)-len(compressed):], compressed) {
+			t.Fatal("Expected the buffer to be left untouched")
+		}
+	}
+
+	if _, err := DecompressInPlace(make([]byte, 10), 0); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+	if _, err := DecompressInPlace(make([]byte, 10), 11); err == nil {
+		t.Fatal("Expected an error for a compressed length larger than the buffer")
+	}
+}
+
+func TestDecompressInPlaceUnknownSize(t *testing.T) {
+	payload := bytes.Repeat([]byte("streamed without a content size "), 10000)
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	_, err := w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	compressed := b.Bytes()
+	margin, err := DecompressionMargin(compressed)
+	failOnError(t, "Failed to get the margin", err)
+
+	buf := make([]byte, len(payload)+margin+100)
+	copy(buf[len(buf)-len(compressed):], compressed)
+	out, err := DecompressInPlace(buf, len(compressed))
+	failOnError(t, "Failed to decompress in place", err)
+	if !bytes.Equal(out, payload) {
+		t.Fatal("In place decompression does not match")
+	}
+
+	buf = make([]byte, len(payload)+margin-1)
+	copy(buf[len(buf)-len(compressed):], compressed)
+	if _, err := DecompressInPlace(buf, len(compressed)); !IsDstSizeTooSmallError(err) {
+		t.Fatalf("Expected a DstSizeTooSmallError, got %v", err)
+	}
+}
+
+func BenchmarkDecompressInPlace(b *testing.B) {
+	payload := bytes.Repeat([]byte("benchmark in place "), (1<<20)/19)
+	compressed, err := Compress(nil, payload)
+	if err != nil {
+		b.Fatal(err)
+	}
+	margin, err := DecompressionMargin(compressed)
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := make([]byte, len(payload)+margin)
+
+	b.Run("Decompress", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			if _, err := Decompress(nil, compressed); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("DecompressInPlace", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			copy(buf[len(buf)-len(compressed):], compressed)
+			if _, err := DecompressInPlace(buf, len(compressed)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
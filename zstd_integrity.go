@@ -0,0 +1,171 @@
+package zstd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// HashAlgorithm identifies the hash of an integrity frame.
+type HashAlgorithm uint8
+
+// Hash algorithms supported in integrity frames. The values are written in
+// the frames and must not change.
+const (
+	HashKeccak256 HashAlgorithm = 1
+	HashSHA256    HashAlgorithm = 2
+	// HashXXH64 is not cryptographic, it only detects accidental corruption.
+	// It requires the C library.
+	HashXXH64 HashAlgorithm = 3
+)
+
+// newXXH64Hash returns the XXH64 implementation bundled with libzstd, it is
+// nil when built without cgo.
+var newXXH64Hash func() hash.Hash
+
+func (a HashAlgorithm) String() string {
+	switch a {
+	case HashKeccak256:
+		return "keccak256"
+	case HashSHA256:
+		return "sha256"
+	case HashXXH64:
+		return "xxh64"
+	}
+	return fmt.Sprintf("HashAlgorithm(%d)", int(a))
+}
+
+func (a HashAlgorithm) new() (hash.Hash, error) {
+	switch a {
+	case HashKeccak256:
+		return sha3.NewLegacyKeccak256(), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashXXH64:
+		if newXXH64Hash != nil {
+			return newXXH64Hash(), nil
+		}
+	}
+	return nil, fmt.Errorf("zstd: unsupported integrity hash %s", a)
+}
+
+// ErrNoIntegrity is returned when verifying data which does not start with an
+// integrity frame.
+var ErrNoIntegrity = errors.New("No integrity frame")
+
+// IntegrityError is returned when the digest of the decompressed data does
+// not match the one of its integrity frame.
+type IntegrityError struct {
+	Algorithm HashAlgorithm
+	Expected  []byte
+	Actual    []byte
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("zstd: %s digest mismatch: expected %x, got %x", e.Algorithm, e.Expected, e.Actual)
+}
+
+const (
+	// integrityMagic is the skippable frame magic number of integrity
+	// frames, ZSTD_MAGIC_SKIPPABLE_START with variant 0xE
+	integrityMagic = 0x184D2A5E
+	// integrityTag starts the content of integrity frames, to tell them
+	// apart from other skippable frames using the same variant
+	integrityTag = "ZINT"
+)
+
+// WriteWithIntegrity compresses src at level and writes it to w preceded by a
+// skippable frame carrying the keccak256 of src, so that any holder of the
+// output can verify it with VerifyIntegrity or DecompressVerified. Decoders
+// unaware of it, including the zstd command line tool, skip the frame.
+//
+// The integrity frame holds the tag "ZINT", then the hash algorithm and
+// digest length on a byte each, then the digest.
+func WriteWithIntegrity(w io.Writer, src []byte, level int) error {
+	return writeWithIntegrity(w, src, level, HashKeccak256)
+}
+
+func writeWithIntegrity(w io.Writer, src []byte, level int, alg HashAlgorithm) error {
+	h, err := alg.new()
+	if err != nil {
+		return err
+	}
+	h.Write(src)
+	digest := h.Sum(nil)
+
+	content := append([]byte(integrityTag), byte(alg), byte(len(digest)))
+	content = append(content, digest...)
+	frame := make([]byte, 8, 8+len(content))
+	binary.LittleEndian.PutUint32(frame[0:], integrityMagic)
+	binary.LittleEndian.PutUint32(frame[4:], uint32(len(content)))
+	frame = append(frame, content...)
+
+	compressed, err := CompressLevel(nil, src, level)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(frame); err != nil {
+		return err
+	}
+	_, err = w.Write(compressed)
+	return err
+}
+
+// parseIntegrityFrame returns the hash algorithm and digest of the integrity
+// frame starting src, and the size of the frame.
+func parseIntegrityFrame(src []byte) (HashAlgorithm, []byte, int, error) {
+	if len(src) < 8 || binary.LittleEndian.Uint32(src) != integrityMagic {
+		return 0, nil, 0, ErrNoIntegrity
+	}
+	size := int(binary.LittleEndian.Uint32(src[4:]))
+	if size > len(src)-8 {
+		return 0, nil, 0, ErrFrameTruncated
+	}
+	content := src[8 : 8+size]
+	if len(content) < len(integrityTag)+2 || !bytes.Equal(content[:len(integrityTag)], []byte(integrityTag)) {
+		return 0, nil, 0, ErrNoIntegrity
+	}
+	alg := HashAlgorithm(content[len(integrityTag)])
+	digest := content[len(integrityTag)+2:]
+	if int(content[len(integrityTag)+1]) != len(digest) {
+		return 0, nil, 0, ErrFrameTruncated
+	}
+	return alg, digest, 8 + size, nil
+}
+
+// DecompressVerified decompresses data written by WriteWithIntegrity into
+// dst like Decompress, and checks its digest against the integrity frame. It
+// returns ErrNoIntegrity if src does not start with an integrity frame, and
+// an *IntegrityError if the digest does not match.
+func DecompressVerified(dst, src []byte) ([]byte, error) {
+	alg, expected, n, err := parseIntegrityFrame(src)
+	if err != nil {
+		return nil, err
+	}
+	h, err := alg.new()
+	if err != nil {
+		return nil, err
+	}
+	out, err := Decompress(dst, src[n:])
+	if err != nil {
+		return nil, err
+	}
+	h.Write(out)
+	if actual := h.Sum(nil); !bytes.Equal(actual, expected) {
+		return nil, &IntegrityError{Algorithm: alg, Expected: append([]byte(nil), expected...), Actual: actual}
+	}
+	return out, nil
+}
+
+// VerifyIntegrity is like DecompressVerified but only reports whether the
+// data matches its integrity frame.
+func VerifyIntegrity(src []byte) error {
+	_, err := DecompressVerified(nil, src)
+	return err
+}
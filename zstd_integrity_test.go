@@ -0,0 +1,97 @@
+package zstd
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+func TestWriteWithIntegrity(t *testing.T) {
+	src := bytes.Repeat([]byte("Hello, World! "), 1000)
+	algs := []HashAlgorithm{HashKeccak256, HashSHA256}
+	if newXXH64Hash != nil {
+		algs = append(algs, HashXXH64)
+	}
+	for _, alg := range algs {
+		var buf bytes.Buffer
+		if err := writeWithIntegrity(&buf, src, DefaultCompression, alg); err != nil {
+			t.Fatalf("Failed to write: %s", err)
+		}
+
+		out, err := DecompressVerified(nil, buf.Bytes())
+		if err != nil {
+			t.Fatalf("Failed to decompress: %s", err)
+		}
+		if !bytes.Equal(out, src) {
+			t.Fatalf("%s: round trip does not match", alg)
+		}
+		if err := VerifyIntegrity(buf.Bytes()); err != nil {
+			t.Fatalf("Failed to verify: %s", err)
+		}
+
+		// Decoders unaware of the integrity frame skip it
+		out, err = Decompress(nil, buf.Bytes())
+		if err != nil {
+			t.Fatalf("Failed to decompress: %s", err)
+		}
+		if !bytes.Equal(out, src) {
+			t.Fatalf("%s: plain decompression does not match", alg)
+		}
+	}
+}
+
+func TestWriteWithIntegrityKeccak(t *testing.T) {
+	src := []byte("Hello, World!")
+	var buf bytes.Buffer
+	if err := WriteWithIntegrity(&buf, src, DefaultCompression); err != nil {
+		t.Fatalf("Failed to write: %s", err)
+	}
+	alg, digest, _, err := parseIntegrityFrame(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse: %s", err)
+	}
+	h := sha3.NewLegacyKeccak256()
+	h.Write(src)
+	if alg != HashKeccak256 || !bytes.Equal(digest, h.Sum(nil)) {
+		t.Fatalf("Expected the keccak256 of src, got %s %x", alg, digest)
+	}
+}
+
+func TestVerifyIntegrityErrors(t *testing.T) {
+	src := []byte("Hello, World!")
+	var buf bytes.Buffer
+	if err := WriteWithIntegrity(&buf, src, DefaultCompression); err != nil {
+		t.Fatalf("Failed to write: %s", err)
+	}
+	data := buf.Bytes()
+
+	// Altered digest
+	tampered := append([]byte(nil), data...)
+	tampered[20] ^= 1
+	err := VerifyIntegrity(tampered)
+	if ierr, ok := err.(*IntegrityError); !ok || ierr.Algorithm != HashKeccak256 || bytes.Equal(ierr.Expected, ierr.Actual) {
+		t.Fatalf("Expected an *IntegrityError, got %v", err)
+	}
+
+	// Data without integrity frame
+	plain, err := Compress(nil, src)
+	if err != nil {
+		t.Fatalf("Failed to compress: %s", err)
+	}
+	if err := VerifyIntegrity(plain); err != ErrNoIntegrity {
+		t.Fatalf("Expected ErrNoIntegrity, got %v", err)
+	}
+
+	// Truncated integrity frame
+	if err := VerifyIntegrity(data[:20]); err != ErrFrameTruncated {
+		t.Fatalf("Expected ErrFrameTruncated, got %v", err)
+	}
+
+	// Unknown algorithm
+	unknown := append([]byte(nil), data...)
+	unknown[12] = 0xff
+	if err := VerifyIntegrity(unknown); err == nil {
+		t.Fatal("Expected an error for an unknown algorithm")
+	}
+}
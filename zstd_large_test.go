@@ -0,0 +1,112 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"testing"
+)
+
+// largePayloadEnv enables the tests of payloads larger than 2GiB, which need
+// about 4GB of memory.
+const largePayloadEnv = "ENABLE_LARGE_PAYLOAD_TESTS"
+
+// largePayload returns a payload of size bytes, zeros but for markers around
+// the offsets at which 32-bit sizes overflow. The zeros are not backed by
+// memory until written.
+func largePayload(t *testing.T, size int) []byte {
+	if os.Getenv(largePayloadEnv) == "" {
+		t.Skipf("Set %s to run the tests of payloads larger than 2GiB", largePayloadEnv)
+	}
+	if strconv.IntSize < 64 {
+		t.Skip("Payloads larger than 2GiB need a 64-bit platform")
+	}
+	// Give back the memory of the previous tests
+	debug.FreeOSMemory()
+	payload := make([]byte, size)
+	for i, offset := range []int{0, 1<<31 - 1, 1 << 31, 1<<32 - 1, 1 << 32, size - 1} {
+		if offset < size {
+			payload[offset] = byte(i + 1)
+		}
+	}
+	return payload
+}
+
+func TestLargePayload(t *testing.T) {
+	const size = 3 << 30
+	payload := largePayload(t, size)
+	compressed, err := CompressLevel(nil, payload, BestSpeed)
+	failOnError(t, "Failed to compress", err)
+	if size, ok := declaredContentSize(compressed); !ok || size != uint64(len(payload)) {
+		t.Fatalf("Expected the content size %d, got %d", len(payload), size)
+	}
+
+	dst := make([]byte, len(payload))
+	out, err := Decompress(dst, compressed)
+	failOnError(t, "Failed to decompress", err)
+	if len(out) != len(payload) || &out[0] != &dst[0] || !bytes.Equal(out, payload) {
+		t.Fatalf("Decompress returned %d bytes, differing from the payload", len(out))
+	}
+	for i := range dst {
+		dst[i] = 0xff
+	}
+	n, err := DecompressInto(dst, compressed)
+	failOnError(t, "Failed to decompress into", err)
+	if n != len(payload) || !bytes.Equal(dst, payload) {
+		t.Fatalf("DecompressInto returned %d bytes, differing from the payload", n)
+	}
+	var sizeErr *DstSizeTooSmallError
+	if _, err := DecompressInto(dst[:len(dst)-1], compressed); !errors.As(err, &sizeErr) || sizeErr.RequiredSize != len(payload) {
+		t.Fatalf("Expected a DstSizeTooSmallError requiring %d bytes, got %v", len(payload), err)
+	}
+}
+
+func TestLargePayloadStream(t *testing.T) {
+	const size = 3 << 30
+	payload := largePayload(t, size)
+	var b bytes.Buffer
+	w := NewWriterLevel(&b, BestSpeed)
+	n, err := w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	if n != len(payload) || w.Stats().BytesIn != int64(len(payload)) {
+		t.Fatalf("Expected to write %d bytes, wrote %d", len(payload), n)
+	}
+	compressed := b.Bytes()
+	w = nil // Its buffer is as large as the payload
+	debug.FreeOSMemory()
+
+	r, err := NewReaderOptions(bytes.NewReader(compressed))
+	failOnError(t, "Failed to create the reader", err)
+	buf := make([]byte, 1<<20)
+	var offset int
+	for {
+		n, err := r.Read(buf)
+		if !bytes.Equal(buf[:n], payload[offset:offset+n]) {
+			t.Fatalf("The output differs from the payload at %d", offset)
+		}
+		offset += n
+		if err == io.EOF {
+			break
+		}
+		failOnError(t, "Failed to read", err)
+	}
+	if offset != len(payload) || r.OutputOffset() != int64(len(payload)) || r.InputOffset() != int64(len(compressed)) {
+		t.Fatalf("Expected %d bytes, read %d, offsets %d and %d", len(payload), offset, r.OutputOffset(), r.InputOffset())
+	}
+
+	failOnError(t, "Failed to close the reader", r.Close())
+	debug.FreeOSMemory()
+	dst := make([]byte, len(payload))
+	n, err = DecompressFromReaderInto(dst, bytes.NewReader(compressed))
+	failOnError(t, "Failed to decompress from the reader", err)
+	if n != len(payload) || !bytes.Equal(dst, payload) {
+		t.Fatalf("DecompressFromReaderInto returned %d bytes, differing from the payload", n)
+	}
+}
@@ -0,0 +1,117 @@
+package zstd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is a compression level. Besides the named levels below, any level
+// supported by libzstd can be used, including negative ones which trade ratio
+// for speed. Convert it with int(level) to pass it to functions taking an int.
+type Level int
+
+// Named levels, mapped onto concrete libzstd levels
+const (
+	SpeedFastest Level = BestSpeed
+	SpeedDefault Level = DefaultCompression
+	SpeedBetter  Level = 11
+	SpeedBest    Level = BestCompression
+)
+
+// Bounds of the compression levels of the vendored libzstd, see
+// ZSTD_minCLevel and ZSTD_maxCLevel. Levels are validated against
+// levelBounds, which asks the linked libzstd when built with cgo.
+const (
+	minLevel = -(1 << 17) // -ZSTD_TARGETLENGTH_MAX
+	maxLevel = 22         // ZSTD_MAX_CLEVEL
+)
+
+var levelNames = map[Level]string{
+	SpeedFastest: "fastest",
+	SpeedDefault: "default",
+	SpeedBetter:  "better",
+	SpeedBest:    "best",
+}
+
+// String returns the name of a named level, or the level as a number.
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return strconv.Itoa(int(l))
+}
+
+// ParseLevel parses a level name, as returned by Level.String, or a numeral.
+// Names are case insensitive. A numeral outside of the levels supported by
+// libzstd returns a *ParameterBoundsError.
+func ParseLevel(s string) (Level, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	for l, n := range levelNames {
+		if n == name {
+			return l, nil
+		}
+	}
+	n, err := strconv.Atoi(name)
+	if err != nil {
+		return 0, fmt.Errorf("zstd: invalid level %q", s)
+	}
+	min, max := levelBounds()
+	if err := checkBounds("compressionLevel", n, min, max); err != nil {
+		return 0, err
+	}
+	return Level(n), nil
+}
+
+// Set implements flag.Value so that a Level can be used as a command line
+// flag with flag.Var.
+func (l *Level) Set(s string) error {
+	level, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler so that a Level can be
+// read from configuration files by name or number.
+func (l *Level) UnmarshalText(text []byte) error {
+	return l.Set(string(text))
+}
+
+// CompressWithLevel is CompressLevel taking a Level.
+func CompressWithLevel(dst, src []byte, level Level) ([]byte, error) {
+	return CompressLevel(dst, src, int(level))
+}
+
+// defaultLevel is the level of Compress, see SetDefaultCompressionLevel
+var defaultLevel int32 = DefaultCompression
+
+// SetDefaultCompressionLevel changes the level of Compress and Ctx.Compress
+// for the whole program, e.g. from configuration, instead of
+// DefaultCompression. It can be called while compressions run, which use
+// either the previous or the new level. A level outside of the levels
+// supported by libzstd returns a *ParameterBoundsError.
+//
+// It does not affect CompressScrollBatchBytes, whose level is part of the
+// protocol, nor the functions taking a level or CParams.
+func SetDefaultCompressionLevel(level int) error {
+	min, max := levelBounds()
+	if err := checkBounds("compressionLevel", level, min, max); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&defaultLevel, int32(level))
+	return nil
+}
+
+// DefaultLevel returns the level of Compress, see SetDefaultCompressionLevel.
+func DefaultLevel() int {
+	return int(atomic.LoadInt32(&defaultLevel))
+}
@@ -0,0 +1,174 @@
+package zstd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Level
+	}{
+		{"fastest", SpeedFastest},
+		{"Default", SpeedDefault},
+		{" better ", SpeedBetter},
+		{"BEST", SpeedBest},
+		{"3", Level(3)},
+		{"-5", Level(-5)},
+		{"22", Level(22)},
+	} {
+		got, err := ParseLevel(tc.in)
+		if err != nil {
+			t.Fatalf("ParseLevel(%q) failed: %s", tc.in, err)
+		}
+		if got != tc.want {
+			t.Fatalf("ParseLevel(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "fast", "1.5", "23", "-200000"} {
+		if _, err := ParseLevel(in); err == nil {
+			t.Fatalf("ParseLevel(%q) should fail", in)
+		}
+	}
+	_, err := ParseLevel("23")
+	if e, ok := err.(*ParameterBoundsError); !ok || e.Max != 22 {
+		t.Fatalf("expected a ParameterBoundsError, got %v", err)
+	}
+}
+
+func TestLevelString(t *testing.T) {
+	for _, l := range []Level{SpeedFastest, SpeedDefault, SpeedBetter, SpeedBest, 3, -7} {
+		parsed, err := ParseLevel(l.String())
+		if err != nil || parsed != l {
+			t.Fatalf("level %d does not round trip through %q: %d, %v", int(l), l.String(), parsed, err)
+		}
+	}
+	if SpeedBest.String() != "best" || Level(3).String() != "3" {
+		t.Fatalf("unexpected names %q and %q", SpeedBest, Level(3))
+	}
+}
+
+func TestLevelFlag(t *testing.T) {
+	level := SpeedDefault
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&level, "level", "compression level")
+	if err := fs.Parse([]string{"-level", "better"}); err != nil {
+		t.Fatalf("failed to parse flags: %s", err)
+	}
+	if level != SpeedBetter {
+		t.Fatalf("expected level %d, got %d", SpeedBetter, level)
+	}
+
+	var fromText Level
+	if err := fromText.UnmarshalText([]byte("7")); err != nil || fromText != 7 {
+		t.Fatalf("UnmarshalText failed: %d, %v", fromText, err)
+	}
+}
+
+func TestCompressWithLevel(t *testing.T) {
+	src := bytes.Repeat([]byte("Hello, World! "), 1000)
+	got, err := CompressWithLevel(nil, src, SpeedBetter)
+	if err != nil {
+		t.Fatalf("failed to compress: %s", err)
+	}
+	want, err := CompressLevel(nil, src, int(SpeedBetter))
+	if err != nil {
+		t.Fatalf("failed to compress: %s", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("CompressWithLevel output differs from CompressLevel")
+	}
+}
+
+func TestSetDefaultCompressionLevel(t *testing.T) {
+	if DefaultLevel() != DefaultCompression {
+		t.Fatalf("Expected the default level %d, got %d", DefaultCompression, DefaultLevel())
+	}
+	defer SetDefaultCompressionLevel(DefaultCompression)
+
+	payload := bytes.Repeat([]byte("the default level is read by every Compress, "), 20000)
+	for i := range payload {
+		payload[i] += byte(i % 7)
+	}
+	expected := make(map[string]int)
+	for _, level := range []int{BestSpeed, 19} {
+		compressed, err := CompressLevel(nil, payload, level)
+		if err != nil {
+			t.Fatalf("Error while compressing: %s", err)
+		}
+		expected[string(compressed)] = level
+	}
+	if len(expected) != 2 {
+		t.Fatalf("Expected the levels to give different frames")
+	}
+
+	// Compressions running while the level changes use either level
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	errs := make(chan error, 4)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				compressed, err := Compress(nil, payload)
+				if err == nil {
+					if _, ok := expected[string(compressed)]; !ok {
+						err = fmt.Errorf("frame of %d bytes from neither level", len(compressed))
+					}
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		level := BestSpeed
+		if i%2 == 1 {
+			level = 19
+		}
+		if err := SetDefaultCompressionLevel(level); err != nil {
+			t.Fatalf("Error while setting level %d: %s", level, err)
+		}
+		if DefaultLevel() != level {
+			t.Fatalf("Expected level %d, got %d", level, DefaultLevel())
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Error while compressing: %s", err)
+	}
+
+	// The last level set is used
+	compressed, err := Compress(nil, payload)
+	if err != nil {
+		t.Fatalf("Error while compressing: %s", err)
+	}
+	if expected[string(compressed)] != 19 {
+		t.Fatalf("Expected a frame of level 19")
+	}
+
+	min, max := levelBounds()
+	for _, level := range []int{max + 1, min - 1} {
+		if _, ok := SetDefaultCompressionLevel(level).(*ParameterBoundsError); !ok {
+			t.Fatalf("Expected a *ParameterBoundsError for level %d", level)
+		}
+	}
+	if DefaultLevel() != 19 {
+		t.Fatalf("Expected invalid levels to be ignored, got %d", DefaultLevel())
+	}
+}
@@ -0,0 +1,131 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrLegacyFrame is returned when decoding a frame of a zstd version older
+// than 0.8 while Limits.DenyLegacy is set.
+var ErrLegacyFrame = errors.New("Legacy frames are not allowed")
+
+// ErrDictionaryFrame is returned when decoding a frame whose header records a
+// dictionary ID while Limits.DenyDictionary is set.
+var ErrDictionaryFrame = errors.New("Frames compressed with a dictionary are not allowed")
+
+// Limits is a policy of decode limits, set for the whole program with
+// SetGlobalLimits, e.g. by services decoding untrusted input. The zero value
+// of a field means no limit.
+type Limits struct {
+	// MaxWindowLog rejects frames whose window is larger than 1<<MaxWindowLog
+	// bytes with ErrWindowTooLarge, see DecompressOptions.MaxWindowLog
+	MaxWindowLog int
+
+	// MaxSize rejects payloads and streams decompressing to more than
+	// MaxSize bytes with ErrSizeLimitExceeded
+	MaxSize int
+
+	// MaxFrames rejects inputs of more than MaxFrames frames, including
+	// skippable ones, with ErrTooManyFrames
+	MaxFrames int
+
+	// DenyLegacy rejects the frames of zstd versions older than 0.8 with
+	// ErrLegacyFrame
+	DenyLegacy bool
+
+	// DenyDictionary rejects the frames whose header records a dictionary
+	// ID with ErrDictionaryFrame. Frames compressed with a raw content
+	// dictionary carry no ID and are not detected.
+	DenyDictionary bool
+}
+
+// globalLimits holds the Limits set by SetGlobalLimits.
+var globalLimits atomic.Value
+
+// SetGlobalLimits sets the decode limits applied by every decoder of the
+// package: Decompress and its variants, the Reader, the contexts such as Ctx,
+// DCtx and BulkProcessor, and the functions decoding files, buffers and
+// streams such as DecompressFile or DecompressParallelStream. The limits of
+// DecompressOptions and of the ReaderOption can only tighten the global ones:
+// the lowest limit applies. It affects the Readers created afterwards.
+//
+// Decoders writing their output as they go, such as DecompressVectored or
+// DCtx.DecompressTo, may have written part of it when they return
+// ErrSizeLimitExceeded.
+func SetGlobalLimits(l Limits) {
+	globalLimits.Store(l)
+}
+
+// GlobalLimits returns the limits set by SetGlobalLimits.
+func GlobalLimits() Limits {
+	l, _ := globalLimits.Load().(Limits)
+	return l
+}
+
+// tighten returns the lowest of the limits a and b, 0 meaning no limit.
+func tighten(a, b int) int {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// withLimits returns the options tightened by the limits l. The options must
+// have their defaults applied.
+func (o DecompressOptions) withLimits(l Limits) DecompressOptions {
+	o.MaxWindowLog = tighten(o.MaxWindowLog, l.MaxWindowLog)
+	o.MaxSize = tighten(o.MaxSize, l.MaxSize)
+	o.MaxFrames = tighten(o.MaxFrames, l.MaxFrames)
+	o.DenyLegacy = o.DenyLegacy || l.DenyLegacy
+	o.DenyDictionary = o.DenyDictionary || l.DenyDictionary
+	return o
+}
+
+// checkFrameHeader returns the error of l for the frame starting with header,
+// which may be a prefix of its header. It returns nil as long as the header
+// is too short to tell.
+func (l Limits) checkFrameHeader(header []byte) error {
+	if l.DenyLegacy && len(header) >= 4 && isLegacyFrame(header) {
+		return ErrLegacyFrame
+	}
+	if l.DenyDictionary {
+		if h, err := getFrameHeader(header); err == nil && h.dictID != 0 {
+			return ErrDictionaryFrame
+		}
+	}
+	return nil
+}
+
+// checkLimits returns the global limits and their error for src, decoded in
+// one shot by a decoder taking no options. The size of the output is left to
+// the caller, see Limits.bound and Limits.checkSize.
+func checkLimits(src []byte) (Limits, error) {
+	l := GlobalLimits()
+	return l, DecompressOptions{}.withLimits(l).check(src)
+}
+
+// bound returns n bounded to one more byte than MaxSize, which tells outputs
+// exceeding the limit apart.
+func (l Limits) bound(n int) int {
+	if l.MaxSize > 0 && l.MaxSize < maxInt && n > l.MaxSize+1 {
+		return l.MaxSize + 1
+	}
+	return n
+}
+
+// checkSize returns ErrSizeLimitExceeded if an output of n bytes exceeds
+// MaxSize.
+func (l Limits) checkSize(n uint64) error {
+	if l.MaxSize > 0 && n > uint64(l.MaxSize) {
+		return ErrSizeLimitExceeded
+	}
+	return nil
+}
+
+// limits returns the frame checks of the options as Limits.
+func (o DecompressOptions) limits() Limits {
+	return Limits{DenyLegacy: o.DenyLegacy, DenyDictionary: o.DenyDictionary}
+}
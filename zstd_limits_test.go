@@ -0,0 +1,158 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// decodeAll decompresses src, of size bytes once decompressed, with every API
+// honoring the global limits and returns their errors by name.
+func decodeAll(t *testing.T, src []byte, size int, opts DecompressOptions, readerOpts ...ReaderOption) map[string]error {
+	errs := map[string]error{}
+	_, errs["Decompress"] = Decompress(nil, src)
+	_, errs["DecompressInto"] = DecompressInto(make([]byte, size), src)
+	_, errs["DecompressWithOptions"] = DecompressWithOptions(nil, src, opts)
+	_, errs["DecompressIntoWithOptions"] = DecompressIntoWithOptions(make([]byte, size), src, opts)
+	_, errs["Reader"] = ioutil.ReadAll(NewReader(bytes.NewReader(src)))
+	r, err := NewReaderOptions(bytes.NewReader(src), readerOpts...)
+	if err == nil {
+		_, err = ioutil.ReadAll(r)
+		r.Close()
+	}
+	errs["NewReaderOptions"] = err
+
+	_, errs["Ctx"] = NewCtx().Decompress(nil, src)
+	p, err := NewBulkProcessor(dict, BestSpeed)
+	failOnError(t, "Failed to create the bulk processor", err)
+	_, errs["BulkProcessor"] = p.Decompress(nil, src)
+	_, errs["DecompressVectored"] = DecompressVectored([][]byte{make([]byte, size/2), make([]byte, size-size/2)}, src)
+	buf := make([]byte, size+len(src)+maxBlockSize)
+	copy(buf[len(buf)-len(src):], src)
+	_, errs["DecompressInPlace"] = DecompressInPlace(buf, len(src))
+	_, errs["DecompressFromReaderInto"] = DecompressFromReaderInto(make([]byte, size), bytes.NewReader(src))
+	errs["DecompressBuffer"] = DecompressBuffer(new(bytes.Buffer), src)
+	errs["DecompressParallelStream"] = DecompressParallelStream(ioutil.Discard, bytes.NewReader(src), int64(len(src)), 2)
+
+	f, err := ioutil.TempFile("", "limits*.zst")
+	failOnError(t, "Failed to create the file", err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(src)
+	failOnError(t, "Failed to write the file", err)
+	failOnError(t, "Failed to close the file", f.Close())
+	_, errs["DecompressFile"] = DecompressFile(f.Name())
+	_, errs["DecompressFileInto"] = DecompressFileInto(make([]byte, size), f.Name())
+	return errs
+}
+
+func TestGlobalLimits(t *testing.T) {
+	defer SetGlobalLimits(Limits{})
+	payload := bytes.Repeat([]byte("Hello World! "), 1000)
+	largeWindow := writerCompress(t, largeWindowParams, payload)
+	frame, err := Compress(nil, payload)
+	failOnError(t, "Error while compressing", err)
+	threeFrames := append(append(append([]byte{}, frame...), frame...), frame...)
+	legacy := []byte("%\xb5/\xfd\x00@\x00\x1bcompressed with legacy zstd\xc0\x00\x00")
+
+	for _, test := range []struct {
+		name       string
+		limits     Limits
+		src        []byte
+		size       int
+		opts       DecompressOptions
+		readerOpts []ReaderOption
+		want       error
+	}{
+		// The per-call limits cannot loosen the global ones
+		{"window", Limits{MaxWindowLog: 20}, largeWindow, len(payload),
+			DecompressOptions{MaxWindowLog: 24}, []ReaderOption{WithMaxWindowLog(24)}, ErrWindowTooLarge},
+		{"size", Limits{MaxSize: 1000}, frame, len(payload),
+			DecompressOptions{MaxSize: 1 << 20}, nil, ErrSizeLimitExceeded},
+		{"frames", Limits{MaxFrames: 2}, threeFrames, 3 * len(payload),
+			DecompressOptions{MaxFrames: -1}, []ReaderOption{WithMaxFrames(10)}, ErrTooManyFrames},
+		{"dictionary", Limits{DenyDictionary: true}, compressedPayload, 1000,
+			DecompressOptions{}, nil, ErrDictionaryFrame},
+	} {
+		SetGlobalLimits(test.limits)
+		if GlobalLimits() != test.limits {
+			t.Fatalf("%s: expected the limits %+v, got %+v", test.name, test.limits, GlobalLimits())
+		}
+		for api, err := range decodeAll(t, test.src, test.size, test.opts, test.readerOpts...) {
+			if err != test.want {
+				t.Fatalf("%s: %s returned %v, want %v", test.name, api, err, test.want)
+			}
+		}
+	}
+
+	// The limits apply to the whole input decoded in parallel, not to each
+	// of its frames
+	SetGlobalLimits(Limits{MaxSize: 2 * len(payload)})
+	if err := DecompressParallelStream(ioutil.Discard, bytes.NewReader(threeFrames), int64(len(threeFrames)), 2); err != ErrSizeLimitExceeded {
+		t.Fatalf("DecompressParallelStream returned %v, want ErrSizeLimitExceeded", err)
+	}
+
+	if hasLegacySupport() {
+		SetGlobalLimits(Limits{DenyLegacy: true})
+		for api, err := range decodeAll(t, legacy, 100, DecompressOptions{}) {
+			if err != ErrLegacyFrame {
+				t.Fatalf("%s returned %v for a legacy frame, want ErrLegacyFrame", api, err)
+			}
+		}
+	}
+
+	// The per-call limits can tighten the global ones
+	SetGlobalLimits(Limits{MaxFrames: 10, MaxSize: 1 << 20})
+	tighter := DecompressOptions{MaxFrames: 2, MaxSize: 100, DenyDictionary: true}
+	if _, err := DecompressWithOptions(nil, threeFrames, tighter); err != ErrTooManyFrames {
+		t.Fatalf("DecompressWithOptions returned %v, want ErrTooManyFrames", err)
+	}
+	if _, err := DecompressIntoWithOptions(make([]byte, len(payload)), frame, tighter); err != ErrSizeLimitExceeded {
+		t.Fatalf("DecompressIntoWithOptions returned %v, want ErrSizeLimitExceeded", err)
+	}
+	if _, err := DecompressWithOptions(nil, compressedPayload, tighter); err != ErrDictionaryFrame {
+		t.Fatalf("DecompressWithOptions returned %v, want ErrDictionaryFrame", err)
+	}
+	r, err := NewReaderOptions(bytes.NewReader(threeFrames), WithMaxFrames(2))
+	failOnError(t, "Error while creating the reader", err)
+	if _, err := ioutil.ReadAll(r); err != ErrTooManyFrames {
+		t.Fatalf("Read returned %v, want ErrTooManyFrames", err)
+	}
+	r.Close()
+
+	// Within the limits, everything decodes
+	for api, err := range decodeAll(t, threeFrames, 3*len(payload), DecompressOptions{}) {
+		// BulkProcessor sizes its output from the first frame only
+		if err != nil && api != "BulkProcessor" {
+			t.Fatalf("%s failed within the limits: %s", api, err)
+		}
+	}
+	SetGlobalLimits(Limits{})
+	for api, err := range decodeAll(t, largeWindow, len(payload), DecompressOptions{}) {
+		if err != nil {
+			t.Fatalf("%s failed without limits: %s", api, err)
+		}
+	}
+}
+
+func TestGlobalLimitsScrollBatch(t *testing.T) {
+	defer SetGlobalLimits(Limits{})
+	batch := bytes.Repeat([]byte("a batch of transactions "), 1000)
+	blob, err := CompressScrollBatchBytes(batch)
+	if err != nil {
+		t.Skipf("The scroll encoder is not available: %s", err)
+	}
+	SetGlobalLimits(Limits{MaxSize: len(batch) - 1})
+	if _, err := DecompressScrollBatchBytes(blob); err != ErrSizeLimitExceeded {
+		t.Fatalf("DecompressScrollBatchBytes returned %v, want ErrSizeLimitExceeded", err)
+	}
+	SetGlobalLimits(Limits{MaxSize: len(batch)})
+	decompressed, err := DecompressScrollBatchBytes(blob)
+	failOnError(t, "Error while decompressing the batch", err)
+	if !bytes.Equal(decompressed, batch) {
+		t.Fatalf("The round trip differs")
+	}
+}
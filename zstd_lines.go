@@ -0,0 +1,135 @@
+package zstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// defaultMaxLineLen is the line length limit of a LineReader created with a
+// limit of 0, the one of bufio.Scanner.
+const defaultMaxLineLen = 64 * 1024
+
+// lineReaderBufferSize is the initial size of the buffer of a LineReader,
+// which grows up to the line length limit for longer lines.
+const lineReaderBufferSize = 4096
+
+// ErrLineTooLong is returned by LineReader.Next when a line is longer than
+// the limit of the LineReader.
+type ErrLineTooLong struct {
+	// Max is the line length limit
+	Max int
+	// Line is the number of the line, starting at 1
+	Line int64
+}
+
+func (e ErrLineTooLong) Error() string {
+	return fmt.Sprintf("Line %d is longer than %d bytes", e.Line, e.Max)
+}
+
+// LineReader splits the content of a zstd stream into lines, decompressing
+// it as they are read, e.g. to process compressed logs.
+type LineReader struct {
+	r          io.ReadCloser
+	maxLineLen int
+	buf        []byte
+	start, end int
+	line       int64
+	err        error
+}
+
+// NewLineReader creates a LineReader reading the zstd stream r, which may
+// hold several frames. Lines are delimited by '\n' and longer than
+// maxLineLen bytes, the line terminator excluded, fail with ErrLineTooLong. A
+// maxLineLen of 0 or less means 64KB, as with bufio.Scanner.
+func NewLineReader(r io.Reader, maxLineLen int) *LineReader {
+	if maxLineLen <= 0 {
+		maxLineLen = defaultMaxLineLen
+	}
+	size := lineReaderBufferSize
+	if size > maxLineLen+2 {
+		size = maxLineLen + 2
+	}
+	return &LineReader{r: NewReader(r), maxLineLen: maxLineLen, buf: make([]byte, size)}
+}
+
+// Next returns the next line without its terminator, "\n" or "\r\n". The
+// last line of the content need not end with a newline. The line is only
+// valid until the next call, which overwrites it. Next returns io.EOF once
+// all the lines were returned, and keeps returning the first error met.
+func (l *LineReader) Next() ([]byte, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	for searched := l.start; ; {
+		if i := bytes.IndexByte(l.buf[searched:l.end], '\n'); i >= 0 {
+			line := l.buf[l.start : searched+i]
+			l.start = searched + i + 1
+			return l.nextLine(line)
+		}
+		searched = l.end
+
+		if l.end-l.start == l.maxLineLen+2 {
+			// Too long even if it ends with "\r\n"
+			l.line++
+			l.err = ErrLineTooLong{Max: l.maxLineLen, Line: l.line}
+			return nil, l.err
+		}
+		if l.end == len(l.buf) {
+			searched -= l.start
+			l.fill()
+		}
+
+		n, err := l.r.Read(l.buf[l.end:])
+		l.end += n
+		if err == io.EOF && n == 0 {
+			if l.start == l.end {
+				l.err = io.EOF
+				return nil, l.err
+			}
+			line := l.buf[l.start:l.end]
+			l.start = l.end
+			return l.nextLine(line)
+		}
+		if err != nil && err != io.EOF {
+			l.err = err
+			return nil, err
+		}
+	}
+}
+
+// nextLine returns line without its "\r", or ErrLineTooLong.
+func (l *LineReader) nextLine(line []byte) ([]byte, error) {
+	l.line++
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	if len(line) > l.maxLineLen {
+		l.err = ErrLineTooLong{Max: l.maxLineLen, Line: l.line}
+		return nil, l.err
+	}
+	return line, nil
+}
+
+// fill makes room at the end of the full buffer for more data, by moving the
+// pending line to its start or by growing it up to the line length limit.
+func (l *LineReader) fill() {
+	if l.start > 0 {
+		l.end = copy(l.buf, l.buf[l.start:l.end])
+		l.start = 0
+		return
+	}
+	size := 2 * len(l.buf)
+	if size > l.maxLineLen+2 {
+		size = l.maxLineLen + 2
+	}
+	buf := make([]byte, size)
+	l.end = copy(buf, l.buf[:l.end])
+	l.buf = buf
+}
+
+// Close releases the resources of the LineReader, without closing the
+// underlying io.Reader.
+func (l *LineReader) Close() error {
+	return l.r.Close()
+}
@@ -0,0 +1,108 @@
+package zstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readLines returns the lines of the LineReader until the first error.
+func readLines(l *LineReader) ([]string, error) {
+	var lines []string
+	for {
+		line, err := l.Next()
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, string(line))
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	var lines []string
+	for i := 0; i < 2000; i++ {
+		// Lines up to 9KB span the boundaries of the decode buffers
+		lines = append(lines, fmt.Sprintf("%d %s", i, strings.Repeat("x", i*i%9000)))
+	}
+	lines = append(lines, "", "last")
+	content := strings.Join(lines, "\n")
+
+	for _, test := range []struct {
+		name    string
+		content string
+		lines   []string
+	}{
+		{"no trailing newline", content, lines},
+		{"trailing newline", content + "\n", lines},
+		{"crlf", "first\r\nsecond\r\n\r\nlast", []string{"first", "second", "", "last"}},
+		{"newline only", "\n", []string{""}},
+	} {
+		// Split the content in several frames, cutting lines in the middle
+		var compressed []byte
+		for _, part := range []string{test.content[:len(test.content)/3], test.content[len(test.content)/3:]} {
+			frame, err := Compress(nil, []byte(part))
+			if err != nil {
+				t.Fatalf("%s: error while compressing: %s", test.name, err)
+			}
+			compressed = append(compressed, frame...)
+		}
+
+		l := NewLineReader(bytes.NewReader(compressed), 10000)
+		got, err := readLines(l)
+		if err != io.EOF {
+			t.Fatalf("%s: expected io.EOF, got %v", test.name, err)
+		}
+		if len(got) != len(test.lines) {
+			t.Fatalf("%s: expected %d lines, got %d", test.name, len(test.lines), len(got))
+		}
+		for i := range got {
+			if got[i] != test.lines[i] {
+				t.Fatalf("%s: line %d differs: expected %.20q, got %.20q", test.name, i+1, test.lines[i], got[i])
+			}
+		}
+		if _, err := l.Next(); err != io.EOF {
+			t.Fatalf("%s: expected io.EOF again, got %v", test.name, err)
+		}
+		if err := l.Close(); err != nil {
+			t.Fatalf("%s: error while closing: %s", test.name, err)
+		}
+	}
+}
+
+func TestLineReaderTooLong(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+		line    int64
+	}{
+		{"in the middle", "short\n" + strings.Repeat("x", 101) + "\nshort\n", 2},
+		{"last line", "short\n" + strings.Repeat("x", 101), 2},
+		{"much longer", strings.Repeat("x", 10000) + "\n", 1},
+	} {
+		compressed, err := Compress(nil, []byte(test.content))
+		if err != nil {
+			t.Fatalf("%s: error while compressing: %s", test.name, err)
+		}
+		l := NewLineReader(bytes.NewReader(compressed), 100)
+		_, err = readLines(l)
+		if err != (ErrLineTooLong{Max: 100, Line: test.line}) {
+			t.Fatalf("%s: expected ErrLineTooLong for line %d, got %v", test.name, test.line, err)
+		}
+		if _, again := l.Next(); again != err {
+			t.Fatalf("%s: expected the error again, got %v", test.name, again)
+		}
+		l.Close()
+	}
+
+	// The limit excludes the line terminator
+	compressed, err := Compress(nil, []byte(strings.Repeat("x", 100)+"\r\n"+strings.Repeat("y", 100)))
+	if err != nil {
+		t.Fatalf("Error while compressing: %s", err)
+	}
+	lines, err := readLines(NewLineReader(bytes.NewReader(compressed), 100))
+	if err != io.EOF || len(lines) != 2 {
+		t.Fatalf("Expected 2 lines of 100 bytes, got %d lines and %v", len(lines), err)
+	}
+}
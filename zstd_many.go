@@ -0,0 +1,79 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import "sync"
+
+// manyCtxPool keeps contexts for CompressMany and DecompressMany, so that a
+// batch only pays for one pool access instead of one context per item.
+var manyCtxPool = sync.Pool{
+	New: func() interface{} {
+		return newCtx()
+	},
+}
+
+// putManyCtx gives a context back to manyCtxPool, unless its allocation
+// failed so that the next batch tries again.
+func putManyCtx(c *ctx) {
+	if c.err == nil {
+		manyCtxPool.Put(c)
+	}
+}
+
+// CompressMany compresses every srcs[i] with the given level, reusing a
+// single context for the whole batch. If dsts is not nil, dsts[i] is used as
+// destination buffer for srcs[i] as in CompressLevel.
+// The results are returned by index. errs is nil when all items succeeded,
+// otherwise it has one entry per item, nil for the successful ones.
+func CompressMany(dsts, srcs [][]byte, level int) (results [][]byte, errs []error) {
+	c := manyCtxPool.Get().(*ctx)
+	defer putManyCtx(c)
+
+	results = make([][]byte, len(srcs))
+	for i, src := range srcs {
+		var dst []byte
+		if i < len(dsts) {
+			dst = dsts[i]
+		}
+		out, err := c.CompressLevel(dst, src, level)
+		if err != nil {
+			if errs == nil {
+				errs = make([]error, len(srcs))
+			}
+			errs[i] = err
+			continue
+		}
+		results[i] = out
+	}
+	return results, errs
+}
+
+// DecompressMany decompresses every srcs[i], reusing a single context for the
+// whole batch. If dsts is not nil, dsts[i] is used as destination buffer for
+// srcs[i] as in Decompress.
+// The results are returned by index. errs is nil when all items succeeded,
+// otherwise it has one entry per item, nil for the successful ones.
+func DecompressMany(dsts, srcs [][]byte) (results [][]byte, errs []error) {
+	c := manyCtxPool.Get().(*ctx)
+	defer putManyCtx(c)
+
+	results = make([][]byte, len(srcs))
+	for i, src := range srcs {
+		var dst []byte
+		if i < len(dsts) {
+			dst = dsts[i]
+		}
+		out, err := c.Decompress(dst, src)
+		if err != nil {
+			if errs == nil {
+				errs = make([]error, len(srcs))
+			}
+			errs[i] = err
+			continue
+		}
+		results[i] = out
+	}
+	return results, errs
+}
@@ -0,0 +1,92 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/colinlyguo/zstd/zstdtest"
+)
+
+func TestCompressManyDecompressMany(t *testing.T) {
+	srcs := zstdtest.Records(1, 100, 300)
+	srcs = append(srcs, nil, []byte{})
+
+	compressed, errs := CompressMany(nil, srcs, DefaultCompression)
+	if errs != nil {
+		t.Fatalf("CompressMany failed: %v", errs)
+	}
+	decompressed, errs := DecompressMany(nil, compressed)
+	if errs != nil {
+		t.Fatalf("DecompressMany failed: %v", errs)
+	}
+	for i := range srcs {
+		if !bytes.Equal(srcs[i], decompressed[i]) {
+			t.Fatalf("item %d does not match: %q != %q", i, srcs[i], decompressed[i])
+		}
+	}
+}
+
+func TestCompressManyReusesDsts(t *testing.T) {
+	srcs := zstdtest.Records(1, 3, 300)
+	dsts := make([][]byte, len(srcs))
+	for i := range dsts {
+		dsts[i] = make([]byte, CompressBound(len(srcs[i])))
+	}
+
+	compressed, errs := CompressMany(dsts, srcs, BestSpeed)
+	if errs != nil {
+		t.Fatalf("CompressMany failed: %v", errs)
+	}
+	for i := range compressed {
+		if &compressed[i][0] != &dsts[i][0] {
+			t.Fatalf("item %d: dst buffer was not reused", i)
+		}
+	}
+}
+
+func TestDecompressManyErrorsByIndex(t *testing.T) {
+	srcs := zstdtest.Records(1, 3, 300)
+	compressed, errs := CompressMany(nil, srcs, DefaultCompression)
+	if errs != nil {
+		t.Fatalf("CompressMany failed: %v", errs)
+	}
+	compressed[1] = []byte("definitely not zstd")
+
+	decompressed, errs := DecompressMany(nil, compressed)
+	if len(errs) != len(srcs) {
+		t.Fatalf("expected one error per item, got %v", errs)
+	}
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if decompressed[1] != nil || !bytes.Equal(decompressed[2], srcs[2]) {
+		t.Fatal("successful items should still be returned")
+	}
+}
+
+func BenchmarkCompressLevelLoop(b *testing.B) {
+	srcs := zstdtest.Records(1, 10000, 300)
+	b.SetBytes(int64(len(srcs) * 300))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, src := range srcs {
+			if _, err := CompressLevel(nil, src, DefaultCompression); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkCompressMany(b *testing.B) {
+	srcs := zstdtest.Records(1, 10000, 300)
+	b.SetBytes(int64(len(srcs) * 300))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, errs := CompressMany(nil, srcs, DefaultCompression); errs != nil {
+			b.Fatal(errs)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import "fmt"
+
+const (
+	// minRatioChunkSize is the amount of input after which WithMinRatio ends
+	// the frame to measure its ratio
+	minRatioChunkSize = 1 << 20
+	// minRatioProbeInterval is the number of chunks stored before one is
+	// compressed again, to check whether the ratio recovered
+	minRatioProbeInterval = 8
+)
+
+// WithMinRatio makes the Writer stop compressing data which does not
+// compress, such as JPEGs or encrypted blobs, which otherwise wastes CPU and
+// slightly expands the output. The input is cut in frames of 1MB, and when
+// the ratio of a frame (input size over output size) is below threshold, the
+// next frames are stored: written in raw blocks, without compressing them.
+// Every 8 stored frames, a frame is compressed again to check whether the
+// ratio recovered, in which case compression resumes. The output is a
+// concatenation of regular zstd frames, which any decoder handles.
+//
+// Stats reports the number of stored frames and whether the Writer is
+// currently storing. Flush ends the stored frame in progress, if any.
+func WithMinRatio(threshold float64) WriterOption {
+	return func(w *Writer) error {
+		if !(threshold > 0) {
+			return fmt.Errorf("zstd: invalid minimum ratio %v", threshold)
+		}
+		w.minRatio = &minRatio{threshold: threshold}
+		return nil
+	}
+}
+
+// minRatio tracks the ratio of the frames of a Writer.
+type minRatio struct {
+	threshold float64
+	// storing is set while the frames are stored
+	storing bool
+	// frameIn is the input size of the compressed frame in progress, and
+	// frameOutStart the output size of the Writer when it started
+	frameIn       int
+	frameOutStart int64
+	// pending is the input of the stored frame in progress
+	pending []byte
+	// chunks is the number of frames stored since the last probe
+	chunks       int
+	storedFrames int
+	scratch      []byte
+}
+
+// paysOff returns whether in bytes compressed to out bytes meet the ratio.
+func (m *minRatio) paysOff(in int, out int64) bool {
+	return float64(in) >= m.threshold*float64(out)
+}
+
+// writeMinRatio compresses or stores p, depending on the ratio of the
+// previous frames.
+func (w *Writer) writeMinRatio(p []byte) error {
+	m := w.minRatio
+	for len(p) > 0 {
+		if m.storing {
+			n := minRatioChunkSize - len(m.pending)
+			if n > len(p) {
+				n = len(p)
+			}
+			m.pending = append(m.pending, p[:n]...)
+			p = p[n:]
+			if len(m.pending) == minRatioChunkSize {
+				if err := w.endStoredChunk(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		n := minRatioChunkSize - m.frameIn
+		if n > len(p) {
+			n = len(p)
+		}
+		if err := w.compress(p[:n]); err != nil {
+			return err
+		}
+		m.frameIn += n
+		p = p[n:]
+		if m.frameIn == minRatioChunkSize {
+			if err := w.endCompressedFrame(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// endCompressedFrame ends the compressed frame in progress, and switches to
+// storing if its ratio is below the threshold.
+func (w *Writer) endCompressedFrame() error {
+	m := w.minRatio
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	if !m.paysOff(m.frameIn, w.bytesOut-m.frameOutStart) {
+		m.storing = true
+		m.chunks = 0
+	}
+	m.frameIn = 0
+	m.frameOutStart = w.bytesOut
+	return nil
+}
+
+// endStoredChunk writes the full chunk pending as a stored frame, or
+// compresses it to probe the ratio every minRatioProbeInterval chunks.
+func (w *Writer) endStoredChunk() error {
+	m := w.minRatio
+	m.chunks++
+	if m.chunks < minRatioProbeInterval {
+		return w.flushStored()
+	}
+	m.chunks = 0
+	start := w.bytesOut
+	if err := w.compress(m.pending); err != nil {
+		return err
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	if m.paysOff(len(m.pending), w.bytesOut-start) {
+		m.storing = false
+		m.frameIn = 0
+		m.frameOutStart = w.bytesOut
+	}
+	m.pending = m.pending[:0]
+	return nil
+}
+
+// flushStored writes the data pending as a stored frame.
+func (w *Writer) flushStored() error {
+	m := w.minRatio
+	if len(m.pending) == 0 {
+		return nil
+	}
+	m.scratch = appendStoredFrame(m.scratch[:0], m.pending, false)
+	if _, err := w.underlyingWriter.Write(m.scratch); err != nil {
+		return err
+	}
+	w.bytesOut += int64(len(m.scratch))
+	m.storedFrames++
+	m.pending = m.pending[:0]
+	return nil
+}
+
+// closeMinRatio writes the data pending as a stored frame on Close. It
+// returns whether the output is complete, i.e. the last frame ended and there
+// is no compressed frame in progress, which would otherwise add an empty
+// frame.
+func (w *Writer) closeMinRatio() (bool, error) {
+	m := w.minRatio
+	if m.storing {
+		if err := w.flushStored(); err != nil {
+			return false, err
+		}
+	} else if m.frameIn > 0 {
+		return false, nil
+	}
+	return w.bytesOut > 0, nil
+}
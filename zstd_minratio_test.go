@@ -0,0 +1,104 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestWriterMinRatio(t *testing.T) {
+	random := make([]byte, 4*minRatioChunkSize+1000)
+	rand.New(rand.NewSource(1)).Read(random)
+	compressible := bytes.Repeat([]byte("compression pays off again "), (minRatioProbeInterval+2)*minRatioChunkSize/27)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		storing bool
+		stored  int
+	}{
+		{"random", random, true, 4},
+		{"compressible", compressible, false, 0},
+		// The probe after minRatioProbeInterval-1 stored frames resumes compression
+		{"recovering", append(append([]byte(nil), random...), compressible...), false, minRatioProbeInterval - 1},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w, err := NewWriterOptions(&buf, BestSpeed, WithMinRatio(1.05))
+		failOnError(t, "Failed to create writer", err)
+		for off := 0; off < len(test.input); off += 100000 {
+			end := off + 100000
+			if end > len(test.input) {
+				end = len(test.input)
+			}
+			_, err := w.Write(test.input[off:end])
+			failOnError(t, "Failed to write", err)
+		}
+		failOnError(t, "Failed to close", w.Close())
+		stats := w.Stats()
+		if stats.Storing != test.storing || stats.StoredFrames != test.stored {
+			t.Fatalf("%s: unexpected stats %+v", test.name, stats)
+		}
+		if test.storing && buf.Len() > len(test.input)+len(test.input)/1000 {
+			t.Fatalf("%s: stored output of %d bytes is too large for %d bytes", test.name, buf.Len(), len(test.input))
+		}
+
+		decompressed, err := Decompress(nil, buf.Bytes())
+		failOnError(t, "Failed to decompress", err)
+		if !bytes.Equal(decompressed, test.input) {
+			t.Fatalf("%s: round trip does not match", test.name)
+		}
+		r := NewReader(bytes.NewReader(buf.Bytes()))
+		decompressed, err = ioutil.ReadAll(r)
+		failOnError(t, "Failed to read", err)
+		r.Close()
+		if !bytes.Equal(decompressed, test.input) {
+			t.Fatalf("%s: stream round trip does not match", test.name)
+		}
+	}
+}
+
+func TestWriterMinRatioFlush(t *testing.T) {
+	random := make([]byte, minRatioChunkSize+100)
+	rand.New(rand.NewSource(2)).Read(random)
+
+	var buf bytes.Buffer
+	w, err := NewWriterOptions(&buf, BestSpeed, WithMinRatio(1.05))
+	failOnError(t, "Failed to create writer", err)
+	_, err = w.Write(random)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to flush", w.Flush())
+	if stats := w.Stats(); !stats.Storing || stats.StoredFrames != 1 {
+		t.Fatalf("Expected Flush to write a stored frame, got %+v", w.Stats())
+	}
+	// Flushed data is decodable before Close
+	decompressed, err := Decompress(nil, buf.Bytes())
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(decompressed, random) {
+		t.Fatal("Flushed data does not match")
+	}
+	size := buf.Len()
+	failOnError(t, "Failed to close", w.Close())
+	if buf.Len() != size {
+		t.Fatalf("Expected Close to write nothing more, wrote %d bytes", buf.Len()-size)
+	}
+
+	// An empty Writer still writes a frame
+	buf.Reset()
+	w, err = NewWriterOptions(&buf, BestSpeed, WithMinRatio(1.05))
+	failOnError(t, "Failed to create writer", err)
+	failOnError(t, "Failed to close", w.Close())
+	if decompressed, err := Decompress(nil, buf.Bytes()); err != nil || len(decompressed) != 0 {
+		t.Fatalf("Expected an empty frame, got %v", err)
+	}
+
+	for _, threshold := range []float64{0, -1} {
+		if _, err := NewWriterOptions(&buf, BestSpeed, WithMinRatio(threshold)); err == nil {
+			t.Fatalf("Expected an error for a threshold of %v", threshold)
+		}
+	}
+}
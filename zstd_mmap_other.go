@@ -0,0 +1,24 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package zstd
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the first size bytes of f, as memory mapping is not
+// supported on this platform.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// munmapFile releases data, returned by mmapFile.
+func munmapFile(data []byte) error {
+	return nil
+}
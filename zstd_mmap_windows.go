@@ -0,0 +1,37 @@
+//go:build windows
+// +build windows
+
+package zstd
+
+import (
+	"os"
+	"reflect"
+	"syscall"
+	"unsafe"
+)
+
+// mmapFile maps the first size bytes of f read-only in memory.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	high, low := uint32(uint64(size)>>32), uint32(size)
+	mapping, err := syscall.CreateFileMapping(syscall.Handle(f.Fd()), nil, syscall.PAGE_READONLY, high, low, nil)
+	if err != nil {
+		return nil, os.NewSyscallError("CreateFileMapping", err)
+	}
+	// The view keeps the mapping alive once its handle is closed
+	defer syscall.CloseHandle(mapping)
+	addr, err := syscall.MapViewOfFile(mapping, syscall.FILE_MAP_READ, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, os.NewSyscallError("MapViewOfFile", err)
+	}
+	var data []byte
+	header := (*reflect.SliceHeader)(unsafe.Pointer(&data))
+	header.Data = addr
+	header.Len = size
+	header.Cap = size
+	return data, nil
+}
+
+// munmapFile unmaps data, returned by mmapFile.
+func munmapFile(data []byte) error {
+	return os.NewSyscallError("UnmapViewOfFile", syscall.UnmapViewOfFile(uintptr(unsafe.Pointer(&data[0]))))
+}
@@ -0,0 +1,10 @@
+//go:build !zstd_nomt
+// +build !zstd_nomt
+
+package zstd
+
+// Multithreading is compiled in unless the zstd_nomt build tag is given, for
+// platforms without pthreads or deployments not using workers.
+
+// #cgo CFLAGS: -DZSTD_MULTITHREAD=1
+import "C"
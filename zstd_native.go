@@ -0,0 +1,142 @@
+package zstd
+
+/*
+#include <stdlib.h>
+#include "zstd.h"
+
+// nativeBytes is the number of bytes allocated by libzstd for the tracked
+// contexts, nativeLimit the budget they share, 0 if unlimited.
+static long long nativeBytes;
+static long long nativeLimit;
+
+// trackingHeader is the space reserved before each tracked allocation to
+// record its size, keeping the alignment of malloc.
+#define trackingHeader 16
+
+static void* trackingAlloc(void* opaque, size_t size) {
+	long long limit = __atomic_load_n(&nativeLimit, __ATOMIC_RELAXED);
+	long long total = __atomic_add_fetch(&nativeBytes, (long long)size, __ATOMIC_RELAXED);
+	if (limit > 0 && total > limit) {
+		__atomic_sub_fetch(&nativeBytes, (long long)size, __ATOMIC_RELAXED);
+		return NULL;
+	}
+	char* p = malloc(size + trackingHeader);
+	if (p == NULL) {
+		__atomic_sub_fetch(&nativeBytes, (long long)size, __ATOMIC_RELAXED);
+		return NULL;
+	}
+	*(size_t*)p = size;
+	return p + trackingHeader;
+}
+
+static void trackingFree(void* opaque, void* address) {
+	if (address == NULL) {
+		return;
+	}
+	char* p = (char*)address - trackingHeader;
+	__atomic_sub_fetch(&nativeBytes, (long long)*(size_t*)p, __ATOMIC_RELAXED);
+	free(p);
+}
+
+static long long loadNativeBytes(void) {
+	return __atomic_load_n(&nativeBytes, __ATOMIC_RELAXED);
+}
+
+static void storeNativeLimit(long long limit) {
+	__atomic_store_n(&nativeLimit, limit, __ATOMIC_RELAXED);
+}
+
+static ZSTD_CCtx* createTrackedCCtx(void) {
+	ZSTD_customMem mem = { trackingAlloc, trackingFree, NULL };
+	return ZSTD_createCCtx_advanced(mem);
+}
+
+static ZSTD_DCtx* createTrackedDCtx(void) {
+	ZSTD_customMem mem = { trackingAlloc, trackingFree, NULL };
+	return ZSTD_createDCtx_advanced(mem);
+}
+*/
+import "C"
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// errContextAllocation is returned when libzstd fails to allocate a context
+// for another reason than the native memory limit.
+var errContextAllocation = errors.New("Failed to allocate a context")
+
+// allocationError returns the error of a failed context creation.
+func allocationError() error {
+	if isNativeMemoryLimited() {
+		return ErrNativeMemoryLimit
+	}
+	return errContextAllocation
+}
+
+// isTracked returns whether new contexts must track their allocations.
+func isTracked() bool {
+	return isAllocationTrackingEnabled() || isNativeMemoryLimited()
+}
+
+// newCCtx creates a compression context, tracking its allocations when
+// allocation tracking is enabled or a native memory limit is set. Free it
+// with freeCCtx.
+func newCCtx() (*C.ZSTD_CCtx, error) {
+	var cctx *C.ZSTD_CCtx
+	if isTracked() {
+		cctx = C.createTrackedCCtx()
+	} else {
+		cctx = C.ZSTD_createCCtx()
+	}
+	if cctx == nil {
+		return nil, allocationError()
+	}
+	atomic.AddInt64(&liveCCtxs, 1)
+	return cctx, nil
+}
+
+// freeCCtx frees a context created by newCCtx and returns the libzstd result
+// code.
+func freeCCtx(cctx *C.ZSTD_CCtx) int {
+	if cctx != nil {
+		atomic.AddInt64(&liveCCtxs, -1)
+	}
+	return int(C.ZSTD_freeCCtx(cctx))
+}
+
+// newDCtx is like newCCtx for decompression contexts. Free it with
+// freeDCtx.
+func newDCtx() (*C.ZSTD_DCtx, error) {
+	var dctx *C.ZSTD_DCtx
+	if isTracked() {
+		dctx = C.createTrackedDCtx()
+	} else {
+		dctx = C.ZSTD_createDCtx()
+	}
+	if dctx == nil {
+		return nil, allocationError()
+	}
+	atomic.AddInt64(&liveDCtxs, 1)
+	return dctx, nil
+}
+
+// freeDCtx frees a context created by newDCtx and returns the libzstd result
+// code.
+func freeDCtx(dctx *C.ZSTD_DCtx) int {
+	if dctx != nil {
+		atomic.AddInt64(&liveDCtxs, -1)
+	}
+	return int(C.ZSTD_freeDCtx(dctx))
+}
+
+// nativeBytes returns the bytes held by the contexts whose allocations are
+// tracked.
+func nativeBytes() int64 {
+	return int64(C.loadNativeBytes())
+}
+
+// setNativeLimit sets the budget of the tracking allocator.
+func setNativeLimit(bytes int64) {
+	C.storeNativeLimit(C.longlong(bytes))
+}
@@ -0,0 +1,308 @@
+//go:build !cgo
+// +build !cgo
+
+package zstd
+
+// This file provides a pure-Go fallback used when the package is built with
+// CGO_ENABLED=0. It is backed by github.com/klauspost/compress/zstd and only
+// covers the simple API and the Reader. Features which need the C library
+// return ErrNotSupported.
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+
+	kzstd "github.com/klauspost/compress/zstd"
+)
+
+// decoder is shared by all one-shot decompressions, DecodeAll is safe for
+// concurrent use.
+var decoder = func() *kzstd.Decoder {
+	d, err := kzstd.NewReader(nil, kzstd.WithDecoderConcurrency(0))
+	if err != nil {
+		panic(err)
+	}
+	return d
+}()
+
+// encoders caches one encoder per compression level, EncodeAll is safe for
+// concurrent use.
+var encoders sync.Map
+
+func encoderForLevel(level int) (*kzstd.Encoder, error) {
+	if e, ok := encoders.Load(level); ok {
+		return e.(*kzstd.Encoder), nil
+	}
+	e, err := kzstd.NewWriter(nil,
+		kzstd.WithEncoderLevel(kzstd.EncoderLevelFromZstd(level)),
+		kzstd.WithEncoderCRC(false), // libzstd does not write a checksum by default
+		kzstd.WithZeroFrames(true),  // libzstd emits a frame for empty input
+	)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := encoders.LoadOrStore(level, e)
+	return actual.(*kzstd.Encoder), nil
+}
+
+// isLegacyFrame returns whether src starts with the magic number of a zstd
+// format older than v0.8, which only the C library can decode.
+func isLegacyFrame(src []byte) bool {
+	return len(src) >= 4 && src[0] >= 0x1E && src[0] <= 0x27 &&
+		src[1] == 0xB5 && src[2] == 0x2F && src[3] == 0xFD
+}
+
+// dictionaryError returns ErrDictionaryRequired instead of err when the
+// decoder failed because the frame starting src needs a dictionary whose ID
+// its header records.
+func dictionaryError(src []byte, err error) error {
+	if !errors.Is(err, kzstd.ErrUnknownDictionary) {
+		return err
+	}
+	var header kzstd.Header
+	if header.Decode(src) == nil && header.DictionaryID != 0 {
+		return ErrDictionaryRequired{DictID: header.DictionaryID}
+	}
+	return err
+}
+
+// Compress src into dst.  If you have a buffer to use, you can pass it to
+// prevent allocation.  If it is too small, or if nil is passed, a new buffer
+// will be allocated and returned. It compresses at DefaultLevel(), see
+// SetDefaultCompressionLevel.
+func Compress(dst, src []byte) ([]byte, error) {
+	return CompressLevel(dst, src, DefaultLevel())
+}
+
+// CompressLevel is the same as Compress but you can pass a compression level
+func CompressLevel(dst, src []byte, level int) ([]byte, error) {
+	hook, start := startTelemetry()
+	out, err := compressLevel(dst, src, level)
+	if hook != nil {
+		endTelemetry(hook, OpCompress, start, len(src), len(out), err)
+	}
+	return out, err
+}
+
+func compressLevel(dst, src []byte, level int) ([]byte, error) {
+	e, err := encoderForLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return e.EncodeAll(src, dst[:0]), nil
+}
+
+// HasMultithreadSupport reports whether compressing with workers is available,
+// which requires the C library: it is always false in this build.
+func HasMultithreadSupport() bool {
+	return false
+}
+
+// levelBounds returns the bounds of the compression levels, those of the
+// vendored libzstd in this build.
+func levelBounds() (min, max int) {
+	return minLevel, maxLevel
+}
+
+// RequireVersion requires the C library and always returns ErrNotSupported in
+// this build.
+func RequireVersion(min uint) error {
+	return ErrNotSupported
+}
+
+// Capabilities reports the features of the linked libzstd, none in this
+// build.
+func Capabilities() LibraryCapabilities {
+	return LibraryCapabilities{}
+}
+
+// CompressScrollBatchBytes requires the C library and always returns
+// ErrNotSupported in this build.
+func CompressScrollBatchBytes(src []byte) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// DecompressScrollBatchBytes requires the C library and always returns
+// ErrNotSupported in this build.
+func DecompressScrollBatchBytes(src []byte) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// DecompressionMargin requires the C library and always returns
+// ErrNotSupported in this build.
+func DecompressionMargin(src []byte) (int, error) {
+	return 0, ErrNotSupported
+}
+
+// DecompressInPlace requires the C library and always returns
+// ErrNotSupported in this build.
+func DecompressInPlace(buf []byte, compressedLen int) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// Decompress src into dst.  If you have a buffer to use, you can pass it to
+// prevent allocation.  If it is too small, or if nil is passed, a new buffer
+// will be allocated and returned.
+func Decompress(dst, src []byte) ([]byte, error) {
+	hook, start := startTelemetry()
+	out, err := decompress(dst, src)
+	if hook != nil {
+		endTelemetry(hook, OpDecompress, start, len(src), len(out), err)
+	}
+	return out, err
+}
+
+func decompress(dst, src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return nil, ErrEmptySlice
+	}
+	if isLegacyFrame(src) {
+		return nil, ErrNotSupported
+	}
+	out, err := decoder.DecodeAll(src, dst[:0])
+	if err != nil {
+		return nil, notZstdError(src, dictionaryError(src, err))
+	}
+	if out == nil {
+		out = []byte{}
+	}
+	return out, nil
+}
+
+// DecompressInto decompresses src into dst. Unlike Decompress, DecompressInto
+// requires that dst be sufficiently large to hold the decompressed payload.
+//
+// It returns the number of bytes copied and an error if any is encountered. If
+// dst is too small, DecompressInto returns a *DstSizeTooSmallError with the
+// required size. An empty src returns ErrEmptySlice.
+func DecompressInto(dst, src []byte) (int, error) {
+	hook, start := startTelemetry()
+	n, err := decompressInto(dst, src)
+	if hook != nil {
+		endTelemetry(hook, OpDecompressInto, start, len(src), n, err)
+	}
+	return n, err
+}
+
+func decompressInto(dst, src []byte) (int, error) {
+	if len(src) == 0 {
+		return 0, ErrEmptySlice
+	}
+	if isLegacyFrame(src) {
+		return 0, ErrNotSupported
+	}
+	// Cap the capacity so that the decoder never writes past len(dst)
+	out, err := decoder.DecodeAll(src, dst[:0:len(dst)])
+	if err != nil {
+		return 0, notZstdError(src, dictionaryError(src, err))
+	}
+	if len(out) > len(dst) {
+		// The decoder grew the buffer, so the required size is known exactly
+		return 0, &DstSizeTooSmallError{RequiredSize: len(out), SizeKnown: true}
+	}
+	return len(out), nil
+}
+
+// errReadCloser is returned by NewReaderDict when the decoder cannot be
+// created, every call reports the creation error.
+type errReadCloser struct {
+	err error
+}
+
+func (e *errReadCloser) Read(p []byte) (int, error) { return 0, e.err }
+func (e *errReadCloser) Close() error               { return e.err }
+
+// NewReader creates a new io.ReadCloser.  Reads from the returned ReadCloser
+// read and decompress data from r.  It is the caller's responsibility to call
+// Close on the ReadCloser when done.
+func NewReader(r io.Reader) io.ReadCloser {
+	return NewReaderDict(r, nil)
+}
+
+// NewReaderDict is like NewReader but uses a preset dictionary.  NewReaderDict
+// ignores the dictionary if it is nil. Only dictionaries in the zstd
+// dictionary format are supported by this build.
+func NewReaderDict(r io.Reader, dict []byte) io.ReadCloser {
+	opts := []kzstd.DOption{kzstd.WithDecoderConcurrency(1)}
+	if len(dict) > 0 {
+		opts = append(opts, kzstd.WithDecoderDicts(dict))
+	}
+	d, err := kzstd.NewReader(r, opts...)
+	if err != nil {
+		return &errReadCloser{err: err}
+	}
+	return d.IOReadCloser()
+}
+
+// CompressVectored is like CompressLevel but compresses the concatenation of
+// srcs into a single frame, without assembling them in a contiguous buffer
+// first.
+func CompressVectored(dst []byte, srcs [][]byte, level int) ([]byte, error) {
+	buf := bytes.NewBuffer(dst[:0])
+	w, err := kzstd.NewWriter(buf,
+		kzstd.WithEncoderLevel(kzstd.EncoderLevelFromZstd(level)),
+		kzstd.WithEncoderCRC(false),
+		kzstd.WithZeroFrames(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range srcs {
+		if _, err := w.Write(src); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CompressScrollBatchVectored requires the C library and always returns
+// ErrNotSupported in this build.
+func CompressScrollBatchVectored(srcs [][]byte) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// DecompressVectored decompresses src across dsts in order, filling each of
+// them up to its length before moving to the next one. Empty slices in dsts
+// are skipped. This build decompresses into an intermediate buffer first.
+//
+// It returns the total number of bytes written, which may be less than the
+// combined length of dsts. If the output does not fit, DecompressVectored
+// returns a *DstSizeTooSmallError. An empty src returns ErrEmptySlice.
+func DecompressVectored(dsts [][]byte, src []byte) (int, error) {
+	out, err := Decompress(nil, src)
+	if err != nil {
+		return 0, err
+	}
+	capacity := 0
+	for _, dst := range dsts {
+		capacity += len(dst)
+	}
+	if len(out) > capacity {
+		return 0, &DstSizeTooSmallError{RequiredSize: len(out), SizeKnown: true}
+	}
+	total := 0
+	for _, dst := range dsts {
+		total += copy(dst, out[total:])
+	}
+	return total, nil
+}
+
+// nativeBytes returns 0, there is no native memory without cgo.
+func nativeBytes() int64 {
+	return 0
+}
+
+// setNativeLimit does nothing, there is no native memory without cgo.
+func setNativeLimit(bytes int64) {}
+
+// trainDictionary requires the C library and always returns ErrNotSupported
+// in this build.
+func trainDictionary(samples [][]byte, maxDictSize int) ([]byte, error) {
+	return nil, ErrNotSupported
+}
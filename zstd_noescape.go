@@ -0,0 +1,90 @@
+//go:build go1.24 && cgo
+// +build go1.24,cgo
+
+package zstd
+
+// The functions below neither keep the pointers they are given after
+// returning, libzstd copies what it needs such as dictionaries and stream
+// input, nor call back into Go, the tracking allocator being C. This lets the
+// compiler keep their Go arguments on the stack and skip the callback
+// bookkeeping. The pragmas are honored from Go 1.24, see
+// zstd_noescape_compat.go for older toolchains.
+//
+// ZSTD_compressStream2_positions is left out on purpose: it is called with
+// ZSTD_c_stableInBuffer, libzstd then keeps the input between calls. No
+// decompression sets ZSTD_d_stableOutBuffer, so ZSTD_decompressStream_positions
+// keeps nothing.
+
+/*
+#cgo noescape ZSTD_compress
+#cgo nocallback ZSTD_compress
+#cgo noescape ZSTD_decompress
+#cgo nocallback ZSTD_decompress
+#cgo noescape ZSTD_compressCCtx
+#cgo nocallback ZSTD_compressCCtx
+#cgo noescape ZSTD_decompressDCtx
+#cgo nocallback ZSTD_decompressDCtx
+#cgo noescape ZSTD_compress2
+#cgo nocallback ZSTD_compress2
+#cgo noescape ZSTD_compress_usingCDict
+#cgo nocallback ZSTD_compress_usingCDict
+#cgo noescape ZSTD_decompress_usingDDict
+#cgo nocallback ZSTD_decompress_usingDDict
+#cgo noescape ZSTD_compressSequences_compat
+#cgo nocallback ZSTD_compressSequences_compat
+#cgo noescape ZSTD_generateSequences_compat
+#cgo nocallback ZSTD_generateSequences_compat
+#cgo noescape ZSTD_compressStream2_wrapper
+#cgo nocallback ZSTD_compressStream2_wrapper
+#cgo noescape ZSTD_compressStream2_flush
+#cgo nocallback ZSTD_compressStream2_flush
+#cgo noescape ZSTD_compressStream2_finish
+#cgo nocallback ZSTD_compressStream2_finish
+#cgo noescape ZSTD_decompressStream_wrapper
+#cgo nocallback ZSTD_decompressStream_wrapper
+#cgo noescape ZSTD_decompressStream_positions
+#cgo nocallback ZSTD_decompressStream_positions
+#cgo noescape ZSTD_verifyFrame_wrapper
+#cgo nocallback ZSTD_verifyFrame_wrapper
+#cgo noescape ZSTD_decompressionMargin_compat
+#cgo nocallback ZSTD_decompressionMargin_compat
+#cgo noescape ZSTD_findFrameCompressedSize
+#cgo nocallback ZSTD_findFrameCompressedSize
+#cgo noescape ZSTD_estimateDStreamSize_fromFrame
+#cgo nocallback ZSTD_estimateDStreamSize_fromFrame
+#cgo noescape ZSTD_findDecompressedSize
+#cgo nocallback ZSTD_findDecompressedSize
+#cgo noescape ZSTD_getFrameContentSize
+#cgo nocallback ZSTD_getFrameContentSize
+#cgo noescape ZSTD_getFrameHeader
+#cgo nocallback ZSTD_getFrameHeader
+#cgo noescape ZSTD_getFrameHeader_advanced
+#cgo nocallback ZSTD_getFrameHeader_advanced
+#cgo noescape ZSTD_getDictID_fromFrame
+#cgo nocallback ZSTD_getDictID_fromFrame
+#cgo noescape ZSTD_getDictID_fromDict
+#cgo nocallback ZSTD_getDictID_fromDict
+#cgo noescape ZSTD_isFrame
+#cgo nocallback ZSTD_isFrame
+#cgo noescape ZSTD_CCtx_loadDictionary
+#cgo nocallback ZSTD_CCtx_loadDictionary
+#cgo noescape ZSTD_DCtx_loadDictionary
+#cgo nocallback ZSTD_DCtx_loadDictionary
+#cgo noescape ZSTD_createCDict
+#cgo nocallback ZSTD_createCDict
+#cgo noescape ZSTD_createDDict
+#cgo nocallback ZSTD_createDDict
+#cgo noescape ZSTD_createCDict_dedicatedDictSearch
+#cgo nocallback ZSTD_createCDict_dedicatedDictSearch
+#cgo noescape ZDICT_trainFromBuffer
+#cgo nocallback ZDICT_trainFromBuffer
+#cgo noescape ZSTD_xxh64
+#cgo nocallback ZSTD_xxh64
+#cgo noescape ZSTD_xxh64Update
+#cgo nocallback ZSTD_xxh64Update
+#include "zstd.h"
+*/
+import "C"
+
+// cgoNoEscape is whether the cgo calls are annotated.
+const cgoNoEscape = true
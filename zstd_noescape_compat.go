@@ -0,0 +1,9 @@
+//go:build !go1.24 && cgo
+// +build !go1.24,cgo
+
+package zstd
+
+// cgoNoEscape is whether the cgo calls are annotated, which requires Go 1.24,
+// see zstd_noescape.go. Older toolchains build the same code, but the Go
+// arguments of the cgo calls escape to the heap.
+const cgoNoEscape = false
@@ -0,0 +1,62 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import "testing"
+
+// The payloads below are arrays on the stack of the caller, which stay there
+// only if nothing makes them escape, in particular the cgo calls.
+
+func TestCgoNoEscapeAllocs(t *testing.T) {
+	if !cgoNoEscape {
+		t.Skip("The cgo calls are annotated from Go 1.24")
+	}
+	dst := make([]byte, 0, CompressBound(64))
+	c := NewCtx()
+	// Compress and CompressLevel pin the inputs of 64MB or more, which makes
+	// every input escape
+	for name, f := range map[string]func(){
+		"Ctx.Compress": func() {
+			var src [64]byte
+			c.Compress(dst, src[:])
+		},
+		"XXH64": func() {
+			var src [64]byte
+			XXH64(src[:], 0)
+		},
+	} {
+		if allocs := testing.AllocsPerRun(100, f); allocs != 0 {
+			t.Errorf("%s: expected no allocation, got %v", name, allocs)
+		}
+	}
+}
+
+func BenchmarkCompressSmallStack(b *testing.B) {
+	dst := make([]byte, 0, CompressBound(64))
+	c := NewCtx()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var src [64]byte
+		src[0] = byte(i)
+		if _, err := c.Compress(dst, src[:]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecompressSmallStack(b *testing.B) {
+	compressed, err := Compress(nil, make([]byte, 64))
+	if err != nil {
+		b.Fatal(err)
+	}
+	dst := make([]byte, 0, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var src [64]byte
+		n := copy(src[:], compressed)
+		if _, err := Decompress(dst, src[:n]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
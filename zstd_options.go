@@ -0,0 +1,207 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+)
+
+// ErrWindowTooLarge is returned when a frame needs a larger window than
+// allowed, see DecompressOptions.MaxWindowLog.
+var ErrWindowTooLarge = errors.New("Frame requires too much memory for decoding")
+
+// ErrContentSizeMismatch is returned when the decompressed size differs from
+// the content size declared by the frame headers, see
+// DecompressOptions.VerifyContentSize.
+type ErrContentSizeMismatch struct {
+	Declared uint64
+	Actual   uint64
+}
+
+func (e ErrContentSizeMismatch) Error() string {
+	return fmt.Sprintf("Decompressed size %d does not match the declared content size %d", e.Actual, e.Declared)
+}
+
+// DecompressOptions holds the options of DecompressWithOptions and
+// DecompressIntoWithOptions. The zero value of a field keeps the default
+// behavior.
+type DecompressOptions struct {
+	// MaxWindowLog rejects frames whose window is larger than 1<<MaxWindowLog
+	// bytes with ErrWindowTooLarge, before any large allocation happens. This
+	// bounds the memory used by untrusted frames. 0 keeps the libzstd default
+	// of 27 (128MB), which only applies to the stream fallback.
+	MaxWindowLog int
+
+	// VerifyContentSize compares the decompressed size with the content size
+	// declared by the frame headers, when they all declare it, and returns
+	// ErrContentSizeMismatch if they differ. This includes frames declaring
+	// more content than they hold, which otherwise fail with a generic zstd
+	// error.
+	VerifyContentSize bool
+
+	// MaxFrames rejects inputs of more than MaxFrames frames, including
+	// skippable ones, with ErrTooManyFrames before decoding them, as many
+	// tiny frames cost much more to decode than their size suggests. 0 keeps
+	// the default of DefaultMaxFrames, a negative value removes the limit.
+	MaxFrames int
+
+	// MaxSize rejects payloads decompressing to more than MaxSize bytes with
+	// ErrSizeLimitExceeded. This bounds the buffer of the stream fallback,
+	// which otherwise grows as long as the frames produce data, up to 32KB
+	// per input byte with RLE blocks. It also lets the size declared by a
+	// seek table ending src size the buffer up to MaxSize, as the table is
+	// not trusted beyond the hint of Decompress otherwise. 0 means no limit.
+	MaxSize int
+
+	// ContentHash, if set, is fed the decompressed content, e.g. to get a
+	// dedup key without a second pass over a large output. It is fed once
+	// the one-shot decompression succeeds, or as the stream fallback
+	// decodes, so that every byte is written exactly once. Its digest is
+	// only meaningful when no error is returned. NewXXH64 selects the XXH64
+	// implementation bundled with libzstd.
+	ContentHash hash.Hash
+
+	// DenyLegacy and DenyDictionary reject legacy frames and frames
+	// compressed with a dictionary, see Limits
+	DenyLegacy     bool
+	DenyDictionary bool
+}
+
+// DefaultMaxFrames is the default of DecompressOptions.MaxFrames. Decompress
+// and DecompressInto, which are not meant for untrusted input, have no limit.
+const DefaultMaxFrames = 1 << 16
+
+// ErrSizeLimitExceeded is returned when the decompressed payload is larger
+// than allowed, see DecompressOptions.MaxSize.
+var ErrSizeLimitExceeded = errors.New("Decompressed size exceeds the limit")
+
+// ErrTooManyFrames is returned when the input has more frames than allowed,
+// see DecompressOptions.MaxFrames and WithMaxFrames.
+var ErrTooManyFrames = errors.New("Too many frames")
+
+// withDefaults returns the options with the defaults of the functions taking
+// options applied. A limit of 0 means no limit for the functions.
+func (o DecompressOptions) withDefaults() DecompressOptions {
+	if o.MaxFrames == 0 {
+		o.MaxFrames = DefaultMaxFrames
+	} else if o.MaxFrames < 0 {
+		o.MaxFrames = 0
+	}
+	return o
+}
+
+// check validates the options, then checks the frames of src against them
+// before anything is allocated for decompression.
+func (o DecompressOptions) check(src []byte) error {
+	if o.MaxWindowLog == 0 && o.MaxFrames <= 0 && !o.DenyLegacy && !o.DenyDictionary {
+		return nil
+	}
+	if o.MaxWindowLog != 0 {
+		if err := checkDParameter(DParamWindowLogMax, o.MaxWindowLog); err != nil {
+			return err
+		}
+	}
+	// One-shot decompression does not honor ZSTD_d_windowLogMax, check the
+	// window of every frame. Parsing errors are left to the decoder.
+	for frames := 0; len(src) > 0; frames++ {
+		if o.MaxFrames > 0 && frames == o.MaxFrames {
+			return ErrTooManyFrames
+		}
+		if err := o.limits().checkFrameHeader(src); err != nil {
+			return err
+		}
+		header, err := getFrameHeader(src)
+		if err != nil {
+			return nil
+		}
+		if o.MaxWindowLog != 0 && header.frameType != C.ZSTD_skippableFrame && uint64(header.windowSize) > 1<<uint(o.MaxWindowLog) {
+			return ErrWindowTooLarge
+		}
+		size, err := FindFrameCompressedSize(src)
+		if err != nil {
+			return nil
+		}
+		src = src[size:]
+	}
+	return nil
+}
+
+// apply sets the options on dctx, leaving the ones at their zero value
+// untouched.
+func (o DecompressOptions) apply(dctx *C.ZSTD_DCtx) error {
+	if o.MaxWindowLog != 0 {
+		return setDParameter(dctx, DParamWindowLogMax, o.MaxWindowLog)
+	}
+	return nil
+}
+
+// DecompressWithOptions is like Decompress but decompresses with options.
+func DecompressWithOptions(dst, src []byte, opts DecompressOptions) ([]byte, error) {
+	return decompress(dst, src, false, opts.withDefaults())
+}
+
+// declaredContentSize sums the content sizes declared by the frame headers of
+// src, including the one of a truncated last frame. It returns false if a
+// frame does not declare its content size.
+func declaredContentSize(src []byte) (uint64, bool) {
+	var total uint64
+	for len(src) > 0 {
+		header, err := getFrameHeader(src)
+		if err != nil {
+			return 0, false
+		}
+		if header.frameType != C.ZSTD_skippableFrame {
+			if uint64(header.frameContentSize) == uint64(C.ZSTD_CONTENTSIZE_UNKNOWN) {
+				return 0, false
+			}
+			total += uint64(header.frameContentSize)
+		}
+		size, err := FindFrameCompressedSize(src)
+		if err != nil {
+			break
+		}
+		src = src[size:]
+	}
+	return total, true
+}
+
+// verify returns ErrContentSizeMismatch if VerifyContentSize is set and src
+// decompressed to n bytes instead of its declared content size. decodeErr is
+// the error of the decompression, if any, in which case the size is measured
+// by decoding src again with the stream API, discarding the output.
+func (o DecompressOptions) verify(src []byte, n int, decodeErr error) error {
+	if !o.VerifyContentSize {
+		return decodeErr
+	}
+	if _, ok := decodeErr.(ErrDictionaryRequired); ok || decodeErr == ErrWindowTooLarge {
+		return decodeErr
+	}
+	declared, ok := declaredContentSize(src)
+	if !ok {
+		return decodeErr
+	}
+	actual := uint64(n)
+	if decodeErr != nil {
+		r := newReader(bytes.NewReader(src), nil)
+		defer r.Close()
+		if r.firstError != nil {
+			return decodeErr
+		}
+		if err := o.apply(r.ctx); err != nil {
+			return decodeErr
+		}
+		written, _ := io.Copy(ioutil.Discard, r)
+		actual = uint64(written)
+	}
+	if actual != declared {
+		return ErrContentSizeMismatch{Declared: declared, Actual: actual}
+	}
+	return decodeErr
+}
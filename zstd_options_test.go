@@ -0,0 +1,166 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+// largeWindowParams stream frames with a 16MB window, which do not record
+// their content size
+var largeWindowParams = WriterParams{CParams: CParams{WindowLog: 24}}
+
+func TestDecompressMaxWindowLog(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello World! "), 1000)
+	frame := writerCompress(t, largeWindowParams, payload)
+
+	opts := DecompressOptions{MaxWindowLog: 20}
+	if _, err := DecompressWithOptions(nil, frame, opts); err != ErrWindowTooLarge {
+		t.Fatalf("DecompressWithOptions returned %v, want ErrWindowTooLarge", err)
+	}
+	if _, err := DecompressIntoWithOptions(make([]byte, len(payload)), frame, opts); err != ErrWindowTooLarge {
+		t.Fatalf("DecompressIntoWithOptions returned %v, want ErrWindowTooLarge", err)
+	}
+	// Frames after the first one are checked too
+	small, err := Compress(nil, []byte("Hello World!"))
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	if _, err := DecompressWithOptions(nil, append(small, frame...), opts); err != ErrWindowTooLarge {
+		t.Fatalf("DecompressWithOptions returned %v, want ErrWindowTooLarge", err)
+	}
+
+	decompressed, err := DecompressWithOptions(nil, frame, DecompressOptions{MaxWindowLog: 24})
+	if err != nil {
+		t.Fatalf("DecompressWithOptions failed: %s", err)
+	}
+	if !bytes.Equal(decompressed, payload) {
+		t.Fatal("Decompressed data does not match")
+	}
+
+	if _, err := DecompressWithOptions(nil, frame, DecompressOptions{MaxWindowLog: 100}); err == nil {
+		t.Fatal("expected an out of bounds error")
+	} else if _, ok := err.(*ParameterBoundsError); !ok {
+		t.Fatalf("expected a ParameterBoundsError, got %v", err)
+	}
+}
+
+func TestDecompressMaxWindowLogStreamFallback(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello World! "), 1000)
+	frame := writerCompress(t, largeWindowParams, payload)
+
+	// The stream decoder enforces the limit by itself
+	if _, err := decompressStream(nil, frame, 0, DecompressOptions{MaxWindowLog: 20}); err != ErrWindowTooLarge {
+		t.Fatalf("decompressStream returned %v, want ErrWindowTooLarge", err)
+	}
+	decompressed, err := decompressStream(nil, frame, 0, DecompressOptions{MaxWindowLog: 24})
+	if err != nil {
+		t.Fatalf("decompressStream failed: %s", err)
+	}
+	if !bytes.Equal(decompressed, payload) {
+		t.Fatal("Decompressed data does not match")
+	}
+}
+
+func TestDecompressVerifyContentSize(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello World! "), 1000)
+	compressed, err := Compress(nil, payload)
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	opts := DecompressOptions{VerifyContentSize: true}
+	decompressed, err := DecompressWithOptions(nil, compressed, opts)
+	if err != nil || !bytes.Equal(decompressed, payload) {
+		t.Fatalf("DecompressWithOptions = (%d bytes, %v)", len(decompressed), err)
+	}
+	if n, err := DecompressIntoWithOptions(make([]byte, len(payload)), compressed, opts); err != nil || n != len(payload) {
+		t.Fatalf("DecompressIntoWithOptions = (%d, %v)", n, err)
+	}
+	// Frames without declared content size are not checked
+	streamed := writerCompress(t, largeWindowParams, payload)
+	if _, err := DecompressWithOptions(nil, streamed, opts); err != nil {
+		t.Fatalf("DecompressWithOptions failed: %s", err)
+	}
+
+	// Truncating the last block makes the frame hold less than declared
+	want := ErrContentSizeMismatch{Declared: uint64(2 * len(payload)), Actual: uint64(len(payload))}
+	truncated := append(append([]byte{}, compressed...), compressed[:len(compressed)-1]...)
+	if _, err := DecompressWithOptions(nil, truncated, opts); err != want {
+		t.Fatalf("DecompressWithOptions returned %v, want %v", err, want)
+	}
+	if _, err := DecompressIntoWithOptions(make([]byte, 2*len(payload)), truncated, opts); err != want {
+		t.Fatalf("DecompressIntoWithOptions returned %v, want %v", err, want)
+	}
+	if _, err := Decompress(nil, truncated); err == nil {
+		t.Fatal("Decompress of a truncated frame should fail")
+	} else if _, ok := err.(ErrContentSizeMismatch); ok {
+		t.Fatal("content size verification should be opt-in")
+	}
+}
+
+func TestDecompressMaxFrames(t *testing.T) {
+	src := tinyFrames(t, 10)
+
+	out, err := DecompressWithOptions(nil, src, DecompressOptions{MaxFrames: 10})
+	failOnError(t, "Failed to decompress up to the limit", err)
+	if len(out) != 10 {
+		t.Fatalf("Expected 10 bytes, got %d", len(out))
+	}
+	if _, err := DecompressWithOptions(nil, src, DecompressOptions{MaxFrames: 9}); err != ErrTooManyFrames {
+		t.Fatalf("Expected ErrTooManyFrames, got %v", err)
+	}
+	if _, err := DecompressIntoWithOptions(make([]byte, 10), src, DecompressOptions{MaxFrames: 9}); err != ErrTooManyFrames {
+		t.Fatalf("Expected ErrTooManyFrames, got %v", err)
+	}
+
+	// Decompress is unlimited, the options have a default limit
+	many := tinyFrames(t, DefaultMaxFrames+1)
+	_, err = Decompress(nil, many)
+	failOnError(t, "Failed to decompress", err)
+	if _, err := DecompressWithOptions(nil, many, DecompressOptions{}); err != ErrTooManyFrames {
+		t.Fatalf("Expected ErrTooManyFrames by default, got %v", err)
+	}
+	_, err = DecompressWithOptions(nil, many, DecompressOptions{MaxFrames: -1})
+	failOnError(t, "Failed to decompress without limit", err)
+}
+
+func TestDecompressContentHash(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello, World! "), 100000)
+	expected := NewXXH64()
+	expected.Write(payload)
+
+	oneShot, err := Compress(nil, payload)
+	failOnError(t, "Failed to compress", err)
+	// Streamed frames do not declare their size, and this one is well beyond
+	// the size hint, which switches to the stream fallback
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	_, err = w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	streamed := buf.Bytes()
+
+	for name, src := range map[string][]byte{"one-shot": oneShot, "streamed": streamed} {
+		for _, dst := range [][]byte{nil, make([]byte, 0, 10), make([]byte, 0, len(payload))} {
+			h := NewXXH64()
+			out, err := DecompressWithOptions(dst, src, DecompressOptions{ContentHash: h})
+			failOnError(t, "Failed to decompress", err)
+			if !bytes.Equal(out, payload) || h.Sum64() != expected.Sum64() {
+				t.Fatalf("%s, cap %d: digest %#x does not match %#x", name, cap(dst), h.Sum64(), expected.Sum64())
+			}
+		}
+
+		h := NewXXH64()
+		_, err := DecompressIntoWithOptions(make([]byte, len(payload)-1), src, DecompressOptions{ContentHash: h})
+		if !IsDstSizeTooSmallError(err) {
+			t.Fatalf("%s: expected a DstSizeTooSmallError, got %v", name, err)
+		}
+		n, err := DecompressIntoWithOptions(make([]byte, len(payload)), src, DecompressOptions{ContentHash: h})
+		failOnError(t, "Failed to decompress into", err)
+		if n != len(payload) || h.Sum64() != expected.Sum64() {
+			t.Fatalf("%s: DecompressIntoWithOptions digest %#x does not match %#x", name, h.Sum64(), expected.Sum64())
+		}
+	}
+}
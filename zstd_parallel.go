@@ -0,0 +1,396 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+)
+
+// DefaultParallelChunkSize is the size of the chunks compressed in parallel
+// when no chunk size is given.
+const DefaultParallelChunkSize = 4 << 20
+
+// pzstdMagic is the magic number of the skippable frames written by pzstd
+// before each frame, holding the compressed size of the frame.
+const pzstdMagic = 0x184D2A50
+
+// pzstdHintSize is the size of a pzstd skippable frame.
+const pzstdHintSize = 12
+
+// CompressParallel compresses the size bytes of src at level into dst,
+// cutting them into chunks of chunkSize bytes compressed as independent
+// frames by workers goroutines, like pzstd does. Frames are written in order,
+// and at most about 2*workers chunks are held in memory at once. The output
+// is a regular concatenation of frames, which decompresses with any zstd
+// decoder. The ratio is slightly worse than the one of a single frame, as
+// chunks cannot reference each other.
+//
+// A chunkSize of 0 selects DefaultParallelChunkSize, and workers of 0 the
+// number of CPUs.
+func CompressParallel(dst io.Writer, src io.ReaderAt, size int64, level, workers, chunkSize int) error {
+	return compressParallel(dst, src, size, level, workers, chunkSize, false)
+}
+
+// CompressParallelPzstd is like CompressParallel but precedes each frame with
+// the skippable frame holding its compressed size written by pzstd, which
+// lets pzstd find the frames without parsing them to decompress them in
+// parallel. Decoders unaware of them skip these frames.
+func CompressParallelPzstd(dst io.Writer, src io.ReaderAt, size int64, level, workers, chunkSize int) error {
+	return compressParallel(dst, src, size, level, workers, chunkSize, true)
+}
+
+// CompressFileParallel compresses the file at srcPath into the file at
+// dstPath with CompressParallelPzstd, using one worker per CPU.
+func CompressFileParallel(dstPath, srcPath string, level int) (err error) {
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return CompressParallelPzstd(out, in, info.Size(), level, 0, 0)
+}
+
+type parallelChunk struct {
+	out []byte
+	err error
+}
+
+func compressParallel(dst io.Writer, src io.ReaderAt, size int64, level, workers, chunkSize int, hints bool) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultParallelChunkSize
+	}
+	if size <= 0 {
+		// A single empty frame keeps the output valid
+		out, err := CompressLevel(nil, nil, level)
+		if err != nil {
+			return err
+		}
+		return writeParallelFrame(dst, out, hints)
+	}
+
+	type job struct {
+		offset int64
+		result chan parallelChunk
+	}
+	jobs := make(chan job)
+	// The results in order, bounding the number of chunks in flight
+	pending := make(chan chan parallelChunk, workers)
+	done := make(chan struct{})
+	defer close(done)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			cctx, err := newCCtx()
+			if err == nil {
+				defer freeCCtx(cctx)
+				err = setCParameter(cctx, CParamCompressionLevel, level)
+			}
+			buf := make([]byte, chunkSize)
+			for j := range jobs {
+				if err != nil {
+					j.result <- parallelChunk{err: err}
+					continue
+				}
+				n := chunkSize
+				if remaining := size - j.offset; remaining < int64(n) {
+					n = int(remaining)
+				}
+				var c parallelChunk
+				read, rerr := src.ReadAt(buf[:n], j.offset)
+				if read == n {
+					// ReadAt may return io.EOF along with the last bytes
+					rerr = nil
+				}
+				if c.err = rerr; c.err == nil {
+					c.out, c.err = compress2(cctx, nil, buf[:n])
+				}
+				j.result <- c
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		for offset := int64(0); offset < size; offset += int64(chunkSize) {
+			j := job{offset: offset, result: make(chan parallelChunk, 1)}
+			select {
+			case pending <- j.result:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- j:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for result := range pending {
+		c := <-result
+		if c.err != nil {
+			return c.err
+		}
+		if err := writeParallelFrame(dst, c.out, hints); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeParallelFrame writes frame to dst, preceded by its pzstd skippable
+// frame if hints is set.
+func writeParallelFrame(dst io.Writer, frame []byte, hints bool) error {
+	if hints {
+		var hint [pzstdHintSize]byte
+		binary.LittleEndian.PutUint32(hint[0:], pzstdMagic)
+		binary.LittleEndian.PutUint32(hint[4:], 4)
+		binary.LittleEndian.PutUint32(hint[8:], uint32(len(frame)))
+		if _, err := dst.Write(hint[:]); err != nil {
+			return err
+		}
+	}
+	_, err := dst.Write(frame)
+	return err
+}
+
+// DecompressParallelStream decompresses the size bytes of src into dst,
+// decoding its frames concurrently on workers goroutines, e.g. the output of
+// CompressParallel. Frames are found with ZSTD_findFrameCompressedSize on a
+// window read ahead, without decoding them. The output is written in order,
+// and at most about 2*workers frames are held in memory at once.
+//
+// An input made of a single frame, or of frames which cannot be found without
+// decoding them, such as frames larger than 64MB, is decoded sequentially with
+// the stream API. workers of 0 selects the number of CPUs. The global limits
+// apply to the whole input, see SetGlobalLimits.
+func DecompressParallelStream(dst io.Writer, src io.ReaderAt, size int64, workers int) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type job struct {
+		frame  []byte
+		result chan parallelChunk
+	}
+	jobs := make(chan job)
+	// The frames in order, bounding the number of frames in flight. A nil
+	// result means the rest of the input, from sequentialOffset after
+	// sequentialFrames frames, is decoded sequentially.
+	pending := make(chan chan parallelChunk, workers)
+	sequentialOffset, sequentialFrames := int64(-1), 0
+	done := make(chan struct{})
+	l := GlobalLimits()
+	defer close(done)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range jobs {
+				var c parallelChunk
+				c.out, c.err = Decompress(nil, j.frame)
+				j.result <- c
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		// report reports err in order, once the previous frames are written
+		report := func(err error) {
+			result := make(chan parallelChunk, 1)
+			result <- parallelChunk{err: err}
+			select {
+			case pending <- result:
+			case <-done:
+			}
+		}
+		s := frameScanner{src: src, size: size}
+		queued := false
+		frames := 0
+		for offset := int64(0); offset < size; {
+			frame, skippable, err := s.next(offset)
+			length := int64(len(frame))
+			single := !queued && !skippable && offset+length == size
+			if err == ErrFrameTruncated {
+				report(err)
+				return
+			}
+			if err != nil || single {
+				// Decoding sequentially is the only option, or as good
+				sequentialOffset, sequentialFrames = offset, frames
+				select {
+				case pending <- nil:
+				case <-done:
+				}
+				return
+			}
+			if frames++; l.MaxFrames > 0 && frames > l.MaxFrames {
+				report(ErrTooManyFrames)
+				return
+			}
+			if !skippable {
+				// The window of the scanner is reused for the next frames
+				j := job{frame: append([]byte(nil), frame...), result: make(chan parallelChunk, 1)}
+				select {
+				case pending <- j.result:
+				case <-done:
+					return
+				}
+				select {
+				case jobs <- j:
+				case <-done:
+					return
+				}
+				queued = true
+			}
+			offset += length
+		}
+	}()
+
+	var written int64
+	for result := range pending {
+		if result == nil {
+			return decompressSequential(dst, io.NewSectionReader(src, sequentialOffset, size-sequentialOffset),
+				l, sequentialFrames, written)
+		}
+		c := <-result
+		if c.err != nil {
+			return c.err
+		}
+		written += int64(len(c.out))
+		if err := l.checkSize(uint64(written)); err != nil {
+			return err
+		}
+		if _, err := dst.Write(c.out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decompressSequential decompresses src to dst with the stream API, the rest
+// of an input whose first frames decompressed to written bytes, which count
+// against the limits l.
+func decompressSequential(dst io.Writer, src io.Reader, l Limits, frames int, written int64) error {
+	if l.MaxFrames > 0 && frames >= l.MaxFrames {
+		return ErrTooManyFrames
+	}
+	r := newReader(src, nil)
+	defer r.Close()
+	if l.MaxFrames > 0 {
+		r.maxFrames = l.MaxFrames - frames
+	}
+	if l.MaxSize <= 0 {
+		_, err := io.Copy(dst, r)
+		return err
+	}
+	// One more byte tells outputs exceeding the limit apart
+	n, err := io.Copy(dst, io.LimitReader(r, int64(l.MaxSize)-written+1))
+	if err == nil {
+		err = l.checkSize(uint64(written + n))
+	}
+	return err
+}
+
+// minScanWindow is the size of the first read of a frameScanner.
+const minScanWindow = 128 << 10
+
+// maxScanWindow bounds the window of a frameScanner, and so the size of the
+// frames it can find, a variable for the tests.
+var maxScanWindow = 64 << 20
+
+// errFrameTooLarge is returned by frameScanner for frames larger than
+// maxScanWindow.
+var errFrameTooLarge = errors.New("Frame is too large to scan")
+
+// frameScanner finds the frames of the size bytes of src without decoding
+// them, with ZSTD_findFrameCompressedSize on a window read ahead. The window
+// is reused across frames and doubles, up to maxScanWindow bytes, until it
+// holds the whole frame.
+type frameScanner struct {
+	src          io.ReaderAt
+	size         int64
+	window       []byte
+	windowOffset int64
+}
+
+// next returns the frame at offset, valid until the next call, and whether it
+// is a skippable frame. It returns ErrFrameTruncated if the frame ends after
+// size and errFrameTooLarge if it does not fit in the window, other errors are
+// left to the stream decoder to report.
+func (s *frameScanner) next(offset int64) ([]byte, bool, error) {
+	if offset < s.windowOffset || offset >= s.windowOffset+int64(len(s.window)) {
+		if err := s.fill(offset, 0); err != nil {
+			return nil, false, err
+		}
+	}
+	for {
+		frame := s.window[offset-s.windowOffset:]
+		length, err := FindFrameCompressedSize(frame)
+		switch {
+		case err == nil:
+			frame = frame[:length]
+			return frame, IsSkippableFrame(frame), nil
+		case err != ErrFrameTruncated:
+			return nil, false, err
+		case offset+int64(len(frame)) == s.size:
+			return nil, false, ErrFrameTruncated
+		case len(frame) >= maxScanWindow:
+			return nil, false, errFrameTooLarge
+		}
+		if err := s.fill(offset, 2*len(frame)); err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// fill reads the window of n bytes at offset, at least minScanWindow and at
+// most maxScanWindow, fewer at the end of the input.
+func (s *frameScanner) fill(offset int64, n int) error {
+	if n < minScanWindow {
+		n = minScanWindow
+	}
+	if n > maxScanWindow {
+		n = maxScanWindow
+	}
+	if remaining := s.size - offset; remaining < int64(n) {
+		n = int(remaining)
+	}
+	if cap(s.window) < n {
+		s.window = make([]byte, n)
+	}
+	s.window, s.windowOffset = s.window[:n], offset
+	read, err := s.src.ReadAt(s.window, offset)
+	if read == n {
+		// ReadAt may return io.EOF along with the last bytes
+		return nil
+	}
+	s.window = s.window[:read]
+	if err == io.EOF {
+		return ErrFrameTruncated
+	}
+	return err
+}
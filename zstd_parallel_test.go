@@ -0,0 +1,224 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/colinlyguo/zstd/zstdtest"
+)
+
+func TestCompressParallel(t *testing.T) {
+	for _, size := range []int{0, 1, 1000, 4096, 4097, 100000} {
+		payload := zstdtest.Compressible(1, size)
+		for _, hints := range []bool{false, true} {
+			var buf bytes.Buffer
+			err := compressParallel(&buf, bytes.NewReader(payload), int64(size), 3, 3, 4096, hints)
+			failOnError(t, "Failed to compress", err)
+
+			out, err := Decompress(nil, buf.Bytes())
+			failOnError(t, "Failed to decompress", err)
+			if !bytes.Equal(out, payload) {
+				t.Fatalf("size=%d hints=%v: Decompress output does not match", size, hints)
+			}
+			out, err = ioutil.ReadAll(NewReader(bytes.NewReader(buf.Bytes())))
+			failOnError(t, "Failed to read", err)
+			if !bytes.Equal(out, payload) {
+				t.Fatalf("size=%d hints=%v: Reader output does not match", size, hints)
+			}
+
+			frames, err := SplitFrames(buf.Bytes())
+			failOnError(t, "Failed to split frames", err)
+			chunks := (size + 4095) / 4096
+			if chunks == 0 {
+				chunks = 1
+			}
+			if hints {
+				chunks *= 2
+			}
+			if len(frames) != chunks {
+				t.Fatalf("size=%d hints=%v: expected %d frames, got %d", size, hints, chunks, len(frames))
+			}
+			if hints {
+				for i := 0; i < len(frames); i += 2 {
+					hint := frames[i]
+					if len(hint) != pzstdHintSize || binary.LittleEndian.Uint32(hint) != pzstdMagic ||
+						int(binary.LittleEndian.Uint32(hint[8:])) != len(frames[i+1]) {
+						t.Fatalf("size=%d: invalid pzstd hint %x", size, hint)
+					}
+				}
+			}
+		}
+	}
+}
+
+type failingReaderAt struct{}
+
+func (failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= 8192 {
+		return 0, errors.New("read failure")
+	}
+	return len(p), nil
+}
+
+func TestCompressParallelReadError(t *testing.T) {
+	var buf bytes.Buffer
+	err := CompressParallel(&buf, failingReaderAt{}, 1<<20, 3, 4, 4096)
+	if err == nil || err.Error() != "read failure" {
+		t.Fatalf("Expected the read failure, got %v", err)
+	}
+}
+
+func TestCompressFileParallel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zstd-parallel")
+	failOnError(t, "Failed to create temp dir", err)
+	defer os.RemoveAll(dir)
+
+	payload := zstdtest.Compressible(1, 3*DefaultParallelChunkSize+12345)
+	src := filepath.Join(dir, "payload")
+	failOnError(t, "Failed to write payload", ioutil.WriteFile(src, payload, 0644))
+	dst := src + ".zst"
+	failOnError(t, "Failed to compress", CompressFileParallel(dst, src, 3))
+
+	compressed, err := ioutil.ReadFile(dst)
+	failOnError(t, "Failed to read compressed file", err)
+	out, err := Decompress(nil, compressed)
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(out, payload) {
+		t.Fatal("Round trip does not match")
+	}
+
+	// The stock command line tool decodes it too
+	zstdCLI, err := exec.LookPath("zstd")
+	if err != nil {
+		t.Skip("zstd command line tool not found")
+	}
+	out, err = exec.Command(zstdCLI, "-d", "-c", dst).Output()
+	failOnError(t, "Failed to decompress with the zstd command line tool", err)
+	if !bytes.Equal(out, payload) {
+		t.Fatal("Output of the zstd command line tool does not match")
+	}
+}
+
+func TestDecompressParallelStream(t *testing.T) {
+	payload := zstdtest.Compressible(1, 100000)
+	plain := new(bytes.Buffer)
+	failOnError(t, "Failed to compress", CompressParallel(plain, bytes.NewReader(payload), int64(len(payload)), 3, 4, 4096))
+	hinted := new(bytes.Buffer)
+	failOnError(t, "Failed to compress", CompressParallelPzstd(hinted, bytes.NewReader(payload), int64(len(payload)), 3, 4, 4096))
+	single, err := Compress(nil, payload)
+	failOnError(t, "Failed to compress", err)
+
+	// Frames with checksums, RLE blocks and a foreign skippable frame
+	var mixed []byte
+	a, err := CompressWithParams(nil, payload[:50000], CParams{Checksum: true})
+	failOnError(t, "Failed to compress", err)
+	b, err := Compress(nil, make([]byte, 300000))
+	failOnError(t, "Failed to compress", err)
+	c, err := Compress(nil, payload[50000:])
+	failOnError(t, "Failed to compress", err)
+	mixed = append(mixed, a...)
+	mixed = append(mixed, 0x5e, 0x2a, 0x4d, 0x18, 3, 0, 0, 0, 'a', 'b', 'c')
+	mixed = append(mixed, b...)
+	mixed = append(mixed, c...)
+	mixedPayload := append(append(append([]byte(nil), payload[:50000]...), make([]byte, 300000)...), payload[50000:]...)
+
+	for _, tc := range []struct {
+		name    string
+		src     []byte
+		payload []byte
+	}{
+		{"plain", plain.Bytes(), payload},
+		{"pzstd", hinted.Bytes(), payload},
+		{"single", single, payload},
+		{"mixed", mixed, mixedPayload},
+	} {
+		for _, workers := range []int{1, 3} {
+			var out bytes.Buffer
+			err := DecompressParallelStream(&out, bytes.NewReader(tc.src), int64(len(tc.src)), workers)
+			failOnError(t, tc.name+": failed to decompress", err)
+			if !bytes.Equal(out.Bytes(), tc.payload) {
+				t.Fatalf("%s workers=%d: output does not match", tc.name, workers)
+			}
+		}
+	}
+
+	// A truncated input is reported after the previous frames
+	src := plain.Bytes()[:plain.Len()-10]
+	if err := DecompressParallelStream(ioutil.Discard, bytes.NewReader(src), int64(len(src)), 2); err != ErrFrameTruncated {
+		t.Fatalf("Expected ErrFrameTruncated, got %v", err)
+	}
+}
+
+func TestFrameScanner(t *testing.T) {
+	payload := zstdtest.Compressible(1, 100000)
+	var frames [][]byte
+	for _, params := range []CParams{{}, {Checksum: true}, {Level: 19}} {
+		frame, err := CompressWithParams(nil, payload, params)
+		failOnError(t, "Failed to compress", err)
+		frames = append(frames, frame)
+	}
+	// Larger than the first window
+	large, err := Compress(nil, zstdtest.Random(1, 3*minScanWindow))
+	failOnError(t, "Failed to compress", err)
+	frames = append(frames, large, []byte{0x5e, 0x2a, 0x4d, 0x18, 3, 0, 0, 0, 'a', 'b', 'c'})
+	src := bytes.Join(frames, nil)
+
+	s := frameScanner{src: bytes.NewReader(src), size: int64(len(src))}
+	offset := int64(0)
+	for i, want := range frames {
+		frame, skippable, err := s.next(offset)
+		failOnError(t, "Failed to scan frame", err)
+		if !bytes.Equal(frame, want) || skippable != (i == len(frames)-1) {
+			t.Fatalf("frame %d: expected %d bytes, got %d", i, len(want), len(frame))
+		}
+		offset += int64(len(frame))
+	}
+
+	s = frameScanner{src: bytes.NewReader(large), size: int64(len(large) - 1)}
+	if _, _, err := s.next(0); err != ErrFrameTruncated {
+		t.Fatalf("Expected ErrFrameTruncated, got %v", err)
+	}
+	defer func(n int) { maxScanWindow = n }(maxScanWindow)
+	maxScanWindow = len(large) - 1
+	s = frameScanner{src: bytes.NewReader(large), size: int64(len(large))}
+	if _, _, err := s.next(0); err != errFrameTooLarge {
+		t.Fatalf("Expected errFrameTooLarge, got %v", err)
+	}
+
+	// The frames which cannot be found are decoded sequentially
+	var out bytes.Buffer
+	src = append(append([]byte(nil), frames[0]...), large...)
+	failOnError(t, "Failed to decompress", DecompressParallelStream(&out, bytes.NewReader(src), int64(len(src)), 2))
+	if !bytes.Equal(out.Bytes(), append(append([]byte(nil), payload...), zstdtest.Random(1, 3*minScanWindow)...)) {
+		t.Fatal("Output does not match")
+	}
+}
+
+func BenchmarkDecompressParallelStream(b *testing.B) {
+	payload := zstdtest.Compressible(1, 64<<20)
+	var buf bytes.Buffer
+	if err := CompressParallelPzstd(&buf, bytes.NewReader(payload), int64(len(payload)), 3, 0, 1<<20); err != nil {
+		b.Fatal(err)
+	}
+	src := buf.Bytes()
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(payload)))
+			for i := 0; i < b.N; i++ {
+				if err := DecompressParallelStream(ioutil.Discard, bytes.NewReader(src), int64(len(src)), workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
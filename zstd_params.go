@@ -0,0 +1,411 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"context"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// Strategy is a compression strategy, from the fastest to the strongest.
+// Each compression level selects one, setting it explicitly overrides it.
+type Strategy int
+
+// Strategies mirror ZSTD_strategy from zstd.h
+const (
+	StrategyFast     Strategy = C.ZSTD_fast
+	StrategyDfast    Strategy = C.ZSTD_dfast
+	StrategyGreedy   Strategy = C.ZSTD_greedy
+	StrategyLazy     Strategy = C.ZSTD_lazy
+	StrategyLazy2    Strategy = C.ZSTD_lazy2
+	StrategyBtlazy2  Strategy = C.ZSTD_btlazy2
+	StrategyBtopt    Strategy = C.ZSTD_btopt
+	StrategyBtultra  Strategy = C.ZSTD_btultra
+	StrategyBtultra2 Strategy = C.ZSTD_btultra2
+)
+
+var strategyNames = map[Strategy]string{
+	StrategyFast:     "fast",
+	StrategyDfast:    "dfast",
+	StrategyGreedy:   "greedy",
+	StrategyLazy:     "lazy",
+	StrategyLazy2:    "lazy2",
+	StrategyBtlazy2:  "btlazy2",
+	StrategyBtopt:    "btopt",
+	StrategyBtultra:  "btultra",
+	StrategyBtultra2: "btultra2",
+}
+
+// String returns the name of the strategy as used in zstd.h, without the
+// ZSTD_ prefix.
+func (s Strategy) String() string {
+	if name, ok := strategyNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// CParams holds advanced compression parameters, see zstd.h for the details
+// of each of them. The zero value of a field keeps the default behavior.
+type CParams struct {
+	// Preset selects the parameters of PresetParams(Preset), which the other
+	// fields override when they are not at their zero value. Checksum can
+	// only be turned off through Params. 0 means no preset.
+	Preset Preset
+
+	// Level is the compression level, 0 means DefaultCompression
+	Level int
+
+	// SrcSizeHint is the expected size of the input when it is not known
+	// upfront, which lets libzstd select parameters tuned for small inputs
+	// instead of the defaults for unknown sizes. It only matters when the
+	// size is unknown, i.e. with the streaming Writer. 0 means no hint.
+	SrcSizeHint int
+
+	// Strategy forces a compression strategy independently of the level,
+	// 0 keeps the strategy selected by the level
+	Strategy Strategy
+
+	// WindowLog is the log2 of the maximum back-reference distance, which is
+	// also the memory needed to decompress in streaming mode. 0 keeps the
+	// window selected by the level.
+	WindowLog int
+
+	// Checksum appends a 32-bit checksum of the content to each frame, which
+	// is verified on decompression
+	Checksum bool
+
+	// BlockDelimiters tells CompressSequences whether the sequences contain
+	// block delimiters, it is ignored otherwise
+	BlockDelimiters SequenceFormat
+
+	// Progress, if set, is called by CompressWithParams and
+	// CompressWithContextParams with the number of bytes of input consumed
+	// and of output produced so far, once per chunk of 1MB of input and once
+	// with (len(src), size of the frame) at completion. It is called from
+	// the calling goroutine, never after an error. It is ignored otherwise.
+	Progress func(consumed, produced int64)
+
+	// Params are further parameters, set in order after the fields above
+	Params []ParamValue
+}
+
+// WriterParams holds the parameters of a Writer created by NewWriterParams.
+type WriterParams struct {
+	CParams
+
+	// Dict is an optional dictionary, see NewWriterLevelDict
+	Dict []byte
+}
+
+// CParameter is an advanced compression parameter, see ZSTD_cParameter in
+// zstd.h for the details of each of them.
+type CParameter int
+
+// Compression parameters mirror ZSTD_cParameter from zstd.h
+const (
+	CParamCompressionLevel CParameter = C.ZSTD_c_compressionLevel
+	CParamWindowLog        CParameter = C.ZSTD_c_windowLog
+	CParamHashLog          CParameter = C.ZSTD_c_hashLog
+	CParamChainLog         CParameter = C.ZSTD_c_chainLog
+	CParamSearchLog        CParameter = C.ZSTD_c_searchLog
+	CParamMinMatch         CParameter = C.ZSTD_c_minMatch
+	CParamTargetLength     CParameter = C.ZSTD_c_targetLength
+	CParamStrategy         CParameter = C.ZSTD_c_strategy
+	CParamLongDistance     CParameter = C.ZSTD_c_enableLongDistanceMatching
+	CParamLdmHashLog       CParameter = C.ZSTD_c_ldmHashLog
+	CParamLdmMinMatch      CParameter = C.ZSTD_c_ldmMinMatch
+	CParamContentSizeFlag  CParameter = C.ZSTD_c_contentSizeFlag
+	CParamChecksumFlag     CParameter = C.ZSTD_c_checksumFlag
+	CParamDictIDFlag       CParameter = C.ZSTD_c_dictIDFlag
+	CParamNbWorkers        CParameter = C.ZSTD_c_nbWorkers
+	CParamJobSize          CParameter = C.ZSTD_c_jobSize
+	CParamOverlapLog       CParameter = C.ZSTD_c_overlapLog
+	CParamSrcSizeHint      CParameter = C.ZSTD_c_srcSizeHint
+	CParamBlockDelimiters  CParameter = C.ZSTD_c_blockDelimiters
+)
+
+var cParameterNames = map[CParameter]string{
+	CParamCompressionLevel: "compressionLevel",
+	CParamWindowLog:        "windowLog",
+	CParamHashLog:          "hashLog",
+	CParamChainLog:         "chainLog",
+	CParamSearchLog:        "searchLog",
+	CParamMinMatch:         "minMatch",
+	CParamTargetLength:     "targetLength",
+	CParamStrategy:         "strategy",
+	CParamLongDistance:     "enableLongDistanceMatching",
+	CParamLdmHashLog:       "ldmHashLog",
+	CParamLdmMinMatch:      "ldmMinMatch",
+	CParamContentSizeFlag:  "contentSizeFlag",
+	CParamChecksumFlag:     "checksumFlag",
+	CParamDictIDFlag:       "dictIDFlag",
+	CParamNbWorkers:        "nbWorkers",
+	CParamJobSize:          "jobSize",
+	CParamOverlapLog:       "overlapLog",
+	CParamSrcSizeHint:      "srcSizeHint",
+	CParamBlockDelimiters:  "blockDelimiters",
+
+	// Experimental parameters of the scroll batch encoding
+	C.ZSTD_c_literalCompressionMode: "literalCompressionMode",
+	C.ZSTD_c_targetCBlockSize:       "targetCBlockSize",
+	C.ZSTD_c_format:                 "format",
+}
+
+// String returns the name of the parameter as used in zstd.h, without the
+// ZSTD_c_ prefix.
+func (p CParameter) String() string {
+	if name, ok := cParameterNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("CParameter(%d)", int(p))
+}
+
+// DParameter is an advanced decompression parameter, see ZSTD_dParameter in
+// zstd.h for the details of each of them.
+type DParameter int
+
+// Decompression parameters mirror ZSTD_dParameter from zstd.h
+const (
+	DParamWindowLogMax DParameter = C.ZSTD_d_windowLogMax
+	DParamFormat       DParameter = C.ZSTD_d_format
+)
+
+var dParameterNames = map[DParameter]string{
+	DParamWindowLogMax: "windowLogMax",
+	DParamFormat:       "format",
+}
+
+// String returns the name of the parameter as used in zstd.h, without the
+// ZSTD_d_ prefix.
+func (p DParameter) String() string {
+	if name, ok := dParameterNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("DParameter(%d)", int(p))
+}
+
+// ParamBounds returns the inclusive range of values of a compression
+// parameter supported by the linked libzstd, which varies across versions.
+func ParamBounds(param CParameter) (min, max int, err error) {
+	bounds := C.ZSTD_cParam_getBounds(C.ZSTD_cParameter(param))
+	if err := getError(int(bounds.error)); err != nil {
+		return 0, 0, opError("ZSTD_cParam_getBounds", 0, 0, err)
+	}
+	return int(bounds.lowerBound), int(bounds.upperBound), nil
+}
+
+// levelBounds returns the bounds of the compression levels of the linked
+// libzstd, which an external libzstd of another version may not share with
+// minLevel and maxLevel.
+func levelBounds() (min, max int) {
+	if min, max, err := ParamBounds(CParamCompressionLevel); err == nil {
+		return min, max
+	}
+	return minLevel, maxLevel
+}
+
+// HasMultithreadSupport reports whether the linked libzstd can compress with
+// workers, see Writer.SetNbWorkers. It is false when built with the zstd_nomt
+// tag, or against an external libzstd built without multithreading.
+func HasMultithreadSupport() bool {
+	_, max, err := ParamBounds(CParamNbWorkers)
+	return err == nil && max > 0
+}
+
+// DParamBounds is like ParamBounds for decompression parameters.
+func DParamBounds(param DParameter) (min, max int, err error) {
+	bounds := C.ZSTD_dParam_getBounds(C.ZSTD_dParameter(param))
+	if err := getError(int(bounds.error)); err != nil {
+		return 0, 0, opError("ZSTD_dParam_getBounds", 0, 0, err)
+	}
+	return int(bounds.lowerBound), int(bounds.upperBound), nil
+}
+
+// setCParameter validates value against the bounds of param, then sets it on
+// cctx.
+func setCParameter(cctx *C.ZSTD_CCtx, param CParameter, value int) error {
+	if err := checkCParameter(param, value); err != nil {
+		return err
+	}
+	return opError("ZSTD_CCtx_setParameter", 0, 0, getError(int(C.ZSTD_CCtx_setParameter(cctx, C.ZSTD_cParameter(param), C.int(value)))))
+}
+
+// checkCParameter validates value against the bounds of param. The
+// parameters of the workers fail with ErrNotSupported when multithreading is
+// not available, unless value is 0.
+func checkCParameter(param CParameter, value int) error {
+	switch param {
+	case CParamNbWorkers, CParamJobSize, CParamOverlapLog:
+		if value != 0 && !HasMultithreadSupport() {
+			return ErrNotSupported
+		}
+	}
+	min, max, err := ParamBounds(param)
+	if err != nil {
+		return err
+	}
+	return checkBounds(param.String(), value, min, max)
+}
+
+// checkDParameter validates value against the bounds of param.
+func checkDParameter(param DParameter, value int) error {
+	min, max, err := DParamBounds(param)
+	if err != nil {
+		return err
+	}
+	return checkBounds(param.String(), value, min, max)
+}
+
+// setDParameter validates value against the bounds of param, then sets it on
+// dctx.
+func setDParameter(dctx *C.ZSTD_DCtx, param DParameter, value int) error {
+	if err := checkDParameter(param, value); err != nil {
+		return err
+	}
+	return opError("ZSTD_DCtx_setParameter", 0, 0, getError(int(C.ZSTD_DCtx_setParameter(dctx, C.ZSTD_dParameter(param), C.int(value)))))
+}
+
+// apply sets the parameters on cctx, leaving the ones at their zero value
+// untouched.
+func (p CParams) apply(cctx *C.ZSTD_CCtx) error {
+	return p.each(func(param CParameter, value int) error {
+		return setCParameter(cctx, param, value)
+	})
+}
+
+// each calls set with the parameters which are not at their zero value, the
+// compression level always, stopping at the first error. The preset is
+// expanded first.
+func (p CParams) each(set func(param CParameter, value int) error) error {
+	p, err := p.withPreset()
+	if err != nil {
+		return err
+	}
+	level := p.Level
+	if level == 0 {
+		level = DefaultCompression
+	}
+	if err := set(CParamCompressionLevel, level); err != nil {
+		return err
+	}
+	if p.SrcSizeHint != 0 {
+		if err := set(CParamSrcSizeHint, p.SrcSizeHint); err != nil {
+			return err
+		}
+	}
+	if p.Strategy != 0 {
+		if err := set(CParamStrategy, int(p.Strategy)); err != nil {
+			return err
+		}
+	}
+	if p.WindowLog != 0 {
+		if err := set(CParamWindowLog, p.WindowLog); err != nil {
+			return err
+		}
+	}
+	if p.Checksum {
+		if err := set(CParamChecksumFlag, 1); err != nil {
+			return err
+		}
+	}
+	if p.BlockDelimiters != 0 {
+		if err := set(CParamBlockDelimiters, int(p.BlockDelimiters)); err != nil {
+			return err
+		}
+	}
+	for _, pv := range p.Params {
+		if err := set(pv.Param, pv.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress2 compresses src into dst with the parameters already set on cctx.
+func compress2(cctx *C.ZSTD_CCtx, dst, src []byte) ([]byte, error) {
+	bound := CompressBound(len(src))
+	if cap(dst) >= bound {
+		dst = dst[0:bound] // Reuse dst buffer
+	} else {
+		dst = make([]byte, bound)
+	}
+	return compress2Into(cctx, dst, src)
+}
+
+// compress2Into is like compress2 but compresses into dst as is, failing with
+// a dstSize_tooSmall error if the frame does not fit. dst must not be empty.
+func compress2Into(cctx *C.ZSTD_CCtx, dst, src []byte) ([]byte, error) {
+	var srcPtr *byte // Do not point anywhere, if src is empty
+	if len(src) > 0 {
+		srcPtr = &src[0]
+	}
+	hook, start := startTrace()
+	written := int(C.ZSTD_compress2(
+		cctx,
+		unsafe.Pointer(&dst[0]),
+		C.size_t(len(dst)),
+		unsafe.Pointer(srcPtr),
+		C.size_t(len(src))))
+	if hook != nil {
+		endTrace(hook, start, Event{Op: "ZSTD_compress2", SrcSize: len(src), DstSize: len(dst),
+			Consumed: len(src), Written: written, Err: getError(written)})
+	}
+	if err := getError(written); err != nil {
+		return nil, opError("ZSTD_compress2", len(src), len(dst), err)
+	}
+	return dst[:written], nil
+}
+
+// CompressWithParams is like CompressLevel but compresses with advanced
+// parameters. It reuses the contexts of the presets warmed up by Warmup.
+func CompressWithParams(dst, src []byte, params CParams) ([]byte, error) {
+	if pool := warmPoolOf(params); pool != nil {
+		return pool.Compress(dst, src)
+	}
+	cctx, err := newCCtx()
+	if err != nil {
+		return nil, err
+	}
+	defer freeCCtx(cctx)
+
+	if err := params.apply(cctx); err != nil {
+		return nil, err
+	}
+	if params.Progress != nil {
+		// Compress in chunks to report progress between them
+		return compressWithContext(context.Background(), cctx, dst, src, params.Progress)
+	}
+	return compress2(cctx, dst, src)
+}
+
+// NewWriterParams is like NewWriterLevelDict but creates a Writer with
+// advanced parameters. Invalid parameters are reported immediately instead
+// of on the first Write.
+func NewWriterParams(w io.Writer, params WriterParams) (*Writer, error) {
+	cparams, err := params.CParams.withPreset()
+	if err != nil {
+		return nil, err
+	}
+	level := cparams.Level
+	if level == 0 {
+		level = DefaultCompression
+	}
+	dict := params.Dict
+	if len(dict) == 0 {
+		dict = nil
+	}
+	zw := NewWriterLevelDict(w, level, dict)
+	if zw.firstError == nil {
+		zw.firstError = params.CParams.apply(zw.ctx)
+	}
+	if zw.firstError != nil {
+		zw.free()
+		return nil, zw.firstError
+	}
+	return zw, nil
+}
@@ -0,0 +1,230 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// jsonDocuments returns n distinct ~1KB JSON documents
+func jsonDocuments(n int) [][]byte {
+	docs := make([][]byte, n)
+	for i := range docs {
+		var b bytes.Buffer
+		b.WriteString(`{"items":[`)
+		for j := 0; b.Len() < 1000; j++ {
+			if j > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, `{"id":%d,"user":"user-%d","active":%t,"score":%d}`, i*100+j, (i+j)%13, j%2 == 0, (i*j)%1000)
+		}
+		b.WriteString(`]}`)
+		docs[i] = b.Bytes()
+	}
+	return docs
+}
+
+// writerCompress compresses src with a Writer created with params. Unlike
+// one-shot compression, the frame does not declare its content size.
+func writerCompress(t testing.TB, params WriterParams, src []byte) []byte {
+	var b bytes.Buffer
+	w, err := NewWriterParams(&b, params)
+	if err != nil {
+		t.Fatalf("NewWriterParams failed: %s", err)
+	}
+	if _, err := w.Write(src); err != nil {
+		t.Fatalf("Failed writing to compress object: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close compress object: %s", err)
+	}
+	return b.Bytes()
+}
+
+func TestCompressWithParams(t *testing.T) {
+	input := []byte("Hello World! Hello World! Hello World!")
+	for _, params := range []CParams{{}, {Level: BestSpeed}, {Level: BestCompression, SrcSizeHint: 100}} {
+		compressed, err := CompressWithParams(nil, input, params)
+		if err != nil {
+			t.Fatalf("%+v: CompressWithParams failed: %s", params, err)
+		}
+		decompressed, err := Decompress(nil, compressed)
+		if err != nil || !bytes.Equal(decompressed, input) {
+			t.Fatalf("%+v: round trip failed: %v", params, err)
+		}
+	}
+}
+
+func TestSrcSizeHintBounds(t *testing.T) {
+	_, err := CompressWithParams(nil, []byte("data"), CParams{SrcSizeHint: -1})
+	if e, ok := err.(*ParameterBoundsError); !ok || e.Parameter != "srcSizeHint" {
+		t.Fatalf("expected a srcSizeHint bounds error, got %v", err)
+	}
+	if _, err := NewWriterParams(&bytes.Buffer{}, WriterParams{CParams: CParams{SrcSizeHint: -1}}); err == nil {
+		t.Fatal("NewWriterParams accepted a negative hint")
+	}
+	ctx := NewCtx().(SrcSizeHinter)
+	if err := ctx.SetSrcSizeHint(-1); err == nil {
+		t.Fatal("SetSrcSizeHint accepted a negative hint")
+	}
+	if err := ctx.SetSrcSizeHint(0); err != nil {
+		t.Fatalf("SetSrcSizeHint(0) failed: %s", err)
+	}
+}
+
+func TestParamBounds(t *testing.T) {
+	min, max, err := ParamBounds(CParamWindowLog)
+	if err != nil {
+		t.Fatalf("ParamBounds failed: %s", err)
+	}
+	if min > 17 || max < 17 {
+		t.Fatalf("windowLog bounds [%d, %d] do not include 17", min, max)
+	}
+	if _, _, err := ParamBounds(CParameter(9999)); err == nil {
+		t.Fatal("ParamBounds accepted an unknown parameter")
+	}
+
+	min, max, err = DParamBounds(DParamWindowLogMax)
+	if err != nil {
+		t.Fatalf("DParamBounds failed: %s", err)
+	}
+	if min > 27 || max < 27 {
+		t.Fatalf("windowLogMax bounds [%d, %d] do not include the default 27", min, max)
+	}
+	if _, _, err := DParamBounds(DParameter(9999)); err == nil {
+		t.Fatal("DParamBounds accepted an unknown parameter")
+	}
+
+	// Validation errors cite the bounds of the linked library
+	_, err = CompressWithParams(nil, []byte("data"), CParams{WindowLog: 100})
+	wantMin, wantMax, _ := ParamBounds(CParamWindowLog)
+	if e, ok := err.(*ParameterBoundsError); !ok || e.Parameter != "windowLog" || e.Min != wantMin || e.Max != wantMax {
+		t.Fatalf("expected windowLog bounds [%d, %d], got %v", wantMin, wantMax, err)
+	}
+	if CParamWindowLog.String() != "windowLog" || CParameter(9999).String() != "CParameter(9999)" {
+		t.Fatalf("unexpected parameter names %s, %s", CParamWindowLog, CParameter(9999))
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	input := bytes.Repeat([]byte(`{"id":1,"name":"strategy","tags":["a","b"]}`), 100)
+	for s := StrategyFast; s <= StrategyBtultra2; s++ {
+		for _, level := range []int{BestSpeed, DefaultCompression} {
+			compressed, err := CompressWithParams(nil, input, CParams{Level: level, Strategy: s})
+			if err != nil {
+				t.Fatalf("%s level %d: CompressWithParams failed: %s", s, level, err)
+			}
+			decompressed, err := Decompress(nil, compressed)
+			if err != nil || !bytes.Equal(decompressed, input) {
+				t.Fatalf("%s level %d: round trip failed: %v", s, level, err)
+			}
+		}
+		compressed := writerCompress(t, WriterParams{CParams: CParams{Strategy: s}}, input)
+		decompressed, err := Decompress(nil, compressed)
+		if err != nil || !bytes.Equal(decompressed, input) {
+			t.Fatalf("%s: Writer round trip failed: %v", s, err)
+		}
+	}
+}
+
+func TestInvalidStrategy(t *testing.T) {
+	for _, s := range []Strategy{-1, StrategyBtultra2 + 1} {
+		_, err := CompressWithParams(nil, []byte("data"), CParams{Strategy: s})
+		e, ok := err.(*ParameterBoundsError)
+		if !ok || e.Parameter != "strategy" || e.Value != int(s) {
+			t.Fatalf("%s: expected a strategy bounds error, got %v", s, err)
+		}
+	}
+	if s := StrategyBtopt.String(); s != "btopt" {
+		t.Fatalf("StrategyBtopt.String() = %q", s)
+	}
+}
+
+func TestWriterSrcSizeHint(t *testing.T) {
+	for _, doc := range jsonDocuments(10) {
+		hinted := writerCompress(t, WriterParams{CParams: CParams{SrcSizeHint: len(doc)}}, doc)
+		decompressed, err := Decompress(nil, hinted)
+		if err != nil || !bytes.Equal(decompressed, doc) {
+			t.Fatalf("round trip failed: %v", err)
+		}
+	}
+}
+
+func TestCtxSrcSizeHint(t *testing.T) {
+	ctx := NewCtx()
+	if err := ctx.(SrcSizeHinter).SetSrcSizeHint(1024); err != nil {
+		t.Fatalf("SetSrcSizeHint failed: %s", err)
+	}
+	for _, doc := range jsonDocuments(10) {
+		compressed, err := ctx.Compress(nil, doc)
+		if err != nil {
+			t.Fatalf("Compress failed: %s", err)
+		}
+		decompressed, err := ctx.Decompress(nil, compressed)
+		if err != nil || !bytes.Equal(decompressed, doc) {
+			t.Fatalf("round trip failed: %v", err)
+		}
+	}
+}
+
+func benchmarkWriterSrcSizeHint(b *testing.B, hint bool) {
+	docs := jsonDocuments(100)
+	var in, out int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range docs {
+			params := WriterParams{}
+			if hint {
+				params.SrcSizeHint = len(doc)
+			}
+			out += len(writerCompress(b, params, doc))
+			in += len(doc)
+		}
+	}
+	b.ReportMetric(float64(in)/float64(out), "ratio")
+}
+
+func BenchmarkWriterNoSrcSizeHint(b *testing.B) {
+	benchmarkWriterSrcSizeHint(b, false)
+}
+
+func BenchmarkWriterSrcSizeHint(b *testing.B) {
+	benchmarkWriterSrcSizeHint(b, true)
+}
+
+func TestLevelBounds(t *testing.T) {
+	min, max, err := ParamBounds(CParamCompressionLevel)
+	if err != nil {
+		t.Fatalf("failed to get level bounds: %s", err)
+	}
+	if lo, hi := levelBounds(); min != lo || max != hi {
+		t.Fatalf("level bounds [%d, %d] differ from libzstd [%d, %d]", lo, hi, min, max)
+	}
+}
+
+func TestHasMultithreadSupport(t *testing.T) {
+	cctx, err := newCCtx()
+	failOnError(t, "Failed to create context", err)
+	defer freeCCtx(cctx)
+	failOnError(t, "Failed to disable workers", setCParameter(cctx, CParamNbWorkers, 0))
+
+	w := NewWriter(&bytes.Buffer{})
+	defer w.Close()
+	err = w.SetNbWorkers(2)
+	if HasMultithreadSupport() {
+		failOnError(t, "Failed to set workers", err)
+		failOnError(t, "Failed to set job size", setCParameter(cctx, CParamJobSize, 1<<20))
+		return
+	}
+	if err != ErrNotSupported {
+		t.Fatalf("Expected ErrNotSupported from SetNbWorkers, got %v", err)
+	}
+	for _, param := range []CParameter{CParamNbWorkers, CParamJobSize, CParamOverlapLog} {
+		if err := setCParameter(cctx, param, 1); err != ErrNotSupported {
+			t.Errorf("Expected ErrNotSupported setting %s, got %v", param, err)
+		}
+	}
+}
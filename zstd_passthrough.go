@@ -0,0 +1,22 @@
+package zstd
+
+// CompressIfSmaller is like CompressLevel but only keeps the compressed form
+// when it is smaller than src. Otherwise it returns src itself, not a copy,
+// with compressed set to false, so that callers can store it as is.
+func CompressIfSmaller(dst, src []byte, level int) (out []byte, compressed bool, err error) {
+	return CompressIfSmallerMargin(dst, src, level, 0)
+}
+
+// CompressIfSmallerMargin is like CompressIfSmaller but only keeps the
+// compressed form when it saves more than margin bytes, e.g. to account for
+// the cost of flagging compressed records in a storage layer.
+func CompressIfSmallerMargin(dst, src []byte, level, margin int) (out []byte, compressed bool, err error) {
+	out, err = CompressLevel(dst, src, level)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(out)+margin >= len(src) {
+		return src, false, nil
+	}
+	return out, true, nil
+}
@@ -0,0 +1,55 @@
+package zstd
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCompressIfSmaller(t *testing.T) {
+	compressible := bytes.Repeat([]byte("Hello, World! "), 1000)
+	out, compressed, err := CompressIfSmaller(nil, compressible, DefaultCompression)
+	if err != nil {
+		t.Fatalf("failed to compress: %s", err)
+	}
+	if !compressed || len(out) >= len(compressible) {
+		t.Fatalf("expected a smaller compressed form, got %d bytes (compressed=%v)", len(out), compressed)
+	}
+	decompressed, err := Decompress(nil, out)
+	if err != nil {
+		t.Fatalf("failed to decompress: %s", err)
+	}
+	if !bytes.Equal(decompressed, compressible) {
+		t.Fatal("decompressed data does not match")
+	}
+
+	incompressible := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(incompressible)
+	for name, src := range map[string][]byte{"incompressible": incompressible, "tiny": []byte("a")} {
+		out, compressed, err := CompressIfSmaller(nil, src, DefaultCompression)
+		if err != nil {
+			t.Fatalf("%s: failed to compress: %s", name, err)
+		}
+		if compressed || &out[0] != &src[0] || len(out) != len(src) {
+			t.Fatalf("%s: expected src to be returned as is", name)
+		}
+	}
+}
+
+func TestCompressIfSmallerMargin(t *testing.T) {
+	src := bytes.Repeat([]byte("Hello, World! "), 100)
+	full, err := CompressLevel(nil, src, DefaultCompression)
+	if err != nil {
+		t.Fatalf("failed to compress: %s", err)
+	}
+	gain := len(src) - len(full)
+
+	_, compressed, err := CompressIfSmallerMargin(nil, src, DefaultCompression, gain-1)
+	if err != nil || !compressed {
+		t.Fatalf("expected compression to be kept with margin %d, got %v (%v)", gain-1, compressed, err)
+	}
+	out, compressed, err := CompressIfSmallerMargin(nil, src, DefaultCompression, gain)
+	if err != nil || compressed || &out[0] != &src[0] {
+		t.Fatalf("expected src to be returned with margin %d, got %v (%v)", gain, compressed, err)
+	}
+}
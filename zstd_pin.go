@@ -0,0 +1,17 @@
+//go:build go1.21 && cgo
+// +build go1.21,cgo
+
+package zstd
+
+import "runtime"
+
+// pinSupported reports whether pin can pin memory, see zstd_pin_compat.go.
+const pinSupported = true
+
+// pin pins b, which libzstd keeps pointers to after the call
+// returns, and returns the function unpinning it.
+func pin(b []byte) (func(), error) {
+	var pinner runtime.Pinner
+	pinner.Pin(&b[0])
+	return pinner.Unpin, nil
+}
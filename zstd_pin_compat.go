@@ -0,0 +1,13 @@
+//go:build !go1.21 && cgo
+// +build !go1.21,cgo
+
+package zstd
+
+// pinSupported reports whether pin can pin memory, see zstd_pin.go.
+const pinSupported = false
+
+// pin requires runtime.Pinner, see zstd_pin.go. Without it, Go
+// memory cannot be handed over to libzstd beyond a call.
+func pin(b []byte) (func(), error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,150 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+)
+
+const (
+	// pipeChunkSize is the size of the reads of CompressPipe
+	pipeChunkSize = 1 << 20
+	// pipeDepth is the number of chunks buffered between two stages of
+	// CompressPipe
+	pipeDepth = 4
+)
+
+// CompressPipe compresses src at level into dst as a single frame, like
+// io.Copy to a Writer, but reads, compresses and writes concurrently so that
+// the throughput is close to the one of the slowest of the three, e.g. a
+// network dst, instead of their sum. The compression is multithreaded when
+// HasMultithreadSupport is set. At most about 2*pipeDepth chunks of 1MB are
+// held in memory at once.
+//
+// The first error of any stage stops the others and is returned, as well as
+// the ctx error once it is done. A Read of src in progress then is not
+// interrupted: its goroutine exits once it returns, without reading further.
+func CompressPipe(ctx context.Context, dst io.Writer, src io.Reader, level int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	chunks := make(chan []byte, pipeDepth)
+	// Chunks go back to the reader once compressed
+	free := make(chan []byte, 2*pipeDepth)
+	go func() {
+		defer close(chunks)
+		for {
+			var buf []byte
+			select {
+			case buf = <-free:
+			default:
+				buf = make([]byte, pipeChunkSize)
+			}
+			n, err := src.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- buf[:n]:
+				case <-ctx.Done():
+					fail(ctx.Err())
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+		}
+	}()
+
+	frames := make(chan []byte, pipeDepth)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for b := range frames {
+			if ctx.Err() != nil {
+				continue // Drain once stopped
+			}
+			if _, err := dst.Write(b); err != nil {
+				fail(err)
+			}
+		}
+	}()
+
+	w := NewWriterLevel(&pipeSink{ctx: ctx, frames: frames}, level)
+	err := compressPipe(ctx, w, chunks, free)
+	if err == nil {
+		err = w.Close()
+	} else {
+		w.Abort()
+	}
+	if err != nil {
+		fail(err)
+	}
+	close(frames)
+	<-written
+	// The reader may still be failing, once synchronizes with it
+	once.Do(func() {})
+	return firstErr
+}
+
+// compressPipe writes the chunks to w until they are all read or ctx is done,
+// handing them back to free.
+func compressPipe(ctx context.Context, w *Writer, chunks <-chan []byte, free chan<- []byte) error {
+	if HasMultithreadSupport() && runtime.NumCPU() > 1 {
+		if err := w.SetNbWorkers(runtime.NumCPU()); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return ctx.Err()
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+			select {
+			case free <- chunk[:cap(chunk)]:
+			default:
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// pipeSink hands the output of the Writer of CompressPipe to its write stage.
+type pipeSink struct {
+	ctx    context.Context
+	frames chan<- []byte
+}
+
+func (s *pipeSink) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// The Writer reuses p
+	b := append([]byte(nil), p...)
+	select {
+	case s.frames <- b:
+		return len(p), nil
+	case <-s.ctx.Done():
+		return 0, s.ctx.Err()
+	}
+}
@@ -0,0 +1,119 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/colinlyguo/zstd/zstdtest"
+)
+
+// latencyReader sleeps before every Read, returning at most size bytes
+type latencyReader struct {
+	r     io.Reader
+	size  int
+	delay time.Duration
+}
+
+func (r *latencyReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	if len(p) > r.size {
+		p = p[:r.size]
+	}
+	return r.r.Read(p)
+}
+
+// latencyWriter sleeps before every Write
+type latencyWriter struct {
+	w     io.Writer
+	delay time.Duration
+}
+
+func (w *latencyWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.w.Write(p)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failure")
+}
+
+func TestCompressPipe(t *testing.T) {
+	payload := zstdtest.Compressible(1, 5*pipeChunkSize+123)
+	for _, size := range []int{0, 1, 1000, len(payload)} {
+		var buf bytes.Buffer
+		src := &latencyReader{r: bytes.NewReader(payload[:size]), size: pipeChunkSize / 3}
+		failOnError(t, "Failed to compress", CompressPipe(context.Background(), &buf, src, 3))
+		out, err := Decompress(nil, buf.Bytes())
+		failOnError(t, "Failed to decompress", err)
+		if !bytes.Equal(out, payload[:size]) {
+			t.Fatalf("size=%d: round trip does not match", size)
+		}
+	}
+}
+
+func TestCompressPipeErrors(t *testing.T) {
+	payload := zstdtest.Compressible(1, 3*pipeChunkSize)
+
+	err := CompressPipe(context.Background(), ioutil.Discard, io.NewSectionReader(failingReaderAt{}, 0, 1<<30), 3)
+	if err == nil || err.Error() != "read failure" {
+		t.Fatalf("Expected the read failure, got %v", err)
+	}
+
+	err = CompressPipe(context.Background(), failingWriter{}, bytes.NewReader(payload), 3)
+	if err == nil || err.Error() != "write failure" {
+		t.Fatalf("Expected the write failure, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	src := &latencyReader{r: bytes.NewReader(payload), size: 1000, delay: 10 * time.Millisecond}
+	if err := CompressPipe(ctx, ioutil.Discard, src, 3); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := CompressPipe(canceled, ioutil.Discard, bytes.NewReader(payload), 3); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// benchmarkPipe compresses with latency on both ends, so that io.Copy waits
+// for each stage in turn while CompressPipe overlaps them.
+func benchmarkPipe(b *testing.B, compress func(dst io.Writer, src io.Reader) error) {
+	payload := zstdtest.Compressible(1, 8*pipeChunkSize)
+	b.SetBytes(int64(len(payload)))
+	for i := 0; i < b.N; i++ {
+		src := &latencyReader{r: bytes.NewReader(payload), size: pipeChunkSize, delay: 5 * time.Millisecond}
+		dst := &latencyWriter{w: ioutil.Discard, delay: 5 * time.Millisecond}
+		if err := compress(dst, src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompressPipe(b *testing.B) {
+	benchmarkPipe(b, func(dst io.Writer, src io.Reader) error {
+		return CompressPipe(context.Background(), dst, src, 3)
+	})
+}
+
+func BenchmarkCompressPipeIOCopy(b *testing.B) {
+	benchmarkPipe(b, func(dst io.Writer, src io.Reader) error {
+		w := NewWriterLevel(dst, 3)
+		if _, err := io.CopyBuffer(w, src, make([]byte, pipeChunkSize)); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
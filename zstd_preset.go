@@ -0,0 +1,130 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import "fmt"
+
+// Preset is a named bundle of compression parameters, see PresetParams. It is
+// accepted wherever CParams are, through CParams.Preset.
+type Preset int
+
+// Presets of PresetParams
+const (
+	// PresetFastest favors speed: level 1 with a 512KB window
+	PresetFastest Preset = iota + 1
+	// PresetDefault is the default level with a 2MB window and checksums
+	PresetDefault
+	// PresetArchive favors the ratio for data written once and read rarely:
+	// level 19 with an 8MB window and checksums
+	PresetArchive
+	// PresetLongRange finds matches up to 128MB back with long distance
+	// matching, for large inputs with distant repetitions such as backups.
+	// Decompressing streams needs a 128MB window, the default maximum.
+	PresetLongRange
+	// PresetScrollBlob are the parameters of CompressScrollBatchBytes,
+	// producing magicless frames decoded by DecompressScrollBatchBytes
+	PresetScrollBlob
+)
+
+var presetNames = map[Preset]string{
+	PresetFastest:    "fastest",
+	PresetDefault:    "default",
+	PresetArchive:    "archive",
+	PresetLongRange:  "long-range",
+	PresetScrollBlob: "scroll-blob",
+}
+
+// String returns the name of the preset.
+func (p Preset) String() string {
+	if name, ok := presetNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Preset(%d)", int(p))
+}
+
+// PresetParams returns the parameters of the preset p, with the level,
+// strategy and window log all set so that they do not depend on the defaults
+// of the linked libzstd. It returns the zero CParams for an unknown preset.
+func PresetParams(p Preset) CParams {
+	switch p {
+	case PresetFastest:
+		return CParams{Level: BestSpeed, Strategy: StrategyFast, WindowLog: 19}
+	case PresetDefault:
+		return CParams{Level: DefaultCompression, Strategy: StrategyDfast, WindowLog: 21, Checksum: true}
+	case PresetArchive:
+		return CParams{Level: 19, Strategy: StrategyBtultra2, WindowLog: 23, Checksum: true}
+	case PresetLongRange:
+		return CParams{Level: 10, Strategy: StrategyLazy2, WindowLog: 27, Checksum: true,
+			Params: []ParamValue{{CParamLongDistance, 1}}}
+	case PresetScrollBlob:
+		// Derived from the parameters of the scroll batch encoding, so that
+		// the two never diverge
+		var params CParams
+		for _, pv := range ScrollBatchParams() {
+			switch pv.Param {
+			case CParamCompressionLevel:
+				params.Level = pv.Value
+			case CParamWindowLog:
+				params.WindowLog = pv.Value
+			default:
+				params.Params = append(params.Params, pv)
+			}
+		}
+		return params
+	default:
+		return CParams{}
+	}
+}
+
+// withPreset returns the parameters of p.Preset overridden by the fields of p
+// which are not at their zero value, or p itself without preset.
+func (p CParams) withPreset() (CParams, error) {
+	if p.Preset == 0 {
+		return p, nil
+	}
+	if _, ok := presetNames[p.Preset]; !ok {
+		return p, fmt.Errorf("Unknown preset %v", p.Preset)
+	}
+	if p.Preset == PresetScrollBlob {
+		if err := checkScrollCapabilities(); err != nil {
+			return p, err
+		}
+	}
+	params := PresetParams(p.Preset)
+	// The fields of p override the parameters of the preset they set
+	overridden := map[CParameter]bool{
+		CParamCompressionLevel: p.Level != 0,
+		CParamSrcSizeHint:      p.SrcSizeHint != 0,
+		CParamStrategy:         p.Strategy != 0,
+		CParamWindowLog:        p.WindowLog != 0,
+		CParamChecksumFlag:     p.Checksum,
+		CParamBlockDelimiters:  p.BlockDelimiters != 0,
+	}
+	presetParams := params.Params
+	params.Params = nil
+	for _, pv := range presetParams {
+		if !overridden[pv.Param] {
+			params.Params = append(params.Params, pv)
+		}
+	}
+	if p.Level != 0 {
+		params.Level = p.Level
+	}
+	if p.SrcSizeHint != 0 {
+		params.SrcSizeHint = p.SrcSizeHint
+	}
+	if p.Strategy != 0 {
+		params.Strategy = p.Strategy
+	}
+	if p.WindowLog != 0 {
+		params.WindowLog = p.WindowLog
+	}
+	params.Checksum = params.Checksum || p.Checksum
+	if p.BlockDelimiters != 0 {
+		params.BlockDelimiters = p.BlockDelimiters
+	}
+	params.Params = append(params.Params, p.Params...)
+	params.Progress = p.Progress
+	return params, nil
+}
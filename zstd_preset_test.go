@@ -0,0 +1,133 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPresetRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("a payload compressed with every preset "), 50000)
+	for _, preset := range []Preset{PresetFastest, PresetDefault, PresetArchive, PresetLongRange} {
+		params := PresetParams(preset)
+		if params.Level == 0 || params.Strategy == 0 || params.WindowLog == 0 {
+			t.Fatalf("%s: the preset is not fully specified: %+v", preset, params)
+		}
+		compressed, err := CompressWithParams(nil, payload, CParams{Preset: preset})
+		failOnError(t, "Error while compressing", err)
+		info, err := Info(compressed)
+		failOnError(t, "Error while reading the frame", err)
+		if info.HasChecksum != params.Checksum {
+			t.Fatalf("%s: expected a checksum %v, got %v", preset, params.Checksum, info.HasChecksum)
+		}
+		decompressed, err := Decompress(nil, compressed)
+		failOnError(t, "Error while decompressing", err)
+		if !bytes.Equal(decompressed, payload) {
+			t.Fatalf("%s: the round trip differs", preset)
+		}
+
+		// Writers accept presets too
+		var b bytes.Buffer
+		w, err := NewWriterParams(&b, WriterParams{CParams: CParams{Preset: preset}})
+		failOnError(t, "Error while creating the writer", err)
+		if w.CompressionLevel != params.Level {
+			t.Fatalf("%s: expected level %d, got %d", preset, params.Level, w.CompressionLevel)
+		}
+		if _, err := w.Write(payload); err != nil {
+			t.Fatalf("Error while writing: %s", err)
+		}
+		failOnError(t, "Error while closing the writer", w.Close())
+		info, err = Info(b.Bytes())
+		failOnError(t, "Error while reading the frame", err)
+		if info.Frames[0].WindowSize != 1<<uint(params.WindowLog) {
+			t.Fatalf("%s: expected a window of %d, got %d", preset, 1<<uint(params.WindowLog), info.Frames[0].WindowSize)
+		}
+	}
+}
+
+func TestPresetScrollBlob(t *testing.T) {
+	if checkScrollCapabilities() != nil {
+		t.Skip("The linked libzstd does not support the scroll encoder")
+	}
+	pool, err := NewCtxPool(CParams{Preset: PresetScrollBlob}, 1)
+	failOnError(t, "Error while creating the pool", err)
+	defer pool.Close()
+	for i, test := range loadScrollGoldens(t) {
+		if i%20 != 0 {
+			continue
+		}
+		batch := readScrollBatch(t, test)
+		expected, err := CompressScrollBatchBytes(batch)
+		failOnError(t, "Error while compressing the batch", err)
+		blob, err := pool.Compress(nil, batch)
+		failOnError(t, "Error while compressing with the preset", err)
+		if !bytes.Equal(blob, expected) {
+			t.Fatalf("%s: the preset differs from the scroll encoding", test.filename)
+		}
+		decompressed, err := DecompressScrollBatchBytes(blob)
+		failOnError(t, "Error while decompressing the blob", err)
+		if !bytes.Equal(decompressed, batch) {
+			t.Fatalf("%s: the round trip differs", test.filename)
+		}
+	}
+}
+
+func TestPresetOverride(t *testing.T) {
+	payload := bytes.Repeat([]byte("overridden "), 10000)
+	for _, test := range []struct {
+		params CParams
+		window uint64
+	}{
+		{CParams{Preset: PresetLongRange}, 1 << 27},
+		{CParams{Preset: PresetLongRange, WindowLog: 20}, 1 << 20},
+	} {
+		var b bytes.Buffer
+		w, err := NewWriterParams(&b, WriterParams{CParams: test.params})
+		failOnError(t, "Error while creating the writer", err)
+		if _, err := w.Write(payload); err != nil {
+			t.Fatalf("Error while writing: %s", err)
+		}
+		failOnError(t, "Error while closing the writer", w.Close())
+		info, err := Info(b.Bytes())
+		failOnError(t, "Error while reading the frame", err)
+		if info.Frames[0].WindowSize != test.window {
+			t.Fatalf("%+v: expected a window of %d, got %d", test.params, test.window, info.Frames[0].WindowSize)
+		}
+	}
+
+	if checkScrollCapabilities() != nil {
+		return
+	}
+	// Overriding the window or the checksum of the scroll preset gives blobs
+	// which are not scroll frames any more
+	payload = bytes.Repeat(payload, 10)
+	for _, params := range []CParams{
+		{Preset: PresetScrollBlob},
+		{Preset: PresetScrollBlob, WindowLog: 20},
+		{Preset: PresetScrollBlob, Checksum: true},
+	} {
+		blob, err := CompressWithParams(nil, payload, params)
+		failOnError(t, "Error while compressing", err)
+		expected := ScrollFrame
+		if params.WindowLog != 0 || params.Checksum {
+			expected = Unknown
+		}
+		if kind, err := ClassifyPayload(blob); err != nil || kind != expected {
+			t.Fatalf("%+v: expected %s, got %s, %v", params, expected, kind, err)
+		}
+	}
+}
+
+func TestPresetInvalid(t *testing.T) {
+	if _, err := CompressWithParams(nil, []byte("payload"), CParams{Preset: 42}); err == nil {
+		t.Fatalf("Expected an error for an unknown preset")
+	}
+	if _, err := NewWriterParams(&bytes.Buffer{}, WriterParams{CParams: CParams{Preset: -1}}); err == nil {
+		t.Fatalf("Expected an error for an unknown preset")
+	}
+	if PresetArchive.String() != "archive" || Preset(42).String() != "Preset(42)" {
+		t.Fatalf("Unexpected names %s and %s", PresetArchive, Preset(42))
+	}
+}
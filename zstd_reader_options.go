@@ -0,0 +1,233 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"hash"
+	"io"
+	"unsafe"
+)
+
+// ReaderOption configures a Reader created by NewReaderOptions.
+type ReaderOption func(*Reader) error
+
+// NewReaderOptions is like NewReader but configures the Reader with options.
+// Invalid options are reported immediately instead of on the first Read.
+func NewReaderOptions(r io.Reader, opts ...ReaderOption) (*Reader, error) {
+	zr := newReader(r, nil)
+	zr.maxFrames = tighten(DefaultMaxFrames, zr.limits.MaxFrames)
+	for _, opt := range opts {
+		if zr.firstError != nil {
+			break
+		}
+		zr.firstError = opt(zr)
+	}
+	if zr.firstError != nil {
+		err := zr.firstError
+		zr.Close()
+		return nil, err
+	}
+	return zr, nil
+}
+
+// WithFrameCallback calls fn with the statistics of each frame once it is
+// decoded, e.g. to audit which frames carried a checksum. fn is called from
+// Read, before it returns the last bytes of the frame.
+func WithFrameCallback(fn func(FrameStats)) ReaderOption {
+	return func(r *Reader) error {
+		r.frameCallback = fn
+		return nil
+	}
+}
+
+// WithMaxFrames makes Read fail with ErrTooManyFrames when the stream has more
+// than n frames, including skippable ones, as many tiny frames cost much more
+// to decode than their size suggests. The frames up to the limit are decoded
+// normally. NewReader has no limit, NewReaderOptions has a limit of
+// DefaultMaxFrames unless WithMaxFrames is given, n <= 0 removes it. The
+// limit of SetGlobalLimits applies if it is lower.
+func WithMaxFrames(n int) ReaderOption {
+	return func(r *Reader) error {
+		r.maxFrames = tighten(n, r.limits.MaxFrames)
+		return nil
+	}
+}
+
+// WithOutputHasher feeds h the decompressed content as it is decoded, e.g. to
+// get a dedup key without a second pass over the output. Bytes are fed once
+// decoded, possibly before Read returns them, so the digest covers the whole
+// content once Read returns io.EOF. NewXXH64 selects the XXH64 implementation
+// bundled with libzstd.
+func WithOutputHasher(h hash.Hash) ReaderOption {
+	return func(r *Reader) error {
+		r.hasher = h
+		return nil
+	}
+}
+
+// WithProgress calls fn with the number of compressed bytes read and of
+// decompressed bytes written so far, each time Read decodes a buffer of data,
+// e.g. to report the progress of restoring a large backup. fn is called from
+// Read. The total to expect is given by ContentSize when known.
+func WithProgress(fn func(compressedRead, decompressedWritten int64)) ReaderOption {
+	return func(r *Reader) error {
+		r.progress = fn
+		return nil
+	}
+}
+
+// WithMaxWindowLog makes Read fail with ErrWindowTooLarge on frames whose
+// window is larger than 1<<n bytes, bounding the memory the Reader allocates
+// for untrusted streams, see DecompressOptions.MaxWindowLog. The default is
+// 27 (128MB). The limit of SetGlobalLimits applies if it is lower.
+func WithMaxWindowLog(n int) ReaderOption {
+	return func(r *Reader) error {
+		if max := r.limits.MaxWindowLog; max > 0 && (n == 0 || n > max) {
+			n = max
+		}
+		return setDParameter(r.ctx, DParamWindowLogMax, n)
+	}
+}
+
+// WithDict decompresses with the preset dictionary dict, like NewReaderDict.
+// An empty dict is ignored.
+func WithDict(dict []byte) ReaderOption {
+	return func(r *Reader) error {
+		if len(dict) == 0 {
+			return nil
+		}
+		r.dict = dict
+		return opError("ZSTD_DCtx_loadDictionary", len(dict), 0, getError(int(C.ZSTD_DCtx_loadDictionary(
+			r.ctx,
+			unsafe.Pointer(&dict[0]),
+			C.size_t(len(dict))))))
+	}
+}
+
+// ContentSize returns the content size declared by the header of the first
+// frame, and whether it is known, which is only the case once Read decoded
+// the header and if the frame declares it. Streams of several frames may hold
+// more content, the size of the others not being known until they are
+// reached.
+func (r *Reader) ContentSize() (int64, bool) {
+	return r.contentSize, r.contentSizeParsed && r.contentSize >= 0
+}
+
+// parseContentSize records the content size of the first frame once its
+// header is complete.
+func (r *Reader) parseContentSize() {
+	header, err := getFrameHeader(r.frameHeader)
+	if err == ErrFrameTruncated || err == ErrEmptySlice {
+		return
+	}
+	r.contentSizeParsed = true
+	r.contentSize = -1
+	if err == nil && header.frameType != C.ZSTD_skippableFrame &&
+		uint64(header.frameContentSize) != uint64(C.ZSTD_CONTENTSIZE_UNKNOWN) {
+		r.contentSize = int64(header.frameContentSize)
+	}
+}
+
+// FrameStats describes a frame decoded by a Reader.
+type FrameStats struct {
+	// Skippable is set for skippable frames, which decode to nothing
+	Skippable bool
+
+	// HasChecksum is set when the frame carries an XXH64 checksum of its
+	// content
+	HasChecksum bool
+
+	// ChecksumVerified is set when the checksum of the frame was verified
+	// against its content. A mismatch makes Read fail with
+	// ErrChecksumMismatch, after reporting the frame with ChecksumVerified
+	// unset.
+	ChecksumVerified bool
+
+	// CompressedSize is the size of the frame
+	CompressedSize int64
+
+	// DecompressedSize is the size of the content of the frame
+	DecompressedSize int64
+}
+
+// ReaderStats reports the frames decoded by a Reader so far.
+type ReaderStats struct {
+	// Frames is the number of frames decoded, including skippable ones
+	Frames int
+
+	// FramesWithChecksum is the number of frames carrying a checksum
+	FramesWithChecksum int
+
+	// ChecksumsVerified is the number of checksums verified, it is lower than
+	// FramesWithChecksum after a mismatch
+	ChecksumsVerified int
+
+	// LastFrame describes the last frame decoded
+	LastFrame FrameStats
+
+	// CompressedSize is the total size of the frames decoded
+	CompressedSize int64
+
+	// DecompressedSize is the total size of the content of the frames
+	// decoded
+	DecompressedSize int64
+}
+
+// Stats returns the statistics of the frames decoded so far. Frames are
+// only accounted for once decoded entirely.
+func (r *Reader) Stats() ReaderStats {
+	return r.stats
+}
+
+// InputOffset returns the number of compressed bytes consumed by the decoder
+// so far. The Reader reads its source ahead, the bytes read but not consumed
+// yet being reported by BufferedInput, so the source was read up to
+// InputOffset() + BufferedInput(). Bytes consumed may still be held by
+// libzstd within the current frame, e.g. a partial block: only at the end of
+// a frame do they match the content returned. Offsets are updated by Read, so
+// they are only meaningful between calls to Read.
+func (r *Reader) InputOffset() int64 {
+	return r.totalIn
+}
+
+// OutputOffset returns the number of decompressed bytes returned by Read so
+// far. Bytes decoded but not returned yet are not counted.
+func (r *Reader) OutputOffset() int64 {
+	return r.totalOut - int64(r.decompSize-r.decompOff)
+}
+
+// BufferedInput returns the number of bytes read from the source but not
+// consumed by the decoder yet.
+func (r *Reader) BufferedInput() int {
+	return r.compressionLeft
+}
+
+// completeFrame accounts for the frame which just ended, whose first bytes are
+// in r.frameHeader.
+func (r *Reader) completeFrame(verified bool) {
+	var fs FrameStats
+	if header, err := getFrameHeader(r.frameHeader); err == nil {
+		fs.Skippable = header.frameType == C.ZSTD_skippableFrame
+		fs.HasChecksum = !fs.Skippable && header.checksumFlag != 0
+	}
+	fs.ChecksumVerified = fs.HasChecksum && verified
+	fs.CompressedSize = r.frameIn
+	fs.DecompressedSize = r.frameOut
+	r.frameIn, r.frameOut = 0, 0
+
+	r.stats.Frames++
+	r.stats.CompressedSize += fs.CompressedSize
+	r.stats.DecompressedSize += fs.DecompressedSize
+	if fs.HasChecksum {
+		r.stats.FramesWithChecksum++
+	}
+	if fs.ChecksumVerified {
+		r.stats.ChecksumsVerified++
+	}
+	r.stats.LastFrame = fs
+	if r.frameCallback != nil {
+		r.frameCallback(fs)
+	}
+}
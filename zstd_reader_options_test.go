@@ -0,0 +1,330 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestReaderFrameStats(t *testing.T) {
+	plain, err := Compress(nil, []byte("Hello, "))
+	failOnError(t, "Failed to compress", err)
+	checked, err := CompressWithParams(nil, bytes.Repeat([]byte("World! "), 1000), CParams{Checksum: true})
+	failOnError(t, "Failed to compress", err)
+	skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 2, 0, 0, 0, 'h', 'i'}
+	src := append(append(append([]byte(nil), plain...), skippable...), checked...)
+
+	var frames []FrameStats
+	r, err := NewReaderOptions(bytes.NewReader(src), WithFrameCallback(func(fs FrameStats) {
+		frames = append(frames, fs)
+	}))
+	failOnError(t, "Failed to create reader", err)
+	defer r.Close()
+	out, err := ioutil.ReadAll(r)
+	failOnError(t, "Failed to read", err)
+	if len(out) != 7+7000 {
+		t.Fatalf("Unexpected output size %d", len(out))
+	}
+
+	want := []FrameStats{
+		{CompressedSize: int64(len(plain)), DecompressedSize: 7},
+		{Skippable: true, CompressedSize: int64(len(skippable))},
+		{HasChecksum: true, ChecksumVerified: true, CompressedSize: int64(len(checked)), DecompressedSize: 7000},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("Expected %d frames, got %+v", len(want), frames)
+	}
+	for i := range want {
+		if frames[i] != want[i] {
+			t.Fatalf("Frame %d: expected %+v, got %+v", i, want[i], frames[i])
+		}
+	}
+	stats := r.Stats()
+	if stats.Frames != 3 || stats.FramesWithChecksum != 1 || stats.ChecksumsVerified != 1 || stats.LastFrame != want[2] {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestReaderFrameStatsCorruptedChecksum(t *testing.T) {
+	src, err := CompressWithParams(nil, []byte("Hello, World!"), CParams{Checksum: true})
+	failOnError(t, "Failed to compress", err)
+	src[len(src)-1] ^= 0xff
+
+	r, err := NewReaderOptions(bytes.NewReader(src))
+	failOnError(t, "Failed to create reader", err)
+	defer r.Close()
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	stats := r.Stats()
+	if stats.Frames != 1 || stats.FramesWithChecksum != 1 || stats.ChecksumsVerified != 0 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	if !stats.LastFrame.HasChecksum || stats.LastFrame.ChecksumVerified {
+		t.Fatalf("Unexpected frame stats %+v", stats.LastFrame)
+	}
+}
+
+// tinyFrames returns n concatenated frames of one byte each.
+func tinyFrames(t *testing.T, n int) []byte {
+	frame, err := Compress(nil, []byte{'a'})
+	failOnError(t, "Failed to compress", err)
+	return bytes.Repeat(frame, n)
+}
+
+func TestReaderMaxFrames(t *testing.T) {
+	src := tinyFrames(t, 10)
+
+	r, err := NewReaderOptions(bytes.NewReader(src), WithMaxFrames(10))
+	failOnError(t, "Failed to create reader", err)
+	out, err := ioutil.ReadAll(r)
+	failOnError(t, "Failed to read up to the limit", err)
+	if len(out) != 10 {
+		t.Fatalf("Expected 10 bytes, got %d", len(out))
+	}
+	r.Close()
+
+	r, err = NewReaderOptions(bytes.NewReader(src), WithMaxFrames(4))
+	failOnError(t, "Failed to create reader", err)
+	defer r.Close()
+	out, err = ioutil.ReadAll(r)
+	if err != ErrTooManyFrames {
+		t.Fatalf("Expected ErrTooManyFrames, got %v", err)
+	}
+	if len(out) != 4 || r.Stats().Frames != 4 {
+		t.Fatalf("Expected the first 4 frames to be decoded, got %d bytes and %+v", len(out), r.Stats())
+	}
+	if _, err := r.Read(make([]byte, 1)); err != ErrTooManyFrames {
+		t.Fatalf("Expected ErrTooManyFrames to stick, got %v", err)
+	}
+}
+
+func TestReaderMaxFramesDefaults(t *testing.T) {
+	src := tinyFrames(t, DefaultMaxFrames+1)
+
+	// NewReader is unlimited
+	out, err := ioutil.ReadAll(NewReader(bytes.NewReader(src)))
+	failOnError(t, "Failed to read", err)
+	if len(out) != DefaultMaxFrames+1 {
+		t.Fatalf("Unexpected output size %d", len(out))
+	}
+
+	r, err := NewReaderOptions(bytes.NewReader(src))
+	failOnError(t, "Failed to create reader", err)
+	if _, err := ioutil.ReadAll(r); err != ErrTooManyFrames {
+		t.Fatalf("Expected ErrTooManyFrames by default, got %v", err)
+	}
+	r.Close()
+
+	r, err = NewReaderOptions(bytes.NewReader(src), WithMaxFrames(-1))
+	failOnError(t, "Failed to create reader", err)
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatalf("Expected no limit, got %v", err)
+	}
+	r.Close()
+}
+
+func TestReaderOutputHasher(t *testing.T) {
+	first := bytes.Repeat([]byte("Hello, "), 50000)
+	second := bytes.Repeat([]byte("World! "), 50000)
+	a, err := Compress(nil, first)
+	failOnError(t, "Failed to compress", err)
+	b, err := Compress(nil, second)
+	failOnError(t, "Failed to compress", err)
+	expected := NewXXH64()
+	expected.Write(first)
+	expected.Write(second)
+
+	h := NewXXH64()
+	r, err := NewReaderOptions(bytes.NewReader(append(a, b...)), WithOutputHasher(h))
+	failOnError(t, "Failed to create reader", err)
+	defer r.Close()
+	// Small reads leave decoded bytes buffered, which are fed only once
+	var out []byte
+	buf := make([]byte, 1000)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	if !bytes.Equal(out, append(first, second...)) {
+		t.Fatal("Round trip does not match")
+	}
+	if h.Sum64() != expected.Sum64() {
+		t.Fatalf("Digest %#x does not match %#x", h.Sum64(), expected.Sum64())
+	}
+}
+
+func TestReaderProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("restoring a large backup "), 100000)
+	first, err := Compress(nil, content)
+	failOnError(t, "Failed to compress", err)
+	second, err := Compress(nil, []byte("tail"))
+	failOnError(t, "Failed to compress", err)
+	src := append(append([]byte(nil), first...), second...)
+
+	var calls int
+	var lastIn, lastOut int64
+	r, err := NewReaderOptions(bytes.NewReader(src), WithProgress(func(compressedRead, decompressedWritten int64) {
+		if compressedRead < lastIn || decompressedWritten < lastOut {
+			t.Fatalf("Progress went backwards: (%d, %d) after (%d, %d)", compressedRead, decompressedWritten, lastIn, lastOut)
+		}
+		calls++
+		lastIn, lastOut = compressedRead, decompressedWritten
+	}))
+	failOnError(t, "Failed to create reader", err)
+	defer r.Close()
+	if _, ok := r.ContentSize(); ok {
+		t.Fatal("Expected no content size before the first Read")
+	}
+	out, err := ioutil.ReadAll(r)
+	failOnError(t, "Failed to read", err)
+	if calls < 2 {
+		t.Fatalf("Expected several progress calls, got %d", calls)
+	}
+	stats := r.Stats()
+	if lastIn != int64(len(src)) || lastIn != stats.CompressedSize || lastOut != int64(len(out)) || lastOut != stats.DecompressedSize {
+		t.Fatalf("Progress (%d, %d) does not match the stats %+v", lastIn, lastOut, stats)
+	}
+	if size, ok := r.ContentSize(); !ok || size != int64(len(content)) {
+		t.Fatalf("Expected the content size of the first frame %d, got %d %v", len(content), size, ok)
+	}
+
+	// A frame without content size has no total
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	_, err = w.Write(content)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	r, err = NewReaderOptions(&buf)
+	failOnError(t, "Failed to create reader", err)
+	defer r.Close()
+	_, err = ioutil.ReadAll(r)
+	failOnError(t, "Failed to read", err)
+	if _, ok := r.ContentSize(); ok {
+		t.Fatal("Expected an unknown content size")
+	}
+}
+
+func TestReaderMaxWindowLog(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriterParams(&buf, WriterParams{CParams: CParams{WindowLog: 20}})
+	failOnError(t, "Failed to create writer", err)
+	payload := bytes.Repeat([]byte("Hello, World! "), 100000)
+	_, err = w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+
+	r, err := NewReaderOptions(bytes.NewReader(buf.Bytes()), WithMaxWindowLog(19))
+	failOnError(t, "Failed to create reader", err)
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrWindowTooLarge) {
+		t.Fatalf("Expected ErrWindowTooLarge, got %v", err)
+	}
+	r.Close()
+
+	r, err = NewReaderOptions(bytes.NewReader(buf.Bytes()), WithMaxWindowLog(20))
+	failOnError(t, "Failed to create reader", err)
+	out, err := ioutil.ReadAll(r)
+	failOnError(t, "Failed to read", err)
+	if !bytes.Equal(out, payload) {
+		t.Fatalf("Decompressed data does not match the input")
+	}
+	failOnError(t, "Failed to close", r.Close())
+
+	if _, err := NewReaderOptions(bytes.NewReader(nil), WithMaxWindowLog(100)); err == nil {
+		t.Fatalf("Expected an error for an invalid window")
+	}
+}
+
+func TestReaderDict(t *testing.T) {
+	payload := []byte("We're building a platform that engineers love to use.")
+	var buf bytes.Buffer
+	w := NewWriterLevelDict(&buf, BestSpeed, dict)
+	_, err := w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+
+	r, err := NewReaderOptions(bytes.NewReader(buf.Bytes()), WithDict(dict))
+	failOnError(t, "Failed to create reader", err)
+	out, err := ioutil.ReadAll(r)
+	failOnError(t, "Failed to read", err)
+	if !bytes.Equal(out, payload) {
+		t.Fatalf("Decompressed data does not match the input")
+	}
+	failOnError(t, "Failed to close", r.Close())
+
+	r, err = NewReaderOptions(bytes.NewReader(buf.Bytes()), WithDict(nil))
+	failOnError(t, "Failed to create reader", err)
+	var required ErrDictionaryRequired
+	if _, err := ioutil.ReadAll(r); !errors.As(err, &required) {
+		t.Fatalf("Expected ErrDictionaryRequired without the dictionary, got %v", err)
+	}
+	r.Close()
+}
+
+func TestReaderOffsets(t *testing.T) {
+	var src, content []byte
+	for i := 0; i < 5; i++ {
+		frameContent := bytes.Repeat([]byte(fmt.Sprintf("frame %d of a resumable transfer ", i)), 1000*(i+1))
+		frame, err := Compress(nil, frameContent)
+		failOnError(t, "Failed to compress", err)
+		src = append(src, frame...)
+		content = append(content, frameContent...)
+	}
+
+	source := bytes.NewReader(src)
+	r, err := NewReaderOptions(source)
+	failOnError(t, "Failed to create reader", err)
+	defer r.Close()
+	if r.InputOffset() != 0 || r.OutputOffset() != 0 || r.BufferedInput() != 0 {
+		t.Fatalf("Expected no offsets before the first Read, got %d %d %d", r.InputOffset(), r.OutputOffset(), r.BufferedInput())
+	}
+	var out []byte
+	buf := make([]byte, 1000)
+	boundaries := 0
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		failOnError(t, "Failed to read", err)
+
+		in, outOffset := r.InputOffset(), r.OutputOffset()
+		if outOffset != int64(len(out)) {
+			t.Fatalf("Expected the output offset %d, got %d", len(out), outOffset)
+		}
+		if read := int64(len(src) - source.Len()); in+int64(r.BufferedInput()) != read {
+			t.Fatalf("Input offset %d and %d buffered bytes do not add up to the %d bytes read", in, r.BufferedInput(), read)
+		}
+		// Between frames, decoding the rest of the input gives the rest of
+		// the content
+		stats := r.Stats()
+		if in != stats.CompressedSize || outOffset != stats.DecompressedSize {
+			continue
+		}
+		boundaries++
+		rest, err := ioutil.ReadAll(NewReader(bytes.NewReader(src[in:])))
+		failOnError(t, "Failed to decode the rest", err)
+		if !bytes.Equal(append(append([]byte(nil), out...), rest...), content) {
+			t.Fatalf("Decoding from the offsets %d, %d does not give the content", in, outOffset)
+		}
+	}
+	if boundaries == 0 {
+		t.Fatal("Expected to stop between frames")
+	}
+	if !bytes.Equal(out, content) {
+		t.Fatal("The output differs from the content")
+	}
+	if r.InputOffset() != int64(len(src)) || r.OutputOffset() != int64(len(content)) || r.BufferedInput() != 0 {
+		t.Fatalf("Unexpected offsets at the end %d %d %d", r.InputOffset(), r.OutputOffset(), r.BufferedInput())
+	}
+}
@@ -0,0 +1,263 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"unsafe"
+)
+
+// Report holds aggregate statistics about a compressed payload, as returned
+// by AnalyzeCompression and AnalyzeFrame. It only holds plain fields, e.g. to
+// be logged as JSON.
+type Report struct {
+	// SrcSize is the size of the content
+	SrcSize int64
+	// CompressedSize is the size of the frames, skippable ones included
+	CompressedSize int64
+	// Frames is the number of frames, skippable ones excluded
+	Frames int
+
+	// Blocks is the number of blocks, the sum of RawBlocks, RLEBlocks and
+	// CompressedBlocks
+	Blocks           int
+	RawBlocks        int
+	RLEBlocks        int
+	CompressedBlocks int
+	// BlockSizes are the compressed sizes of the blocks in order, their
+	// 3-byte headers excluded
+	BlockSizes []int
+
+	// LiteralBytes and MatchBytes are the bytes of content emitted as
+	// literals and copied by matches, they add up to SrcSize
+	LiteralBytes int64
+	MatchBytes   int64
+	// Sequences is the number of matches
+	Sequences int64
+	// AverageMatchLength is MatchBytes divided by Sequences
+	AverageMatchLength float64
+	// OffsetBuckets[i] is the number of matches whose offset is between 1<<i
+	// included and 1<<(i+1) excluded, up to the largest offset. It is only
+	// filled by AnalyzeCompression.
+	OffsetBuckets []int64
+}
+
+// Ratio returns the compression ratio, or 0 for an empty payload.
+func (r Report) Ratio() float64 {
+	if r.SrcSize == 0 || r.CompressedSize == 0 {
+		return 0
+	}
+	return float64(r.SrcSize) / float64(r.CompressedSize)
+}
+
+// AnalyzeCompression compresses src with params, collecting the sequences the
+// compressor finds, and reports about them and the blocks of the frame.
+// LiteralBytes and MatchBytes come from the sequences, so matches found in a
+// block which ended up stored raw because it did not shrink are counted.
+func AnalyzeCompression(src []byte, params CParams) (Report, error) {
+	if len(src) == 0 {
+		return Report{}, ErrEmptySlice
+	}
+	compressed, err := CompressWithParams(nil, src, params)
+	if err != nil {
+		return Report{}, err
+	}
+	sequences, err := GenerateSequences(src, params)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{SrcSize: int64(len(src)), CompressedSize: int64(len(compressed)), Frames: 1}
+	header, err := getFrameHeader(compressed)
+	if err != nil {
+		return Report{}, err
+	}
+	// The literals and matches come from the sequences rather than the
+	// headers of the blocks
+	report.addBlocks(compressed[header.headerSize:])
+	for _, seq := range sequences {
+		report.LiteralBytes += int64(seq.LitLength)
+		if seq.MatchLength == 0 {
+			continue
+		}
+		report.MatchBytes += int64(seq.MatchLength)
+		report.Sequences++
+		bucket := bits.Len32(seq.Offset) - 1
+		for len(report.OffsetBuckets) <= bucket {
+			report.OffsetBuckets = append(report.OffsetBuckets, 0)
+		}
+		report.OffsetBuckets[bucket]++
+	}
+	if report.Sequences > 0 {
+		report.AverageMatchLength = float64(report.MatchBytes) / float64(report.Sequences)
+	}
+	return report, nil
+}
+
+// AnalyzeFrame reports about the blocks of compressed, a sequence of frames
+// such as Decompress accepts or a scroll blob, see ClassifyPayload. The
+// literals and matches are counted from the block and literals headers, the
+// frames being decoded only to check them and to measure the content when no
+// size is declared. OffsetBuckets stays empty, as the offsets are only known
+// once the sequences are decoded.
+//
+// It returns the errors of ValidateFrame for invalid frames, and
+// ErrNotSupported for legacy frames.
+func AnalyzeFrame(compressed []byte) (Report, error) {
+	if len(compressed) == 0 {
+		return Report{}, ErrEmptySlice
+	}
+	report := Report{CompressedSize: int64(len(compressed))}
+	if kind, _ := ClassifyPayload(compressed); kind == ScrollFrame {
+		content, err := DecompressScrollBatchBytes(compressed)
+		if err != nil {
+			return Report{}, err
+		}
+		var header C.ZSTD_frameHeader
+		C.ZSTD_getFrameHeader_advanced(&header, unsafe.Pointer(&compressed[0]), C.size_t(len(compressed)), C.ZSTD_f_zstd1_magicless)
+		report.Frames = 1
+		report.SrcSize = int64(len(content))
+		report.LiteralBytes, report.Sequences = report.addBlocks(compressed[header.headerSize:])
+		report.summarize()
+		return report, nil
+	}
+
+	for offset := 0; offset < len(compressed); {
+		size, err := FindFrameCompressedSize(compressed[offset:])
+		if err != nil {
+			return Report{}, notZstdError(compressed[offset:], err)
+		}
+		frame := compressed[offset : offset+size]
+		offset += size
+		if isLegacyFrame(frame) {
+			return Report{}, fmt.Errorf("zstd: analyzing legacy frames: %w", ErrNotSupported)
+		}
+		header, err := getFrameHeader(frame)
+		if err != nil {
+			return Report{}, err
+		}
+		if header.frameType == C.ZSTD_skippableFrame {
+			continue
+		}
+		// Decoding checks the blocks before their headers are parsed
+		r := NewReader(bytes.NewReader(frame))
+		n, err := io.Copy(ioutil.Discard, r)
+		r.Close()
+		if err != nil {
+			return Report{}, dictionaryError(frame, err)
+		}
+		report.Frames++
+		report.SrcSize += n
+		literals, sequences := report.addBlocks(frame[header.headerSize:])
+		report.LiteralBytes += literals
+		report.Sequences += sequences
+	}
+	report.summarize()
+	return report, nil
+}
+
+// addBlocks counts the blocks starting src, up to the last one, and returns
+// the number of literals and sequences their headers declare. The blocks
+// must be valid.
+func (r *Report) addBlocks(src []byte) (literals, sequences int64) {
+	for offset := 0; offset+3 <= len(src); {
+		bh := uint32(src[offset]) | uint32(src[offset+1])<<8 | uint32(src[offset+2])<<16
+		offset += 3
+		blockSize := int(bh >> 3)
+		r.Blocks++
+		switch (bh >> 1) & 3 {
+		case rawBlock:
+			r.RawBlocks++
+			literals += int64(blockSize)
+			r.BlockSizes = append(r.BlockSizes, blockSize)
+			offset += blockSize
+		case rleBlock:
+			r.RLEBlocks++
+			literals += int64(blockSize)
+			r.BlockSizes = append(r.BlockSizes, 1)
+			offset++
+		case compressedBlock:
+			r.CompressedBlocks++
+			if offset+blockSize <= len(src) {
+				l, s := parseBlockHeaders(src[offset : offset+blockSize])
+				literals += int64(l)
+				sequences += int64(s)
+			}
+			r.BlockSizes = append(r.BlockSizes, blockSize)
+			offset += blockSize
+		}
+		if bh&1 != 0 {
+			break
+		}
+	}
+	return literals, sequences
+}
+
+// summarize derives the match statistics of AnalyzeFrame from the totals.
+func (r *Report) summarize() {
+	r.MatchBytes = r.SrcSize - r.LiteralBytes
+	if r.Sequences > 0 {
+		r.AverageMatchLength = float64(r.MatchBytes) / float64(r.Sequences)
+	}
+}
+
+// parseBlockHeaders returns the number of literals and of sequences of block,
+// the content of a compressed block, from the headers of its literals and
+// sequences sections, see RFC 8878 section 3.1.1.3.
+func parseBlockHeaders(block []byte) (literals, sequences int) {
+	if len(block) == 0 {
+		return 0, 0
+	}
+	b := func(i int) int {
+		if i < len(block) {
+			return int(block[i])
+		}
+		return 0
+	}
+	var sectionSize int
+	switch literalsType, sizeFormat := block[0]&3, (block[0]>>2)&3; literalsType {
+	case 0, 1: // Raw and RLE literals
+		var headerSize int
+		switch sizeFormat {
+		case 0, 2:
+			headerSize, literals = 1, b(0)>>3
+		case 1:
+			headerSize, literals = 2, b(0)>>4+b(1)<<4
+		case 3:
+			headerSize, literals = 3, b(0)>>4+b(1)<<4+b(2)<<12
+		}
+		if literalsType == 0 {
+			sectionSize = headerSize + literals
+		} else {
+			sectionSize = headerSize + 1
+		}
+	default: // Compressed and treeless literals
+		var compressedSize int
+		switch sizeFormat {
+		case 0, 1:
+			sectionSize, literals, compressedSize = 3, b(0)>>4+(b(1)&0x3F)<<4, b(1)>>6+b(2)<<2
+		case 2:
+			sectionSize, literals, compressedSize = 4, b(0)>>4+b(1)<<4+(b(2)&3)<<12, b(2)>>2+b(3)<<6
+		case 3:
+			sectionSize, literals, compressedSize = 5, b(0)>>4+b(1)<<4+(b(2)&0x3F)<<12, b(2)>>6+b(3)<<2+b(4)<<10
+		}
+		sectionSize += compressedSize
+	}
+
+	switch n := b(sectionSize); {
+	case sectionSize >= len(block):
+	case n < 128:
+		sequences = n
+	case n < 255:
+		sequences = (n-128)<<8 + b(sectionSize+1)
+	default:
+		sequences = b(sectionSize+1) + b(sectionSize+2)<<8 + 0x7F00
+	}
+	return literals, sequences
+}
@@ -0,0 +1,148 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// checkReport checks that the totals of report add up, for a frame without
+// checksum.
+func checkReport(t *testing.T, name string, report Report, compressed []byte, headerSize int) {
+	t.Helper()
+	if report.RawBlocks+report.RLEBlocks+report.CompressedBlocks != report.Blocks || len(report.BlockSizes) != report.Blocks {
+		t.Fatalf("%s: block counts do not add up: %+v", name, report)
+	}
+	size := headerSize + 3*report.Blocks
+	for _, blockSize := range report.BlockSizes {
+		size += blockSize
+	}
+	if int64(size) != report.CompressedSize || report.CompressedSize != int64(len(compressed)) {
+		t.Fatalf("%s: expected %d bytes of blocks, got %d", name, report.CompressedSize, size)
+	}
+	if report.LiteralBytes+report.MatchBytes != report.SrcSize || report.LiteralBytes < 0 || report.MatchBytes < 0 {
+		t.Fatalf("%s: literals %d and matches %d do not add up to %d", name, report.LiteralBytes, report.MatchBytes, report.SrcSize)
+	}
+	if report.Sequences > 0 && report.AverageMatchLength != float64(report.MatchBytes)/float64(report.Sequences) {
+		t.Fatalf("%s: unexpected average match length %f", name, report.AverageMatchLength)
+	}
+}
+
+func TestAnalyzeCompression(t *testing.T) {
+	params := CParams{Level: 19, WindowLog: 17}
+	var corpus []byte
+	var batches [][]byte
+	for i, test := range loadScrollGoldens(t) {
+		batch := readScrollBatch(t, test)
+		corpus = append(corpus, batch...)
+		if i%20 == 0 {
+			batches = append(batches, batch)
+		}
+	}
+	// The whole corpus spans many blocks
+	batches = append(batches, corpus)
+
+	for _, batch := range batches {
+		name := fmt.Sprintf("%d bytes", len(batch))
+		report, err := AnalyzeCompression(batch, params)
+		failOnError(t, "Error while analyzing the compression", err)
+		compressed, err := CompressWithParams(nil, batch, params)
+		failOnError(t, "Error while compressing", err)
+		header, err := getFrameHeader(compressed)
+		failOnError(t, "Error while parsing the header", err)
+		checkReport(t, name, report, compressed, int(header.headerSize))
+		if report.SrcSize != int64(len(batch)) || report.Frames != 1 || report.Sequences == 0 {
+			t.Fatalf("%s: unexpected report %+v", name, report)
+		}
+		var buckets int64
+		for _, n := range report.OffsetBuckets {
+			buckets += n
+		}
+		if buckets != report.Sequences {
+			t.Fatalf("%s: offset buckets hold %d matches instead of %d", name, buckets, report.Sequences)
+		}
+
+		// The headers of the frame tell the same blocks and sequences
+		fromFrame, err := AnalyzeFrame(compressed)
+		failOnError(t, "Error while analyzing the frame", err)
+		checkReport(t, name, fromFrame, compressed, int(header.headerSize))
+		if fromFrame.SrcSize != report.SrcSize || !equalInts(fromFrame.BlockSizes, report.BlockSizes) || fromFrame.OffsetBuckets != nil {
+			t.Fatalf("%s: the frame analysis differs: %+v", name, fromFrame)
+		}
+		if report.RawBlocks == 0 && (fromFrame.Sequences != report.Sequences || fromFrame.LiteralBytes != report.LiteralBytes) {
+			t.Fatalf("%s: expected %d sequences and %d literals, got %d and %d", name,
+				report.Sequences, report.LiteralBytes, fromFrame.Sequences, fromFrame.LiteralBytes)
+		}
+
+		// The report can be logged as JSON
+		if _, err := json.Marshal(report); err != nil {
+			t.Fatalf("Error while encoding the report: %s", err)
+		}
+	}
+
+	if _, err := AnalyzeCompression(nil, params); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+}
+
+func TestAnalyzeFrame(t *testing.T) {
+	tests := loadScrollGoldens(t)
+	batch := readScrollBatch(t, tests[0])
+	blob, err := CompressScrollBatchBytes(batch)
+	failOnError(t, "Error while compressing the batch", err)
+	report, err := AnalyzeFrame(blob)
+	failOnError(t, "Error while analyzing the blob", err)
+	// The magicless header only holds the frame header descriptor and the
+	// window descriptor
+	checkReport(t, "scroll", report, blob, 2)
+	if report.SrcSize != int64(len(batch)) || report.Frames != 1 {
+		t.Fatalf("Unexpected report of the blob %+v", report)
+	}
+
+	// Skippable frames only count in the compressed size
+	rle := rleFrame(-1, 3, 1000)
+	src := append(skippableFrame(0, []byte("metadata")), rle...)
+	report, err = AnalyzeFrame(src)
+	failOnError(t, "Error while analyzing the frames", err)
+	if report.Frames != 1 || report.RLEBlocks != 3 || report.SrcSize != 3000 || report.LiteralBytes != 3000 ||
+		report.CompressedSize != int64(len(src)) || !equalInts(report.BlockSizes, []int{1, 1, 1}) {
+		t.Fatalf("Unexpected report of RLE blocks %+v", report)
+	}
+
+	stored, err := CompressStored(nil, bytes.Repeat([]byte("stored"), 100000))
+	failOnError(t, "Error while compressing", err)
+	report, err = AnalyzeFrame(append(stored, stored...))
+	failOnError(t, "Error while analyzing the frames", err)
+	if report.Frames != 2 || report.RawBlocks != report.Blocks || report.MatchBytes != 0 || report.SrcSize != 1200000 {
+		t.Fatalf("Unexpected report of raw blocks %+v", report)
+	}
+
+	legacy := []byte("%\xb5/\xfd\x00@\x00\x1bcompressed with legacy zstd\xc0\x00\x00")
+	if _, err := AnalyzeFrame(legacy); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("Expected ErrNotSupported for legacy frames, got %v", err)
+	}
+	if _, err := AnalyzeFrame(stored[:len(stored)-1]); err != ErrFrameTruncated {
+		t.Fatalf("Expected ErrFrameTruncated, got %v", err)
+	}
+	var notZstd ErrNotZstd
+	if _, err := AnalyzeFrame([]byte("not a zstd frame at all")); !errors.As(err, &notZstd) {
+		t.Fatalf("Expected ErrNotZstd, got %v", err)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
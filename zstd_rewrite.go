@@ -0,0 +1,97 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"io"
+	"io/ioutil"
+)
+
+// RewriteFrame decompresses the frames of src and compresses their content
+// again into a single frame written to dst with params, e.g. to upgrade old
+// archives to a higher level with a checksum. Data is streamed from decoder to
+// encoder, so that memory use does not depend on the content size. It returns
+// the number of bytes written to dst.
+//
+// The new frame declares its content size when src is an io.Seeker, such as
+// an *os.File: src is then decoded twice, first to measure its content, from
+// its current position.
+func RewriteFrame(dst io.Writer, src io.Reader, params CParams) (int64, error) {
+	return RewriteFrameDict(dst, src, nil, WriterParams{CParams: params})
+}
+
+// RewriteFrameDict is like RewriteFrame but decodes src with srcDict, nil if
+// it was compressed without dictionary, and compresses the content with
+// params, which may set another dictionary.
+func RewriteFrameDict(dst io.Writer, src io.Reader, srcDict []byte, params WriterParams) (int64, error) {
+	size, err := rewriteContentSize(src, srcDict)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &countingWriter{w: dst}
+	zw, err := NewWriterParams(counter, params)
+	if err != nil {
+		return 0, err
+	}
+	if size >= 0 {
+		if err := getError(int(C.ZSTD_CCtx_setPledgedSrcSize(zw.ctx, C.ulonglong(size)))); err != nil {
+			zw.Abort()
+			return 0, opError("ZSTD_CCtx_setPledgedSrcSize", 0, 0, err)
+		}
+	}
+	zr := newReader(src, srcDict)
+	defer zr.Close()
+	_, err = io.Copy(zw, zr)
+	if err == nil && zr.frameIn > 0 {
+		// The Reader stops silently when src ends between two blocks
+		err = ErrFrameTruncated
+	}
+	if err != nil {
+		zw.Abort()
+		return counter.n, err
+	}
+	err = zw.Close()
+	return counter.n, err
+}
+
+// rewriteContentSize returns the content size of the frames of src, or -1 if
+// it cannot be known without consuming src. A seekable src is decoded, then
+// rewound to its position.
+func rewriteContentSize(src io.Reader, dict []byte) (int64, error) {
+	seeker, ok := src.(io.Seeker)
+	if !ok {
+		return -1, nil
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	zr := newReader(src, dict)
+	size, err := io.Copy(ioutil.Discard, zr)
+	if err == nil && zr.frameIn > 0 {
+		err = ErrFrameTruncated
+	}
+	zr.Close()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
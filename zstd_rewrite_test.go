@@ -0,0 +1,86 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestRewriteFrame(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello, World! "), 50000)
+	var buf bytes.Buffer
+	w := NewWriterLevel(&buf, 3)
+	_, err := w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	if info, err := Info(buf.Bytes()); err != nil || info.DecompressedSize != -1 {
+		t.Fatalf("Expected a frame without content size, got %+v %v", info, err)
+	}
+
+	var out bytes.Buffer
+	n, err := RewriteFrame(&out, bytes.NewReader(buf.Bytes()), CParams{Level: 19, Checksum: true})
+	failOnError(t, "Failed to rewrite", err)
+	if n != int64(out.Len()) {
+		t.Fatalf("Reported %d bytes, wrote %d", n, out.Len())
+	}
+	info, err := Info(out.Bytes())
+	failOnError(t, "Failed to get info", err)
+	if len(info.Frames) != 1 || info.DecompressedSize != int64(len(payload)) || !info.HasChecksum {
+		t.Fatalf("Expected a frame with the content size %d and a checksum, got %+v", len(payload), info)
+	}
+	failOnError(t, "Failed to verify", VerifyFrame(out.Bytes()))
+	decompressed, err := Decompress(nil, out.Bytes())
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(decompressed, payload) {
+		t.Fatal("Rewritten content does not match")
+	}
+
+	// Without seeking, the size cannot be known upfront
+	out.Reset()
+	_, err = RewriteFrame(&out, struct{ io.Reader }{bytes.NewReader(buf.Bytes())}, CParams{Level: 1})
+	failOnError(t, "Failed to rewrite", err)
+	if info, err := Info(out.Bytes()); err != nil || info.DecompressedSize != -1 {
+		t.Fatalf("Expected a frame without content size, got %+v %v", info, err)
+	}
+}
+
+func TestRewriteFrameDict(t *testing.T) {
+	dict := bytes.Repeat([]byte("Hello, dictionary! "), 100)
+	payload := bytes.Repeat([]byte("Hello, World! "), 1000)
+	src, err := Compress(nil, payload)
+	failOnError(t, "Failed to compress", err)
+
+	var withDict bytes.Buffer
+	_, err = RewriteFrameDict(&withDict, bytes.NewReader(src), nil, WriterParams{CParams: CParams{Level: 5}, Dict: dict})
+	failOnError(t, "Failed to rewrite with a dictionary", err)
+	var back bytes.Buffer
+	_, err = RewriteFrameDict(&back, bytes.NewReader(withDict.Bytes()), dict, WriterParams{})
+	failOnError(t, "Failed to rewrite without a dictionary", err)
+
+	decompressed, err := Decompress(nil, back.Bytes())
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(decompressed, payload) {
+		t.Fatal("Rewritten content does not match")
+	}
+
+	r := NewReader(bytes.NewReader(withDict.Bytes()))
+	defer r.Close()
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Fatal("Expected the rewritten frame to require the dictionary")
+	}
+}
+
+func TestRewriteFrameCorrupted(t *testing.T) {
+	src, err := Compress(nil, bytes.Repeat([]byte("Hello, World! "), 1000))
+	failOnError(t, "Failed to compress", err)
+	for _, truncated := range []io.Reader{bytes.NewReader(src[:len(src)-5]), struct{ io.Reader }{bytes.NewReader(src[:len(src)-5])}} {
+		var out bytes.Buffer
+		if _, err := RewriteFrame(&out, truncated, CParams{}); err == nil {
+			t.Fatal("Expected an error rewriting a truncated frame")
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package zstd
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SampleCollector keeps a uniform random sample of the payloads it is given,
+// bounded by count and by total size, to train a dictionary from live
+// traffic. It is safe for concurrent use, e.g. from request handlers: once
+// the reservoir is full, most payloads are dropped without being copied.
+type SampleCollector struct {
+	maxSamples int
+	maxBytes   int
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	samples [][]byte
+	size    int
+	seen    int64
+}
+
+// NewSampleCollector creates a SampleCollector keeping at most maxSamples
+// payloads totalling at most maxBytes.
+func NewSampleCollector(maxSamples, maxBytes int) *SampleCollector {
+	return &SampleCollector{
+		maxSamples: maxSamples,
+		maxBytes:   maxBytes,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Add offers a payload to the reservoir, which keeps a copy of it if it is
+// selected. Empty payloads and payloads larger than maxBytes are ignored.
+func (c *SampleCollector) Add(payload []byte) {
+	if len(payload) == 0 || len(payload) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seen++
+	if len(c.samples) < c.maxSamples && c.size+len(payload) <= c.maxBytes {
+		c.samples = append(c.samples, append([]byte(nil), payload...))
+		c.size += len(payload)
+		return
+	}
+	// Reservoir sampling: the payload replaces a random sample with
+	// probability len(samples)/seen
+	i := c.rand.Int63n(c.seen)
+	if i >= int64(len(c.samples)) {
+		return
+	}
+	old := c.samples[i]
+	if c.size-len(old)+len(payload) > c.maxBytes {
+		return
+	}
+	c.samples[i] = append([]byte(nil), payload...)
+	c.size += len(payload) - len(old)
+}
+
+// Snapshot returns the samples currently in the reservoir. They must not be
+// modified.
+func (c *SampleCollector) Snapshot() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.samples...)
+}
+
+// Train trains a dictionary of at most maxDictSize bytes from the current
+// samples. The trainer needs a good number of samples, typically a hundred
+// times maxDictSize in total, and fails if there are too few of them.
+func (c *SampleCollector) Train(maxDictSize int) ([]byte, error) {
+	return trainDictionary(c.Snapshot(), maxDictSize)
+}
@@ -0,0 +1,78 @@
+package zstd
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSampleCollectorBounds(t *testing.T) {
+	c := NewSampleCollector(10, 100)
+	for i := 0; i < 1000; i++ {
+		c.Add([]byte(fmt.Sprintf("payload %d", i)))
+	}
+	samples := c.Snapshot()
+	if len(samples) != 10 {
+		t.Fatalf("Expected 10 samples, got %d", len(samples))
+	}
+	total := 0
+	for _, s := range samples {
+		total += len(s)
+	}
+	if total > 100 {
+		t.Fatalf("Expected at most 100 bytes, got %d", total)
+	}
+
+	// Payloads larger than the reservoir are ignored
+	c.Add(make([]byte, 101))
+	for _, s := range c.Snapshot() {
+		if len(s) > 100 {
+			t.Fatal("Oversized payload was kept")
+		}
+	}
+}
+
+func TestSampleCollectorCopies(t *testing.T) {
+	c := NewSampleCollector(1, 100)
+	payload := []byte("Hello, World!")
+	c.Add(payload)
+	payload[0] = 'J'
+	if got := c.Snapshot(); len(got) != 1 || !bytes.Equal(got[0], []byte("Hello, World!")) {
+		t.Fatalf("Expected a copy of the payload, got %q", got)
+	}
+}
+
+func TestSampleCollectorUniform(t *testing.T) {
+	// Each payload should have the same chance of being kept, check that both
+	// halves of the stream are represented
+	c := NewSampleCollector(100, 1<<20)
+	for i := 0; i < 10000; i++ {
+		c.Add([]byte{byte(i / 5000)})
+	}
+	var halves [2]int
+	for _, s := range c.Snapshot() {
+		halves[s[0]]++
+	}
+	if halves[0] < 20 || halves[1] < 20 {
+		t.Fatalf("Expected samples from the whole stream, got %v", halves)
+	}
+}
+
+func TestSampleCollectorConcurrent(t *testing.T) {
+	c := NewSampleCollector(50, 1<<20)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Add([]byte(fmt.Sprintf("goroutine %d payload %d", g, i)))
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := len(c.Snapshot()); n != 50 {
+		t.Fatalf("Expected 50 samples, got %d", n)
+	}
+}
@@ -0,0 +1,55 @@
+package zstd
+
+import "encoding/binary"
+
+const (
+	// seekTableMagic is the magic number ending the seek table of the zstd
+	// seekable format, see contrib/seekable_format in the zstd sources
+	seekTableMagic = 0x8F92EAB1
+	// seekTableFooterSize is the size of the footer of a seek table: the
+	// number of frames, the descriptor and the magic number
+	seekTableFooterSize = 9
+)
+
+// seekTableContentSize returns the total decompressed size declared by the
+// seek table of the zstd seekable format ending src, a skippable frame listing
+// the compressed and decompressed size of every frame. It returns false if src
+// does not end with a seek table, or if the compressed sizes it lists do not
+// add up to the size of src.
+func seekTableContentSize(src []byte) (uint64, bool) {
+	if len(src) < 8+seekTableFooterSize {
+		return 0, false
+	}
+	footer := src[len(src)-seekTableFooterSize:]
+	if binary.LittleEndian.Uint32(footer[5:]) != seekTableMagic {
+		return 0, false
+	}
+	descriptor := footer[4]
+	if descriptor&0x7C != 0 { // Reserved bits
+		return 0, false
+	}
+	entrySize := uint64(8)
+	if descriptor&0x80 != 0 { // Checksum flag
+		entrySize += 4
+	}
+	frames := uint64(binary.LittleEndian.Uint32(footer))
+	tableSize := 8 + frames*entrySize + seekTableFooterSize
+	if tableSize > uint64(len(src)) {
+		return 0, false
+	}
+	table := src[uint64(len(src))-tableSize:]
+	if binary.LittleEndian.Uint32(table)&0xFFFFFFF0 != 0x184D2A50 ||
+		uint64(binary.LittleEndian.Uint32(table[4:])) != tableSize-8 {
+		return 0, false
+	}
+
+	var compressed, decompressed uint64
+	for entries := table[8 : tableSize-seekTableFooterSize]; len(entries) > 0; entries = entries[entrySize:] {
+		compressed += uint64(binary.LittleEndian.Uint32(entries))
+		decompressed += uint64(binary.LittleEndian.Uint32(entries[4:]))
+	}
+	if compressed != uint64(len(src))-tableSize {
+		return 0, false
+	}
+	return decompressed, true
+}
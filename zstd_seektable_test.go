@@ -0,0 +1,65 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// appendSeekTable appends to dst the seek table of frames, given as
+// compressed and decompressed sizes, with checksums of 0 if checksums is set.
+func appendSeekTable(dst []byte, frames [][2]uint32, checksums bool) []byte {
+	entrySize := 8
+	if checksums {
+		entrySize = 12
+	}
+	table := make([]byte, 8+len(frames)*entrySize+seekTableFooterSize)
+	binary.LittleEndian.PutUint32(table, 0x184D2A5E)
+	binary.LittleEndian.PutUint32(table[4:], uint32(len(table)-8))
+	for i, f := range frames {
+		binary.LittleEndian.PutUint32(table[8+i*entrySize:], f[0])
+		binary.LittleEndian.PutUint32(table[8+i*entrySize+4:], f[1])
+	}
+	footer := table[len(table)-seekTableFooterSize:]
+	binary.LittleEndian.PutUint32(footer, uint32(len(frames)))
+	if checksums {
+		footer[4] = 0x80
+	}
+	binary.LittleEndian.PutUint32(footer[5:], seekTableMagic)
+	return append(dst, table...)
+}
+
+func TestSeekTableContentSize(t *testing.T) {
+	frames := [][2]uint32{{10, 100}, {20, 300}}
+	data := make([]byte, 30)
+	for _, checksums := range []bool{false, true} {
+		src := appendSeekTable(append([]byte(nil), data...), frames, checksums)
+		if size, ok := seekTableContentSize(src); !ok || size != 400 {
+			t.Fatalf("checksums=%v: expected 400, got %d %v", checksums, size, ok)
+		}
+	}
+
+	valid := appendSeekTable(append([]byte(nil), data...), frames, false)
+	tests := map[string][]byte{
+		"no table":        data,
+		"short":           valid[len(valid)-seekTableFooterSize:],
+		"sizes mismatch":  appendSeekTable(make([]byte, 31), frames, false),
+		"truncated table": valid[len(data)+1:],
+	}
+	badMagic := append([]byte(nil), valid...)
+	badMagic[len(badMagic)-1] ^= 0xFF
+	tests["bad magic"] = badMagic
+	reserved := append([]byte(nil), valid...)
+	reserved[len(reserved)-5] = 0x04
+	tests["reserved bits"] = reserved
+	badFrame := append([]byte(nil), valid...)
+	badFrame[len(data)] = 0
+	tests["not a skippable frame"] = badFrame
+	tooManyFrames := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint32(tooManyFrames[len(tooManyFrames)-seekTableFooterSize:], 1000)
+	tests["too many frames"] = tooManyFrames
+	for name, src := range tests {
+		if _, ok := seekTableContentSize(src); ok {
+			t.Errorf("%s: expected no seek table", name)
+		}
+	}
+}
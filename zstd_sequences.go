@@ -0,0 +1,234 @@
+package zstd
+
+/*
+#define ZSTD_DISABLE_DEPRECATE_WARNINGS
+#include "zstd.h"
+#include "zstd_errors.h"
+
+// The sequence API only settled in zstd 1.5.6, which an external libzstd may
+// predate, and ZSTD_Sequence had another layout before. The wrappers take the
+// layout of 1.5.6 and the version is checked before calling them.
+typedef struct {
+	unsigned int offset;
+	unsigned int litLength;
+	unsigned int matchLength;
+	unsigned int rep;
+} ZSTD_Sequence_compat;
+
+static size_t ZSTD_compressSequences_compat(ZSTD_CCtx* cctx, void* dst, size_t dstSize,
+		const ZSTD_Sequence_compat* inSeqs, size_t inSeqsSize, const void* src, size_t srcSize) {
+#if ZSTD_VERSION_NUMBER >= 10506
+	return ZSTD_compressSequences(cctx, dst, dstSize, (const ZSTD_Sequence*)inSeqs, inSeqsSize, src, srcSize);
+#else
+	return (size_t)-ZSTD_error_version_unsupported;
+#endif
+}
+
+static size_t ZSTD_sequenceBound_compat(size_t srcSize) {
+#if ZSTD_VERSION_NUMBER >= 10506
+	return ZSTD_sequenceBound(srcSize);
+#else
+	return 1; // Room for ZSTD_generateSequences_compat to fail
+#endif
+}
+
+static size_t ZSTD_generateSequences_compat(ZSTD_CCtx* zc, ZSTD_Sequence_compat* outSeqs, size_t outSeqsSize,
+		const void* src, size_t srcSize) {
+#if ZSTD_VERSION_NUMBER >= 10506
+	return ZSTD_generateSequences(zc, (ZSTD_Sequence*)outSeqs, outSeqsSize, src, srcSize);
+#else
+	return (size_t)-ZSTD_error_version_unsupported;
+#endif
+}
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// minMatchLength is ZSTD_MINMATCH_MIN from zstd.h
+const minMatchLength = 3
+
+// Sequence is a match of the compressed data: LitLength literals followed by
+// MatchLength bytes copied from Offset bytes back. A sequence with Offset and
+// MatchLength both 0 holds the last literals of a block and delimits it. See
+// ZSTD_Sequence in zstd.h.
+type Sequence struct {
+	Offset      uint32
+	LitLength   uint32
+	MatchLength uint32
+	// Rep is the repeat offset code computed by GenerateSequences, it is
+	// ignored by CompressSequences
+	Rep uint32
+}
+
+// SequenceFormat tells CompressSequences whether the sequences contain block
+// delimiters.
+type SequenceFormat int
+
+// Sequence formats mirror ZSTD_sequenceFormat_e from zstd.h
+const (
+	// SequencesNoBlockDelimiters lets the compressor split the sequences in
+	// blocks. The literals after the last sequence are implied by the input.
+	SequencesNoBlockDelimiters SequenceFormat = C.ZSTD_sf_noBlockDelimiters
+	// SequencesExplicitBlockDelimiters expects every block to end with a
+	// delimiter, as produced by GenerateSequences
+	SequencesExplicitBlockDelimiters SequenceFormat = C.ZSTD_sf_explicitBlockDelimiters
+)
+
+// SequenceError is returned by CompressSequences for sequences which do not
+// describe the input.
+type SequenceError struct {
+	Index  int
+	Reason string
+}
+
+func (e *SequenceError) Error() string {
+	return fmt.Sprintf("zstd: invalid sequence %d: %s", e.Index, e.Reason)
+}
+
+// validateSequences checks that the sequences describe a valid input of
+// srcSize bytes, so that invalid sequences are reported without crossing into
+// cgo.
+func validateSequences(sequences []Sequence, srcSize int, format SequenceFormat) error {
+	pos := 0
+	for i, seq := range sequences {
+		pos += int(seq.LitLength)
+		isDelimiter := seq.Offset == 0 && seq.MatchLength == 0
+		switch {
+		case isDelimiter && format != SequencesExplicitBlockDelimiters:
+			return &SequenceError{Index: i, Reason: "block delimiter without SequencesExplicitBlockDelimiters"}
+		case !isDelimiter && seq.Offset == 0:
+			return &SequenceError{Index: i, Reason: "match with a zero offset"}
+		case !isDelimiter && seq.MatchLength < minMatchLength:
+			return &SequenceError{Index: i, Reason: fmt.Sprintf("match length %d is below %d", seq.MatchLength, minMatchLength)}
+		case int(seq.Offset) > pos:
+			return &SequenceError{Index: i, Reason: fmt.Sprintf("offset %d is before the start of the input", seq.Offset)}
+		}
+		pos += int(seq.MatchLength)
+		if pos > srcSize {
+			return &SequenceError{Index: i, Reason: fmt.Sprintf("sequences cover more than the %d bytes of input", srcSize)}
+		}
+	}
+	if format == SequencesExplicitBlockDelimiters {
+		if len(sequences) == 0 || sequences[len(sequences)-1].Offset != 0 || sequences[len(sequences)-1].MatchLength != 0 {
+			return &SequenceError{Index: len(sequences), Reason: "missing final block delimiter"}
+		}
+		if pos != srcSize {
+			return &SequenceError{Index: len(sequences) - 1, Reason: fmt.Sprintf("sequences cover %d of the %d bytes of input", pos, srcSize)}
+		}
+	}
+	return nil
+}
+
+// CompressSequences builds a single frame from sequences instead of searching
+// for matches. src is the entire input, not only the literals: the sequences
+// are applied to it in order, and any input left after the last sequence is
+// emitted as literals. params.BlockDelimiters tells whether sequences contain
+// block delimiters. The sequences are validated before compression and a
+// *SequenceError is returned if they do not describe src. It returns a
+// *VersionError when built against an external libzstd older than 1.5.6.
+func CompressSequences(dst []byte, sequences []Sequence, src []byte, params CParams) ([]byte, error) {
+	if err := requireVersion("sequence API", minVersionSequences); err != nil {
+		return nil, err
+	}
+	if err := validateSequences(sequences, len(src), params.BlockDelimiters); err != nil {
+		return nil, err
+	}
+
+	cctx, err := newCCtx()
+	if err != nil {
+		return nil, err
+	}
+	defer freeCCtx(cctx)
+	if err := params.apply(cctx); err != nil {
+		return nil, err
+	}
+	// Let libzstd double check the sequences, and accept the shortest matches
+	if err := getError(int(C.ZSTD_CCtx_setParameter(cctx, C.ZSTD_c_validateSequences, 1))); err != nil {
+		return nil, opError("ZSTD_CCtx_setParameter", 0, 0, err)
+	}
+	if err := setCParameter(cctx, CParamMinMatch, minMatchLength); err != nil {
+		return nil, err
+	}
+
+	bound := CompressBound(len(src))
+	if cap(dst) >= bound {
+		dst = dst[0:bound] // Reuse dst buffer
+	} else {
+		dst = make([]byte, bound)
+	}
+	cSequences := make([]C.ZSTD_Sequence_compat, len(sequences))
+	for i, seq := range sequences {
+		cSequences[i] = C.ZSTD_Sequence_compat{
+			offset:      C.uint(seq.Offset),
+			litLength:   C.uint(seq.LitLength),
+			matchLength: C.uint(seq.MatchLength),
+			rep:         C.uint(seq.Rep),
+		}
+	}
+	var seqPtr *C.ZSTD_Sequence_compat // Do not point anywhere, if there are no sequences
+	if len(cSequences) > 0 {
+		seqPtr = &cSequences[0]
+	}
+	var srcPtr *byte // Do not point anywhere, if src is empty
+	if len(src) > 0 {
+		srcPtr = &src[0]
+	}
+	written := int(C.ZSTD_compressSequences_compat(
+		cctx,
+		unsafe.Pointer(&dst[0]),
+		C.size_t(len(dst)),
+		seqPtr,
+		C.size_t(len(cSequences)),
+		unsafe.Pointer(srcPtr),
+		C.size_t(len(src))))
+	if err := getError(written); err != nil {
+		return nil, opError("ZSTD_compressSequences", len(src), len(dst), err)
+	}
+	return dst[:written], nil
+}
+
+// GenerateSequences returns the sequences the compressor finds in src with
+// params, each block ending with a delimiter. They can be passed to
+// CompressSequences with SequencesExplicitBlockDelimiters. libzstd only
+// provides this for debugging and informational purposes. It returns a
+// *VersionError when built against an external libzstd older than 1.5.6.
+func GenerateSequences(src []byte, params CParams) ([]Sequence, error) {
+	if len(src) == 0 {
+		return nil, ErrEmptySlice
+	}
+	if err := requireVersion("sequence API", minVersionSequences); err != nil {
+		return nil, err
+	}
+	cctx, err := newCCtx()
+	if err != nil {
+		return nil, err
+	}
+	defer freeCCtx(cctx)
+	if err := params.apply(cctx); err != nil {
+		return nil, err
+	}
+
+	cSequences := make([]C.ZSTD_Sequence_compat, int(C.ZSTD_sequenceBound_compat(C.size_t(len(src)))))
+	count := int(C.ZSTD_generateSequences_compat(
+		cctx,
+		&cSequences[0],
+		C.size_t(len(cSequences)),
+		unsafe.Pointer(&src[0]),
+		C.size_t(len(src))))
+	if err := getError(count); err != nil {
+		return nil, opError("ZSTD_generateSequences", len(src), 0, err)
+	}
+	sequences := make([]Sequence, count)
+	for i, seq := range cSequences[:count] {
+		sequences[i] = Sequence{
+			Offset:      uint32(seq.offset),
+			LitLength:   uint32(seq.litLength),
+			MatchLength: uint32(seq.matchLength),
+			Rep:         uint32(seq.rep),
+		}
+	}
+	return sequences, nil
+}
@@ -0,0 +1,93 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompressSequences(t *testing.T) {
+	src := []byte("abcdefabcdefabcdef-end")
+	// "abcdef" as literals, then 12 bytes copied from 6 bytes back, then
+	// "-end" as last literals
+	sequences := []Sequence{{Offset: 6, LitLength: 6, MatchLength: 12}}
+	for _, format := range []SequenceFormat{SequencesNoBlockDelimiters, SequencesExplicitBlockDelimiters} {
+		seqs := sequences
+		if format == SequencesExplicitBlockDelimiters {
+			seqs = append(seqs, Sequence{LitLength: 4})
+		}
+		compressed, err := CompressSequences(nil, seqs, src, CParams{BlockDelimiters: format})
+		if err != nil {
+			t.Fatalf("format %d: CompressSequences failed: %s", format, err)
+		}
+		decompressed, err := Decompress(nil, compressed)
+		if err != nil {
+			t.Fatalf("format %d: Decompress failed: %s", format, err)
+		}
+		if !bytes.Equal(decompressed, src) {
+			t.Fatalf("format %d: got %q, want %q", format, decompressed, src)
+		}
+	}
+}
+
+func TestCompressSequencesValidation(t *testing.T) {
+	src := []byte("abcdefabcdefabcdef-end")
+	for _, tc := range []struct {
+		name      string
+		sequences []Sequence
+		format    SequenceFormat
+	}{
+		{"offset before start", []Sequence{{Offset: 7, LitLength: 6, MatchLength: 12}}, SequencesNoBlockDelimiters},
+		{"zero offset", []Sequence{{LitLength: 6, MatchLength: 12}}, SequencesNoBlockDelimiters},
+		{"short match", []Sequence{{Offset: 6, LitLength: 6, MatchLength: 2}}, SequencesNoBlockDelimiters},
+		{"past the input", []Sequence{{Offset: 6, LitLength: 6, MatchLength: 100}}, SequencesNoBlockDelimiters},
+		{"unexpected delimiter", []Sequence{{LitLength: 22}}, SequencesNoBlockDelimiters},
+		{"missing delimiter", []Sequence{{Offset: 6, LitLength: 6, MatchLength: 12}}, SequencesExplicitBlockDelimiters},
+		{"partial cover", []Sequence{{Offset: 6, LitLength: 6, MatchLength: 12}, {LitLength: 1}}, SequencesExplicitBlockDelimiters},
+	} {
+		_, err := CompressSequences(nil, tc.sequences, src, CParams{BlockDelimiters: tc.format})
+		if _, ok := err.(*SequenceError); !ok {
+			t.Errorf("%s: expected a SequenceError, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestGenerateSequencesRoundTrip(t *testing.T) {
+	inputs := [][]byte{
+		[]byte("Hello World!"),
+		[]byte(strings.Repeat("Hello World! ", 10000)),
+		bytes.Join(jsonDocuments(100), nil),
+	}
+	for _, src := range inputs {
+		sequences, err := GenerateSequences(src, CParams{Level: BestSpeed})
+		if err != nil {
+			t.Fatalf("len=%d GenerateSequences failed: %s", len(src), err)
+		}
+		covered := 0
+		for _, seq := range sequences {
+			covered += int(seq.LitLength + seq.MatchLength)
+		}
+		if covered != len(src) {
+			t.Fatalf("len=%d sequences cover %d bytes", len(src), covered)
+		}
+
+		compressed, err := CompressSequences(nil, sequences, src, CParams{BlockDelimiters: SequencesExplicitBlockDelimiters})
+		if err != nil {
+			t.Fatalf("len=%d CompressSequences failed: %s", len(src), err)
+		}
+		decompressed, err := Decompress(nil, compressed)
+		if err != nil {
+			t.Fatalf("len=%d Decompress failed: %s", len(src), err)
+		}
+		if !bytes.Equal(decompressed, src) {
+			t.Fatalf("len=%d round trip does not match", len(src))
+		}
+	}
+
+	if _, err := GenerateSequences(nil, CParams{}); err != ErrEmptySlice {
+		t.Fatalf("expected ErrEmptySlice, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrNotZstd is returned when decompressing data which does not start with a
+// zstd magic number. Detected names the format the data looks like, e.g.
+// "gzip", "xz" or "text", or is empty if it was not recognized.
+type ErrNotZstd struct {
+	Detected string
+}
+
+func (e ErrNotZstd) Error() string {
+	if e.Detected == "" {
+		return "Not zstd compressed data"
+	}
+	return fmt.Sprintf("Not zstd compressed data, looks like %s", e.Detected)
+}
+
+// formatSignatures are the magic numbers of well-known formats, checked in
+// order against the start of the data.
+var formatSignatures = []struct {
+	name  string
+	magic []byte
+}{
+	{"gzip", []byte{0x1F, 0x8B}},
+	{"xz", []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}},
+	{"bzip2", []byte("BZh")},
+	{"lz4", []byte{0x04, 0x22, 0x4D, 0x18}},
+	{"snappy", []byte{0xFF, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y'}},
+	{"zip", []byte{'P', 'K', 0x03, 0x04}},
+	{"7z", []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}},
+}
+
+// sniffLength is the number of bytes looked at to tell text from binary data.
+const sniffLength = 512
+
+// hasZstdMagic returns whether src starts with the magic number of a zstd
+// frame, a legacy frame or a skippable frame, or with a prefix of it when src
+// is shorter.
+func hasZstdMagic(src []byte) bool {
+	if len(src) < 4 {
+		var magic [4]byte
+		binary.LittleEndian.PutUint32(magic[:], 0xFD2FB528)
+		return bytes.HasPrefix(magic[:], src)
+	}
+	magic := binary.LittleEndian.Uint32(src)
+	return magic >= 0xFD2FB51E && magic <= 0xFD2FB528 || magic&0xFFFFFFF0 == 0x184D2A50
+}
+
+// sniffFormat returns the name of the format src looks like from its first
+// bytes, or "" if it is not recognized.
+func sniffFormat(src []byte) string {
+	for _, s := range formatSignatures {
+		if bytes.HasPrefix(src, s.magic) {
+			return s.name
+		}
+	}
+	// zlib has no magic number, but a header whose first 2 bytes are a
+	// multiple of 31, with the deflate method and a window of at most 32KB
+	if len(src) >= 2 && src[0]&0x0F == 8 && src[0]>>4 <= 7 && binary.BigEndian.Uint16(src)%31 == 0 {
+		return "zlib"
+	}
+	if isText(src) {
+		return "text"
+	}
+	return ""
+}
+
+// isText returns whether the first bytes of src are printable UTF-8 text.
+func isText(src []byte) bool {
+	if len(src) > sniffLength {
+		src = src[:sniffLength]
+		// Do not reject a rune cut by the limit
+		for i := 0; i < utf8.UTFMax-1 && !utf8.Valid(src); i++ {
+			src = src[:len(src)-1]
+		}
+	}
+	if !utf8.Valid(src) {
+		return false
+	}
+	for _, b := range src {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' || b == 0x7F {
+			return false
+		}
+	}
+	return true
+}
+
+// notZstdError returns ErrNotZstd instead of err when decompressing src
+// failed because it is not zstd compressed data.
+func notZstdError(src []byte, err error) error {
+	if err == nil || len(src) == 0 || hasZstdMagic(src) {
+		return err
+	}
+	return ErrNotZstd{Detected: sniffFormat(src)}
+}
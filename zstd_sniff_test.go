@@ -0,0 +1,102 @@
+package zstd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"testing"
+)
+
+func TestSniffFormat(t *testing.T) {
+	var gz, zl, zlBest bytes.Buffer
+	for _, w := range []interface {
+		Write([]byte) (int, error)
+		Close() error
+	}{gzip.NewWriter(&gz), zlib.NewWriter(&zl)} {
+		w.Write([]byte("payload"))
+		w.Close()
+	}
+	zw, _ := zlib.NewWriterLevel(&zlBest, zlib.BestCompression)
+	zw.Write([]byte("payload"))
+	zw.Close()
+
+	tests := []struct {
+		name     string
+		src      []byte
+		expected string
+	}{
+		{"gzip", gz.Bytes(), "gzip"},
+		{"zlib", zl.Bytes(), "zlib"},
+		{"zlib best", zlBest.Bytes(), "zlib"},
+		{"xz", []byte{0xFD, '7', 'z', 'X', 'Z', 0x00, 0x00, 0x04}, "xz"},
+		{"bzip2", []byte("BZh91AY&SY"), "bzip2"},
+		{"lz4", []byte{0x04, 0x22, 0x4D, 0x18, 0x64, 0x40}, "lz4"},
+		{"snappy", []byte{0xFF, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y'}, "snappy"},
+		{"zip", []byte{'P', 'K', 0x03, 0x04, 0x14, 0x00}, "zip"},
+		{"7z", []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C, 0x00}, "7z"},
+		{"text", []byte("Hello, World!\n"), "text"},
+		{"utf8 text", []byte("héllo wörld\r\n\tend"), "text"},
+		{"long text", bytes.Repeat([]byte("é"), sniffLength), "text"},
+		{"binary", []byte{0x00, 0x01, 0x02, 0x03, 0xFF}, ""},
+		{"invalid utf8", []byte{'a', 0xC3, 'b'}, ""},
+	}
+	for _, test := range tests {
+		if detected := sniffFormat(test.src); detected != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, detected)
+		}
+	}
+}
+
+func TestHasZstdMagic(t *testing.T) {
+	tests := []struct {
+		src      []byte
+		expected bool
+	}{
+		{[]byte{0x28, 0xB5, 0x2F, 0xFD, 0x00}, true},
+		{[]byte{0x28, 0xB5}, true},
+		{[]byte{0x27, 0xB5, 0x2F, 0xFD}, true},
+		{[]byte{0x1E, 0xB5, 0x2F, 0xFD}, true},
+		{[]byte{0x50, 0x2A, 0x4D, 0x18}, true},
+		{[]byte{0x5F, 0x2A, 0x4D, 0x18}, true},
+		{[]byte{0x29, 0xB5, 0x2F, 0xFD}, false},
+		{[]byte{0x1F, 0x8B}, false},
+		{[]byte("text"), false},
+	}
+	for _, test := range tests {
+		if got := hasZstdMagic(test.src); got != test.expected {
+			t.Errorf("%x: expected %v, got %v", test.src, test.expected, got)
+		}
+	}
+}
+
+func TestDecompressNotZstd(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("payload"))
+	w.Close()
+
+	_, err := Decompress(nil, gz.Bytes())
+	if err != (ErrNotZstd{Detected: "gzip"}) {
+		t.Fatalf("Expected ErrNotZstd for gzip, got %v", err)
+	}
+	if err.Error() != "Not zstd compressed data, looks like gzip" {
+		t.Fatalf("Unexpected message %q", err.Error())
+	}
+	if _, err := DecompressInto(make([]byte, 100), []byte("plain text")); err != (ErrNotZstd{Detected: "text"}) {
+		t.Fatalf("Expected ErrNotZstd for text, got %v", err)
+	}
+	if _, err := Decompress(nil, []byte{0x00, 0x01, 0x02, 0x03}); err != (ErrNotZstd{}) {
+		t.Fatalf("Expected ErrNotZstd, got %v", err)
+	}
+
+	// Corrupted zstd data keeps its error
+	compressed, err := Compress(nil, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decompress(nil, compressed[:len(compressed)-2]); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(ErrNotZstd); ok {
+		t.Fatalf("Unexpected ErrNotZstd for truncated zstd data")
+	}
+}
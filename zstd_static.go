@@ -0,0 +1,342 @@
+package zstd
+
+/*
+#include "zstd.h"
+
+// ZSTD_decompressStream_positions runs ZSTD_decompressStream with positions
+// kept by the caller.
+static size_t ZSTD_decompressStream_positions(ZSTD_DCtx* ctx,
+		void* dst, size_t dstSize, size_t* dstPos,
+		const void* src, size_t srcSize, size_t* srcPos) {
+	ZSTD_outBuffer outBuffer = { dst, dstSize, *dstPos };
+	ZSTD_inBuffer inBuffer = { src, srcSize, *srcPos };
+	size_t retCode = ZSTD_decompressStream(ctx, &outBuffer, &inBuffer);
+	*dstPos = outBuffer.pos;
+	*srcPos = inBuffer.pos;
+	return retCode;
+}
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"unsafe"
+)
+
+// WorkspaceSizeError is returned by NewStaticCtx and NewStaticDCtx when the
+// workspace cannot hold the context, and by DCtx.DecompressTo when it cannot
+// hold the window of a frame.
+type WorkspaceSizeError struct {
+	// Size is the size of the workspace
+	Size int
+	// RequiredSize is the size the context needs, see StaticCtxSize and
+	// StaticDCtxSize
+	RequiredSize int
+}
+
+func (e *WorkspaceSizeError) Error() string {
+	return fmt.Sprintf("Workspace of %d bytes is too small, %d bytes required", e.Size, e.RequiredSize)
+}
+
+// errWorkspaceAlignment is returned for a workspace which is not 8-byte
+// aligned, e.g. a slice of a larger buffer.
+var errWorkspaceAlignment = errors.New("Workspace is not 8-byte aligned")
+
+// StaticCtxSize returns the size of the workspace NewStaticCtx needs to
+// compress inputs of any size with params.
+func StaticCtxSize(params CParams) (int, error) {
+	cparams := C.ZSTD_createCCtxParams()
+	if cparams == nil {
+		return 0, allocationError()
+	}
+	defer C.ZSTD_freeCCtxParams(cparams)
+	err := params.each(func(param CParameter, value int) error {
+		if err := checkCParameter(param, value); err != nil {
+			return err
+		}
+		return opError("ZSTD_CCtxParams_setParameter", 0, 0, getError(int(C.ZSTD_CCtxParams_setParameter(cparams, C.ZSTD_cParameter(param), C.int(value)))))
+	})
+	if err != nil {
+		return 0, err
+	}
+	size := int(C.ZSTD_estimateCCtxSize_usingCCtxParams(cparams))
+	if err := getError(size); err != nil {
+		return 0, opError("ZSTD_estimateCCtxSize_usingCCtxParams", 0, 0, err)
+	}
+	return size, nil
+}
+
+// pinWorkspace checks that workspace is aligned and holds at least required
+// bytes, then pins it and returns the function unpinning it.
+func pinWorkspace(workspace []byte, required int) (func(), error) {
+	if len(workspace) < required {
+		return nil, &WorkspaceSizeError{Size: len(workspace), RequiredSize: required}
+	}
+	if uintptr(unsafe.Pointer(&workspace[0]))%8 != 0 {
+		return nil, errWorkspaceAlignment
+	}
+	return pin(workspace)
+}
+
+// staticCtx is a Ctx compressing in a caller-provided workspace.
+type staticCtx struct {
+	// ctx decompresses, with a regular decompression context
+	*ctx
+	cctx      *C.ZSTD_CCtx
+	level     int
+	workspace []byte
+	unpin     func()
+}
+
+// NewStaticCtx returns a Ctx whose compression context lives in workspace
+// instead of memory allocated by libzstd, for services which must not
+// allocate native memory once started. Its Compress compresses with params,
+// and never allocates C memory. workspace must be at least
+// StaticCtxSize(params) bytes, otherwise a *WorkspaceSizeError reports the
+// size needed, and 8-byte aligned, which a slice starting a buffer of 8
+// bytes or more allocated by Go always is.
+//
+// The workspace is pinned, so that the garbage collector neither moves nor
+// frees it, until the Ctx is garbage collected. It belongs to the Ctx during
+// that time and must not be read or written by the caller. Pinning requires
+// Go 1.21, NewStaticCtx returns ErrNotSupported with older toolchains.
+//
+// CompressLevel compresses at another level, which fails with a memory
+// allocation error if it needs a larger workspace than params. Decompress
+// uses a regular decompression context, allocated by NewStaticCtx.
+func NewStaticCtx(workspace []byte, params CParams) (Ctx, error) {
+	required, err := StaticCtxSize(params)
+	if err != nil {
+		return nil, err
+	}
+	unpin, err := pinWorkspace(workspace, required)
+	if err != nil {
+		return nil, err
+	}
+	c := &staticCtx{ctx: &ctx{}, workspace: workspace, unpin: unpin}
+	c.cctx = C.ZSTD_initStaticCCtx(unsafe.Pointer(&workspace[0]), C.size_t(len(workspace)))
+	if c.cctx == nil {
+		unpin()
+		return nil, &WorkspaceSizeError{Size: len(workspace), RequiredSize: required}
+	}
+	runtime.SetFinalizer(c, finalizeStaticCtx)
+	if err := params.apply(c.cctx); err != nil {
+		return nil, err
+	}
+	if params, err = params.withPreset(); err != nil {
+		return nil, err
+	}
+	c.level = params.Level
+	if c.level == 0 {
+		c.level = DefaultCompression
+	}
+	if c.ctx.dctx, err = newDCtx(); err != nil {
+		return nil, err
+	}
+	runtime.SetFinalizer(c.ctx, finalizeCtx)
+	return c, nil
+}
+
+func (c *staticCtx) Compress(dst, src []byte) ([]byte, error) {
+	return compress2(c.cctx, dst, src)
+}
+
+func (c *staticCtx) CompressLevel(dst, src []byte, level int) ([]byte, error) {
+	if level == c.level {
+		return compress2(c.cctx, dst, src)
+	}
+	if err := setCParameter(c.cctx, CParamCompressionLevel, level); err != nil {
+		return nil, err
+	}
+	defer setCParameter(c.cctx, CParamCompressionLevel, c.level)
+	return compress2(c.cctx, dst, src)
+}
+
+// SetSrcSizeHint implements SrcSizeHinter.
+func (c *staticCtx) SetSrcSizeHint(hint int) error {
+	return setCParameter(c.cctx, CParamSrcSizeHint, hint)
+}
+
+func finalizeStaticCtx(c *staticCtx) {
+	// The context lives in the workspace, there is nothing to free
+	c.unpin()
+}
+
+// StaticDCtxSize returns the size of the workspace NewStaticDCtx needs to
+// decompress frames whose window is at most 1<<windowLog bytes with
+// DCtx.DecompressTo. A windowLog of 0 returns the size needed by
+// DCtx.DecompressInto alone, which decompresses into dst without a window.
+func StaticDCtxSize(windowLog int) (int, error) {
+	if windowLog == 0 {
+		return int(C.ZSTD_estimateDCtxSize()), nil
+	}
+	min, max, err := DParamBounds(DParamWindowLogMax)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkBounds("windowLog", windowLog, min, max); err != nil {
+		return 0, err
+	}
+	return int(C.ZSTD_estimateDStreamSize(C.size_t(1) << uint(windowLog))), nil
+}
+
+// DCtx is a decompression context living in a caller-provided workspace,
+// created by NewStaticDCtx. It must not be used concurrently.
+type DCtx struct {
+	dctx      *C.ZSTD_DCtx
+	workspace []byte
+	scratch   []byte
+	unpin     func()
+}
+
+// NewStaticDCtx returns a DCtx living in workspace instead of memory
+// allocated by libzstd, whose decompressions never allocate native memory,
+// e.g. for real-time pipelines or to bound the memory used deterministically.
+// workspace must be at least StaticDCtxSize(0) bytes, otherwise a
+// *WorkspaceSizeError reports the size needed, and 8-byte aligned, see
+// NewStaticCtx. Like there, the workspace is pinned until the DCtx is garbage
+// collected and requires Go 1.21.
+//
+// As they are decoded by contexts allocated by libzstd, legacy frames fail
+// with ErrNotSupported.
+func NewStaticDCtx(workspace []byte) (*DCtx, error) {
+	required, _ := StaticDCtxSize(0)
+	unpin, err := pinWorkspace(workspace, required)
+	if err != nil {
+		return nil, err
+	}
+	d := &DCtx{workspace: workspace, unpin: unpin}
+	d.dctx = C.ZSTD_initStaticDCtx(unsafe.Pointer(&workspace[0]), C.size_t(len(workspace)))
+	if d.dctx == nil {
+		unpin()
+		return nil, &WorkspaceSizeError{Size: len(workspace), RequiredSize: required}
+	}
+	runtime.SetFinalizer(d, finalizeDCtx)
+	return d, nil
+}
+
+// DecompressInto decompresses src, which may contain several frames, into
+// dst and returns the number of bytes written, like the DecompressInto
+// function: it returns a *DstSizeTooSmallError if dst is too small. This
+// needs no window, so it works with any frame and the smallest workspace.
+func (d *DCtx) DecompressInto(dst, src []byte) (int, error) {
+	l, err := checkLimits(src)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkStaticFrames(src, nil); err != nil {
+		return 0, err
+	}
+	C.ZSTD_DCtx_reset(d.dctx, C.ZSTD_reset_session_only)
+	limited := dst[:l.bound(len(dst))]
+	var dstPtr *byte // Do not point anywhere, if dst is empty
+	if len(limited) > 0 {
+		dstPtr = &limited[0]
+	}
+	written := int(C.ZSTD_decompressDCtx(
+		d.dctx,
+		unsafe.Pointer(dstPtr),
+		C.size_t(len(limited)),
+		unsafe.Pointer(&src[0]),
+		C.size_t(len(src))))
+	if err := getError(written); err != nil {
+		if IsDstSizeTooSmallError(err) {
+			if len(limited) < len(dst) {
+				return 0, ErrSizeLimitExceeded
+			}
+			return 0, dstSizeTooSmallError(src, len(dst))
+		}
+		return 0, dictionaryError(src, opError("ZSTD_decompressDCtx", len(src), len(dst), err))
+	}
+	if err := l.checkSize(uint64(written)); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// DecompressTo decompresses src, which may contain several frames, to w and
+// returns the number of bytes written. The frames are decoded through a
+// window kept in the workspace, so the output needs no buffer of its size,
+// and the workspace must be large enough for the window of each frame: a
+// frame needing more returns a *WorkspaceSizeError with the size it needs,
+// before anything of it is written to w.
+func (d *DCtx) DecompressTo(w io.Writer, src []byte) (int64, error) {
+	if d.scratch == nil {
+		d.scratch = make([]byte, int(C.ZSTD_DStreamOutSize()))
+	}
+	l, err := checkLimits(src)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	err = checkStaticFrames(src, func(frame []byte) error {
+		required := int(C.ZSTD_estimateDStreamSize_fromFrame(unsafe.Pointer(&frame[0]), C.size_t(len(frame))))
+		if err := frameError(required); err != nil {
+			return opError("ZSTD_estimateDStreamSize_fromFrame", len(frame), 0, err)
+		}
+		if required > len(d.workspace) {
+			return &WorkspaceSizeError{Size: len(d.workspace), RequiredSize: required}
+		}
+		C.ZSTD_DCtx_reset(d.dctx, C.ZSTD_reset_session_only)
+		var srcPos C.size_t
+		for ret := 1; ret != 0; {
+			var dstPos C.size_t
+			ret = int(C.ZSTD_decompressStream_positions(
+				d.dctx,
+				unsafe.Pointer(&d.scratch[0]),
+				C.size_t(len(d.scratch)),
+				&dstPos,
+				unsafe.Pointer(&frame[0]),
+				C.size_t(len(frame)),
+				&srcPos))
+			if err := frameError(ret); err != nil {
+				return dictionaryError(frame, opError("ZSTD_decompressStream", len(frame)-int(srcPos), len(d.scratch), err))
+			}
+			if err := l.checkSize(uint64(total) + uint64(dstPos)); err != nil {
+				return err
+			}
+			if _, err := w.Write(d.scratch[:dstPos]); err != nil {
+				return err
+			}
+			total += int64(dstPos)
+			if ret != 0 && int(srcPos) == len(frame) && int(dstPos) < len(d.scratch) {
+				return ErrFrameTruncated
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// checkStaticFrames checks that src is a sequence of frames which a DCtx
+// decodes without allocating, calling fn, if not nil, with each of its
+// non-skippable frames.
+func checkStaticFrames(src []byte, fn func(frame []byte) error) error {
+	if len(src) == 0 {
+		return ErrEmptySlice
+	}
+	for offset := 0; offset < len(src); {
+		size, err := FindFrameCompressedSize(src[offset:])
+		if err != nil {
+			return notZstdError(src[offset:], err)
+		}
+		frame := src[offset : offset+size]
+		if isLegacyFrame(frame) {
+			return ErrNotSupported
+		}
+		if fn != nil && !IsSkippableFrame(frame) {
+			if err := fn(frame); err != nil {
+				return err
+			}
+		}
+		offset += size
+	}
+	return nil
+}
+
+func finalizeDCtx(d *DCtx) {
+	// The context lives in the workspace, there is nothing to free
+	d.unpin()
+}
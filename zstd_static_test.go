@@ -0,0 +1,244 @@
+//go:build cgo && go1.21
+// +build cgo,go1.21
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNewStaticCtx(t *testing.T) {
+	for _, params := range []CParams{{}, {Level: 1}, {Level: 9, Checksum: true}, {Level: 3, WindowLog: 24}} {
+		size, err := StaticCtxSize(params)
+		failOnError(t, "StaticCtxSize failed", err)
+		c, err := NewStaticCtx(make([]byte, size), params)
+		failOnError(t, "NewStaticCtx failed", err)
+		if _, ok := c.(SrcSizeHinter); !ok {
+			t.Fatal("Expected the static context to accept a source size hint")
+		}
+
+		// The context cannot grow: compressing anything with the exact
+		// workspace shows that it is enough
+		for _, n := range []int{0, 1, 1000, 1 << 20, 16 << 20} {
+			payload := []byte(strings.Repeat("Hello World! ", n/13+1))[:n]
+			compressed, err := c.Compress(nil, payload)
+			failOnError(t, "Compress failed", err)
+			decompressed, err := c.Decompress(nil, compressed)
+			failOnError(t, "Decompress failed", err)
+			if !bytes.Equal(decompressed, payload) {
+				t.Fatalf("%+v len=%d: round trip does not match", params, n)
+			}
+			if params.Checksum && n > 0 {
+				failOnError(t, "Expected a checksum", VerifyFrame(compressed))
+			}
+		}
+	}
+}
+
+func TestNewStaticCtxWorkspaceSize(t *testing.T) {
+	small, err := StaticCtxSize(CParams{Level: 1})
+	failOnError(t, "StaticCtxSize failed", err)
+	large, err := StaticCtxSize(CParams{Level: 19})
+	failOnError(t, "StaticCtxSize failed", err)
+	if small <= 0 || large <= small {
+		t.Fatalf("Expected level 19 to need more than level 1, got %d and %d", large, small)
+	}
+
+	_, err = NewStaticCtx(make([]byte, large-1), CParams{Level: 19})
+	var sizeErr *WorkspaceSizeError
+	if !errors.As(err, &sizeErr) || sizeErr.Size != large-1 || sizeErr.RequiredSize != large {
+		t.Fatalf("Expected a *WorkspaceSizeError requiring %d bytes, got %v", large, err)
+	}
+	if _, err := NewStaticCtx(nil, CParams{}); !errors.As(err, &sizeErr) {
+		t.Fatalf("Expected a *WorkspaceSizeError for no workspace, got %v", err)
+	}
+	if _, err := NewStaticCtx(make([]byte, small+1)[1:], CParams{Level: 1}); err != errWorkspaceAlignment {
+		t.Fatalf("Expected errWorkspaceAlignment, got %v", err)
+	}
+	if _, err := NewStaticCtx(make([]byte, large), CParams{Level: 1000}); err == nil {
+		t.Fatalf("Expected an error for an invalid level")
+	}
+}
+
+func TestStaticCtxCompressLevel(t *testing.T) {
+	size, err := StaticCtxSize(CParams{Level: 3})
+	failOnError(t, "StaticCtxSize failed", err)
+	c, err := NewStaticCtx(make([]byte, size), CParams{Level: 3})
+	failOnError(t, "NewStaticCtx failed", err)
+	payload := []byte(strings.Repeat("Hello World! ", 100000))
+	want, err := c.Compress(nil, payload)
+	failOnError(t, "Compress failed", err)
+
+	// A lower level fits in the workspace, a much higher one does not
+	if _, err := c.CompressLevel(nil, payload, 1); err != nil {
+		t.Fatalf("CompressLevel(1) failed: %s", err)
+	}
+	var zerr *Error
+	if _, err := c.CompressLevel(nil, payload, 19); !errors.As(err, &zerr) {
+		t.Fatalf("Expected a memory allocation error at level 19, got %v", err)
+	}
+	got, err := c.Compress(nil, payload)
+	failOnError(t, "Compress failed", err)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Expected Compress to keep the level of the params")
+	}
+}
+
+func TestStaticCtxFinalizer(t *testing.T) {
+	size, err := StaticCtxSize(CParams{})
+	failOnError(t, "StaticCtxSize failed", err)
+	for i := 0; i < 10; i++ {
+		c, err := NewStaticCtx(make([]byte, size), CParams{})
+		failOnError(t, "NewStaticCtx failed", err)
+		_, err = c.Compress(nil, []byte("Hello World!"))
+		failOnError(t, "Compress failed", err)
+	}
+	// Unpinning the workspaces of the unreachable contexts must not panic
+	runtime.GC()
+	runtime.GC()
+}
+
+func TestStaticDCtxDecompressInto(t *testing.T) {
+	size, err := StaticDCtxSize(0)
+	failOnError(t, "StaticDCtxSize failed", err)
+	d, err := NewStaticDCtx(make([]byte, size))
+	failOnError(t, "NewStaticDCtx failed", err)
+
+	payload := []byte(strings.Repeat("Hello World! ", 100000))
+	var streamed bytes.Buffer
+	w, err := NewWriterParams(&streamed, WriterParams{CParams: CParams{WindowLog: 24}})
+	failOnError(t, "Failed to create writer", err)
+	_, err = w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	oneShot, err := Compress(nil, payload)
+	failOnError(t, "Error while compressing", err)
+	concatenated := append(append(append([]byte{}, oneShot...), skippableFrame(0, []byte("metadata"))...), streamed.Bytes()...)
+
+	// One-shot decompression needs no window, whatever the frame asks for
+	for _, src := range [][]byte{oneShot, streamed.Bytes(), concatenated} {
+		dst := make([]byte, 2*len(payload))
+		n, err := d.DecompressInto(dst, src)
+		failOnError(t, "DecompressInto failed", err)
+		if !bytes.Equal(dst[:n], bytes.Repeat(payload, n/len(payload))) || n%len(payload) != 0 {
+			t.Fatalf("Decompressed data does not match the input")
+		}
+	}
+
+	var sizeErr *DstSizeTooSmallError
+	if _, err := d.DecompressInto(make([]byte, 10), oneShot); !errors.As(err, &sizeErr) || sizeErr.RequiredSize != len(payload) {
+		t.Fatalf("Expected a *DstSizeTooSmallError, got %v", err)
+	}
+	legacy := []byte("%\xb5/\xfd\x00@\x00\x1bcompressed with legacy zstd\xc0\x00\x00")
+	if _, err := d.DecompressInto(make([]byte, 100), legacy); err != ErrNotSupported {
+		t.Fatalf("Expected ErrNotSupported for a legacy frame, got %v", err)
+	}
+	if _, err := d.DecompressInto(nil, nil); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+	// The context recovers from errors
+	n, err := d.DecompressInto(make([]byte, len(payload)), oneShot)
+	if err != nil || n != len(payload) {
+		t.Fatalf("Expected the context to be reusable, got %d, %v", n, err)
+	}
+
+	var workspaceErr *WorkspaceSizeError
+	if _, err := NewStaticDCtx(make([]byte, size-8)); !errors.As(err, &workspaceErr) || workspaceErr.RequiredSize != size {
+		t.Fatalf("Expected a *WorkspaceSizeError requiring %d bytes, got %v", size, err)
+	}
+}
+
+func TestStaticDCtxDecompressTo(t *testing.T) {
+	payload := []byte(strings.Repeat("Hello World! ", 100000))
+	var streamed bytes.Buffer
+	w, err := NewWriterParams(&streamed, WriterParams{CParams: CParams{WindowLog: 20}})
+	failOnError(t, "Failed to create writer", err)
+	_, err = w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	src := append(append([]byte{}, streamed.Bytes()...), streamed.Bytes()...)
+
+	small, err := StaticDCtxSize(0)
+	failOnError(t, "StaticDCtxSize failed", err)
+	required, err := StaticDCtxSize(20)
+	failOnError(t, "StaticDCtxSize failed", err)
+	d, err := NewStaticDCtx(make([]byte, small))
+	failOnError(t, "NewStaticDCtx failed", err)
+	var out bytes.Buffer
+	_, err = d.DecompressTo(&out, src)
+	var workspaceErr *WorkspaceSizeError
+	if !errors.As(err, &workspaceErr) || workspaceErr.Size != small || workspaceErr.RequiredSize != required {
+		t.Fatalf("Expected a *WorkspaceSizeError requiring %d bytes, got %v", required, err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Expected nothing written, got %d bytes", out.Len())
+	}
+
+	d, err = NewStaticDCtx(make([]byte, required))
+	failOnError(t, "NewStaticDCtx failed", err)
+	for i := 0; i < 2; i++ {
+		out.Reset()
+		n, err := d.DecompressTo(&out, src)
+		failOnError(t, "DecompressTo failed", err)
+		if n != int64(out.Len()) || !bytes.Equal(out.Bytes(), append(append([]byte{}, payload...), payload...)) {
+			t.Fatalf("Decompressed data does not match the input")
+		}
+	}
+	if _, err := d.DecompressTo(failingWriter{}, src); err == nil {
+		t.Fatalf("Expected the error of the writer")
+	}
+	if _, err := StaticDCtxSize(100); err == nil {
+		t.Fatalf("Expected an error for an invalid window")
+	}
+}
+
+func TestStaticDCtxGlobalLimits(t *testing.T) {
+	defer SetGlobalLimits(Limits{})
+	payload := []byte(strings.Repeat("Hello World! ", 100000))
+	var streamed bytes.Buffer
+	w, err := NewWriterParams(&streamed, WriterParams{CParams: CParams{WindowLog: 20}})
+	failOnError(t, "Failed to create writer", err)
+	_, err = w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	src := append(append([]byte{}, streamed.Bytes()...), streamed.Bytes()...)
+	size, err := StaticDCtxSize(20)
+	failOnError(t, "StaticDCtxSize failed", err)
+	d, err := NewStaticDCtx(make([]byte, size))
+	failOnError(t, "NewStaticDCtx failed", err)
+
+	for _, test := range []struct {
+		limits Limits
+		want   error
+	}{
+		{Limits{MaxWindowLog: 19}, ErrWindowTooLarge},
+		{Limits{MaxSize: len(payload)}, ErrSizeLimitExceeded},
+		{Limits{MaxFrames: 1}, ErrTooManyFrames},
+	} {
+		SetGlobalLimits(test.limits)
+		if _, err := d.DecompressInto(make([]byte, 2*len(payload)), src); err != test.want {
+			t.Fatalf("%+v: DecompressInto returned %v, want %v", test.limits, err, test.want)
+		}
+		var out bytes.Buffer
+		if _, err := d.DecompressTo(&out, src); err != test.want {
+			t.Fatalf("%+v: DecompressTo returned %v, want %v", test.limits, err, test.want)
+		}
+		if out.Len() > test.limits.MaxSize {
+			t.Fatalf("%+v: DecompressTo wrote %d bytes", test.limits, out.Len())
+		}
+	}
+
+	SetGlobalLimits(Limits{MaxWindowLog: 20, MaxSize: 2 * len(payload), MaxFrames: 2})
+	n, err := d.DecompressInto(make([]byte, 2*len(payload)), src)
+	if err != nil || n != 2*len(payload) {
+		t.Fatalf("Expected DecompressInto to succeed within the limits, got %d, %v", n, err)
+	}
+	if n, err := d.DecompressTo(ioutil.Discard, src); err != nil || n != int64(2*len(payload)) {
+		t.Fatalf("Expected DecompressTo to succeed within the limits, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,64 @@
+package zstd
+
+import "time"
+
+// CompressStats describes a compression, see CompressWithStats.
+type CompressStats struct {
+	// InputSize and OutputSize are the sizes of the content and of the frame
+	InputSize  int
+	OutputSize int
+	// Ratio is InputSize divided by OutputSize, 0 without output
+	Ratio float64
+	// Duration is the time spent compressing, the allocation of the output
+	// buffer excluded
+	Duration time.Duration
+	// Reused is whether the output was written to dst rather than to a new
+	// buffer
+	Reused bool
+}
+
+// CompressWithStats is like CompressLevel but also describes the compression.
+// When dst is too small, the output buffer is allocated before the
+// compression is timed.
+func CompressWithStats(dst, src []byte, level int) ([]byte, CompressStats, error) {
+	buf := dst
+	if cap(buf) < CompressBound(len(src)) {
+		buf = make([]byte, 0, CompressBound(len(src)))
+	}
+	out, stats, err := compressWithStats(src, func() ([]byte, error) {
+		return CompressLevel(buf, src, level)
+	})
+	stats.Reused = err == nil && sameArray(dst, out)
+	return out, stats, err
+}
+
+// CompressScrollBatchWithStats is like CompressScrollBatchBytes but also
+// describes the compression, e.g. to derive fees from the ratio. The blob is
+// always a new buffer.
+func CompressScrollBatchWithStats(src []byte) ([]byte, CompressStats, error) {
+	return compressWithStats(src, func() ([]byte, error) {
+		return CompressScrollBatchBytes(src)
+	})
+}
+
+// compressWithStats times compress, which compresses src, and describes its
+// output.
+func compressWithStats(src []byte, compress func() ([]byte, error)) ([]byte, CompressStats, error) {
+	start := time.Now()
+	out, err := compress()
+	stats := CompressStats{Duration: time.Since(start)}
+	if err != nil {
+		return nil, stats, err
+	}
+	stats.InputSize = len(src)
+	stats.OutputSize = len(out)
+	if len(out) > 0 {
+		stats.Ratio = float64(len(src)) / float64(len(out))
+	}
+	return out, stats, nil
+}
+
+// sameArray returns whether a and b start the same array.
+func sameArray(a, b []byte) bool {
+	return cap(a) > 0 && cap(b) > 0 && &a[:cap(a)][0] == &b[:cap(b)][0]
+}
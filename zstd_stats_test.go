@@ -0,0 +1,58 @@
+package zstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressWithStats(t *testing.T) {
+	payload := bytes.Repeat([]byte("the ratio feeds the fees "), 10000)
+	for _, test := range []struct {
+		name   string
+		dst    []byte
+		reused bool
+	}{
+		{"nil", nil, false},
+		{"too small", make([]byte, 0, 10), false},
+		{"large enough", make([]byte, 0, CompressBound(len(payload))), true},
+		{"large enough with content", make([]byte, 100, CompressBound(len(payload))), true},
+	} {
+		out, stats, err := CompressWithStats(test.dst, payload, BestSpeed)
+		if err != nil {
+			t.Fatalf("%s: error while compressing: %s", test.name, err)
+		}
+		if stats.Reused != test.reused {
+			t.Fatalf("%s: expected Reused %v, got %v", test.name, test.reused, stats.Reused)
+		}
+		if stats.InputSize != len(payload) || stats.OutputSize != len(out) ||
+			stats.Ratio != float64(len(payload))/float64(len(out)) || stats.Ratio < 10 || stats.Duration <= 0 {
+			t.Fatalf("%s: unexpected stats %+v", test.name, stats)
+		}
+		decompressed, err := Decompress(nil, out)
+		if err != nil || !bytes.Equal(decompressed, payload) {
+			t.Fatalf("%s: the round trip differs: %v", test.name, err)
+		}
+	}
+}
+
+func TestCompressScrollBatchWithStats(t *testing.T) {
+	batch := bytes.Repeat([]byte("a batch of transactions "), 1000)
+	expected, err := CompressScrollBatchBytes(batch)
+	if err == ErrNotSupported {
+		t.Skip("The scroll encoder requires the C library")
+	}
+	if err != nil {
+		t.Fatalf("Error while compressing the batch: %s", err)
+	}
+	blob, stats, err := CompressScrollBatchWithStats(batch)
+	if err != nil {
+		t.Fatalf("Error while compressing the batch: %s", err)
+	}
+	if !bytes.Equal(blob, expected) {
+		t.Fatalf("The blob differs from CompressScrollBatchBytes")
+	}
+	if stats.InputSize != len(batch) || stats.OutputSize != len(blob) || stats.Reused ||
+		stats.Ratio != float64(len(batch))/float64(len(blob)) {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
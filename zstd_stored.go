@@ -0,0 +1,115 @@
+package zstd
+
+import "encoding/binary"
+
+const (
+	// frameMagic is the magic number starting zstd frames
+	frameMagic = 0xFD2FB528
+	// maxBlockSize is the maximum content size of a block, ZSTD_BLOCKSIZE_MAX
+	maxBlockSize = 128 << 10
+	// storedWindowDescriptor is the window descriptor of stored frames
+	// which do not declare their content size: a window of maxBlockSize
+	storedWindowDescriptor = (17 - 10) << 3
+)
+
+// CompressStored returns src in a zstd frame without compressing it, made of
+// raw blocks only, appended to dst. This gives data which does not compress,
+// or is compressed already, the framing of zstd for the pipelines expecting
+// it. The frame declares its content size and needs no window to decode.
+func CompressStored(dst, src []byte) ([]byte, error) {
+	return appendStoredFrame(dst, src, false), nil
+}
+
+// CompressStoredWithChecksum is like CompressStored but ends the frame with
+// the checksum of src, verified on decompression. It requires the C library
+// and returns ErrNotSupported without it.
+func CompressStoredWithChecksum(dst, src []byte) ([]byte, error) {
+	if newXXH64Hash == nil {
+		return nil, ErrNotSupported
+	}
+	return appendStoredFrame(dst, src, true), nil
+}
+
+// appendStoredFrame appends to dst a frame holding src in raw blocks,
+// declaring its content size with a single segment, followed by the checksum
+// of src if checksum is set.
+func appendStoredFrame(dst, src []byte, checksum bool) []byte {
+	var header [14]byte
+	binary.LittleEndian.PutUint32(header[:], frameMagic)
+	// Frame header descriptor: Single_Segment_Flag, and Frame_Content_Size_Flag
+	// selecting the smallest field holding the size
+	n := 5
+	switch size := uint64(len(src)); {
+	case size < 256:
+		header[4] = 0x20
+		header[5] = byte(size)
+		n += 1
+	case size < 65536+256:
+		header[4] = 0x60
+		binary.LittleEndian.PutUint16(header[5:], uint16(size-256))
+		n += 2
+	case size <= 0xFFFFFFFF:
+		header[4] = 0xA0
+		binary.LittleEndian.PutUint32(header[5:], uint32(size))
+		n += 4
+	default:
+		header[4] = 0xE0
+		binary.LittleEndian.PutUint64(header[5:], size)
+		n += 8
+	}
+	if checksum {
+		header[4] |= 0x04 // Content_Checksum_Flag
+	}
+	dst = append(dst, header[:n]...)
+
+	content := src
+	for {
+		block := src
+		if len(block) > maxBlockSize {
+			block = block[:maxBlockSize]
+		}
+		src = src[len(block):]
+		dst = appendRawBlock(dst, block, len(src) == 0)
+		if len(src) == 0 {
+			break
+		}
+	}
+	if checksum {
+		h := newXXH64Hash()
+		h.Write(content)
+		dst = appendStoredChecksum(dst, h.Sum(nil))
+	}
+	return dst
+}
+
+// appendRawBlock appends to dst block in a raw block, the last one of the
+// frame if last is set.
+func appendRawBlock(dst, block []byte, last bool) []byte {
+	// Block header: Last_Block, then Block_Type 0 (raw), then Block_Size
+	bh := uint32(len(block)) << 3
+	if last {
+		bh |= 1
+	}
+	dst = append(dst, byte(bh), byte(bh>>8), byte(bh>>16))
+	return append(dst, block...)
+}
+
+// appendStoredChecksum appends to dst the checksum of a frame, the low 32
+// bits of the XXH64 of its content, from its big endian digest.
+func appendStoredChecksum(dst, digest []byte) []byte {
+	return appendUint32(dst, binary.BigEndian.Uint32(digest[4:]))
+}
+
+// appendUint32 appends v to b in little endian.
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// appendUint64 appends v to b in little endian.
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,101 @@
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// storedBlocks returns the sizes of the raw blocks of the stored frame src,
+// whose header is headerSize bytes long, failing if another block type is
+// found.
+func storedBlocks(t *testing.T, src []byte, headerSize int) []int {
+	var sizes []int
+	for pos, last := headerSize, false; !last; {
+		bh := uint32(src[pos]) | uint32(src[pos+1])<<8 | uint32(src[pos+2])<<16
+		if bh>>1&3 != 0 {
+			t.Fatalf("Expected a raw block at %d, got type %d", pos, bh>>1&3)
+		}
+		last = bh&1 != 0
+		sizes = append(sizes, int(bh>>3))
+		pos += 3 + int(bh>>3)
+	}
+	return sizes
+}
+
+func TestCompressStored(t *testing.T) {
+	payload := make([]byte, 3*maxBlockSize+10)
+	for i := range payload {
+		payload[i] = byte(i * 7)
+	}
+	tests := []struct {
+		size       int
+		headerSize int
+		blocks     []int
+	}{
+		{0, 6, []int{0}},
+		{1, 6, []int{1}},
+		{255, 6, []int{255}},
+		{256, 7, []int{256}},
+		{65791, 7, []int{65791}},
+		{65792, 9, []int{65792}},
+		{maxBlockSize, 9, []int{maxBlockSize}},
+		{maxBlockSize + 1, 9, []int{maxBlockSize, 1}},
+		{len(payload), 9, []int{maxBlockSize, maxBlockSize, maxBlockSize, 10}},
+	}
+	for _, test := range tests {
+		src := payload[:test.size]
+		frame, err := CompressStored([]byte("prefix"), src)
+		if err != nil {
+			t.Fatalf("size=%d: failed to compress: %s", test.size, err)
+		}
+		if !bytes.HasPrefix(frame, []byte("prefix")) {
+			t.Fatalf("size=%d: expected the frame appended to dst", test.size)
+		}
+		frame = frame[len("prefix"):]
+		if binary.LittleEndian.Uint32(frame) != frameMagic {
+			t.Fatalf("size=%d: expected a zstd frame", test.size)
+		}
+		blocks := storedBlocks(t, frame, test.headerSize)
+		if len(blocks) != len(test.blocks) {
+			t.Fatalf("size=%d: expected blocks %v, got %v", test.size, test.blocks, blocks)
+		}
+		for i := range blocks {
+			if blocks[i] != test.blocks[i] {
+				t.Fatalf("size=%d: expected blocks %v, got %v", test.size, test.blocks, blocks)
+			}
+		}
+		if len(frame) != test.headerSize+3*len(blocks)+test.size {
+			t.Fatalf("size=%d: unexpected frame size %d", test.size, len(frame))
+		}
+		out, err := Decompress(nil, frame)
+		if err != nil {
+			t.Fatalf("size=%d: failed to decompress: %s", test.size, err)
+		}
+		if !bytes.Equal(out, src) {
+			t.Fatalf("size=%d: round trip does not match", test.size)
+		}
+	}
+}
+
+func TestCompressStoredWithChecksum(t *testing.T) {
+	src := bytes.Repeat([]byte("stored with a checksum "), 10000)
+	frame, err := CompressStoredWithChecksum(nil, src)
+	if newXXH64Hash == nil {
+		if err != ErrNotSupported {
+			t.Fatalf("Expected ErrNotSupported, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Failed to compress: %s", err)
+	}
+	out, err := Decompress(nil, frame)
+	if err != nil || !bytes.Equal(out, src) {
+		t.Fatalf("Failed to round trip: %v", err)
+	}
+	frame[len(frame)-1] ^= 0xFF
+	if _, err := Decompress(nil, frame); err == nil {
+		t.Fatal("Expected a checksum error")
+	}
+}
@@ -0,0 +1,83 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import "hash"
+
+// WithStoredFrames makes the Writer write its input without compressing it,
+// in a frame made of raw blocks of at most 128KB, ending with the checksum of
+// the content if checksum is set. This gives data which does not compress,
+// or is compressed already, the framing of zstd for the pipelines expecting
+// it. The frame does not declare its content size, which is not known
+// upfront. Flush writes the data pending as a block, the compression level is
+// ignored.
+func WithStoredFrames(checksum bool) WriterOption {
+	return func(w *Writer) error {
+		w.stored = &storedFrame{}
+		if checksum {
+			w.stored.hash = NewXXH64()
+		}
+		return nil
+	}
+}
+
+// storedFrame is the frame in progress of a Writer writing stored frames.
+type storedFrame struct {
+	started bool
+	pending []byte
+	hash    hash.Hash
+	scratch []byte
+}
+
+// writeStored appends p to the frame in progress, writing its full blocks.
+func (w *Writer) writeStored(p []byte) error {
+	s := w.stored
+	if s.hash != nil {
+		s.hash.Write(p)
+	}
+	for len(p) > 0 {
+		n := maxBlockSize - len(s.pending)
+		if n > len(p) {
+			n = len(p)
+		}
+		s.pending = append(s.pending, p[:n]...)
+		p = p[n:]
+		if len(s.pending) == maxBlockSize {
+			if err := w.writeStoredBlock(false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeStoredBlock writes the data pending as a block, preceded by the frame
+// header for the first one, and followed by the checksum for the last one.
+func (w *Writer) writeStoredBlock(last bool) error {
+	s := w.stored
+	if len(s.pending) == 0 && !last {
+		return nil
+	}
+	out := s.scratch[:0]
+	if !s.started {
+		// Frame header descriptor: a window descriptor and no content size
+		var fhd byte
+		if s.hash != nil {
+			fhd |= 0x04 // Content_Checksum_Flag
+		}
+		out = append(appendUint32(out, frameMagic), fhd, storedWindowDescriptor)
+	}
+	out = appendRawBlock(out, s.pending, last)
+	if last && s.hash != nil {
+		out = appendStoredChecksum(out, s.hash.Sum(nil))
+	}
+	s.scratch = out
+	if _, err := w.underlyingWriter.Write(out); err != nil {
+		return err
+	}
+	s.started = true
+	s.pending = s.pending[:0]
+	w.bytesOut += int64(len(out))
+	return nil
+}
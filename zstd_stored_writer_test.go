@@ -0,0 +1,87 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"testing"
+)
+
+func TestWriterStoredFrames(t *testing.T) {
+	payload := make([]byte, 2*maxBlockSize+1000)
+	for i := range payload {
+		payload[i] = byte(i * 13)
+	}
+	zstdCLI, _ := exec.LookPath("zstd")
+	for _, checksum := range []bool{false, true} {
+		var buf bytes.Buffer
+		w, err := NewWriterOptions(&buf, BestSpeed, WithStoredFrames(checksum))
+		failOnError(t, "Failed to create writer", err)
+		_, err = w.Write(payload[:1000])
+		failOnError(t, "Failed to write", err)
+		failOnError(t, "Failed to flush", w.Flush())
+		_, err = w.Write(payload[1000:])
+		failOnError(t, "Failed to write", err)
+		failOnError(t, "Failed to close", w.Close())
+
+		frame := buf.Bytes()
+		blocks := storedBlocks(t, frame, 6)
+		if len(blocks) != 4 || blocks[0] != 1000 || blocks[1] != maxBlockSize || blocks[2] != maxBlockSize || blocks[3] != 0 {
+			t.Fatalf("Unexpected blocks %v", blocks)
+		}
+		expectedSize := 6 + 3*len(blocks) + len(payload)
+		if checksum {
+			expectedSize += 4
+		}
+		if len(frame) != expectedSize {
+			t.Fatalf("Expected a frame of %d bytes, got %d", expectedSize, len(frame))
+		}
+		if stats := w.Stats(); stats.BytesIn != int64(len(payload)) || stats.BytesOut != int64(len(frame)) {
+			t.Fatalf("Unexpected stats %+v", stats)
+		}
+
+		out, err := Decompress(nil, frame)
+		failOnError(t, "Failed to decompress", err)
+		if !bytes.Equal(out, payload) {
+			t.Fatal("Round trip does not match")
+		}
+		r := NewReader(bytes.NewReader(frame))
+		out, err = ioutil.ReadAll(r)
+		failOnError(t, "Failed to read", err)
+		r.Close()
+		if !bytes.Equal(out, payload) {
+			t.Fatal("Stream round trip does not match")
+		}
+		if info, err := Info(frame); err != nil || info.HasChecksum != checksum {
+			t.Fatalf("Expected HasChecksum=%v, got %+v %v", checksum, info, err)
+		}
+
+		// The stock command line tool decodes it too
+		if zstdCLI == "" {
+			continue
+		}
+		stored, err := CompressStored(nil, payload)
+		failOnError(t, "Failed to compress", err)
+		for _, src := range [][]byte{frame, stored} {
+			cmd := exec.Command(zstdCLI, "-d", "-c")
+			cmd.Stdin = bytes.NewReader(src)
+			out, err := cmd.Output()
+			failOnError(t, "Failed to decompress with the zstd command line tool", err)
+			if !bytes.Equal(out, payload) {
+				t.Fatal("Output of the zstd command line tool does not match")
+			}
+		}
+	}
+
+	// An empty Writer writes an empty frame
+	var buf bytes.Buffer
+	w, err := NewWriterOptions(&buf, BestSpeed, WithStoredFrames(false))
+	failOnError(t, "Failed to create writer", err)
+	failOnError(t, "Failed to close", w.Close())
+	if out, err := Decompress(nil, buf.Bytes()); err != nil || len(out) != 0 {
+		t.Fatalf("Expected an empty frame, got %d bytes, %v", len(out), err)
+	}
+}
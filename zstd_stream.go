@@ -64,15 +64,190 @@ import "C"
 import (
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 var errShortRead = errors.New("short read")
 var errReaderClosed = errors.New("Reader is closed")
-var ErrNoParallelSupport = errors.New("No parallel support")
+var errWriterClosed = errors.New("Writer is closed")
+
+// ErrNoParallelSupport is returned by SetNbWorkers when multithreading is not
+// available, see HasMultithreadSupport. It is ErrNotSupported.
+var ErrNoParallelSupport = ErrNotSupported
+
+// traceStream reports a streaming call to hook, from the fields of its
+// result struct.
+func traceStream(hook func(Event), start time.Time, op string, srcSize, dstSize int, code, consumed, written C.size_t) {
+	endTrace(hook, start, Event{Op: op, SrcSize: srcSize, DstSize: dstSize,
+		Consumed: int(consumed), Written: int(written), Err: getError(int(code))})
+}
+
+// CompressVectored is like CompressLevel but compresses the concatenation of
+// srcs into a single frame, without assembling them in a contiguous buffer
+// first. The pieces are fed in order to the streaming API.
+func CompressVectored(dst []byte, srcs [][]byte, level int) ([]byte, error) {
+	cctx, err := newCCtx()
+	if err != nil {
+		return nil, err
+	}
+	defer freeCCtx(cctx)
+	if err := setCParameter(cctx, CParamCompressionLevel, level); err != nil {
+		return nil, err
+	}
+	return compressVectored(cctx, dst, srcs)
+}
+
+// compressVectored compresses the concatenation of srcs into dst with the
+// parameters set on cctx, declaring the total size upfront so that the frame
+// header records it when the parameters allow.
+func compressVectored(cctx *C.ZSTD_CCtx, dst []byte, srcs [][]byte) ([]byte, error) {
+	total := 0
+	for _, src := range srcs {
+		total += len(src)
+	}
+	if err := getError(int(C.ZSTD_CCtx_setPledgedSrcSize(cctx, C.ulonglong(total)))); err != nil {
+		return nil, opError("ZSTD_CCtx_setPledgedSrcSize", total, 0, err)
+	}
+	bound := CompressBound(total)
+	if cap(dst) >= bound {
+		dst = dst[0:bound] // Reuse dst buffer
+	} else {
+		dst = make([]byte, bound)
+	}
+
+	result := new(C.compressStream2_result)
+	written := 0
+	for _, src := range srcs {
+		for len(src) > 0 {
+			if written == len(dst) {
+				dst = resize(dst, 2*len(dst))
+			}
+			hook, start := startTrace()
+			C.ZSTD_compressStream2_wrapper(
+				result,
+				cctx,
+				unsafe.Pointer(&dst[written]),
+				C.size_t(len(dst)-written),
+				unsafe.Pointer(&src[0]),
+				C.size_t(len(src)),
+			)
+			if hook != nil {
+				traceStream(hook, start, "ZSTD_compressStream2", len(src), len(dst)-written,
+					result.return_code, result.bytes_consumed, result.bytes_written)
+			}
+			if err := getError(int(result.return_code)); err != nil {
+				return nil, opError("ZSTD_compressStream2", len(src), len(dst)-written, err)
+			}
+			written += int(result.bytes_written)
+			src = src[int(result.bytes_consumed):]
+		}
+	}
+
+	ret := 1 // So we loop at least once
+	for ret > 0 {
+		if written == len(dst) {
+			dst = resize(dst, 2*len(dst))
+		}
+		hook, start := startTrace()
+		C.ZSTD_compressStream2_finish(
+			result,
+			cctx,
+			unsafe.Pointer(&dst[written]),
+			C.size_t(len(dst)-written),
+			unsafe.Pointer(nil),
+			C.size_t(0),
+		)
+		if hook != nil {
+			traceStream(hook, start, "ZSTD_compressStream2", 0, len(dst)-written,
+				result.return_code, result.bytes_consumed, result.bytes_written)
+		}
+		ret = int(result.return_code)
+		if err := getError(ret); err != nil {
+			return nil, opError("ZSTD_compressStream2", 0, len(dst)-written, err)
+		}
+		written += int(result.bytes_written)
+	}
+	return dst[:written], nil
+}
+
+// DecompressVectored decompresses src across dsts in order, filling each of
+// them up to its length before moving to the next one, without an
+// intermediate contiguous buffer. Empty slices in dsts are skipped.
+//
+// It returns the total number of bytes written, which may be less than the
+// combined length of dsts. If the output does not fit, DecompressVectored
+// returns a *DstSizeTooSmallError. An empty src returns ErrEmptySlice.
+func DecompressVectored(dsts [][]byte, src []byte) (int, error) {
+	if len(src) == 0 {
+		return 0, ErrEmptySlice
+	}
+	l, err := checkLimits(src)
+	if err != nil {
+		return 0, err
+	}
+	dctx, err := newDCtx()
+	if err != nil {
+		return 0, err
+	}
+	defer freeDCtx(dctx)
+
+	result := new(C.decompressStream2_result)
+	var probe [1]byte // Detects leftover output once dsts are full
+	total, consumed, pos := 0, 0, 0
+	ret := 1 // So we loop at least once
+	for {
+		for len(dsts) > 0 && pos == len(dsts[0]) {
+			dsts, pos = dsts[1:], 0
+		}
+		if ret == 0 && consumed == len(src) {
+			return total, nil
+		}
+		out := probe[:]
+		if len(dsts) > 0 {
+			out = dsts[0][pos:]
+		}
+		var srcPtr *byte // Do not point anywhere, if src is consumed
+		if consumed < len(src) {
+			srcPtr = &src[consumed]
+		}
+		hook, start := startTrace()
+		C.ZSTD_decompressStream_wrapper(
+			result,
+			dctx,
+			unsafe.Pointer(&out[0]),
+			C.size_t(len(out)),
+			unsafe.Pointer(srcPtr),
+			C.size_t(len(src)-consumed),
+		)
+		if hook != nil {
+			traceStream(hook, start, "ZSTD_decompressStream", len(src)-consumed, len(out),
+				result.return_code, result.bytes_consumed, result.bytes_written)
+		}
+		ret = int(result.return_code)
+		if err := getError(ret); err != nil {
+			return 0, dictionaryError(src, opError("ZSTD_decompressStream", len(src)-consumed, len(out), err))
+		}
+		written := int(result.bytes_written)
+		if len(dsts) == 0 && written > 0 {
+			return 0, dstSizeTooSmallError(src, total)
+		}
+		if written == 0 && result.bytes_consumed == 0 && consumed == len(src) {
+			return 0, ErrFrameTruncated
+		}
+		consumed += int(result.bytes_consumed)
+		pos += written
+		total += written
+		if err := l.checkSize(uint64(total)); err != nil {
+			return 0, err
+		}
+	}
+}
 
 // Writer is an io.WriteCloser that zstd-compresses its input.
 type Writer struct {
@@ -85,6 +260,12 @@ type Writer struct {
 	firstError       error
 	underlyingWriter io.Writer
 	resultBuffer     *C.compressStream2_result
+	adapt            *adaptiveLevel
+	minRatio         *minRatio
+	stored           *storedFrame
+	hasher           hash.Hash
+	bytesIn          int64
+	bytesOut         int64
 }
 
 func resize(in []byte, newSize int) []byte {
@@ -118,20 +299,22 @@ func NewWriterLevel(w io.Writer, level int) *Writer {
 // compress with.  If the dictionary is empty or nil it is ignored. The dictionary
 // should not be modified until the writer is closed.
 func NewWriterLevelDict(w io.Writer, level int, dict []byte) *Writer {
-	var err error
-	ctx := C.ZSTD_createCStream()
+	ctx, err := newCCtx()
+	if err == nil {
+		atomic.AddInt64(&liveWriters, 1)
+	}
 
 	// Load dictionnary if any
-	if dict != nil {
-		err = getError(int(C.ZSTD_CCtx_loadDictionary(ctx,
+	if err == nil && dict != nil {
+		err = opError("ZSTD_CCtx_loadDictionary", len(dict), 0, getError(int(C.ZSTD_CCtx_loadDictionary(ctx,
 			unsafe.Pointer(&dict[0]),
 			C.size_t(len(dict)),
-		)))
+		))))
 	}
 
 	if err == nil {
 		// Only set level if the ctx is not in error already
-		err = getError(int(C.ZSTD_CCtx_setParameter(ctx, C.ZSTD_c_compressionLevel, C.int(level))))
+		err = opError("ZSTD_CCtx_setParameter", 0, 0, getError(int(C.ZSTD_CCtx_setParameter(ctx, C.ZSTD_c_compressionLevel, C.int(level)))))
 	}
 
 	return &Writer{
@@ -154,65 +337,103 @@ func (w *Writer) Write(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
-	// Check if dstBuffer is enough
-	w.dstBuffer = w.dstBuffer[0:cap(w.dstBuffer)]
-	if len(w.dstBuffer) < CompressBound(len(p)) {
-		w.dstBuffer = make([]byte, CompressBound(len(p)))
+	var err error
+	if w.stored != nil {
+		err = w.writeStored(p)
+	} else if w.minRatio != nil {
+		err = w.writeMinRatio(p)
+	} else {
+		err = w.compress(p)
 	}
-
-	// Do not do an extra memcopy if zstd ingest all input data
-	srcData := p
-	fastPath := len(w.srcBuffer) == 0
-	if !fastPath {
-		w.srcBuffer = append(w.srcBuffer, p...)
-		srcData = w.srcBuffer
+	if err != nil {
+		return 0, err
 	}
-
-	if len(srcData) == 0 {
-		// this is technically unnecessary: srcData is p or w.srcBuffer, and len() > 0 checked above
-		// but this ensures the code can change without dereferencing an srcData[0]
-		return 0, nil
+	if w.hasher != nil {
+		w.hasher.Write(p)
 	}
-	C.ZSTD_compressStream2_wrapper(
-		w.resultBuffer,
-		w.ctx,
-		unsafe.Pointer(&w.dstBuffer[0]),
-		C.size_t(len(w.dstBuffer)),
-		unsafe.Pointer(&srcData[0]),
-		C.size_t(len(srcData)),
-	)
-	ret := int(w.resultBuffer.return_code)
-	if err := getError(ret); err != nil {
-		return 0, err
+	w.bytesIn += int64(len(p))
+	return len(p), nil
+}
+
+// compress compresses p, writing the output available to the underlying
+// io.Writer.
+func (w *Writer) compress(p []byte) error {
+	// Check if dstBuffer is enough
+	w.dstBuffer = w.dstBuffer[0:cap(w.dstBuffer)]
+	if bound := CompressBound(len(w.srcBuffer) + len(p)); len(w.dstBuffer) < bound {
+		w.dstBuffer = make([]byte, bound)
 	}
 
-	consumed := int(w.resultBuffer.bytes_consumed)
-	if !fastPath {
+	// Compress the data left by the previous writes first, then p without
+	// copying it: the Go memory is pinned for the duration of the call. Only
+	// the data zstd does not ingest, e.g. when all the workers are busy, is
+	// kept in srcBuffer for the next call.
+	written := 0
+	if len(w.srcBuffer) > 0 {
+		consumed, n, err := w.compressStep(w.dstBuffer, w.srcBuffer)
+		if err != nil {
+			return err
+		}
 		w.srcBuffer = w.srcBuffer[consumed:]
-	} else {
-		remaining := len(p) - consumed
-		if remaining > 0 {
-			// We still have some non-consumed data, copy remaining data to srcBuffer
-			// Try to not reallocate w.srcBuffer if we already have enough space
-			if cap(w.srcBuffer) >= remaining {
-				w.srcBuffer = w.srcBuffer[0:remaining]
-			} else {
-				w.srcBuffer = make([]byte, remaining)
-			}
-			copy(w.srcBuffer, p[consumed:])
+		written += n
+	}
+	consumed := 0
+	if len(w.srcBuffer) == 0 && written < len(w.dstBuffer) {
+		var n int
+		var err error
+		consumed, n, err = w.compressStep(w.dstBuffer[written:], p)
+		if err != nil {
+			return err
+		}
+		written += n
+	}
+	if remaining := p[consumed:]; len(remaining) > 0 {
+		// We still have some non-consumed data, copy remaining data to srcBuffer
+		// Try to not reallocate w.srcBuffer if we already have enough space
+		if len(w.srcBuffer) == 0 && cap(w.srcBuffer) >= len(remaining) {
+			w.srcBuffer = w.srcBuffer[0:len(remaining)]
+			copy(w.srcBuffer, remaining)
+		} else {
+			w.srcBuffer = append(w.srcBuffer, remaining...)
 		}
 	}
 
-	written := int(w.resultBuffer.bytes_written)
 	// Write to underlying buffer
+	t := w.adapt.now()
 	_, err := w.underlyingWriter.Write(w.dstBuffer[:written])
+	w.adapt.blocked(t)
 
 	// Same behaviour as zlib, we can't know how much data we wrote, only
 	// if there was an error
 	if err != nil {
-		return 0, err
+		return err
+	}
+	w.bytesOut += int64(written)
+	return nil
+}
+
+// compressStep runs one step of the stream compression of src into dst. It
+// returns the number of bytes consumed from src and written to dst.
+func (w *Writer) compressStep(dst, src []byte) (int, int, error) {
+	hook, start := startTrace()
+	t := w.adapt.now()
+	C.ZSTD_compressStream2_wrapper(
+		w.resultBuffer,
+		w.ctx,
+		unsafe.Pointer(&dst[0]),
+		C.size_t(len(dst)),
+		unsafe.Pointer(&src[0]),
+		C.size_t(len(src)),
+	)
+	w.adapt.compressed(t)
+	if hook != nil {
+		traceStream(hook, start, "ZSTD_compressStream2", len(src), len(dst),
+			w.resultBuffer.return_code, w.resultBuffer.bytes_consumed, w.resultBuffer.bytes_written)
 	}
-	return len(p), err
+	if err := getError(int(w.resultBuffer.return_code)); err != nil {
+		return 0, 0, opError("ZSTD_compressStream2", len(src), len(dst), err)
+	}
+	return int(w.resultBuffer.bytes_consumed), int(w.resultBuffer.bytes_written), nil
 }
 
 // Flush writes any unwritten data to the underlying io.Writer.
@@ -220,7 +441,21 @@ func (w *Writer) Flush() error {
 	if w.firstError != nil {
 		return w.firstError
 	}
+	if w.stored != nil {
+		return w.writeStoredBlock(false)
+	}
+	if w.minRatio != nil && w.minRatio.storing {
+		return w.flushStored()
+	}
+	if w.adapt != nil {
+		return w.adaptiveFlush()
+	}
+	return w.flush(false)
+}
 
+// flush writes any unwritten data to the underlying io.Writer, ending the
+// current frame if end is set.
+func (w *Writer) flush(end bool) error {
 	ret := 1 // So we loop at least once
 	for ret > 0 {
 		var srcPtr *byte // Do not point anywhere, if src is empty
@@ -228,24 +463,45 @@ func (w *Writer) Flush() error {
 			srcPtr = &w.srcBuffer[0]
 		}
 
-		C.ZSTD_compressStream2_flush(
-			w.resultBuffer,
-			w.ctx,
-			unsafe.Pointer(&w.dstBuffer[0]),
-			C.size_t(len(w.dstBuffer)),
-			unsafe.Pointer(srcPtr),
-			C.size_t(len(w.srcBuffer)),
-		)
+		hook, start := startTrace()
+		t := w.adapt.now()
+		if end {
+			C.ZSTD_compressStream2_finish(
+				w.resultBuffer,
+				w.ctx,
+				unsafe.Pointer(&w.dstBuffer[0]),
+				C.size_t(len(w.dstBuffer)),
+				unsafe.Pointer(srcPtr),
+				C.size_t(len(w.srcBuffer)),
+			)
+		} else {
+			C.ZSTD_compressStream2_flush(
+				w.resultBuffer,
+				w.ctx,
+				unsafe.Pointer(&w.dstBuffer[0]),
+				C.size_t(len(w.dstBuffer)),
+				unsafe.Pointer(srcPtr),
+				C.size_t(len(w.srcBuffer)),
+			)
+		}
+		w.adapt.compressed(t)
+		if hook != nil {
+			traceStream(hook, start, "ZSTD_compressStream2", len(w.srcBuffer), len(w.dstBuffer),
+				w.resultBuffer.return_code, w.resultBuffer.bytes_consumed, w.resultBuffer.bytes_written)
+		}
 		ret = int(w.resultBuffer.return_code)
 		if err := getError(ret); err != nil {
-			return err
+			return opError("ZSTD_compressStream2", len(w.srcBuffer), len(w.dstBuffer), err)
 		}
 		w.srcBuffer = w.srcBuffer[w.resultBuffer.bytes_consumed:]
 		written := int(w.resultBuffer.bytes_written)
+		t = w.adapt.now()
 		_, err := w.underlyingWriter.Write(w.dstBuffer[:written])
+		w.adapt.blocked(t)
 		if err != nil {
 			return err
 		}
+		w.bytesOut += int64(written)
 
 		if ret > 0 { // We have a hint if we need to resize the dstBuffer
 			w.dstBuffer = w.dstBuffer[:cap(w.dstBuffer)]
@@ -261,9 +517,36 @@ func (w *Writer) Flush() error {
 // Close closes the Writer, flushing any unwritten data to the underlying
 // io.Writer and freeing objects, but does not close the underlying io.Writer.
 func (w *Writer) Close() error {
+	hook, start := startTelemetry()
+	err := w.close()
+	if hook != nil {
+		endTelemetry(hook, OpWriterClose, start, int(w.bytesIn), int(w.bytesOut), err)
+	}
+	return err
+}
+
+func (w *Writer) close() error {
 	if w.firstError != nil {
+		w.free()
 		return w.firstError
 	}
+	if w.stored != nil {
+		if err := w.writeStoredBlock(true); err != nil {
+			w.free()
+			return err
+		}
+		return opError("ZSTD_freeCCtx", 0, 0, getError(w.free()))
+	}
+	if w.minRatio != nil {
+		ended, err := w.closeMinRatio()
+		if err != nil {
+			w.free()
+			return err
+		}
+		if ended {
+			return opError("ZSTD_freeCCtx", 0, 0, getError(w.free()))
+		}
+	}
 
 	ret := 1 // So we loop at least once
 	for ret > 0 {
@@ -272,6 +555,7 @@ func (w *Writer) Close() error {
 			srcPtr = &w.srcBuffer[0]
 		}
 
+		hook, start := startTrace()
 		C.ZSTD_compressStream2_finish(
 			w.resultBuffer,
 			w.ctx,
@@ -280,17 +564,23 @@ func (w *Writer) Close() error {
 			unsafe.Pointer(srcPtr),
 			C.size_t(len(w.srcBuffer)),
 		)
+		if hook != nil {
+			traceStream(hook, start, "ZSTD_compressStream2", len(w.srcBuffer), len(w.dstBuffer),
+				w.resultBuffer.return_code, w.resultBuffer.bytes_consumed, w.resultBuffer.bytes_written)
+		}
 		ret = int(w.resultBuffer.return_code)
 		if err := getError(ret); err != nil {
-			return err
+			w.free()
+			return opError("ZSTD_compressStream2", len(w.srcBuffer), len(w.dstBuffer), err)
 		}
 		w.srcBuffer = w.srcBuffer[w.resultBuffer.bytes_consumed:]
 		written := int(w.resultBuffer.bytes_written)
 		_, err := w.underlyingWriter.Write(w.dstBuffer[:written])
 		if err != nil {
-			C.ZSTD_freeCStream(w.ctx)
+			w.free()
 			return err
 		}
+		w.bytesOut += int64(written)
 
 		if ret > 0 { // We have a hint if we need to resize the dstBuffer
 			w.dstBuffer = w.dstBuffer[:cap(w.dstBuffer)]
@@ -300,7 +590,37 @@ func (w *Writer) Close() error {
 		}
 	}
 
-	return getError(int(C.ZSTD_freeCStream(w.ctx)))
+	return opError("ZSTD_freeCCtx", 0, 0, getError(w.free()))
+}
+
+// Abort discards the data written to the Writer that was not flushed yet and
+// frees its objects like Close, but writes nothing further to the underlying
+// io.Writer: what it received is an incomplete frame, ending at the last
+// Flush if any. In async mode (see SetNbWorkers), the chunks queued to the
+// workers are discarded too. The Writer cannot be used after Abort, further
+// calls return an error.
+func (w *Writer) Abort() error {
+	if w.ctx != nil {
+		// Stops the workers and drops their jobs in async mode
+		C.ZSTD_CCtx_reset(w.ctx, C.ZSTD_reset_session_only)
+	}
+	w.srcBuffer = w.srcBuffer[:0]
+	if w.firstError == nil {
+		w.firstError = errWriterClosed
+	}
+	return opError("ZSTD_freeCCtx", 0, 0, getError(w.free()))
+}
+
+// free frees the context of the Writer, if not done yet, and returns the
+// libzstd result code.
+func (w *Writer) free() int {
+	if w.ctx == nil {
+		return 0
+	}
+	atomic.AddInt64(&liveWriters, -1)
+	code := freeCCtx(w.ctx)
+	w.ctx = nil
+	return code
 }
 
 // Set the number of workers to run the compression in parallel using multiple threads
@@ -308,14 +628,21 @@ func (w *Writer) Close() error {
 // If you call Write() too fast, you might incur a memory buffer up to as large as your input.
 // Consider calling Flush() periodically if you need to compress a very large file that would not fit all in memory.
 // By default only one worker is used.
+// Without multithreading support, see HasMultithreadSupport, any n > 0 fails
+// with ErrNoParallelSupport.
 func (w *Writer) SetNbWorkers(n int) error {
 	if w.firstError != nil {
 		return w.firstError
 	}
+	if n > 0 && !HasMultithreadSupport() {
+		w.firstError = ErrNoParallelSupport
+		return ErrNoParallelSupport
+	}
 	if err := getError(int(C.ZSTD_CCtx_setParameter(w.ctx, C.ZSTD_c_nbWorkers, C.int(n)))); err != nil {
+		err = opError("ZSTD_CCtx_setParameter", 0, 0, err)
 		w.firstError = err
 		// First error case, a shared libary is used, and the library was compiled without parallel support
-		if err.Error() == "Unsupported parameter" {
+		if code, ok := errorCode(err); ok && code.Error() == "Unsupported parameter" {
 			return ErrNoParallelSupport
 		} else {
 			// This could happen if a very large number is passed in, and possibly zstd refuse to create as many threads, or the OS fails to do so
@@ -367,8 +694,10 @@ var dPool = sync.Pool{
 	},
 }
 
-// reader is an io.ReadCloser that decompresses when read from.
-type reader struct {
+// Reader is an io.ReadCloser that decompresses when read from. NewReader and
+// NewReaderDict return a *Reader as an io.ReadCloser, NewReaderOptions returns
+// it directly.
+type Reader struct {
 	ctx                 *C.ZSTD_DCtx
 	compressionBuffer   []byte
 	compressionLeft     int
@@ -377,6 +706,21 @@ type reader struct {
 	decompSize          int
 	dict                []byte
 	firstError          error
+	frameHeader         []byte
+	frameDone           bool
+	outputFull          bool
+	frameIn             int64
+	frameOut            int64
+	frameCallback       func(FrameStats)
+	hasher              hash.Hash
+	progress            func(compressedRead, decompressedWritten int64)
+	totalIn             int64
+	totalOut            int64
+	contentSize         int64
+	contentSizeParsed   bool
+	maxFrames           int
+	limits              Limits
+	stats               ReaderStats
 	recommendedSrcSize  int
 	resultBuffer        *C.decompressStream2_result
 	underlyingReader    io.Reader
@@ -393,28 +737,41 @@ func NewReader(r io.Reader) io.ReadCloser {
 // NewReaderDict is like NewReader but uses a preset dictionary.  NewReaderDict
 // ignores the dictionary if it is nil.
 func NewReaderDict(r io.Reader, dict []byte) io.ReadCloser {
-	var err error
-	ctx := C.ZSTD_createDStream()
-	if len(dict) == 0 {
-		err = getError(int(C.ZSTD_initDStream(ctx)))
-	} else {
-		err = getError(int(C.ZSTD_DCtx_reset(ctx, C.ZSTD_reset_session_only)))
-		if err == nil {
-			// Only load dictionary if we succesfully inited the context
-			err = getError(int(C.ZSTD_DCtx_loadDictionary(
-				ctx,
-				unsafe.Pointer(&dict[0]),
-				C.size_t(len(dict)))))
+	return newReader(r, dict)
+}
+
+func newReader(r io.Reader, dict []byte) *Reader {
+	ctx, err := newDCtx()
+	if err == nil {
+		atomic.AddInt64(&liveReaders, 1)
+		if len(dict) == 0 {
+			err = opError("ZSTD_initDStream", 0, 0, getError(int(C.ZSTD_initDStream(ctx))))
+		} else {
+			err = opError("ZSTD_DCtx_reset", 0, 0, getError(int(C.ZSTD_DCtx_reset(ctx, C.ZSTD_reset_session_only))))
+			if err == nil {
+				// Only load dictionary if we succesfully inited the context
+				err = opError("ZSTD_DCtx_loadDictionary", len(dict), 0, getError(int(C.ZSTD_DCtx_loadDictionary(
+					ctx,
+					unsafe.Pointer(&dict[0]),
+					C.size_t(len(dict))))))
+			}
 		}
 	}
+	limits := GlobalLimits()
+	if err == nil && limits.MaxWindowLog != 0 {
+		err = setDParameter(ctx, DParamWindowLogMax, limits.MaxWindowLog)
+	}
+	// Buffers are put back with the length of the last input size hint
 	compressionBufferP := cPool.Get().(*[]byte)
 	decompressionBufferP := dPool.Get().(*[]byte)
-	return &reader{
+	return &Reader{
 		ctx:                 ctx,
 		dict:                dict,
-		compressionBuffer:   *compressionBufferP,
+		compressionBuffer:   (*compressionBufferP)[:cap(*compressionBufferP)],
 		decompressionBuffer: *decompressionBufferP,
 		firstError:          err,
+		maxFrames:           limits.MaxFrames,
+		limits:              limits,
 		recommendedSrcSize:  cSize,
 		resultBuffer:        new(C.decompressStream2_result),
 		underlyingReader:    r,
@@ -422,8 +779,18 @@ func NewReaderDict(r io.Reader, dict []byte) io.ReadCloser {
 }
 
 // Close frees the allocated C objects
-func (r *reader) Close() error {
+func (r *Reader) Close() error {
+	hook, start := startTelemetry()
+	err := r.close()
+	if hook != nil {
+		endTelemetry(hook, OpReaderClose, start, int(r.totalIn), int(r.totalOut), err)
+	}
+	return err
+}
+
+func (r *Reader) close() error {
 	if r.firstError != nil {
+		r.free()
 		return r.firstError
 	}
 
@@ -436,10 +803,56 @@ func (r *reader) Close() error {
 
 	cPool.Put(&cb)
 	dPool.Put(&db)
-	return getError(int(C.ZSTD_freeDStream(r.ctx)))
+	return opError("ZSTD_freeDCtx", 0, 0, getError(r.free()))
+}
+
+// free frees the context of the reader, if not done yet, and returns the
+// libzstd result code.
+func (r *Reader) free() int {
+	if r.ctx == nil {
+		return 0
+	}
+	atomic.AddInt64(&liveReaders, -1)
+	code := freeDCtx(r.ctx)
+	r.ctx = nil
+	return code
+}
+
+// trackFrameHeader keeps the first bytes of the current frame, which are
+// needed to report the dictionary it requires as the header may be split
+// across several reads. It returns the error of the limits of the Reader for
+// the frame, if any.
+func (r *Reader) trackFrameHeader(consumed []byte, frameDone bool) error {
+	if room := zstdFrameHeaderSizeMax - len(r.frameHeader); room > 0 {
+		if len(consumed) > room {
+			consumed = consumed[:room]
+		}
+		r.frameHeader = append(r.frameHeader, consumed...)
+	}
+	if err := r.limits.checkFrameHeader(r.frameHeader); err != nil {
+		return err
+	}
+	if !r.contentSizeParsed && r.stats.Frames == 0 {
+		r.parseContentSize()
+	}
+	if frameDone {
+		r.completeFrame(true)
+		r.frameHeader = r.frameHeader[:0]
+	}
+	return nil
 }
 
-func (r *reader) Read(p []byte) (int, error) {
+// Read decompresses into p. Timeouts of the underlying reader, such as the
+// errors of a net.Conn whose read deadline passed, are returned as is and
+// leave the Reader intact: reading again once the deadline is extended
+// continues the stream where it stopped, even within a frame. Other errors of
+// the underlying reader are wrapped.
+//
+// Decoding errors are classified as by Decompress: input which is not zstd
+// compressed data fails with ErrNotZstd, the other errors of libzstd are
+// *Error values, and a stream ending within a frame fails with an *Error
+// matching both ErrFrameTruncated and io.ErrUnexpectedEOF with errors.Is.
+func (r *Reader) Read(p []byte) (int, error) {
 	if r.firstError != nil {
 		return 0, r.firstError
 	}
@@ -465,91 +878,329 @@ func (r *reader) Read(p []byte) (int, error) {
 
 	// Repeatedly read from the underlying reader until we get
 	// at least one zstd block, so that we don't block if the
-	// other end has flushed a block.
+	// other end has flushed a block. Once some data is decoded,
+	// keep decoding the input already read while p has room, so
+	// that large reads take few calls into libzstd.
+	n := 0
 	for {
-		// - If the last decompression didn't entirely fill the decompression buffer,
-		//   zstd flushed all it could, and needs new data. In that case, do 1 Read.
-		// - If the last decompression did entirely fill the decompression buffer,
+		// - If the last decompression didn't entirely fill its output buffer,
+		//   zstd flushed all it could, and needs new data. In that case, do 1 Read,
+		//   unless some data is already decoded.
+		// - If the last decompression did entirely fill its output buffer,
 		//   it might have needed more room to decompress the input. In that case,
 		//   don't do any unnecessary Read that might block.
-		needsData := r.decompSize < len(r.decompressionBuffer)
+		// - If the last decompression ended a frame, the remaining compressed
+		//   data starts the next frame, decompress it before reading more.
+		needsData := !r.outputFull && !(r.frameDone && r.compressionLeft > 0)
 
 		var src []byte
 		if !needsData {
 			src = r.compressionBuffer[:r.compressionLeft]
 		} else {
+			if n > 0 {
+				return n, nil
+			}
 			src = r.compressionBuffer
-			var n int
+			var read int
 			var err error
 			// Read until data arrives or an error occurs.
-			for n == 0 && err == nil {
-				n, err = r.underlyingReader.Read(src[r.compressionLeft:])
+			for read == 0 && err == nil {
+				read, err = r.underlyingReader.Read(src[r.compressionLeft:])
+			}
+			if isTimeout(err) {
+				// Decode what arrived before the deadline, the next Read
+				// will hit the deadline again if it is not extended
+				if read == 0 {
+					return 0, err
+				}
+				err = nil
 			}
 			if err != nil && err != io.EOF { // Handle underlying reader errors first
-				return 0, fmt.Errorf("failed to read from underlying reader: %s", err)
+				return 0, fmt.Errorf("failed to read from underlying reader: %w", err)
 			}
-			if n == 0 {
-				// Ideally, we'd return with ErrUnexpectedEOF in all cases where the stream was unexpectedly EOF'd
-				// during a block or frame, i.e. when there are incomplete, pending compression data.
-				// However, it's hard to detect those cases with zstd. Namely, there is no way to know the size of
-				// the current buffered compression data in the zstd stream internal buffers.
-				// Best effort: throw ErrUnexpectedEOF if we still have some pending buffered compression data that
-				// zstd doesn't want to accept.
-				// If we don't have any buffered compression data but zstd still has some in its internal buffers,
-				// we will return with EOF instead.
-				if r.compressionLeft > 0 {
-					return 0, io.ErrUnexpectedEOF
+			if read == 0 {
+				// The stream was cut within a frame if some compressed data
+				// is pending, either here or in the internal buffers of zstd,
+				// which keep e.g. a partial checksum: the frame consumed
+				// input but did not end.
+				if r.compressionLeft > 0 || r.frameIn > 0 {
+					return 0, truncatedError("ZSTD_decompressStream", r.compressionLeft)
 				}
 				return 0, io.EOF
 			}
-			src = src[:r.compressionLeft+n]
+			src = src[:r.compressionLeft+read]
 		}
 
-		// C code
-		var srcPtr *byte // Do not point anywhere, if src is empty
-		if len(src) > 0 {
-			srcPtr = &src[0]
+		// Refuse to start a frame beyond the limit
+		if r.maxFrames > 0 && r.stats.Frames >= r.maxFrames && r.frameIn == 0 && len(src) > 0 {
+			r.firstError = ErrTooManyFrames
+			if n > 0 {
+				return n, nil
+			}
+			return 0, r.firstError
 		}
 
-		C.ZSTD_decompressStream_wrapper(
-			r.resultBuffer,
-			r.ctx,
-			unsafe.Pointer(&r.decompressionBuffer[0]),
-			C.size_t(len(r.decompressionBuffer)),
-			unsafe.Pointer(srcPtr),
-			C.size_t(len(src)),
-		)
-		retCode := int(r.resultBuffer.return_code)
+		// Decode directly into p when it has room for a full internal buffer,
+		// saving a copy
+		direct := len(p)-n >= len(r.decompressionBuffer)
+		dst := r.decompressionBuffer
+		if direct {
+			dst = p[n:]
+		}
+		written, err := r.decompress(dst, src)
+		if err != nil {
+			return n, err
+		}
+		if direct {
+			r.decompSize, r.decompOff = 0, 0
+			n += written
+		} else {
+			r.decompSize = written
+			r.decompOff = copy(p[n:], r.decompressionBuffer[:written])
+			n += r.decompOff
+		}
+		if n == len(p) || r.decompOff < r.decompSize {
+			return n, nil
+		}
+	}
+}
+
+// isTimeout returns whether err is a timeout, such as the errors of a
+// net.Conn whose deadline passed, after which reading can be retried.
+func isTimeout(err error) bool {
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
 
-		// Keep src here even though we reuse later, the code might be deleted at some point
-		runtime.KeepAlive(src)
-		if err := getError(retCode); err != nil {
-			return 0, fmt.Errorf("failed to decompress: %s", err)
+// DecompressFromReaderInto decompresses the zstd stream read from r into dst,
+// which must be large enough for the whole content as with DecompressInto,
+// and returns the number of bytes decompressed. The stream may hold several
+// frames. It returns a *DstSizeTooSmallError if the content does not fit in
+// dst, an error matching io.ErrUnexpectedEOF if r ends within a frame, see
+// Reader.Read, and io.EOF if r ends before the first frame.
+//
+// r is read in the amounts libzstd asks for, which never go past the end of
+// the current frame: once a frame ends, at most the 9 bytes of the smallest
+// frame header and block header are read to find whether another frame
+// follows. Once dst is full at the end of a frame, nothing more is read, so
+// that a frame following in r, e.g. the next record of a connection, is left
+// for the next call. The input is staged in the pooled buffers of the Reader.
+// The global limits apply to each call, see SetGlobalLimits.
+func DecompressFromReaderInto(dst []byte, r io.Reader) (int, error) {
+	c := manyCtxPool.Get().(*ctx)
+	defer putManyCtx(c)
+	if c.err != nil {
+		return 0, c.err
+	}
+	defer C.ZSTD_DCtx_reset(c.dctx, C.ZSTD_reset_session_only)
+	l := GlobalLimits()
+	if l.MaxWindowLog != 0 {
+		// The pool expects contexts with their default parameters
+		defer C.ZSTD_DCtx_reset(c.dctx, C.ZSTD_reset_session_and_parameters)
+		if err := setDParameter(c.dctx, DParamWindowLogMax, l.MaxWindowLog); err != nil {
+			return 0, err
 		}
+	}
+	bufP := cPool.Get().(*[]byte)
+	defer cPool.Put(bufP)
+	buf := (*bufP)[:cap(*bufP)]
 
-		// Put everything in buffer
-		bytesConsumed := int(r.resultBuffer.bytes_consumed)
-		if bytesConsumed < len(src) {
-			left := src[bytesConsumed:]
-			copy(r.compressionBuffer, left)
+	result := new(C.decompressStream2_result)
+	var probe [1]byte
+	n, left, frames := 0, 0, 0
+	inFrame, readAny, ended := false, false, false
+	var header []byte
+	for {
+		// Refuse to start a frame beyond the limit
+		if l.MaxFrames > 0 && frames >= l.MaxFrames && !inFrame && left > 0 {
+			return n, ErrTooManyFrames
+		}
+		// Once dst is full, only check whether there is more content
+		out := dst[n:]
+		if len(out) == 0 {
+			out = probe[:]
+		}
+		var srcPtr *byte // Do not point anywhere, if no input is pending
+		if left > 0 {
+			srcPtr = &buf[0]
 		}
-		r.compressionLeft = len(src) - bytesConsumed
-		r.decompSize = int(r.resultBuffer.bytes_written)
-		r.decompOff = copy(p, r.decompressionBuffer[:r.decompSize])
+		C.ZSTD_decompressStream_wrapper(result, c.dctx,
+			unsafe.Pointer(&out[0]), C.size_t(len(out)), unsafe.Pointer(srcPtr), C.size_t(left))
+		code := int(result.return_code)
+		if err := getError(code); err != nil {
+			// Frames denied by the limits fail with the error of the limits,
+			// whatever made the decoder fail on them
+			if limitErr := l.checkFrameHeader(append(header, buf[:left]...)); limitErr != nil {
+				return n, limitErr
+			}
+			if frameError(code) == ErrWindowTooLarge {
+				return n, ErrWindowTooLarge
+			}
+			err = opError("ZSTD_decompressStream", left, len(out), err)
+			if !inFrame && !ended {
+				err = notZstdError(buf[:left], err)
+			}
+			return n, dictionaryError(append(header, buf[:left]...), err)
+		}
+		consumed, written := int(result.bytes_consumed), int(result.bytes_written)
+		if written > 0 && n == len(dst) {
+			return n, &DstSizeTooSmallError{}
+		}
+		n += written
+		if err := l.checkSize(uint64(n)); err != nil {
+			return n, err
+		}
+		if room := zstdFrameHeaderSizeMax - len(header); room > 0 {
+			// Keep the header of the frame to report the dictionary it needs
+			if room > consumed {
+				room = consumed
+			}
+			header = append(header, buf[:room]...)
+			if err := l.checkFrameHeader(header); err != nil {
+				return n, err
+			}
+		}
+		left = copy(buf, buf[consumed:left])
+		inFrame = inFrame || consumed > 0
 
-		// Resize buffers
-		nsize := retCode // Hint for next src buffer size
-		if nsize <= 0 {
-			// Reset to recommended size
-			nsize = r.recommendedSrcSize
+		if code == 0 {
+			// The frame ended, the next call asks for the next frame header
+			inFrame = false
+			ended = true
+			frames++
+			header = header[:0]
+			if n == len(dst) && left == 0 {
+				return n, nil
+			}
+			continue
 		}
-		if nsize < r.compressionLeft {
-			nsize = r.compressionLeft
+		if written == len(out) || left > 0 {
+			// More output may be pending
+			continue
 		}
-		r.compressionBuffer = resize(r.compressionBuffer, nsize)
 
-		if r.decompOff > 0 {
-			return r.decompOff, nil
+		hint := code
+		if hint > len(buf) {
+			// The rest of a skippable frame can be up to 4GB
+			hint = len(buf)
+		}
+		var read int
+		var err error
+		for read == 0 && err == nil {
+			read, err = r.Read(buf[:hint])
 		}
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if read == 0 {
+			if inFrame {
+				return n, truncatedError("ZSTD_decompressStream", left)
+			}
+			if !readAny {
+				return 0, io.EOF
+			}
+			return n, nil
+		}
+		readAny = true
+		left = read
+	}
+}
+
+// decompress runs one step of the stream decompression of src into dst, and
+// keeps the input left for the next step. It returns the number of bytes
+// written to dst.
+func (r *Reader) decompress(dst, src []byte) (int, error) {
+	// C code
+	var srcPtr *byte // Do not point anywhere, if src is empty
+	if len(src) > 0 {
+		srcPtr = &src[0]
+	}
+
+	hook, start := startTrace()
+	C.ZSTD_decompressStream_wrapper(
+		r.resultBuffer,
+		r.ctx,
+		unsafe.Pointer(&dst[0]),
+		C.size_t(len(dst)),
+		unsafe.Pointer(srcPtr),
+		C.size_t(len(src)),
+	)
+	if hook != nil {
+		traceStream(hook, start, "ZSTD_decompressStream", len(src), len(dst),
+			r.resultBuffer.return_code, r.resultBuffer.bytes_consumed, r.resultBuffer.bytes_written)
+	}
+	retCode := int(r.resultBuffer.return_code)
+
+	// Keep src here even though we reuse later, the code might be deleted at some point
+	runtime.KeepAlive(src)
+	if err := getError(retCode); err != nil {
+		// Frames denied by the limits fail with the error of the limits,
+		// whatever made the decoder fail on them
+		if limitErr := r.limits.checkFrameHeader(append(r.frameHeader, src...)); limitErr != nil {
+			r.firstError = limitErr
+			return 0, limitErr
+		}
+		switch frameError(retCode) {
+		case ErrWindowTooLarge:
+			return 0, ErrWindowTooLarge
+		case ErrChecksumMismatch:
+			r.frameHeader = append(r.frameHeader, src...)
+			r.completeFrame(false)
+			return 0, opError("ZSTD_decompressStream", len(src), len(dst), err)
+		}
+		if len(r.dict) == 0 {
+			if dictErr, ok := dictionaryError(append(r.frameHeader, src...), err).(ErrDictionaryRequired); ok {
+				return 0, dictErr
+			}
+		}
+		err = opError("ZSTD_decompressStream", len(src), len(dst), err)
+		if r.stats.Frames == 0 && r.frameIn == 0 {
+			// Like the one-shot functions, tell apart input which is not
+			// zstd compressed data
+			err = notZstdError(append(r.frameHeader, src...), err)
+		}
+		return 0, err
+	}
+
+	// Keep the input left
+	bytesConsumed := int(r.resultBuffer.bytes_consumed)
+	written := int(r.resultBuffer.bytes_written)
+	r.frameIn += int64(bytesConsumed)
+	r.frameOut += int64(written)
+	r.totalIn += int64(bytesConsumed)
+	r.totalOut += int64(written)
+	if err := r.trackFrameHeader(src[:bytesConsumed], retCode == 0); err != nil {
+		r.firstError = err
+		return 0, err
+	}
+	if r.limits.MaxSize > 0 && r.totalOut > int64(r.limits.MaxSize) {
+		r.firstError = ErrSizeLimitExceeded
+		return 0, r.firstError
+	}
+	r.frameDone = retCode == 0
+	r.outputFull = written == len(dst)
+	if bytesConsumed < len(src) {
+		left := src[bytesConsumed:]
+		copy(r.compressionBuffer, left)
+	}
+	r.compressionLeft = len(src) - bytesConsumed
+	if r.hasher != nil {
+		r.hasher.Write(dst[:written])
+	}
+	if r.progress != nil && (bytesConsumed > 0 || written > 0) {
+		r.progress(r.totalIn, r.totalOut)
+	}
+
+	// Resize buffers
+	nsize := retCode // Hint for next src buffer size
+	if nsize <= 0 || nsize > r.recommendedSrcSize {
+		// Reset to recommended size, the hint is the size of the rest of a
+		// skippable frame which can be up to 4GB
+		nsize = r.recommendedSrcSize
+	}
+	if nsize < r.compressionLeft {
+		nsize = r.compressionLeft
 	}
+	r.compressionBuffer = resize(r.compressionBuffer, nsize)
+	return written, nil
 }
@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package zstd
 
 import (
@@ -7,10 +10,14 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"runtime/debug"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func failOnError(t *testing.T, msg string, err error) {
@@ -314,6 +321,193 @@ func TestStreamDecompressionUnexpectedEOFHandling(t *testing.T) {
 	}
 }
 
+// timeoutError is the error of a read deadline, implementing net.Error.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// timeoutReader fails with a timeout every other read, after some bytes or
+// none.
+type timeoutReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	r.reads++
+	switch r.reads % 4 {
+	case 1:
+		return 0, timeoutError{}
+	case 3:
+		if len(p) > 100 {
+			p = p[:100]
+		}
+		n, _ := r.r.Read(p)
+		return n, timeoutError{}
+	}
+	if len(p) > 1000 {
+		p = p[:1000]
+	}
+	return r.r.Read(p)
+}
+
+func TestStreamDecompressionTimeout(t *testing.T) {
+	payload := bytes.Repeat([]byte("resumed after the deadline "), 100000)
+	var compressed bytes.Buffer
+	w := NewWriterLevel(&compressed, BestSpeed)
+	for i := 0; i < len(payload); i += 10000 {
+		// Small writes make many small blocks
+		if _, err := w.Write(payload[i : i+10000]); err != nil {
+			t.Fatalf("Failed writing to compress object: %s", err)
+		}
+		failOnError(t, "Failed to flush", w.Flush())
+	}
+	failOnError(t, "Failed to close compress object", w.Close())
+
+	// Injected timeouts, with or without data, are returned and retried
+	r := NewReader(&timeoutReader{r: bytes.NewReader(compressed.Bytes())})
+	defer r.Close()
+	var out []byte
+	timeouts := 0
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			timeouts++
+			continue
+		}
+		failOnError(t, "Failed to decompress", err)
+	}
+	if !bytes.Equal(out, payload) || timeouts == 0 {
+		t.Fatalf("Expected the payload after timeouts, got %d bytes after %d timeouts", len(out), timeouts)
+	}
+
+	// A net.Conn whose deadline passes in the middle of a frame
+	client, server := net.Pipe()
+	defer client.Close()
+	half := compressed.Len() / 2
+	resume := make(chan struct{})
+	go func() {
+		defer server.Close()
+		server.Write(compressed.Bytes()[:half])
+		<-resume
+		server.Write(compressed.Bytes()[half:])
+	}()
+	r = NewReader(client)
+	defer r.Close()
+	failOnError(t, "Failed to set the deadline", client.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	out = out[:0]
+	var err error
+	for err == nil {
+		var n int
+		n, err = r.Read(buf)
+		out = append(out, buf[:n]...)
+	}
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+	if len(out) == 0 || len(out) >= len(payload) {
+		t.Fatalf("Expected part of the payload before the deadline, got %d bytes", len(out))
+	}
+	failOnError(t, "Failed to extend the deadline", client.SetReadDeadline(time.Time{}))
+	close(resume)
+	rest, err := ioutil.ReadAll(r)
+	failOnError(t, "Failed to decompress after the deadline", err)
+	if !bytes.Equal(append(out, rest...), payload) {
+		t.Fatalf("The payload differs after the deadline")
+	}
+}
+
+func TestStreamDecompressionTruncatedFrame(t *testing.T) {
+	compressed, err := Compress(nil, []byte("truncated in the checksum"))
+	failOnError(t, "Failed to compress", err)
+	for _, cut := range []int{1, 2, 4, len(compressed) / 2} {
+		_, err := ioutil.ReadAll(NewReader(bytes.NewReader(compressed[:len(compressed)-cut])))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Expected io.ErrUnexpectedEOF without the last %d bytes, got %v", cut, err)
+		}
+	}
+}
+
+func TestStreamDecompressionLargeSkippableFrame(t *testing.T) {
+	// The header of a skippable frame of almost 4GB must not size the buffers
+	src := []byte("P*M\x18\xf1\xf9\x8ee")
+	if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(src))); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestStreamDecompressionConcatenatedFrames(t *testing.T) {
+	// Frames following each other in a single read of the underlying reader,
+	// including a skippable frame which decompresses to nothing
+	skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 2, 0, 0, 0, 'h', 'i'}
+	a, err := Compress(nil, []byte("Hello, "))
+	failOnError(t, "Failed to compress", err)
+	b, err := Compress(nil, []byte("World!"))
+	failOnError(t, "Failed to compress", err)
+	src := append(append(append([]byte(nil), skippable...), a...), b...)
+
+	r := NewReader(bytes.NewReader(src))
+	defer r.Close()
+	out, err := ioutil.ReadAll(r)
+	failOnError(t, "Failed to read", err)
+	if string(out) != "Hello, World!" {
+		t.Fatalf("Expected %q, got %q", "Hello, World!", out)
+	}
+}
+
+func TestStreamAbort(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello, World! "), 100000)
+	for _, workers := range []int{0, 2} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if workers > 0 {
+			if !HasMultithreadSupport() {
+				continue
+			}
+			failOnError(t, "Failed to set workers", w.SetNbWorkers(workers))
+		}
+		_, err := w.Write(payload[:1000])
+		failOnError(t, "Failed to write", err)
+		failOnError(t, "Failed to flush", w.Flush())
+		flushed := buf.Len()
+		_, err = w.Write(payload)
+		failOnError(t, "Failed to write", err)
+		written := buf.Len()
+
+		failOnError(t, "Failed to abort", w.Abort())
+		if _, err := w.Write(payload); err == nil {
+			t.Fatalf("workers=%d: expected Write to fail after Abort", workers)
+		}
+		if err := w.Flush(); err == nil {
+			t.Fatalf("workers=%d: expected Flush to fail after Abort", workers)
+		}
+		if err := w.Close(); err == nil {
+			t.Fatalf("workers=%d: expected Close to fail after Abort", workers)
+		}
+		failOnError(t, "Failed to abort twice", w.Abort())
+		if buf.Len() != written {
+			t.Fatalf("workers=%d: %d bytes were written after Abort", workers, buf.Len()-written)
+		}
+
+		// The output is an incomplete frame holding the flushed data
+		r := NewReader(bytes.NewReader(buf.Bytes()[:flushed]))
+		out := make([]byte, 1000)
+		_, err = io.ReadFull(r, out)
+		failOnError(t, "Failed to read the flushed data", err)
+		if !bytes.Equal(out, payload[:1000]) {
+			t.Fatalf("workers=%d: flushed data does not match", workers)
+		}
+		r.Close()
+	}
+}
+
 func TestStreamCompressionChunks(t *testing.T) {
 	MB := 1024 * 1024
 	totalSize := 100 * MB
@@ -414,6 +608,131 @@ func TestStreamSetNbWorkers(t *testing.T) {
 	testCompressionDecompression(t, nil, []byte(s), nbWorkers)
 }
 
+func TestCompressVectored(t *testing.T) {
+	srcs := [][]byte{
+		[]byte("Hello, "),
+		nil,
+		bytes.Repeat([]byte("World! "), 10000),
+		[]byte{},
+		[]byte("Bye"),
+	}
+	expected := bytes.Join(srcs, nil)
+
+	compressed, err := CompressVectored(nil, srcs, 3)
+	failOnError(t, "Failed to compress", err)
+	if count, err := FrameCount(compressed); err != nil || count != 1 {
+		t.Fatalf("Expected a single frame, got %d (%v)", count, err)
+	}
+	decompressed, err := Decompress(nil, compressed)
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(decompressed, expected) {
+		t.Fatalf("Decompressed data does not match the concatenation")
+	}
+
+	// A small dst is grown
+	compressed, err = CompressVectored(make([]byte, 0, 1), srcs, 3)
+	failOnError(t, "Failed to compress with a small dst", err)
+	decompressed, err = Decompress(nil, compressed)
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(decompressed, expected) {
+		t.Fatalf("Decompressed data does not match the concatenation")
+	}
+
+	// No pieces at all yields an empty frame
+	compressed, err = CompressVectored(nil, nil, 3)
+	failOnError(t, "Failed to compress no pieces", err)
+	decompressed, err = Decompress(nil, compressed)
+	failOnError(t, "Failed to decompress", err)
+	if len(decompressed) != 0 {
+		t.Fatalf("Expected empty output, got %d bytes", len(decompressed))
+	}
+
+	if _, err := CompressVectored(nil, srcs, 1000); err == nil {
+		t.Fatal("Expected an error for an invalid level")
+	}
+}
+
+func TestCompressScrollBatchVectored(t *testing.T) {
+	blocks := [][]byte{
+		bytes.Repeat([]byte("block 1 "), 5000),
+		[]byte("block 2"),
+		nil,
+		bytes.Repeat([]byte("block 3 "), 20000),
+	}
+	expected := bytes.Join(blocks, nil)
+
+	compressed, err := CompressScrollBatchVectored(blocks)
+	failOnError(t, "Failed to compress", err)
+	decompressed, err := DecompressScrollBatchBytes(compressed)
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(decompressed, expected) {
+		t.Fatalf("Decompressed data does not match the concatenation")
+	}
+
+	compressed, err = CompressScrollBatchVectored([][]byte{nil, {}})
+	failOnError(t, "Failed to compress empty blocks", err)
+	if len(compressed) != 0 {
+		t.Fatalf("Expected empty output, got %d bytes", len(compressed))
+	}
+
+	// Like CompressScrollBatchBytes, the blob is never larger than the batch
+	if _, err := CompressScrollBatchVectored([][]byte{[]byte("Hello, "), []byte("World!")}); !IsDstSizeTooSmallError(err) {
+		t.Fatalf("Expected a dstSize_tooSmall error for an incompressible batch, got %v", err)
+	}
+}
+
+func TestDecompressVectored(t *testing.T) {
+	payload := bytes.Repeat([]byte("header body trailer "), 10000)
+	compressed, err := Compress(nil, payload)
+	failOnError(t, "Failed to compress", err)
+
+	header, body, trailer := make([]byte, 7), make([]byte, len(payload)-17), make([]byte, 10)
+	n, err := DecompressVectored([][]byte{header, nil, body, {}, trailer}, compressed)
+	failOnError(t, "Failed to decompress", err)
+	if n != len(payload) {
+		t.Fatalf("Expected %d bytes, got %d", len(payload), n)
+	}
+	if !bytes.Equal(bytes.Join([][]byte{header, body, trailer}, nil), payload) {
+		t.Fatalf("Decompressed data does not match")
+	}
+
+	// Output smaller than the capacity
+	dst := make([]byte, 2*len(payload))
+	n, err = DecompressVectored([][]byte{dst[:10], dst[10:]}, compressed)
+	failOnError(t, "Failed to decompress into a larger buffer", err)
+	if n != len(payload) || !bytes.Equal(dst[:n], payload) {
+		t.Fatalf("Decompressed data does not match")
+	}
+
+	// Insufficient capacity
+	_, err = DecompressVectored([][]byte{make([]byte, 10), make([]byte, len(payload)-11)}, compressed)
+	var sizeErr *DstSizeTooSmallError
+	if !errors.As(err, &sizeErr) || sizeErr.RequiredSize != len(payload) {
+		t.Fatalf("Expected a DstSizeTooSmallError requiring %d bytes, got %v", len(payload), err)
+	}
+	if _, err := DecompressVectored(nil, compressed); !IsDstSizeTooSmallError(err) {
+		t.Fatalf("Expected a DstSizeTooSmallError without destination, got %v", err)
+	}
+
+	// Multiple frames
+	second := []byte("second frame")
+	compressedSecond, err := Compress(nil, second)
+	failOnError(t, "Failed to compress", err)
+	dst = make([]byte, len(payload)+len(second))
+	n, err = DecompressVectored([][]byte{dst}, append(compressed, compressedSecond...))
+	failOnError(t, "Failed to decompress frames", err)
+	if !bytes.Equal(dst[:n], append(payload, second...)) {
+		t.Fatalf("Decompressed frames do not match")
+	}
+
+	if _, err := DecompressVectored([][]byte{dst}, compressed[:len(compressed)-5]); err == nil {
+		t.Fatal("Expected an error for a truncated frame")
+	}
+	if _, err := DecompressVectored([][]byte{dst}, nil); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+}
+
 func BenchmarkStreamCompression(b *testing.B) {
 	if raw == nil {
 		b.Fatal(ErrNoPayloadEnv)
@@ -460,3 +779,218 @@ func BenchmarkStreamDecompression(b *testing.B) {
 		r.Close()
 	}
 }
+
+// countDecompressStreamCalls returns the number of calls to
+// ZSTD_decompressStream made by fn, counted with the trace hook.
+func countDecompressStreamCalls(fn func()) int64 {
+	var calls int64
+	SetTraceHook(func(ev Event) {
+		if ev.Op == "ZSTD_decompressStream" {
+			atomic.AddInt64(&calls, 1)
+		}
+	})
+	defer SetTraceHook(nil)
+	fn()
+	return atomic.LoadInt64(&calls)
+}
+
+// readInChunks reads r until EOF with reads of chunkSize bytes.
+func readInChunks(r io.Reader, chunkSize int) (int64, error) {
+	buf := make([]byte, chunkSize)
+	var total int64
+	for {
+		n, err := r.Read(buf)
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+func TestStreamDecompressionLargeReads(t *testing.T) {
+	payload := bytes.Repeat([]byte("large reads take few calls into libzstd "), (8<<20)/40)
+	compressed, err := Compress(nil, payload)
+	failOnError(t, "Failed to compress", err)
+
+	var out bytes.Buffer
+	calls := countDecompressStreamCalls(func() {
+		r := NewReader(bytes.NewReader(compressed))
+		defer r.Close()
+		_, err = io.CopyBuffer(struct{ io.Writer }{&out}, struct{ io.Reader }{r}, make([]byte, 1<<20))
+	})
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(out.Bytes(), payload) {
+		t.Fatal("Decompressed payload does not match")
+	}
+	// Filling the internal buffer on every call would take at least
+	// len(payload)/dSize calls
+	if max := int64(len(payload) / dSize / 4); calls > max {
+		t.Fatalf("Expected at most %d calls into libzstd, got %d", max, calls)
+	}
+
+	// Small reads still go through the internal buffer
+	var small int64
+	calls = countDecompressStreamCalls(func() {
+		r := NewReader(bytes.NewReader(compressed))
+		defer r.Close()
+		small, err = readInChunks(r, 1000)
+	})
+	failOnError(t, "Failed to decompress", err)
+	if small != int64(len(payload)) || calls < int64(len(payload)/dSize) {
+		t.Fatalf("Unexpected small reads: %d bytes, %d calls", small, calls)
+	}
+}
+
+// BenchmarkStreamDecompressionLargeReads reads a 64MB payload in 1MB chunks,
+// reporting the number of calls into libzstd per read. Reads smaller than the
+// internal buffer show the cost of a call per internal buffer fill.
+func BenchmarkStreamDecompressionLargeReads(b *testing.B) {
+	payload := make([]byte, 64<<20)
+	for i := range payload {
+		payload[i] = byte(i / 1024 % 251)
+	}
+	compressed, err := Compress(nil, payload)
+	if err != nil {
+		b.Fatalf("Failed to compress: %s", err)
+	}
+	for _, chunkSize := range []int{1 << 20, dSize / 2} {
+		b.Run(fmt.Sprintf("chunk=%d", chunkSize), func(b *testing.B) {
+			b.SetBytes(int64(len(payload)))
+			var calls int64
+			for i := 0; i < b.N; i++ {
+				calls += countDecompressStreamCalls(func() {
+					r := NewReader(bytes.NewReader(compressed))
+					defer r.Close()
+					if _, err := readInChunks(r, chunkSize); err != nil {
+						b.Fatalf("Failed to decompress: %s", err)
+					}
+				})
+			}
+			b.ReportMetric(float64(calls)/float64(b.N), "calls/op")
+		})
+	}
+}
+
+func TestStreamCompressionInPlace(t *testing.T) {
+	payload := make([]byte, 4<<20)
+	for i := range payload {
+		payload[i] = byte(i / 100 % 251)
+	}
+	for _, workers := range []int{0, 2} {
+		if workers > 0 && !HasMultithreadSupport() {
+			continue
+		}
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		failOnError(t, "Failed to set workers", w.SetNbWorkers(workers))
+		var staged int64
+		SetTraceHook(func(ev Event) {
+			if ev.Op == "ZSTD_compressStream2" && ev.Consumed < ev.SrcSize {
+				atomic.AddInt64(&staged, 1)
+			}
+		})
+		for off := 0; off < len(payload); off += 1 << 20 {
+			_, err := w.Write(payload[off : off+1<<20])
+			failOnError(t, "Failed to write", err)
+		}
+		SetTraceHook(nil)
+		failOnError(t, "Failed to close", w.Close())
+		if workers == 0 && staged != 0 {
+			t.Fatalf("Expected the writes to be ingested in place, %d were staged", staged)
+		}
+		decompressed, err := Decompress(nil, buf.Bytes())
+		failOnError(t, "Failed to decompress", err)
+		if !bytes.Equal(decompressed, payload) {
+			t.Fatalf("Round trip failed with %d workers", workers)
+		}
+	}
+}
+
+func TestDecompressFromReaderInto(t *testing.T) {
+	first := bytes.Repeat([]byte("the first record "), 20000)
+	second := []byte("the second record")
+	firstFrame, err := Compress(nil, first)
+	failOnError(t, "Failed to compress", err)
+	secondFrame, err := Compress(nil, second)
+	failOnError(t, "Failed to compress", err)
+	var streamed bytes.Buffer
+	w := NewWriter(&streamed)
+	w.Write(first)
+	failOnError(t, "Failed to close", w.Close())
+	both := append(append([]byte{}, firstFrame...), secondFrame...)
+
+	for _, test := range []struct {
+		name    string
+		src     []byte
+		dstSize int
+		content []byte
+	}{
+		{"exact size", firstFrame, len(first), first},
+		{"larger dst", firstFrame, len(first) + 100, first},
+		{"content size unknown", streamed.Bytes(), len(first), first},
+		{"several frames", both, len(first) + len(second) + 10, append(append([]byte{}, first...), second...)},
+	} {
+		for _, r := range []io.Reader{bytes.NewReader(test.src), iotest.OneByteReader(bytes.NewReader(test.src))} {
+			dst := make([]byte, test.dstSize)
+			n, err := DecompressFromReaderInto(dst, r)
+			if err != nil {
+				t.Fatalf("%s: failed to decompress: %s", test.name, err)
+			}
+			if !bytes.Equal(dst[:n], test.content) {
+				t.Fatalf("%s: the content differs", test.name)
+			}
+		}
+	}
+
+	// The second frame is left in the reader once dst holds the first one
+	r := bytes.NewReader(both)
+	dst := make([]byte, len(first))
+	n, err := DecompressFromReaderInto(dst, r)
+	if err != nil || n != len(first) || r.Len() != len(secondFrame) {
+		t.Fatalf("Expected to read the first frame only, got %d bytes, %d left and %v", n, r.Len(), err)
+	}
+	n, err = DecompressFromReaderInto(dst, r)
+	if err != nil || !bytes.Equal(dst[:n], second) {
+		t.Fatalf("Failed to decompress the second frame: %v", err)
+	}
+
+	if _, err := DecompressFromReaderInto(make([]byte, len(first)-1), bytes.NewReader(firstFrame)); !IsDstSizeTooSmallError(err) {
+		t.Fatalf("Expected a DstSizeTooSmallError, got %v", err)
+	}
+	if _, err := DecompressFromReaderInto(make([]byte, len(first)+1), bytes.NewReader(both)); !IsDstSizeTooSmallError(err) {
+		t.Fatalf("Expected a DstSizeTooSmallError for the second frame, got %v", err)
+	}
+	for _, cut := range []int{1, len(firstFrame) / 2, len(firstFrame) - 1} {
+		if _, err := DecompressFromReaderInto(make([]byte, len(first)), bytes.NewReader(firstFrame[:cut])); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("Expected io.ErrUnexpectedEOF for %d bytes, got %v", cut, err)
+		}
+	}
+	if _, err := DecompressFromReaderInto(dst, bytes.NewReader(nil)); err != io.EOF {
+		t.Fatalf("Expected io.EOF for an empty stream, got %v", err)
+	}
+	if _, err := DecompressFromReaderInto(dst, strings.NewReader("not a zstd stream")); err == nil {
+		t.Fatalf("Expected an error for invalid data")
+	}
+}
+
+// BenchmarkStreamCompressionLargeWrites compresses 8MB writes, which are
+// ingested in place instead of being copied to a staging buffer.
+func BenchmarkStreamCompressionLargeWrites(b *testing.B) {
+	payload := make([]byte, 8<<20)
+	for i := range payload {
+		payload[i] = byte(i / 100 % 251)
+	}
+	w := NewWriterLevel(ioutil.Discard, BestSpeed)
+	defer w.Close()
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := w.Write(payload); err != nil {
+			b.Fatalf("Failed writing to compress object: %s", err)
+		}
+	}
+}
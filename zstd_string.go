@@ -0,0 +1,45 @@
+package zstd
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// stringBytes returns the bytes of s without copying them. The returned slice
+// must never be written to: it is only passed to the compressor, which reads
+// its input and keeps no reference to it once the call returns, so the
+// immutability of s is preserved.
+func stringBytes(s string) []byte {
+	if len(s) == 0 {
+		return nil
+	}
+	var b []byte
+	sh := (*reflect.StringHeader)(unsafe.Pointer(&s))
+	bh := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	bh.Data = sh.Data
+	bh.Len = len(s)
+	bh.Cap = len(s)
+	return b
+}
+
+// CompressString is like CompressLevel but compresses a string without
+// copying it to a byte slice first.
+func CompressString(dst []byte, s string, level int) ([]byte, error) {
+	return CompressLevel(dst, stringBytes(s), level)
+}
+
+// DecompressToString is like Decompress but returns the decompressed data as
+// a string. The buffer the data is decompressed into is owned by the string
+// without copy, unless it is much larger than the data, in which case the
+// data is copied to avoid retaining the unused capacity.
+func DecompressToString(src []byte) (string, error) {
+	out, err := Decompress(nil, src)
+	if err != nil {
+		return "", err
+	}
+	if cap(out) > 2*len(out) {
+		return string(out), nil
+	}
+	// Nothing else references out, so the string can take it over
+	return *(*string)(unsafe.Pointer(&out)), nil
+}
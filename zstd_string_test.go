@@ -0,0 +1,60 @@
+package zstd
+
+// Run with the race detector and pointer checks to validate the unsafe
+// conversions:
+//   GODEBUG=cgocheck=2 go test -race -run String .
+// (GOEXPERIMENT=cgocheck2 instead of GODEBUG since Go 1.21)
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompressStringRoundTrip(t *testing.T) {
+	for _, s := range []string{"", "Hello World!", strings.Repeat("Hello World! ", 10000)} {
+		compressed, err := CompressString(nil, s, DefaultCompression)
+		if err != nil {
+			t.Fatalf("len=%d CompressString failed: %s", len(s), err)
+		}
+		want, err := Compress(nil, []byte(s))
+		if err != nil {
+			t.Fatalf("Error while compressing: %v", err)
+		}
+		if string(compressed) != string(want) {
+			t.Fatalf("len=%d CompressString output differs from Compress", len(s))
+		}
+		decompressed, err := DecompressToString(compressed)
+		if err != nil {
+			t.Fatalf("len=%d DecompressToString failed: %s", len(s), err)
+		}
+		if decompressed != s {
+			t.Fatalf("len=%d round trip does not match", len(s))
+		}
+	}
+
+	if _, err := DecompressToString(nil); err != ErrEmptySlice {
+		t.Fatalf("expected ErrEmptySlice, got %v", err)
+	}
+}
+
+func TestCompressStringConcurrent(t *testing.T) {
+	// The same string is read concurrently by several compressions
+	s := strings.Repeat("Hello World! ", 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			compressed, err := CompressString(nil, s, BestSpeed)
+			if err != nil {
+				t.Errorf("CompressString failed: %s", err)
+				return
+			}
+			if out, err := DecompressToString(compressed); err != nil || out != s {
+				t.Errorf("round trip failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
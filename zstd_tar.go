@@ -0,0 +1,281 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrUnsafeTarPath is returned when extracting an archive entry which would
+// be written outside of the destination directory, or through a symbolic
+// link.
+var ErrUnsafeTarPath = errors.New("Unsafe path in archive")
+
+// TarSymlinks selects how CreateTarZst and ExtractTarZst handle symbolic
+// links.
+type TarSymlinks int
+
+const (
+	// TarSymlinksPreserve archives symbolic links as links, and extracts the
+	// ones pointing inside of the destination directory. It is the default.
+	TarSymlinksPreserve TarSymlinks = iota
+	// TarSymlinksSkip leaves symbolic links out
+	TarSymlinksSkip
+	// TarSymlinksReject fails with ErrUnsafeTarPath on any symbolic link
+	TarSymlinksReject
+)
+
+// TarOption configures CreateTarZst and ExtractTarZst.
+type TarOption func(*tarOptions)
+
+type tarOptions struct {
+	symlinks TarSymlinks
+}
+
+// WithTarSymlinks sets how symbolic links are handled.
+func WithTarSymlinks(mode TarSymlinks) TarOption {
+	return func(o *tarOptions) {
+		o.symlinks = mode
+	}
+}
+
+func newTarOptions(opts []TarOption) tarOptions {
+	var o tarOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// CreateTarZst writes the tree under root to dst as a tar archive compressed
+// at level, with the stream API. Entries are named relative to root, which is
+// not archived itself, and keep their permissions and modification times.
+// Symbolic links are archived as links, see WithTarSymlinks, and other
+// special files are skipped.
+func CreateTarZst(dst io.Writer, root string, level int, opts ...TarOption) error {
+	o := newTarOptions(opts)
+	zw := NewWriterLevel(dst, level)
+	tw := tar.NewWriter(zw)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		return writeTarEntry(tw, path, filepath.ToSlash(rel), info, o)
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		zw.Abort()
+		return err
+	}
+	return zw.Close()
+}
+
+// writeTarEntry writes the file at path to tw, named name.
+func writeTarEntry(tw *tar.Writer, path, name string, info os.FileInfo, o tarOptions) error {
+	var link string
+	switch mode := info.Mode(); {
+	case mode&os.ModeSymlink != 0:
+		switch o.symlinks {
+		case TarSymlinksSkip:
+			return nil
+		case TarSymlinksReject:
+			return fmt.Errorf("zstd: %s is a symbolic link: %w", path, ErrUnsafeTarPath)
+		}
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	case !mode.IsDir() && !mode.IsRegular():
+		return nil
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// ExtractTarZst extracts the tar archive compressed in src, e.g. by
+// CreateTarZst, into destDir, which is created if needed. Permissions and
+// modification times are restored, except for the setuid, setgid and sticky
+// bits, and for symbolic links.
+//
+// Entries which would be written outside of destDir, including through a
+// symbolic link, fail with ErrUnsafeTarPath, as do symbolic links pointing
+// outside of it. Entries other than directories, regular files and links are
+// skipped.
+func ExtractTarZst(src io.Reader, destDir string, opts ...TarOption) error {
+	o := newTarOptions(opts)
+	zr := NewReader(src)
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	type dirTime struct {
+		path  string
+		mtime time.Time
+	}
+	// Creating entries updates the modification time of their directory,
+	// which are restored last
+	var dirs []dirTime
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		path, err := tarEntryPath(destDir, header.Name)
+		if err != nil {
+			return err
+		}
+		if path == destDir {
+			continue
+		}
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0700); err != nil {
+				return err
+			}
+			if err := os.Chmod(path, mode); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTime{path, header.ModTime})
+		case tar.TypeReg, tar.TypeRegA:
+			if err := extractTarFile(tr, path, mode); err != nil {
+				return err
+			}
+			if err := os.Chtimes(path, header.ModTime, header.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			switch o.symlinks {
+			case TarSymlinksSkip:
+				continue
+			case TarSymlinksReject:
+				return fmt.Errorf("zstd: %s is a symbolic link: %w", header.Name, ErrUnsafeTarPath)
+			}
+			target := filepath.FromSlash(header.Linkname)
+			name, _ := cleanTarName(header.Name)
+			if _, ok := cleanTarName(filepath.Join(filepath.Dir(name), target)); !ok || filepath.IsAbs(target) {
+				return fmt.Errorf("zstd: %s links to %s: %w", header.Name, header.Linkname, ErrUnsafeTarPath)
+			}
+			if err := os.Symlink(target, path); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			target, err := tarEntryPath(destDir, header.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := os.Link(target, path); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirs[i].path, dirs[i].mtime, dirs[i].mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tarEntryPath returns the path in destDir of the archive entry name. It
+// fails with ErrUnsafeTarPath if the path is outside of destDir, or if it or
+// one of the directories leading to it in destDir is a symbolic link, so that
+// nothing is ever written through a link.
+func tarEntryPath(destDir, name string) (string, error) {
+	clean, ok := cleanTarName(name)
+	if !ok {
+		return "", fmt.Errorf("zstd: %s: %w", name, ErrUnsafeTarPath)
+	}
+	if clean == "." {
+		return destDir, nil
+	}
+	dir := destDir
+	parts := strings.Split(clean, string(filepath.Separator))
+	for _, part := range parts {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("zstd: %s: %w", name, ErrUnsafeTarPath)
+		}
+	}
+	return filepath.Join(destDir, clean), nil
+}
+
+// cleanTarName returns name cleaned, with the path separators of the
+// platform, and whether it is a relative path staying in its root.
+func cleanTarName(name string) (string, bool) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" ||
+		clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return clean, true
+}
+
+// extractTarFile writes the content of the current entry of tr to a new file
+// at path, creating its directory if needed.
+func extractTarFile(tr *tar.Reader, path string, mode os.FileMode) (err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	if _, err := io.Copy(f, tr); err != nil {
+		return err
+	}
+	return f.Chmod(mode)
+}
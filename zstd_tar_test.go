@@ -0,0 +1,181 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/colinlyguo/zstd/zstdtest"
+)
+
+// tarTree creates a tree with a large file, an empty file and symbolic links
+// under a new temporary directory.
+func tarTree(t *testing.T) string {
+	root, err := ioutil.TempDir("", "zstd-tar")
+	failOnError(t, "Failed to create temp dir", err)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := map[string][]byte{
+		"large.bin":       zstdtest.Compressible(1, 3<<20+17),
+		"empty":           nil,
+		"sub/nested.txt":  []byte("nested"),
+		"sub/deep/secret": []byte("private"),
+	}
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		failOnError(t, "Failed to create dir", os.MkdirAll(filepath.Dir(path), 0755))
+		failOnError(t, "Failed to write file", ioutil.WriteFile(path, data, 0644))
+	}
+	failOnError(t, "Failed to chmod", os.Chmod(filepath.Join(root, "sub", "deep", "secret"), 0600))
+	failOnError(t, "Failed to chmod", os.Chmod(filepath.Join(root, "sub", "deep"), 0700))
+	failOnError(t, "Failed to link", os.Symlink("large.bin", filepath.Join(root, "link")))
+	failOnError(t, "Failed to link", os.Symlink("../sub", filepath.Join(root, "sub", "deep", "up")))
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		return os.Chtimes(path, mtime, mtime)
+	})
+	failOnError(t, "Failed to set times", err)
+	return root
+}
+
+func TestTarZst(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+	root := tarTree(t)
+	defer os.RemoveAll(root)
+	dest, err := ioutil.TempDir("", "zstd-tar")
+	failOnError(t, "Failed to create temp dir", err)
+	defer os.RemoveAll(dest)
+
+	var buf bytes.Buffer
+	failOnError(t, "Failed to create archive", CreateTarZst(&buf, root, 3))
+	failOnError(t, "Failed to extract archive", ExtractTarZst(bytes.NewReader(buf.Bytes()), dest))
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		extracted, err := os.Lstat(filepath.Join(dest, rel))
+		if err != nil {
+			t.Fatalf("%s was not extracted: %v", rel, err)
+		}
+		if extracted.Mode() != info.Mode() {
+			t.Errorf("%s: expected mode %v, got %v", rel, info.Mode(), extracted.Mode())
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			expected, _ := os.Readlink(path)
+			if link, _ := os.Readlink(filepath.Join(dest, rel)); link != expected {
+				t.Errorf("%s: expected a link to %s, got %s", rel, expected, link)
+			}
+		case rel != ".":
+			if !extracted.ModTime().Equal(info.ModTime()) {
+				t.Errorf("%s: expected mtime %v, got %v", rel, info.ModTime(), extracted.ModTime())
+			}
+			if info.Mode().IsRegular() {
+				want, _ := ioutil.ReadFile(path)
+				got, _ := ioutil.ReadFile(filepath.Join(dest, rel))
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s: content does not match", rel)
+				}
+			}
+		}
+		return nil
+	})
+	failOnError(t, "Failed to compare trees", err)
+}
+
+func TestTarZstSymlinkOptions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+	root := tarTree(t)
+	defer os.RemoveAll(root)
+
+	var buf bytes.Buffer
+	if err := CreateTarZst(&buf, root, 3, WithTarSymlinks(TarSymlinksReject)); !errors.Is(err, ErrUnsafeTarPath) {
+		t.Fatalf("Expected ErrUnsafeTarPath, got %v", err)
+	}
+	buf.Reset()
+	failOnError(t, "Failed to create archive", CreateTarZst(&buf, root, 3))
+
+	dest, err := ioutil.TempDir("", "zstd-tar")
+	failOnError(t, "Failed to create temp dir", err)
+	defer os.RemoveAll(dest)
+	failOnError(t, "Failed to extract archive", ExtractTarZst(bytes.NewReader(buf.Bytes()), dest, WithTarSymlinks(TarSymlinksSkip)))
+	if _, err := os.Lstat(filepath.Join(dest, "link")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the link to be skipped, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "large.bin")); err != nil {
+		t.Fatalf("Expected the files to be extracted: %v", err)
+	}
+
+	err = ExtractTarZst(bytes.NewReader(buf.Bytes()), dest, WithTarSymlinks(TarSymlinksReject))
+	if !errors.Is(err, ErrUnsafeTarPath) {
+		t.Fatalf("Expected ErrUnsafeTarPath, got %v", err)
+	}
+}
+
+// tarZst compresses an archive of headers, regular files holding their name.
+func tarZst(t *testing.T, headers ...*tar.Header) []byte {
+	var buf bytes.Buffer
+	zw := NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(h.Name))
+		}
+		if h.Mode == 0 {
+			h.Mode = 0644
+		}
+		failOnError(t, "Failed to write header", tw.WriteHeader(h))
+		if h.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(h.Name))
+			failOnError(t, "Failed to write", err)
+		}
+	}
+	failOnError(t, "Failed to close archive", tw.Close())
+	failOnError(t, "Failed to close writer", zw.Close())
+	return buf.Bytes()
+}
+
+func TestTarZstUnsafePaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+	archives := map[string][]byte{
+		"parent":      tarZst(t, &tar.Header{Name: "../evil", Typeflag: tar.TypeReg}),
+		"nested":      tarZst(t, &tar.Header{Name: "sub/../../evil", Typeflag: tar.TypeReg}),
+		"absolute":    tarZst(t, &tar.Header{Name: "/tmp/evil", Typeflag: tar.TypeReg}),
+		"link out":    tarZst(t, &tar.Header{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "../outside"}),
+		"link abs":    tarZst(t, &tar.Header{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "/etc"}),
+		"hard link":   tarZst(t, &tar.Header{Name: "l", Typeflag: tar.TypeLink, Linkname: "../outside"}),
+		"through dir": tarZst(t, &tar.Header{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "."}, &tar.Header{Name: "l/evil", Typeflag: tar.TypeReg}),
+		"onto link":   tarZst(t, &tar.Header{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "target"}, &tar.Header{Name: "l", Typeflag: tar.TypeReg}),
+	}
+	for name, archive := range archives {
+		parent, err := ioutil.TempDir("", "zstd-tar")
+		failOnError(t, "Failed to create temp dir", err)
+		dest := filepath.Join(parent, "dest")
+		err = ExtractTarZst(bytes.NewReader(archive), dest)
+		if !errors.Is(err, ErrUnsafeTarPath) {
+			t.Errorf("%s: expected ErrUnsafeTarPath, got %v", name, err)
+		}
+		if _, err := os.Lstat(filepath.Join(parent, "evil")); !os.IsNotExist(err) {
+			t.Errorf("%s: a file was written outside of the destination", name)
+		}
+		os.RemoveAll(parent)
+	}
+}
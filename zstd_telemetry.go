@@ -0,0 +1,93 @@
+package zstd
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Op identifies the operation reported to the telemetry hook.
+type Op int
+
+const (
+	// OpCompress is reported by Compress and CompressLevel
+	OpCompress Op = iota + 1
+	// OpDecompress is reported by Decompress
+	OpDecompress
+	// OpDecompressInto is reported by DecompressInto
+	OpDecompressInto
+	// OpCompressScrollBatch is reported by CompressScrollBatchBytes
+	OpCompressScrollBatch
+	// OpWriterClose is reported by Writer.Close, with the sizes of the whole
+	// stream
+	OpWriterClose
+	// OpReaderClose is reported by the Close of the streaming Reader, with
+	// the sizes of the whole stream
+	OpReaderClose
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpCompress:
+		return "compress"
+	case OpDecompress:
+		return "decompress"
+	case OpDecompressInto:
+		return "decompress_into"
+	case OpCompressScrollBatch:
+		return "compress_scroll_batch"
+	case OpWriterClose:
+		return "writer_close"
+	case OpReaderClose:
+		return "reader_close"
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// TelemetryHook receives the operations reported by SetTelemetryHook.
+type TelemetryHook func(op Op, inSize, outSize int, d time.Duration, err error)
+
+// telemetryHook holds a *TelemetryHook, nil when telemetry is disabled.
+var telemetryHook unsafe.Pointer
+
+// SetTelemetryHook sets a function called once per Compress, CompressLevel,
+// Decompress, DecompressInto and CompressScrollBatchBytes call, and once per
+// Close of a streaming Writer or Reader, as a single integration point for
+// metrics, including the calls made by other helpers of the package such as
+// CompressString. inSize is the size of the input and outSize the size of the
+// output, 0 if err is not nil, and d how long the call took. For stream closes
+// they are the totals of the stream and d is the time spent in Close, which
+// flushes the end of the stream for a Writer.
+//
+// A nil hook disables telemetry, which is the default, and then costs a single
+// atomic load per call. The hook is called on the calling goroutine, after
+// the operation and without holding any lock of the package, so it may call
+// the package itself, but it may be called concurrently and must not block.
+// Unlike SetTraceHook, it also reports the one-shot calls when built without
+// cgo.
+func SetTelemetryHook(hook TelemetryHook) {
+	var p unsafe.Pointer
+	if hook != nil {
+		p = unsafe.Pointer(&hook)
+	}
+	atomic.StorePointer(&telemetryHook, p)
+}
+
+// startTelemetry returns the telemetry hook and the start time of an
+// operation, the hook is nil and the time zero when telemetry is disabled.
+func startTelemetry() (TelemetryHook, time.Time) {
+	p := atomic.LoadPointer(&telemetryHook)
+	if p == nil {
+		return nil, time.Time{}
+	}
+	return *(*TelemetryHook)(p), time.Now()
+}
+
+// endTelemetry reports op, started at start, to hook.
+func endTelemetry(hook TelemetryHook, op Op, start time.Time, inSize, outSize int, err error) {
+	if err != nil {
+		outSize = 0
+	}
+	hook(op, inSize, outSize, time.Since(start), err)
+}
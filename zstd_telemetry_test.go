@@ -0,0 +1,158 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+type telemetryRecord struct {
+	op      Op
+	inSize  int
+	outSize int
+	d       time.Duration
+	err     error
+}
+
+// recordTelemetry sets a telemetry hook recording the operations until the
+// returned function is called.
+func recordTelemetry() (records func() []telemetryRecord) {
+	var mu sync.Mutex
+	var recorded []telemetryRecord
+	SetTelemetryHook(func(op Op, inSize, outSize int, d time.Duration, err error) {
+		mu.Lock()
+		recorded = append(recorded, telemetryRecord{op, inSize, outSize, d, err})
+		mu.Unlock()
+	})
+	return func() []telemetryRecord {
+		SetTelemetryHook(nil)
+		mu.Lock()
+		defer mu.Unlock()
+		return recorded
+	}
+}
+
+func expectTelemetry(t *testing.T, records []telemetryRecord, expected ...telemetryRecord) {
+	t.Helper()
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d operations, got %+v", len(expected), records)
+	}
+	for i, e := range expected {
+		r := records[i]
+		if r.op != e.op || r.inSize != e.inSize || r.outSize != e.outSize || (r.err == nil) != (e.err == nil) {
+			t.Errorf("Expected %v %d -> %d (err: %v), got %v %d -> %d (err: %v)",
+				e.op, e.inSize, e.outSize, e.err, r.op, r.inSize, r.outSize, r.err)
+		}
+		if r.d < 0 {
+			t.Errorf("Unexpected duration %s", r.d)
+		}
+	}
+}
+
+func TestTelemetryHook(t *testing.T) {
+	payload := bytes.Repeat([]byte("telemetry "), 1000)
+	records := recordTelemetry()
+	compressed, err := Compress(nil, payload)
+	failOnError(t, "Failed to compress", err)
+	decompressed, err := Decompress(nil, compressed)
+	failOnError(t, "Failed to decompress", err)
+	n, err := DecompressInto(make([]byte, len(payload)), compressed)
+	failOnError(t, "Failed to decompress into", err)
+	_, decompressErr := Decompress(nil, []byte("not zstd"))
+	_, intoErr := DecompressInto(make([]byte, 10), compressed)
+	expectTelemetry(t, records(),
+		telemetryRecord{op: OpCompress, inSize: len(payload), outSize: len(compressed)},
+		telemetryRecord{op: OpDecompress, inSize: len(compressed), outSize: len(decompressed)},
+		telemetryRecord{op: OpDecompressInto, inSize: len(compressed), outSize: n},
+		telemetryRecord{op: OpDecompress, inSize: len("not zstd"), err: decompressErr},
+		telemetryRecord{op: OpDecompressInto, inSize: len(compressed), err: intoErr},
+	)
+	if decompressErr == nil || intoErr == nil {
+		t.Fatal("Expected errors for invalid input and a small destination")
+	}
+
+	// Nothing is reported once the hook is unset
+	if _, err := Compress(nil, payload); err != nil {
+		t.Fatal(err)
+	}
+	records = recordTelemetry()
+	expectTelemetry(t, records())
+}
+
+func TestTelemetryHookScrollBatch(t *testing.T) {
+	if checkScrollCapabilities() != nil {
+		t.Skip("The linked libzstd does not support the scroll encoder")
+	}
+	batch := bytes.Repeat([]byte("scroll batch "), 1000)
+	records := recordTelemetry()
+	blob, err := CompressScrollBatchBytes(batch)
+	failOnError(t, "Failed to compress the batch", err)
+	expectTelemetry(t, records(), telemetryRecord{op: OpCompressScrollBatch, inSize: len(batch), outSize: len(blob)})
+}
+
+func TestTelemetryHookStreams(t *testing.T) {
+	payload := bytes.Repeat([]byte("streamed telemetry "), 10000)
+	records := recordTelemetry()
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	_, err := w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close the writer", w.Close())
+	r := NewReader(bytes.NewReader(b.Bytes()))
+	_, err = ioutil.ReadAll(r)
+	failOnError(t, "Failed to read", err)
+	failOnError(t, "Failed to close the reader", r.Close())
+
+	// A stream failing on the underlying writer reports the error
+	w = NewWriter(failingWriter{})
+	if _, err := w.Write(payload); err == nil {
+		t.Fatal("Expected an error from the underlying writer")
+	}
+	closeErr := w.Close()
+	if closeErr == nil {
+		t.Fatal("Expected an error from the underlying writer")
+	}
+	expectTelemetry(t, records(),
+		telemetryRecord{op: OpWriterClose, inSize: len(payload), outSize: b.Len()},
+		telemetryRecord{op: OpReaderClose, inSize: b.Len(), outSize: len(payload)},
+		telemetryRecord{op: OpWriterClose, inSize: int(w.Stats().BytesIn), err: closeErr},
+	)
+}
+
+func TestTelemetryHookReentrant(t *testing.T) {
+	var calls int
+	SetTelemetryHook(func(op Op, inSize, outSize int, d time.Duration, err error) {
+		calls++
+		if op == OpCompress && calls == 1 {
+			// The hook holds no lock of the package and may use it
+			if _, err := Decompress(nil, mustCompress(t)); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	defer SetTelemetryHook(nil)
+	if _, err := Compress(nil, []byte("reentrant")); err != nil {
+		t.Fatal(err)
+	}
+	// The compression, the one of mustCompress and the decompression
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func mustCompress(t *testing.T) []byte {
+	out, err := CompressLevel(nil, []byte("from the hook"), BestSpeed)
+	failOnError(t, "Failed to compress", err)
+	return out
+}
+
+func TestOpString(t *testing.T) {
+	if OpWriterClose.String() != "writer_close" || Op(42).String() != "Op(42)" {
+		t.Errorf("Unexpected names %q and %q", OpWriterClose, Op(42))
+	}
+}
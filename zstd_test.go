@@ -1,16 +1,27 @@
+//go:build cgo
+// +build cgo
+
 package zstd
 
 import (
 	"bytes"
 	b64 "encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
+	"os/exec"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -35,12 +46,20 @@ func init() {
 // Test our version of compress bound vs C implementation
 func TestCompressBound(t *testing.T) {
 	tests := []int{0, 1, 2, 10, 456, 15468, 1313, 512, 2147483632}
+	if strconv.IntSize == 64 {
+		tests = append(tests, 3<<30, 1<<40)
+	}
 	for _, test := range tests {
 		if CompressBound(test) != cCompressBound(test) {
 			t.Fatalf("For %v, results are different: %v (actual) != %v (expected)", test,
 				CompressBound(test), cCompressBound(test))
 		}
 	}
+
+	// The bound saturates instead of overflowing
+	if CompressBound(maxInt) != maxInt || CompressBound(maxInt-1000) != maxInt {
+		t.Fatalf("Expected the bound of the largest sizes to be maxInt, got %d", CompressBound(maxInt))
+	}
 }
 
 // Test error code
@@ -120,6 +139,97 @@ func TestCompressDecompressInto(t *testing.T) {
 	}
 }
 
+func TestDecompressIntoRequiredSize(t *testing.T) {
+	payload := []byte("Hello World!")
+	compressed, err := Compress(nil, payload)
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	// The required size covers all the frames
+	twoFrames := append(append([]byte{}, compressed...), compressed...)
+	_, err = DecompressInto(make([]byte, len(payload)), twoFrames)
+	sizeErr, ok := err.(*DstSizeTooSmallError)
+	if !ok || !sizeErr.SizeKnown || sizeErr.RequiredSize != 2*len(payload) {
+		t.Fatalf("DecompressInto returned %#v, want a required size of %d", err, 2*len(payload))
+	}
+	if n, err := DecompressInto(make([]byte, sizeErr.RequiredSize), twoFrames); err != nil || n != 2*len(payload) {
+		t.Fatalf("retry with the required size = (%d, %v)", n, err)
+	}
+
+	// Stream compression does not record the content size
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("Failed writing to compress object: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close compress object: %s", err)
+	}
+	_, err = DecompressInto(make([]byte, 1), b.Bytes())
+	if sizeErr, ok := err.(*DstSizeTooSmallError); !ok || sizeErr.SizeKnown || !IsDstSizeTooSmallError(err) {
+		t.Fatalf("DecompressInto returned %#v, want an unknown required size", err)
+	}
+}
+
+func TestDecompressIntoLyingContentSize(t *testing.T) {
+	// A frame declaring 48 bytes but decoding to more than 1KB
+	src := []byte("(\xb5/\xfd$02000\x01\x00\x000000")
+	_, err := DecompressInto(make([]byte, 1<<10), src)
+	if sizeErr, ok := err.(*DstSizeTooSmallError); ok && sizeErr.SizeKnown {
+		t.Fatalf("DecompressInto returned %#v, want an unknown required size", err)
+	}
+}
+
+func TestDecompressSizeHintLargeContentSize(t *testing.T) {
+	// Content sizes up to 2^64-3, beyond an int, are capped like the others
+	for _, size := range []uint64{1 << 31, 1 << 32, 1<<63 + 1, 1<<64 - 3} {
+		frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0xe0, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint64(frame[5:], size)
+		if hint := decompressSizeHint(frame); hint != decompressSizeBufferLimit {
+			t.Errorf("Expected a hint of %d for a content size of %d, got %d", decompressSizeBufferLimit, size, hint)
+		}
+	}
+}
+
+func TestDictionaryRequired(t *testing.T) {
+	want := ErrDictionaryRequired{DictID: binary.LittleEndian.Uint32(dict[4:8])}
+	var streamed bytes.Buffer
+	w := NewWriterLevelDict(&streamed, BestSpeed, dict)
+	if _, err := w.Write([]byte("We're building a platform that engineers love to use.")); err != nil {
+		t.Fatalf("Failed writing to compress object: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close compress object: %s", err)
+	}
+
+	for _, frame := range [][]byte{compressedPayload, streamed.Bytes()} {
+		if _, err := Decompress(nil, frame); err != want {
+			t.Fatalf("Decompress returned %v, want %v", err, want)
+		}
+		if _, err := DecompressInto(make([]byte, 1000), frame); err != want {
+			t.Fatalf("DecompressInto returned %v, want %v", err, want)
+		}
+		if _, err := NewCtx().Decompress(nil, frame); err != want {
+			t.Fatalf("Ctx.Decompress returned %v, want %v", err, want)
+		}
+		// The header is split across reads with a one byte reader
+		for _, src := range []io.Reader{bytes.NewReader(frame), iotest.OneByteReader(bytes.NewReader(frame))} {
+			r := NewReader(src)
+			if _, err := ioutil.ReadAll(r); err != want {
+				t.Fatalf("Reader returned %v, want %v", err, want)
+			}
+			r.Close()
+		}
+
+		// Retrying with the dictionary succeeds
+		r := NewReaderDict(bytes.NewReader(frame), dict)
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Fatalf("Reader with the dictionary failed: %s", err)
+		}
+		r.Close()
+	}
+}
+
 func TestCompressLevel(t *testing.T) {
 	inputs := [][]byte{
 		nil, {}, {0}, []byte("Hello World!"),
@@ -239,6 +349,75 @@ func TestEmptySliceDecompress(t *testing.T) {
 	}
 }
 
+func TestEmptyAndNilSemantics(t *testing.T) {
+	p := newBulkProcessor(t, dict, BestSpeed)
+	emptyFrame, err := Compress(nil, nil)
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	emptyDictFrame, err := p.Compress(nil, nil)
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	helloFrame, err := Compress(nil, []byte("Hello World!"))
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+
+	decompressInto := func(dst, src []byte) ([]byte, error) {
+		n, err := DecompressInto(dst, src)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return []byte{}, nil // DecompressInto only reports a size, no slice to check
+		}
+		return dst[:n], nil
+	}
+	decoders := []struct {
+		name       string
+		decompress func(dst, src []byte) ([]byte, error)
+		emptyFrame []byte
+		growsDst   bool
+	}{
+		{"Decompress", Decompress, emptyFrame, true},
+		{"DecompressInto", decompressInto, emptyFrame, false},
+		{"Ctx", NewCtx().Decompress, emptyFrame, true},
+		{"BulkProcessor", p.Decompress, emptyDictFrame, true},
+	}
+	for _, d := range decoders {
+		t.Run(d.name, func(t *testing.T) {
+			for _, src := range [][]byte{nil, {}} {
+				for _, dst := range [][]byte{nil, {}, make([]byte, 10)} {
+					out, err := d.decompress(dst, src)
+					if err != ErrEmptySlice || out != nil {
+						t.Fatalf("src=%#v dst=%#v: got (%#v, %v), want (nil, ErrEmptySlice)", src, dst, out, err)
+					}
+				}
+			}
+			for _, dst := range [][]byte{nil, {}, make([]byte, 10)} {
+				out, err := d.decompress(dst, d.emptyFrame)
+				if err != nil {
+					t.Fatalf("dst=%#v: empty frame failed: %v", dst, err)
+				}
+				if out == nil || len(out) != 0 {
+					t.Fatalf("dst=%#v: empty frame decoded to %#v, want non-nil empty slice", dst, out)
+				}
+			}
+			for _, dst := range [][]byte{nil, {}} {
+				out, err := d.decompress(dst, helloFrame)
+				if d.growsDst {
+					if err != nil || string(out) != "Hello World!" {
+						t.Fatalf("dst=%#v: got (%q, %v)", dst, out, err)
+					}
+				} else if !IsDstSizeTooSmallError(err) {
+					t.Fatalf("dst=%#v: got %v, want dst size too small", dst, err)
+				}
+			}
+		})
+	}
+}
+
 func TestDecompressZeroLengthBuf(t *testing.T) {
 	input := []byte("Hello World!")
 	out, err := Compress(nil, input)
@@ -278,6 +457,45 @@ func TestTooSmall(t *testing.T) {
 	}
 }
 
+func TestDecompressStrict(t *testing.T) {
+	// Stream compression does not declare the content size, so the hint is
+	// max(10x input, 1MB), way below the 10MB of content
+	input := bytes.Repeat([]byte("Hello World! "), 800000)
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if _, err := w.Write(input); err != nil {
+		t.Fatalf("Failed writing to compress object: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close compress object: %s", err)
+	}
+	compressed := b.Bytes()
+	if len(input) <= 10*len(compressed) {
+		t.Fatalf("Payload ratio is too small for this test: %d -> %d", len(input), len(compressed))
+	}
+
+	if _, err := DecompressStrict(nil, compressed); err != ErrSizeHintExceeded {
+		t.Fatalf("DecompressStrict returned %v, want ErrSizeHintExceeded", err)
+	}
+	decompressed, err := Decompress(nil, compressed)
+	if err != nil {
+		t.Fatalf("Decompress failed: %s", err)
+	}
+	if !bytes.Equal(decompressed, input) {
+		t.Fatal("Decompress output does not match")
+	}
+
+	// Payloads fitting in the hint are decoded the same way in both modes
+	small, err := Compress(nil, []byte("Hello World!"))
+	if err != nil {
+		t.Fatalf("Error while compressing: %v", err)
+	}
+	decompressed, err = DecompressStrict(nil, small)
+	if err != nil || string(decompressed) != "Hello World!" {
+		t.Fatalf("DecompressStrict = (%q, %v)", decompressed, err)
+	}
+}
+
 func TestRealPayload(t *testing.T) {
 	if raw == nil {
 		t.Skip(ErrNoPayloadEnv)
@@ -321,8 +539,48 @@ func TestLegacy(t *testing.T) {
 func TestBadPayloadZipBomb(t *testing.T) {
 	payload, _ := b64.StdEncoding.DecodeString("KLUv/dcwMDAwMDAwMDAwMAAA")
 	_, err := Decompress(nil, payload)
-	if err.Error() != "Src size is incorrect" {
-		t.Fatal("zstd should detect that the size is incorrect")
+	var zerr *Error
+	if !errors.As(err, &zerr) || zerr.Code.Error() != "Src size is incorrect" {
+		t.Fatalf("zstd should detect that the size is incorrect, got %v", err)
+	}
+	if zerr.Op != "ZSTD_decompress" || zerr.SrcLen != len(payload) || err.Error() != "zstd: ZSTD_decompress: Src size is incorrect" {
+		t.Fatalf("Unexpected context %+v", err)
+	}
+	want := ErrContentSizeMismatch{Declared: 0x303030303030, Actual: 0}
+	if _, err := DecompressWithOptions(nil, payload, DecompressOptions{VerifyContentSize: true}); err != want {
+		t.Fatalf("DecompressWithOptions returned %v, want %v", err, want)
+	}
+}
+
+func TestDecompressMaxSize(t *testing.T) {
+	payload := bytes.Repeat([]byte("limit "), 100<<10)
+	compressed, err := Compress(nil, payload)
+	failOnError(t, "Failed to compress", err)
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	_, err = w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+
+	// With and without a content size, the latter going through the stream
+	// fallback
+	for _, src := range [][]byte{compressed, b.Bytes()} {
+		out, err := DecompressWithOptions(nil, src, DecompressOptions{MaxSize: len(payload)})
+		if err != nil || !bytes.Equal(out, payload) {
+			t.Fatalf("Failed to decompress up to the limit: %v", err)
+		}
+		if _, err := DecompressWithOptions(nil, src, DecompressOptions{MaxSize: len(payload) - 1}); err != ErrSizeLimitExceeded {
+			t.Fatalf("Expected ErrSizeLimitExceeded, got %v", err)
+		}
+	}
+
+	// The largest limit does not overflow
+	out, err := DecompressWithOptions(nil, compressed, DecompressOptions{MaxSize: maxInt})
+	if err != nil || !bytes.Equal(out, payload) {
+		t.Fatalf("Failed to decompress with the largest limit: %v", err)
+	}
+	if _, err := DecompressIntoWithOptions(make([]byte, len(payload)), compressed, DecompressOptions{MaxSize: maxInt}); err != nil {
+		t.Fatalf("Failed to decompress into with the largest limit: %v", err)
 	}
 }
 
@@ -345,25 +603,74 @@ func TestSmallPayload(t *testing.T) {
 
 }
 
+func TestStreamFallbackReusesDst(t *testing.T) {
+	// Stream compression does not declare the content size, so Decompress
+	// has to fall back to the stream API for payloads larger than the hint
+	input := bytes.Repeat([]byte("Hello World! "), 200000)
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if _, err := w.Write(input); err != nil {
+		t.Fatalf("Failed writing to compress object: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close compress object: %s", err)
+	}
+	compressed := b.Bytes()
+
+	preAllocated := make([]byte, 1, len(input))
+	decompressed, err := decompressStream(preAllocated, compressed, decompressSizeHint(compressed), DecompressOptions{})
+	if err != nil {
+		t.Fatalf("failed to decompress: %s", err)
+	}
+	if !bytes.Equal(decompressed, input) {
+		t.Fatal("Decompressed data does not match")
+	}
+	if &(preAllocated[0]) != &(decompressed[0]) { // They should point to the same spot (no realloc)
+		t.Fatal("Decompression buffer was changed")
+	}
+
+	// Too small buffers are grown
+	decompressed, err = Decompress(make([]byte, 0, decompressSizeHint(compressed)), compressed)
+	if err != nil {
+		t.Fatalf("failed to decompress: %s", err)
+	}
+	if !bytes.Equal(decompressed, input) {
+		t.Fatal("Decompressed data does not match")
+	}
+}
+
 func TestScrollBatchBytesCompressDecompress(t *testing.T) {
 	testCases := []struct {
-		name string
-		src  []byte
+		name           string
+		src            []byte
+		incompressible bool
 	}{
 		{
-			name: "Default",
-			src:  []byte("Hello, World!"),
+			name:           "Default",
+			src:            []byte("Hello, World!"),
+			incompressible: true,
+		},
+		{
+			name: "Compressible",
+			src:  bytes.Repeat([]byte("Hello, World!"), 100000),
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			compressed, err := CompressScrollBatchBytes(tc.src)
+			if tc.incompressible {
+				// The blob is never larger than the batch
+				if !IsDstSizeTooSmallError(err) {
+					t.Errorf("expected a dstSize_tooSmall error, got %v", err)
+				}
+				return
+			}
 			if err != nil {
 				t.Errorf("failed to CompressScrollBatchBytes: %v", err)
 			}
 
-			decompressed, err := Decompress(nil, compressed)
+			decompressed, err := DecompressScrollBatchBytes(compressed)
 			if err != nil {
 				t.Errorf("failed to Decompression: %v", err)
 			}
@@ -375,13 +682,17 @@ func TestScrollBatchBytesCompressDecompress(t *testing.T) {
 	}
 }
 
-func TestCompressScrollBatchBytes(t *testing.T) {
-	var tests []struct {
-		filename     string
-		rawSize      int
-		comprSize    int
-		expectedHash common.Hash
-	}
+// scrollGolden is a batch of testdata and the size and keccak hash of its
+// blob, as recorded in testdata/input.txt.
+type scrollGolden struct {
+	filename     string
+	rawSize      int
+	comprSize    int
+	expectedHash common.Hash
+}
+
+func loadScrollGoldens(t *testing.T) []scrollGolden {
+	var tests []scrollGolden
 
 	data, err := os.ReadFile("testdata/input.txt")
 	if err != nil {
@@ -401,31 +712,33 @@ func TestCompressScrollBatchBytes(t *testing.T) {
 		}
 
 		batch = strings.TrimSuffix(batch, ",")
-		fmt.Println("test", fmt.Sprintf("%s.hex", batch), rawSize, comprSize, common.HexToHash(comprKeccakHash))
-
-		tests = append(tests, struct {
-			filename     string
-			rawSize      int
-			comprSize    int
-			expectedHash common.Hash
-		}{
+		tests = append(tests, scrollGolden{
 			filename:     fmt.Sprintf("testdata/%s.hex", batch),
 			rawSize:      rawSize,
 			comprSize:    comprSize,
 			expectedHash: common.HexToHash(comprKeccakHash),
 		})
 	}
+	return tests
+}
 
-	for _, test := range tests {
-		hexData, err := os.ReadFile(test.filename)
-		if err != nil {
-			t.Fatalf("failed to read file %s: %v", test.filename, err)
-		}
+func readScrollBatch(t *testing.T, test scrollGolden) []byte {
+	hexData, err := os.ReadFile(test.filename)
+	if err != nil {
+		t.Fatalf("failed to read file %s: %v", test.filename, err)
+	}
 
-		batchBytes, err := hex.DecodeString(strings.TrimSpace(string(hexData)))
-		if err != nil {
-			t.Fatalf("failed to decode hex data from file %s: %v", test.filename, err)
-		}
+	batchBytes, err := hex.DecodeString(strings.TrimSpace(string(hexData)))
+	if err != nil {
+		t.Fatalf("failed to decode hex data from file %s: %v", test.filename, err)
+	}
+	return batchBytes
+}
+
+func TestCompressScrollBatchBytes(t *testing.T) {
+	for _, test := range loadScrollGoldens(t) {
+		fmt.Println("test", strings.TrimPrefix(test.filename, "testdata/"), test.rawSize, test.comprSize, test.expectedHash)
+		batchBytes := readScrollBatch(t, test)
 
 		if len(batchBytes) != test.rawSize {
 			t.Errorf("raw size mismatch for file %s: expected %d, got %d", test.filename, test.rawSize, len(batchBytes))
@@ -448,6 +761,114 @@ func TestCompressScrollBatchBytes(t *testing.T) {
 	}
 }
 
+// determinismChildEnv is set in the environment of the test binary re-run by
+// TestScrollBatchDeterminism.
+const determinismChildEnv = "ZSTD_TEST_DETERMINISM_CHILD"
+
+// TestScrollBatchDeterminism checks that the blobs match the golden hashes
+// whatever the number of threads, the concurrency and the environment of the
+// process. A failure means the blobs of this build differ from the ones of the
+// protocol.
+func TestScrollBatchDeterminism(t *testing.T) {
+	if checkScrollCapabilities() != nil {
+		t.Skip("The linked libzstd does not support the scroll encoder")
+	}
+	goldens := loadScrollGoldens(t)
+	batches := make([][]byte, len(goldens))
+	for i, test := range goldens {
+		batches[i] = readScrollBatch(t, test)
+	}
+	check := func(t *testing.T, workers int) {
+		var wg sync.WaitGroup
+		errs := make([]error, len(batches))
+		next := int64(-1)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := int(atomic.AddInt64(&next, 1)); i < len(batches); i = int(atomic.AddInt64(&next, 1)) {
+					blob, err := CompressScrollBatchBytes(batches[i])
+					if err == nil && crypto.Keccak256Hash(blob) != goldens[i].expectedHash {
+						err = fmt.Errorf("expected hash %v, got %v", goldens[i].expectedHash, crypto.Keccak256Hash(blob))
+					}
+					// The preset is the same encoding
+					if err == nil {
+						blob, err = CompressWithParams(nil, batches[i], CParams{Preset: PresetScrollBlob})
+					}
+					if err == nil && crypto.Keccak256Hash(blob) != goldens[i].expectedHash {
+						err = fmt.Errorf("expected hash %v with PresetScrollBlob, got %v", goldens[i].expectedHash, crypto.Keccak256Hash(blob))
+					}
+					errs[i] = err
+				}
+			}()
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("The blob of %s differs from the protocol one: %v", goldens[i].filename, err)
+			}
+		}
+	}
+	if os.Getenv(determinismChildEnv) != "" {
+		check(t, runtime.GOMAXPROCS(0))
+		return
+	}
+
+	for _, procs := range []int{1, 2, runtime.NumCPU() + 3} {
+		t.Run(fmt.Sprintf("GOMAXPROCS=%d", procs), func(t *testing.T) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+			check(t, procs)
+		})
+	}
+
+	// A fresh process, with a fresh pool of contexts, in a different
+	// environment
+	for _, env := range [][]string{
+		{"GOMAXPROCS=1", "GOGC=1"},
+		{"GOMAXPROCS=16", "GOGC=off", "GODEBUG=cgocheck=0", "LC_ALL=C", "TZ=Asia/Tokyo"},
+	} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestScrollBatchDeterminism$", "-test.count=1")
+		cmd.Env = append(append(os.Environ(), determinismChildEnv+"=1"), env...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("The blobs differ with %v: %v\n%s", env, err, out)
+		}
+	}
+}
+
+func TestScrollBatchParams(t *testing.T) {
+	params := ScrollBatchParams()
+	if !params.IsDeterministicProfile() {
+		t.Fatalf("The scroll batch parameters are not deterministic: %v", params)
+	}
+	// Any change here changes the blobs of the protocol
+	expected := []string{
+		"compressionLevel=22", "literalCompressionMode=2", "targetCBlockSize=126976", "windowLog=17",
+		"dictIDFlag=0", "checksumFlag=0", "format=1", "contentSizeFlag=0", "nbWorkers=0",
+	}
+	var actual []string
+	for _, p := range params {
+		actual = append(actual, fmt.Sprintf("%s=%d", p.Param, p.Value))
+	}
+	if strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Fatalf("The scroll batch parameters changed, the blobs would differ from the protocol ones:\nexpected %v\ngot      %v", expected, actual)
+	}
+
+	// The accessor returns a copy
+	params[0].Value = 3
+	if ScrollBatchParams()[0].Value != 22 {
+		t.Fatal("ScrollBatchParams returned the parameters in use")
+	}
+	for _, p := range []ScrollParams{
+		params[1:],
+		append(ScrollBatchParams()[:8:8], ParamValue{CParamNbWorkers, 2}),
+		ScrollBatchParams()[:8],
+	} {
+		if p.IsDeterministicProfile() {
+			t.Errorf("Expected %v not to be deterministic", p)
+		}
+	}
+}
+
 func BenchmarkCompression(b *testing.B) {
 	if raw == nil {
 		b.Fatal(ErrNoPayloadEnv)
@@ -487,3 +908,52 @@ func BenchmarkDecompression(b *testing.B) {
 		b.StartTimer()
 	}
 }
+
+func TestDecompressSeekTableHint(t *testing.T) {
+	// 20 frames of about 25x ratio each, the first frame declaring its own
+	// size only
+	var src []byte
+	var frames [][2]uint32
+	var expected []byte
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		pattern := make([]byte, 4000)
+		rng.Read(pattern)
+		content := bytes.Repeat(pattern, 25)
+		frame, err := CompressLevel(nil, content, BestSpeed)
+		failOnError(t, "Failed to compress", err)
+		src = append(src, frame...)
+		frames = append(frames, [2]uint32{uint32(len(frame)), uint32(len(content))})
+		expected = append(expected, content...)
+	}
+	if _, err := DecompressStrict(nil, src); err != ErrSizeHintExceeded {
+		t.Fatalf("Expected the multi-frame payload to exceed the size hint, got %v", err)
+	}
+
+	// The table is not trusted beyond the default bound, which a forged one
+	// could otherwise raise to 4GB per frame
+	withTable := appendSeekTable(append([]byte(nil), src...), frames, false)
+	forged := make([][2]uint32, len(frames))
+	for i, f := range frames {
+		forged[i] = [2]uint32{f[0], 1<<32 - 1}
+	}
+	for _, src := range [][]byte{withTable, appendSeekTable(append([]byte(nil), src...), forged, false)} {
+		if hint := decompressSizeHint(src); hint > decompressSizeBufferLimit {
+			t.Fatalf("Expected a size hint of at most %d, got %d", decompressSizeBufferLimit, hint)
+		}
+		if _, err := DecompressStrict(nil, src); err != ErrSizeHintExceeded {
+			t.Fatalf("Expected the payload to exceed the size hint, got %v", err)
+		}
+		out, err := DecompressWithOptions(nil, src, DecompressOptions{MaxSize: len(expected)})
+		failOnError(t, "Failed to decompress", err)
+		if !bytes.Equal(out, expected) {
+			t.Fatal("Decompressed payload does not match")
+		}
+	}
+
+	// A table within the default bound is trusted without a limit
+	small := appendSeekTable(append([]byte(nil), src[:frames[0][0]+frames[1][0]]...), frames[:2], false)
+	if hint := decompressSizeHint(small); hint != int(frames[0][1]+frames[1][1]) {
+		t.Fatalf("Expected a size hint of %d, got %d", frames[0][1]+frames[1][1], hint)
+	}
+}
@@ -0,0 +1,65 @@
+package zstd
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Event describes a call into libzstd, reported to the trace hook once the
+// call returns.
+type Event struct {
+	// Op is the name of the libzstd function, e.g. "ZSTD_compress2"
+	Op string
+	// Level is the compression level, for the functions taking one
+	Level int
+	// SrcSize and DstSize are the sizes of the buffers passed to the call
+	SrcSize int
+	DstSize int
+	// Consumed and Written are the numbers of bytes read from the source and
+	// written to the destination, 0 if the call failed
+	Consumed int
+	Written  int
+	// Err is the error returned by libzstd, if any
+	Err error
+	// Start is when the call started and Duration how long it took
+	Start    time.Time
+	Duration time.Duration
+}
+
+// traceHook holds a *func(Event), nil when tracing is disabled.
+var traceHook unsafe.Pointer
+
+// SetTraceHook sets a function called after every compression and
+// decompression call into libzstd, including each step of the streaming
+// Writer and Reader. A nil hook disables tracing, which is the default, and
+// then costs a single atomic load per call. The hook may be called
+// concurrently and must not block, as it runs on the calling goroutine.
+// Nothing is traced when built without cgo.
+func SetTraceHook(hook func(Event)) {
+	var p unsafe.Pointer
+	if hook != nil {
+		p = unsafe.Pointer(&hook)
+	}
+	atomic.StorePointer(&traceHook, p)
+}
+
+// startTrace returns the trace hook and the start time of a call, the hook
+// is nil and the time zero when tracing is disabled.
+func startTrace() (func(Event), time.Time) {
+	p := atomic.LoadPointer(&traceHook)
+	if p == nil {
+		return nil, time.Time{}
+	}
+	return *(*func(Event))(p), time.Now()
+}
+
+// endTrace reports ev, a call started at start, to hook.
+func endTrace(hook func(Event), start time.Time, ev Event) {
+	ev.Start = start
+	ev.Duration = time.Since(start)
+	if ev.Err != nil {
+		ev.Consumed, ev.Written = 0, 0
+	}
+	hook(ev)
+}
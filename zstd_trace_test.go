@@ -0,0 +1,132 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ExampleSetTraceHook logs the calls into libzstd taking more than 10ms.
+func ExampleSetTraceHook() {
+	SetTraceHook(func(ev Event) {
+		if ev.Duration > 10*time.Millisecond {
+			log.Printf("slow %s: %d -> %d bytes in %s (err: %v)", ev.Op, ev.SrcSize, ev.Written, ev.Duration, ev.Err)
+		}
+	})
+	defer SetTraceHook(nil)
+
+	Compress(nil, bytes.Repeat([]byte("Hello, World! "), 1<<20))
+}
+
+// recordEvents sets a trace hook recording the events until the returned
+// function is called.
+func recordEvents() (events func() []Event) {
+	var mu sync.Mutex
+	var recorded []Event
+	SetTraceHook(func(ev Event) {
+		mu.Lock()
+		recorded = append(recorded, ev)
+		mu.Unlock()
+	})
+	return func() []Event {
+		SetTraceHook(nil)
+		mu.Lock()
+		defer mu.Unlock()
+		return recorded
+	}
+}
+
+func TestTraceHook(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello, World! "), 1000)
+	events := recordEvents()
+	compressed, err := CompressLevel(nil, payload, 3)
+	failOnError(t, "Failed to compress", err)
+	_, err = Decompress(nil, compressed)
+	failOnError(t, "Failed to decompress", err)
+	_, err = DecompressInto(make([]byte, 10), compressed)
+	if !IsDstSizeTooSmallError(err) {
+		t.Fatalf("Expected a DstSizeTooSmallError, got %v", err)
+	}
+	recorded := events()
+
+	if len(recorded) != 3 {
+		t.Fatalf("Expected 3 events, got %d: %+v", len(recorded), recorded)
+	}
+	ev := recorded[0]
+	if ev.Op != "ZSTD_compress" || ev.Level != 3 || ev.SrcSize != len(payload) || ev.Written != len(compressed) || ev.Err != nil {
+		t.Fatalf("Unexpected compression event %+v", ev)
+	}
+	if ev.Start.IsZero() || ev.Duration <= 0 {
+		t.Fatalf("Expected the timing of the call, got %+v", ev)
+	}
+	ev = recorded[1]
+	if ev.Op != "ZSTD_decompress" || ev.SrcSize != len(compressed) || ev.Written != len(payload) || ev.Err != nil {
+		t.Fatalf("Unexpected decompression event %+v", ev)
+	}
+	ev = recorded[2]
+	if ev.Op != "ZSTD_decompress" || ev.DstSize != 10 || ev.Written != 0 || !IsDstSizeTooSmallError(ev.Err) {
+		t.Fatalf("Unexpected failed decompression event %+v", ev)
+	}
+
+	// Once disabled, nothing is reported
+	if _, err := Compress(nil, payload); err != nil {
+		t.Fatalf("Failed to compress: %s", err)
+	}
+	if n := len(events()); n != 3 {
+		t.Fatalf("Expected no event once disabled, got %d", n-3)
+	}
+}
+
+func TestTraceHookStream(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello, World! "), 10000)
+	events := recordEvents()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	_, err := w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	failOnError(t, "Failed to close", w.Close())
+	r := NewReader(&buf)
+	out, err := ioutil.ReadAll(r)
+	failOnError(t, "Failed to read", err)
+	failOnError(t, "Failed to close", r.Close())
+	recorded := events()
+
+	if !bytes.Equal(out, payload) {
+		t.Fatal("Decompressed data does not match")
+	}
+	consumed := map[string]int{}
+	for _, ev := range recorded {
+		if ev.Err != nil {
+			t.Fatalf("Unexpected error event %+v", ev)
+		}
+		consumed[ev.Op] += ev.Consumed
+	}
+	if consumed["ZSTD_compressStream2"] != len(payload) {
+		t.Fatalf("Expected %d bytes consumed by the Writer, got %d", len(payload), consumed["ZSTD_compressStream2"])
+	}
+	if consumed["ZSTD_decompressStream"] == 0 {
+		t.Fatal("Expected events from the Reader")
+	}
+}
+
+func TestTraceHookDisabledAllocs(t *testing.T) {
+	SetTraceHook(nil)
+	payload := bytes.Repeat([]byte("Hello, World! "), 1000)
+	dst := make([]byte, CompressBound(len(payload)))
+	w := NewWriter(ioutil.Discard)
+	defer w.Close()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		CompressLevel(dst, payload, BestSpeed)
+		w.Write(payload)
+	})
+	if allocs != 0 {
+		t.Fatalf("Expected no allocation without trace hook, got %v", allocs)
+	}
+}
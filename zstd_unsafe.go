@@ -0,0 +1,40 @@
+package zstd
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// foreignBytes returns the n bytes of memory at p as a slice, without copying
+// them. p must not point to Go memory, which the garbage collector could
+// move or free without knowing about the slice.
+func foreignBytes(p unsafe.Pointer, n int) []byte {
+	if p == nil || n <= 0 {
+		return nil
+	}
+	var b []byte
+	bh := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	bh.Data = uintptr(p)
+	bh.Len = n
+	bh.Cap = n
+	return b
+}
+
+// CompressUnsafe is like CompressLevel but compresses the srcLen bytes at src
+// without copying them to a Go slice first, e.g. a payload handed over by
+// another C library. src is passed as is to libzstd.
+//
+// src must not point to memory managed by Go, which must be passed as a
+// slice to CompressLevel instead, and must remain valid and unmodified until
+// CompressUnsafe returns. It keeps no reference to src once it returns.
+func CompressUnsafe(dst []byte, src unsafe.Pointer, srcLen int, level int) ([]byte, error) {
+	return CompressLevel(dst, foreignBytes(src, srcLen), level)
+}
+
+// DecompressUnsafe is like Decompress but decompresses the srcLen bytes at
+// src without copying them to a Go slice first, with the same requirements on
+// src as CompressUnsafe. The output is decompressed into dst, or a new Go
+// slice if dst is too small, as usual.
+func DecompressUnsafe(dst []byte, src unsafe.Pointer, srcLen int) ([]byte, error) {
+	return Decompress(dst, foreignBytes(src, srcLen))
+}
@@ -0,0 +1,63 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+// Run with pointer checks to validate that no Go pointer is involved:
+//   GODEBUG=cgocheck=2 go test -run Unsafe .
+// (GOEXPERIMENT=cgocheck2 instead of GODEBUG since Go 1.21)
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+)
+
+// cCopy returns a copy of b in C memory, to be freed with cFree.
+func cCopy(b []byte) unsafe.Pointer {
+	p := cMalloc(len(b) + 1) // malloc(0) may return nil
+	copy(foreignBytes(p, len(b)), b)
+	return p
+}
+
+func TestCompressUnsafeRoundTrip(t *testing.T) {
+	for _, payload := range [][]byte{nil, []byte("Hello World!"), bytes.Repeat([]byte("Hello World! "), 100000)} {
+		src := cCopy(payload)
+		compressed, err := CompressUnsafe(nil, src, len(payload), DefaultCompression)
+		cFree(src)
+		failOnError(t, "CompressUnsafe failed", err)
+		want, err := CompressLevel(nil, payload, DefaultCompression)
+		failOnError(t, "Error while compressing", err)
+		if !bytes.Equal(compressed, want) {
+			t.Fatalf("len=%d CompressUnsafe output differs from CompressLevel", len(payload))
+		}
+
+		src = cCopy(compressed)
+		decompressed, err := DecompressUnsafe(make([]byte, 0, 16), src, len(compressed))
+		cFree(src)
+		failOnError(t, "DecompressUnsafe failed", err)
+		if !bytes.Equal(decompressed, payload) {
+			t.Fatalf("len=%d round trip does not match", len(payload))
+		}
+	}
+}
+
+func TestDecompressUnsafeErrors(t *testing.T) {
+	if _, err := DecompressUnsafe(nil, nil, 0); err != ErrEmptySlice {
+		t.Fatalf("Expected ErrEmptySlice, got %v", err)
+	}
+	payload := []byte("not a zstd frame")
+	src := cCopy(payload)
+	defer cFree(src)
+	if _, err := DecompressUnsafe(nil, src, len(payload)); err == nil {
+		t.Fatalf("Expected an error decompressing invalid data")
+	}
+	// A frame truncated by the length takes the stream fallback
+	compressed, err := Compress(nil, bytes.Repeat([]byte("Hello World! "), 1000))
+	failOnError(t, "Error while compressing", err)
+	frame := cCopy(compressed)
+	defer cFree(frame)
+	if _, err := DecompressUnsafe(nil, frame, len(compressed)-1); err == nil {
+		t.Fatalf("Expected an error decompressing a truncated frame")
+	}
+}
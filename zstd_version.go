@@ -0,0 +1,96 @@
+package zstd
+
+/*
+#include "zstd.h"
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Minimum libzstd versions of the features relying on experimental APIs, as
+// ZSTD_VERSION_NUMBER values. They only matter with the libzstd_external build
+// tag, the vendored libzstd supports them all.
+const (
+	// minVersionMagicless is required by the magicless format of the scroll
+	// blobs, decoded by DecompressScrollBatchBytes
+	minVersionMagicless = 10400
+	// minVersionDedicatedDictSearch is required by
+	// ZSTD_c_enableDedicatedDictSearch, see WithDedicatedDictSearch
+	minVersionDedicatedDictSearch = 10407
+	// minVersionLiteralCompressionMode is required by
+	// ZSTD_c_literalCompressionMode taking ZSTD_ps_disable
+	minVersionLiteralCompressionMode = 10501
+	// minVersionDecompressionMargin is required by ZSTD_decompressionMargin,
+	// see DecompressionMargin
+	minVersionDecompressionMargin = 10504
+	// minVersionSequences is required by CompressSequences and
+	// GenerateSequences, whose API settled in this version
+	minVersionSequences = 10506
+	// minVersionScrollEncoder is required by the scroll encoder, as older
+	// versions split blocks differently with ZSTD_c_targetCBlockSize and
+	// produce blobs which do not match the ones of the vendored libzstd
+	minVersionScrollEncoder = 10506
+)
+
+// RequireVersion returns a *VersionError if the linked libzstd is older than
+// min, given as a ZSTD_VERSION_NUMBER value such as 10506 for 1.5.6. This
+// lets programs built against an external libzstd fail early instead of
+// producing different compressed bytes.
+func RequireVersion(min uint) error {
+	return requireVersion("", int(min))
+}
+
+// Capabilities reports the features of the linked libzstd, probed at runtime
+// as an external libzstd may lack some of them.
+func Capabilities() LibraryCapabilities {
+	return LibraryCapabilities{
+		Multithread:         HasMultithreadSupport(),
+		Legacy:              hasLegacySupport(),
+		Magicless:           checkMagicless() == nil,
+		DedicatedDictSearch: C.ZSTD_versionNumber() >= minVersionDedicatedDictSearch,
+		Version:             uint(C.ZSTD_versionNumber()),
+	}
+}
+
+// hasLegacySupport reports whether libzstd recognizes the frames of zstd 0.7,
+// which requires ZSTD_LEGACY_SUPPORT.
+func hasLegacySupport() bool {
+	magic := []byte{0x27, 0xB5, 0x2F, 0xFD}
+	return C.ZSTD_isFrame(unsafe.Pointer(&magic[0]), C.size_t(len(magic))) != 0
+}
+
+// requireVersion returns a *VersionError if the linked libzstd is older than
+// required for feature.
+func requireVersion(feature string, required int) error {
+	if linked := int(C.ZSTD_versionNumber()); linked < required {
+		return &VersionError{Feature: feature, Required: required, Linked: linked}
+	}
+	return nil
+}
+
+// checkMagicless checks that the linked libzstd supports the magicless format.
+func checkMagicless() error {
+	if err := requireVersion("magicless format", minVersionMagicless); err != nil {
+		return err
+	}
+	bounds := C.ZSTD_cParam_getBounds(C.ZSTD_c_format)
+	if C.ZSTD_isError(bounds.error) != 0 || bounds.upperBound < C.int(C.ZSTD_f_zstd1_magicless) {
+		return fmt.Errorf("zstd: magicless format: %w", ErrNotSupported)
+	}
+	return nil
+}
+
+// checkScrollCapabilities checks that the linked libzstd supports the
+// parameters of the scroll encoder and produces the same blobs as the vendored
+// one, instead of silently breaking the protocol.
+func checkScrollCapabilities() error {
+	if err := checkMagicless(); err != nil {
+		return err
+	}
+	if err := requireVersion("literal compression mode", minVersionLiteralCompressionMode); err != nil {
+		return err
+	}
+	return requireVersion("scroll encoder", minVersionScrollEncoder)
+}
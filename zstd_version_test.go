@@ -0,0 +1,65 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVersionString(t *testing.T) {
+	for v, expected := range map[int]string{10400: "1.4.0", 10506: "1.5.6", 20010: "2.0.10"} {
+		if s := versionString(v); s != expected {
+			t.Errorf("versionString(%d) = %q, expected %q", v, s, expected)
+		}
+	}
+}
+
+func TestRequireVersion(t *testing.T) {
+	if err := requireVersion("scroll encoder", minVersionScrollEncoder); err != nil {
+		t.Fatalf("Linked libzstd does not support the scroll encoder: %v", err)
+	}
+	if scrollPoolErr != nil {
+		t.Fatalf("Failed to create the scroll pool: %v", scrollPoolErr)
+	}
+
+	err := requireVersion("future feature", 990000)
+	var verr *VersionError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a *VersionError, got %v", err)
+	}
+	if verr.Feature != "future feature" || verr.Required != 990000 || verr.Linked < minVersionScrollEncoder {
+		t.Errorf("Unexpected error fields: %+v", verr)
+	}
+	if expected := "zstd: future feature requires libzstd 99.0.0 or later, linked against " + versionString(verr.Linked); err.Error() != expected {
+		t.Errorf("Unexpected message %q, expected %q", err.Error(), expected)
+	}
+}
+
+func TestRequireVersionPublic(t *testing.T) {
+	failOnError(t, "Failed to require the vendored version", RequireVersion(minVersionScrollEncoder))
+	err := RequireVersion(990000)
+	var verr *VersionError
+	if !errors.As(err, &verr) || verr.Required != 990000 {
+		t.Fatalf("Expected a *VersionError requiring 99.0.0, got %v", err)
+	}
+	if expected := "zstd: libzstd 99.0.0 or later is required, linked against " + versionString(verr.Linked); err.Error() != expected {
+		t.Errorf("Unexpected message %q, expected %q", err.Error(), expected)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := Capabilities()
+	// The vendored libzstd is built with legacy support
+	if !caps.Legacy || !caps.Magicless || !caps.DedicatedDictSearch {
+		t.Errorf("Expected legacy, magicless and dedicated dictionary search support, got %+v", caps)
+	}
+	if caps.Multithread != HasMultithreadSupport() {
+		t.Errorf("Expected Multithread to be %v, got %+v", HasMultithreadSupport(), caps)
+	}
+	if caps.Version < minVersionScrollEncoder {
+		t.Errorf("Unexpected version %d", caps.Version)
+	}
+	failOnError(t, "Failed to check the scroll capabilities", checkScrollCapabilities())
+}
@@ -0,0 +1,128 @@
+package zstd
+
+/*
+#include <stdlib.h>
+#include "zstd.h"
+*/
+import "C"
+import (
+	"bytes"
+	"runtime"
+	"sync"
+)
+
+// warmPools keeps the pools of the presets warmed up by Warmup, which
+// CompressWithParams uses for parameters selecting a preset alone.
+var warmPools = struct {
+	sync.RWMutex
+	m map[Preset]*CtxPool
+}{m: map[Preset]*CtxPool{}}
+
+// warmupSample is the input compressed to warm up the contexts, small enough
+// to cost nothing but long enough to go through the match finders.
+var warmupSample = bytes.Repeat([]byte("warming up the contexts of libzstd "), 32)
+
+// Warmup prepares the package for the compressions with the given presets,
+// e.g. while a service is not ready yet, so that the first requests do not
+// pay for the creation of contexts and the page faults of their first use.
+//
+// For each preset, it creates a pool of contexts keeping up to
+// runtime.NumCPU() of them, and allocates the workspace of one by compressing
+// a sample. CompressWithParams then takes its contexts from the pool when the
+// parameters select the preset alone, i.e. CParams{Preset: p}, and
+// CompressScrollBatchBytes already has such a pool for PresetScrollBlob.
+// Warmup also runs a round trip with the context of CompressMany and
+// DecompressMany to fault in the code of the one-shot functions.
+//
+// Calling Warmup again with the same presets only touches the existing
+// pools. The contexts are kept for the lifetime of the process, so warm up
+// the presets with large windows such as PresetLongRange only if they are
+// used frequently.
+func Warmup(profiles ...Preset) error {
+	for _, p := range profiles {
+		pool, err := warmPool(p)
+		if err != nil {
+			return err
+		}
+		c, err := pool.Get()
+		if err != nil {
+			return err
+		}
+		err = warmCCtx(c.cctx)
+		pool.Put(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	c := manyCtxPool.Get().(*ctx)
+	defer putManyCtx(c)
+	compressed, err := c.CompressLevel(nil, warmupSample, DefaultLevel())
+	if err != nil {
+		return err
+	}
+	_, err = c.Decompress(nil, compressed)
+	return err
+}
+
+// warmPool returns the pool of the preset p, creating it if it does not
+// exist yet.
+func warmPool(p Preset) (*CtxPool, error) {
+	warmPools.Lock()
+	defer warmPools.Unlock()
+	if pool, ok := warmPools.m[p]; ok {
+		return pool, nil
+	}
+
+	var pool *CtxPool
+	var err error
+	if p == PresetScrollBlob {
+		pool, err = scrollPool, scrollPoolErr
+	} else {
+		pool, err = NewCtxPool(CParams{Preset: p}, runtime.NumCPU())
+	}
+	if err != nil {
+		return nil, err
+	}
+	warmPools.m[p] = pool
+	return pool, nil
+}
+
+// warmPoolOf returns the pool warmed up for params, or nil if params does not
+// select a warmed up preset alone.
+func warmPoolOf(params CParams) *CtxPool {
+	if params.Preset == 0 || params.Level != 0 || params.SrcSizeHint != 0 || params.Strategy != 0 ||
+		params.WindowLog != 0 || params.Checksum || params.BlockDelimiters != 0 ||
+		params.Progress != nil || len(params.Params) != 0 {
+		return nil
+	}
+	warmPools.RLock()
+	defer warmPools.RUnlock()
+	return warmPools.m[params.Preset]
+}
+
+// warmCCtx compresses warmupSample with cctx through the streaming API. As
+// the size of the input is not declared, libzstd allocates the workspace for
+// inputs of any size instead of one tuned for the sample. The session of
+// cctx must be reset afterwards.
+func warmCCtx(cctx *C.ZSTD_CCtx) error {
+	src := C.CBytes(warmupSample)
+	defer C.free(src)
+	dstSize := CompressBound(len(warmupSample))
+	dst := C.malloc(C.size_t(dstSize))
+	defer C.free(dst)
+
+	in := C.ZSTD_inBuffer{src: src, size: C.size_t(len(warmupSample))}
+	out := C.ZSTD_outBuffer{dst: dst, size: C.size_t(dstSize)}
+	endOp := C.ZSTD_EndDirective(C.ZSTD_e_continue)
+	for {
+		remaining := int(C.ZSTD_compressStream2(cctx, &out, &in, endOp))
+		if err := getError(remaining); err != nil {
+			return opError("ZSTD_compressStream2", len(warmupSample), dstSize, err)
+		}
+		if endOp == C.ZSTD_e_end && remaining == 0 {
+			return nil
+		}
+		endOp = C.ZSTD_e_end
+	}
+}
@@ -0,0 +1,67 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWarmup(t *testing.T) {
+	EnableAllocationTracking(true)
+	defer EnableAllocationTracking(false)
+	presets := []Preset{PresetFastest, PresetDefault}
+	failOnError(t, "Error while warming up", Warmup(presets...))
+
+	payload := bytes.Repeat([]byte("the first request after a deploy "), 30000)
+	before := DebugStats()
+	created := map[Preset]int64{}
+	for _, preset := range presets {
+		created[preset] = warmPoolOf(CParams{Preset: preset}).Stats().Created
+	}
+	for i := 0; i < 3; i++ {
+		for _, preset := range presets {
+			compressed, err := CompressWithParams(nil, payload, CParams{Preset: preset})
+			failOnError(t, "Error while compressing", err)
+			decompressed, err := Decompress(nil, compressed)
+			failOnError(t, "Error while decompressing", err)
+			if !bytes.Equal(decompressed, payload) {
+				t.Fatalf("%s: the round trip differs", preset)
+			}
+		}
+	}
+	// The garbage collector may free the context kept for CompressMany
+	after := DebugStats()
+	if after.CCtxs > before.CCtxs || after.NativeBytes > before.NativeBytes {
+		t.Fatalf("Expected no allocation after the warmup, got %+v from %+v", after, before)
+	}
+	for _, preset := range presets {
+		if stats := warmPoolOf(CParams{Preset: preset}).Stats(); stats.Created != created[preset] {
+			t.Fatalf("%s: expected no context created after the warmup, got %+v", preset, stats)
+		}
+	}
+
+	// Only the parameters of a preset alone use the pool
+	if warmPoolOf(CParams{Preset: PresetDefault, Level: 5}) != nil || warmPoolOf(CParams{Preset: PresetArchive}) != nil {
+		t.Fatalf("Expected no pool for parameters not warmed up")
+	}
+	if err := Warmup(Preset(100)); err == nil {
+		t.Fatalf("Expected an error for an unknown preset")
+	}
+}
+
+func TestWarmupScrollBlob(t *testing.T) {
+	if scrollPoolErr != nil {
+		t.Skip("The linked libzstd cannot produce the blobs")
+	}
+	failOnError(t, "Error while warming up", Warmup(PresetScrollBlob))
+	batch := bytes.Repeat([]byte("a batch of transactions "), 1000)
+	expected, err := CompressScrollBatchBytes(batch)
+	failOnError(t, "Error while compressing the batch", err)
+	blob, err := CompressWithParams(nil, batch, CParams{Preset: PresetScrollBlob})
+	failOnError(t, "Error while compressing the batch", err)
+	if !bytes.Equal(blob, expected) {
+		t.Fatalf("The blob differs from CompressScrollBatchBytes")
+	}
+}
@@ -0,0 +1,134 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"fmt"
+	"hash"
+	"io"
+)
+
+// WriterOption configures a Writer created by NewWriterOptions.
+type WriterOption func(*Writer) error
+
+// NewWriterOptions is like NewWriterLevel but configures the Writer with
+// options. Invalid options are reported immediately instead of on the first
+// Write.
+func NewWriterOptions(w io.Writer, level int, opts ...WriterOption) (*Writer, error) {
+	zw := NewWriterLevel(w, level)
+	for _, opt := range opts {
+		if zw.firstError != nil {
+			break
+		}
+		zw.firstError = opt(zw)
+	}
+	if zw.firstError != nil {
+		zw.free()
+		return nil, zw.firstError
+	}
+	return zw, nil
+}
+
+// WriterStats reports the activity of a Writer.
+type WriterStats struct {
+	// Level is the compression level currently in effect
+	Level int
+
+	// BytesIn is the number of bytes written to the Writer
+	BytesIn int64
+
+	// BytesOut is the number of compressed bytes written to the underlying
+	// io.Writer
+	BytesOut int64
+
+	// StoredFrames is the number of frames written uncompressed, see
+	// WithMinRatio
+	StoredFrames int
+
+	// Storing is set while the frames are written uncompressed, see
+	// WithMinRatio
+	Storing bool
+}
+
+// Stats returns the statistics of the Writer.
+func (w *Writer) Stats() WriterStats {
+	level := w.CompressionLevel
+	if w.adapt != nil {
+		level = w.adapt.level
+	}
+	stats := WriterStats{Level: level, BytesIn: w.bytesIn, BytesOut: w.bytesOut}
+	if w.minRatio != nil {
+		stats.StoredFrames = w.minRatio.storedFrames
+		stats.Storing = w.minRatio.storing
+	}
+	return stats
+}
+
+// WithContentHasher writes every byte accepted by Write into h before it is
+// compressed, e.g. to get the keccak or sha256 of the uncompressed data
+// without reading it twice. Data is hashed once, when Write returns
+// successfully, whatever the number of workers. Stats().BytesIn is the number
+// of bytes hashed, which callers can compare to the size they expect before
+// Close.
+func WithContentHasher(h hash.Hash) WriterOption {
+	return func(w *Writer) error {
+		w.hasher = h
+		return nil
+	}
+}
+
+// ErrCompressedSizeExceeded is returned by a Writer whose compressed output
+// would exceed the budget set by WithMaxCompressedSize.
+type ErrCompressedSizeExceeded struct {
+	// Limit is the budget of the Writer
+	Limit int64
+	// Size is the output size the refused write would have reached
+	Size int64
+}
+
+func (e ErrCompressedSizeExceeded) Error() string {
+	return fmt.Sprintf("Compressed size %d exceeds the limit of %d bytes", e.Size, e.Limit)
+}
+
+// WithMaxCompressedSize limits the output of the Writer to n bytes, e.g. to
+// compress into a slot of fixed size. Write, Flush and Close return
+// ErrCompressedSizeExceeded as soon as writing the compressed data they
+// produce would exceed n bytes, and so do all the later calls. The data is
+// handed to the underlying io.Writer in whole chunks: the chunk crossing the
+// budget is not written, so the underlying io.Writer holds at most n bytes,
+// the output up to the previous chunk, which is an incomplete frame.
+//
+// zstd buffers up to a block of input before producing output, so a Write
+// may succeed and the budget only be crossed by a later Flush or Close.
+func WithMaxCompressedSize(n int64) WriterOption {
+	return func(w *Writer) error {
+		if n < 0 {
+			return fmt.Errorf("zstd: invalid compressed size limit %d", n)
+		}
+		w.underlyingWriter = &limitedWriter{w: w.underlyingWriter, limit: n}
+		return nil
+	}
+}
+
+// limitedWriter is an io.Writer refusing the writes which would make its
+// output exceed limit bytes.
+type limitedWriter struct {
+	w       io.Writer
+	limit   int64
+	written int64
+	err     error
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if size := l.written + int64(len(p)); size > l.limit {
+		l.err = ErrCompressedSizeExceeded{Limit: l.limit, Size: size}
+		return 0, l.err
+	}
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	return n, err
+}
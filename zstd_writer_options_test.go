@@ -0,0 +1,139 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestWithContentHasher(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello, World! "), 100000)
+	want := sha256.Sum256(payload)
+
+	for _, workers := range []int{0, 2} {
+		var buf bytes.Buffer
+		h := sha256.New()
+		w, err := NewWriterOptions(&buf, DefaultCompression, WithContentHasher(h))
+		failOnError(t, "Failed to create writer", err)
+		if workers > 0 {
+			if !HasMultithreadSupport() {
+				continue
+			}
+			failOnError(t, "Failed to set workers", w.SetNbWorkers(workers))
+		}
+		// io.Copy splits the input in many writes, some of which are
+		// buffered by the Writer
+		_, err = io.Copy(w, bytes.NewReader(payload))
+		failOnError(t, "Failed to copy", err)
+		if n := w.Stats().BytesIn; n != int64(len(payload)) {
+			t.Fatalf("workers=%d: expected %d bytes hashed, got %d", workers, len(payload), n)
+		}
+		failOnError(t, "Failed to close", w.Close())
+
+		if !bytes.Equal(h.Sum(nil), want[:]) {
+			t.Fatalf("workers=%d: hash of the input does not match", workers)
+		}
+		decompressed, err := Decompress(nil, buf.Bytes())
+		failOnError(t, "Failed to decompress", err)
+		if !bytes.Equal(decompressed, payload) {
+			t.Fatalf("workers=%d: round trip does not match", workers)
+		}
+	}
+}
+
+func TestWithMaxCompressedSize(t *testing.T) {
+	const slot = 128 << 10
+	random := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("Hello, World! "), 100000)
+
+	compress := func(payload []byte, opts ...WriterOption) ([]byte, error) {
+		var buf bytes.Buffer
+		w, err := NewWriterOptions(&buf, DefaultCompression, opts...)
+		failOnError(t, "Failed to create writer", err)
+		_, err = io.Copy(w, bytes.NewReader(payload))
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if n := w.Stats().BytesOut; n != int64(buf.Len()) {
+			t.Fatalf("Expected %d bytes out, got %d", buf.Len(), n)
+		}
+		return buf.Bytes(), err
+	}
+
+	// Compressible data fits in the slot, like the one-shot output does
+	oneShot, err := Compress(nil, text)
+	failOnError(t, "Failed to compress", err)
+	if len(oneShot) > slot {
+		t.Fatalf("Expected the one-shot output to fit, got %d bytes", len(oneShot))
+	}
+	out, err := compress(text, WithMaxCompressedSize(slot))
+	failOnError(t, "Failed to compress in the slot", err)
+	decompressed, err := Decompress(nil, out)
+	failOnError(t, "Failed to decompress", err)
+	if !bytes.Equal(decompressed, text) {
+		t.Fatalf("Decompressed data does not match the input")
+	}
+
+	// Random data does not fit: the output is a prefix of the full one,
+	// within the slot
+	oneShot, err = Compress(nil, random)
+	failOnError(t, "Failed to compress", err)
+	if len(oneShot) <= slot {
+		t.Fatalf("Expected the one-shot output not to fit, got %d bytes", len(oneShot))
+	}
+	full, err := compress(random)
+	failOnError(t, "Failed to compress", err)
+	for _, opts := range [][]WriterOption{
+		{WithMaxCompressedSize(slot)},
+		{WithMaxCompressedSize(slot), WithStoredFrames(true)},
+		{WithMinRatio(1.5), WithMaxCompressedSize(slot)},
+	} {
+		out, err := compress(random, opts...)
+		var exceeded ErrCompressedSizeExceeded
+		if !errors.As(err, &exceeded) || exceeded.Limit != slot || exceeded.Size <= slot {
+			t.Fatalf("Expected ErrCompressedSizeExceeded, got %v", err)
+		}
+		if len(out) > slot {
+			t.Fatalf("Expected at most %d bytes written, got %d", slot, len(out))
+		}
+		if len(opts) == 1 && !bytes.HasPrefix(full, out) {
+			t.Fatalf("Expected the output written to be a prefix of the full output")
+		}
+	}
+
+	if _, err := NewWriterOptions(ioutil.Discard, DefaultCompression, WithMaxCompressedSize(-1)); err == nil {
+		t.Fatalf("Expected an error for a negative limit")
+	}
+}
+
+func TestWithMaxCompressedSizeBuffered(t *testing.T) {
+	// Less than a block: Write only buffers it, Flush crosses the budget
+	payload := make([]byte, 100<<10)
+	rand.New(rand.NewSource(1)).Read(payload)
+	var buf bytes.Buffer
+	w, err := NewWriterOptions(&buf, DefaultCompression, WithMaxCompressedSize(50<<10))
+	failOnError(t, "Failed to create writer", err)
+	_, err = w.Write(payload)
+	failOnError(t, "Failed to write", err)
+	var exceeded ErrCompressedSizeExceeded
+	if err := w.Flush(); !errors.As(err, &exceeded) {
+		t.Fatalf("Expected ErrCompressedSizeExceeded from Flush, got %v", err)
+	}
+	if _, err := w.Write(payload); !errors.As(err, &exceeded) {
+		t.Fatalf("Expected ErrCompressedSizeExceeded from later writes, got %v", err)
+	}
+	if err := w.Close(); !errors.As(err, &exceeded) {
+		t.Fatalf("Expected ErrCompressedSizeExceeded from Close, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Expected nothing written, got %d bytes", buf.Len())
+	}
+}
@@ -0,0 +1,122 @@
+package zstd
+
+/*
+#include "xxhash.h"
+
+// The XXH64 functions are macros adding the ZSTD_ namespace, which cgo cannot
+// call.
+static XXH64_state_t* ZSTD_xxh64New(unsigned long long seed) {
+	XXH64_state_t* state = XXH64_createState();
+	if (state != NULL) {
+		XXH64_reset(state, seed);
+	}
+	return state;
+}
+
+static void ZSTD_xxh64Free(XXH64_state_t* state) {
+	XXH64_freeState(state);
+}
+
+static void ZSTD_xxh64Reset(XXH64_state_t* state, unsigned long long seed) {
+	XXH64_reset(state, seed);
+}
+
+static void ZSTD_xxh64Update(XXH64_state_t* state, const void* src, size_t srcSize) {
+	XXH64_update(state, src, srcSize);
+}
+
+static unsigned long long ZSTD_xxh64Digest(XXH64_state_t* state) {
+	return XXH64_digest(state);
+}
+
+static unsigned long long ZSTD_xxh64(const void* src, size_t srcSize, unsigned long long seed) {
+	return XXH64(src, srcSize, seed);
+}
+*/
+import "C"
+import (
+	"encoding/binary"
+	"hash"
+	"runtime"
+	"unsafe"
+)
+
+// XXH64 returns the XXH64 of data with seed, using the implementation bundled
+// with libzstd. The checksum of zstd frames is the low 32 bits of the XXH64 of
+// their content with a seed of 0.
+func XXH64(data []byte, seed uint64) uint64 {
+	var ptr unsafe.Pointer // Do not point anywhere, if data is empty
+	if len(data) > 0 {
+		ptr = unsafe.Pointer(&data[0])
+	}
+	return uint64(C.ZSTD_xxh64(ptr, C.size_t(len(data)), C.ulonglong(seed)))
+}
+
+// XXH64Digest is a hash.Hash64 computing the XXH64 of its input with a seed,
+// using the implementation bundled with libzstd. Sum appends the digest in big
+// endian, the canonical representation of xxHash.
+type XXH64Digest struct {
+	state *C.XXH64_state_t
+	seed  uint64
+}
+
+// NewXXH64 returns a hash.Hash64 computing the XXH64 of its input with a seed
+// of 0, the checksum of zstd frames. It can be given to
+// DecompressOptions.ContentHash or WithOutputHasher to get the XXH64 of the
+// decompressed content.
+func NewXXH64() hash.Hash64 {
+	return NewXXH64Seed(0)
+}
+
+// NewXXH64Seed returns an XXH64Digest computing the XXH64 of its input with
+// seed.
+func NewXXH64Seed(seed uint64) *XXH64Digest {
+	state := C.ZSTD_xxh64New(C.ulonglong(seed))
+	if state == nil {
+		panic("zstd: failed to allocate an XXH64 state")
+	}
+	d := &XXH64Digest{state: state, seed: seed}
+	runtime.SetFinalizer(d, func(d *XXH64Digest) {
+		C.ZSTD_xxh64Free(d.state)
+	})
+	return d
+}
+
+func (d *XXH64Digest) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		C.ZSTD_xxh64Update(d.state, unsafe.Pointer(&p[0]), C.size_t(len(p)))
+		runtime.KeepAlive(d)
+	}
+	return len(p), nil
+}
+
+func (d *XXH64Digest) Sum64() uint64 {
+	sum := uint64(C.ZSTD_xxh64Digest(d.state))
+	runtime.KeepAlive(d)
+	return sum
+}
+
+// Sum appends the digest to b in big endian, the canonical representation of
+// xxHash.
+func (d *XXH64Digest) Sum(b []byte) []byte {
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], d.Sum64())
+	return append(b, sum[:]...)
+}
+
+func (d *XXH64Digest) Reset() {
+	C.ZSTD_xxh64Reset(d.state, C.ulonglong(d.seed))
+	runtime.KeepAlive(d)
+}
+
+func (d *XXH64Digest) Size() int {
+	return 8
+}
+
+func (d *XXH64Digest) BlockSize() int {
+	return 32
+}
+
+func init() {
+	newXXH64Hash = func() hash.Hash { return NewXXH64() }
+}
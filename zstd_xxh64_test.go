@@ -0,0 +1,82 @@
+//go:build cgo
+// +build cgo
+
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	h := NewXXH64()
+	if sum := h.Sum64(); sum != 0xEF46DB3751D8E999 {
+		t.Fatalf("Expected the XXH64 of no input to be 0xEF46DB3751D8E999, got %#x", sum)
+	}
+
+	// The checksum of a frame is the low 32 bits of the XXH64 of its content
+	payload := bytes.Repeat([]byte("Hello, World! "), 10000)
+	frame, err := CompressWithParams(nil, payload, CParams{Checksum: true})
+	failOnError(t, "Failed to compress", err)
+	for _, split := range []int{0, 1, 1000, len(payload)} {
+		h.Reset()
+		h.Write(payload[:split])
+		h.Write(payload[split:])
+		if sum := uint32(h.Sum64()); sum != binary.LittleEndian.Uint32(frame[len(frame)-4:]) {
+			t.Fatalf("split=%d: checksum %#x does not match the one of the frame", split, sum)
+		}
+		if b := h.Sum([]byte{1}); len(b) != 9 || binary.BigEndian.Uint64(b[1:]) != h.Sum64() {
+			t.Fatalf("split=%d: unexpected Sum %x", split, b)
+		}
+	}
+}
+
+// xxh64SanityBuffer returns the first n bytes of the sanity buffer of the
+// xxHash reference test suite.
+func xxh64SanityBuffer(n int) []byte {
+	const prime32, prime64 = 2654435761, 11400714785074694797
+	buf := make([]byte, n)
+	gen := uint64(prime32)
+	for i := range buf {
+		buf[i] = byte(gen >> 56)
+		gen *= prime64
+	}
+	return buf
+}
+
+func TestXXH64Vectors(t *testing.T) {
+	const prime32 = 2654435761
+	tests := []struct {
+		size     int
+		seed     uint64
+		expected uint64
+	}{
+		{0, 0, 0xEF46DB3751D8E999},
+		{0, prime32, 0xAC75FDA2929B17EF},
+		{1, 0, 0xE934A84ADB052768},
+		{1, prime32, 0x5014607643A9B4C3},
+		{14, 0, 0x8282DCC4994E35C8},
+		{14, prime32, 0xC3BD6BF63DEB6DF0},
+		{222, 0, 0xB641AE8CB691C174},
+		{222, prime32, 0x20CB8AB7AE10C14A},
+	}
+	for _, test := range tests {
+		data := xxh64SanityBuffer(test.size)
+		if sum := XXH64(data, test.seed); sum != test.expected {
+			t.Fatalf("size=%d seed=%#x: expected %#x, got %#x", test.size, test.seed, test.expected, sum)
+		}
+		d := NewXXH64Seed(test.seed)
+		for i := range data {
+			d.Write(data[i : i+1])
+		}
+		if sum := d.Sum64(); sum != test.expected {
+			t.Fatalf("size=%d seed=%#x: expected %#x from the digest, got %#x", test.size, test.seed, test.expected, sum)
+		}
+		d.Reset()
+		d.Write(data)
+		if sum := d.Sum64(); sum != test.expected {
+			t.Fatalf("size=%d seed=%#x: expected %#x after Reset, got %#x", test.size, test.seed, test.expected, sum)
+		}
+	}
+}
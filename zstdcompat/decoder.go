@@ -0,0 +1,341 @@
+//go:build cgo
+// +build cgo
+
+package zstdcompat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/colinlyguo/zstd"
+)
+
+var (
+	// ErrDecoderSizeExceeded is returned when the decompressed content is
+	// larger than allowed, see WithDecoderMaxMemory and
+	// WithDecodeAllCapLimit.
+	ErrDecoderSizeExceeded = zstd.ErrSizeLimitExceeded
+
+	// ErrWindowSizeExceeded is returned when a frame needs a larger window
+	// than allowed, see WithDecoderMaxWindow.
+	ErrWindowSizeExceeded = zstd.ErrWindowTooLarge
+
+	// ErrCRCMismatch is returned when the checksum of a frame does not match
+	// its content.
+	ErrCRCMismatch = zstd.ErrChecksumMismatch
+
+	// ErrDecoderClosed is returned when the Decoder is used after Close.
+	ErrDecoderClosed = errors.New("Decoder used after Close")
+
+	// ErrDecoderNilInput is returned when the Decoder streams without a
+	// reader.
+	ErrDecoderNilInput = errors.New("Nil input provided as reader")
+)
+
+const (
+	defaultMaxMemory = 64 << 30
+	defaultMaxWindow = 512 << 20
+
+	// maxWindowLog is the largest window log libzstd accepts
+	maxWindowLog = 30 + int(^uint(0)>>63)
+	maxInt       = int(^uint(0) >> 1)
+)
+
+// DOption is an option for NewReader.
+type DOption func(*decoderOptions) error
+
+type decoderOptions struct {
+	maxMemory uint64
+	maxWindow uint64
+	capLimit  bool
+	dict      []byte
+}
+
+// windowLog returns the largest window log whose window is at most max,
+// within the bounds of libzstd.
+func windowLog(max uint64) int {
+	log := log2(max)
+	if log < log2(MinWindowSize) {
+		return log2(MinWindowSize)
+	}
+	if log > maxWindowLog {
+		return maxWindowLog
+	}
+	return log
+}
+
+// streamWindowLog returns the window log of the streams, whose window also
+// fits the maximum memory.
+func (o *decoderOptions) streamWindowLog() int {
+	if o.maxMemory < o.maxWindow {
+		return windowLog(o.maxMemory)
+	}
+	return windowLog(o.maxWindow)
+}
+
+// WithDecoderMaxMemory sets the maximum size DecodeAll decompresses to, and
+// caps the window of the streams, which fail with ErrWindowSizeExceeded if it
+// is larger. The default is 64GB, n must be between 1 and 1<<63.
+func WithDecoderMaxMemory(n uint64) DOption {
+	return func(o *decoderOptions) error {
+		if n == 0 {
+			return errors.New("WithDecoderMaxMemory must be at least 1")
+		}
+		if n > 1<<63 {
+			return errors.New("WithDecoderMaxMemory must be less than 1 << 63")
+		}
+		o.maxMemory = n
+		return nil
+	}
+}
+
+// WithDecoderMaxWindow sets the maximum window of the frames, which fail with
+// ErrWindowSizeExceeded if it is larger. Windows are powers of two, size is
+// rounded down to one. The default is 512MB, size must be at least
+// MinWindowSize.
+func WithDecoderMaxWindow(size uint64) DOption {
+	return func(o *decoderOptions) error {
+		if size < MinWindowSize {
+			return errors.New("WithDecoderMaxWindow must be at least 1KB")
+		}
+		o.maxWindow = size
+		return nil
+	}
+}
+
+// WithDecodeAllCapLimit limits the output of DecodeAll to the capacity left
+// in its dst, instead of the maximum memory.
+func WithDecodeAllCapLimit(b bool) DOption {
+	return func(o *decoderOptions) error {
+		o.capLimit = b
+		return nil
+	}
+}
+
+// WithDecoderDicts decompresses with a dictionary, in the format produced by
+// "zstd --train". Only one dictionary is supported, as libzstd does not pick
+// the dictionary by the ID the frames declare.
+func WithDecoderDicts(dicts ...[]byte) DOption {
+	return func(o *decoderOptions) error {
+		switch len(dicts) {
+		case 0:
+			return nil
+		case 1:
+			if zstd.GetDictIDFromDict(dicts[0]) == 0 {
+				return errors.New("invalid dictionary")
+			}
+			o.dict = dicts[0]
+			return nil
+		default:
+			return fmt.Errorf("%w: WithDecoderDicts with %d dictionaries", ErrUnsupportedOption, len(dicts))
+		}
+	}
+}
+
+// WithDecoderConcurrency is accepted for compatibility, DecodeAll can be
+// called concurrently whatever n is, and the streams decompress in the
+// calling goroutine.
+func WithDecoderConcurrency(n int) DOption {
+	return func(o *decoderOptions) error {
+		if n < 0 {
+			return errors.New("concurrency must be at least 0")
+		}
+		return nil
+	}
+}
+
+// WithDecoderLowmem is accepted for compatibility and has no effect.
+func WithDecoderLowmem(b bool) DOption {
+	return func(o *decoderOptions) error {
+		return nil
+	}
+}
+
+// WithDecodeBuffersBelow is accepted for compatibility and has no effect.
+func WithDecodeBuffersBelow(size int) DOption {
+	return func(o *decoderOptions) error {
+		return nil
+	}
+}
+
+// IgnoreChecksum is not supported, unless b is false: checksums are always
+// verified.
+func IgnoreChecksum(b bool) DOption {
+	return func(o *decoderOptions) error {
+		if !b {
+			return nil
+		}
+		return unsupported("IgnoreChecksum")
+	}
+}
+
+// WithDecoderDictRaw is not supported.
+func WithDecoderDictRaw(id uint32, content []byte) DOption {
+	return func(o *decoderOptions) error {
+		return unsupported("WithDecoderDictRaw")
+	}
+}
+
+// Decoder decompresses streams read from it, like a zstd.Reader, and buffers
+// with DecodeAll.
+type Decoder struct {
+	o      decoderOptions
+	zr     *zstd.Reader
+	closed bool
+}
+
+// NewReader returns a Decoder reading from r, which may be nil if the Decoder
+// is only used for DecodeAll.
+func NewReader(r io.Reader, opts ...DOption) (*Decoder, error) {
+	d := &Decoder{o: decoderOptions{maxMemory: defaultMaxMemory, maxWindow: defaultMaxWindow}}
+	for _, opt := range opts {
+		if err := opt(&d.o); err != nil {
+			return nil, err
+		}
+	}
+	if r != nil {
+		if err := d.Reset(r); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// newReader returns a zstd.Reader honoring the options, with a window of at
+// most 1<<windowLog bytes.
+func (d *Decoder) newReader(r io.Reader, windowLog int) (*zstd.Reader, error) {
+	return zstd.NewReaderOptions(r, zstd.WithDict(d.o.dict), zstd.WithMaxWindowLog(windowLog))
+}
+
+// Read decompresses from the underlying reader.
+func (d *Decoder) Read(p []byte) (int, error) {
+	if d.closed {
+		return 0, ErrDecoderClosed
+	}
+	if d.zr == nil {
+		return 0, ErrDecoderNilInput
+	}
+	return d.zr.Read(p)
+}
+
+// WriteTo writes the decompressed content to w until the end of the
+// underlying reader.
+func (d *Decoder) WriteTo(w io.Writer) (int64, error) {
+	if d.closed {
+		return 0, ErrDecoderClosed
+	}
+	if d.zr == nil {
+		return 0, ErrDecoderNilInput
+	}
+	return io.Copy(w, d.zr)
+}
+
+// Reset discards the stream in progress, if any, and starts a new one
+// reading from r.
+func (d *Decoder) Reset(r io.Reader) error {
+	if d.closed {
+		return ErrDecoderClosed
+	}
+	if r == nil {
+		return ErrDecoderNilInput
+	}
+	zr, err := d.newReader(r, d.o.streamWindowLog())
+	if err != nil {
+		return err
+	}
+	if d.zr != nil {
+		d.zr.Close()
+	}
+	d.zr = zr
+	return nil
+}
+
+// Close releases the resources of the Decoder, which cannot be used anymore.
+func (d *Decoder) Close() {
+	if d.zr != nil {
+		d.zr.Close()
+		d.zr = nil
+	}
+	d.closed = true
+}
+
+// IOReadCloser returns the Decoder as an io.ReadCloser, whose Close closes
+// the Decoder.
+func (d *Decoder) IOReadCloser() io.ReadCloser {
+	return closeWrapper{d: d}
+}
+
+type closeWrapper struct {
+	d *Decoder
+}
+
+func (c closeWrapper) Read(p []byte) (int, error) {
+	return c.d.Read(p)
+}
+
+func (c closeWrapper) WriteTo(w io.Writer) (int64, error) {
+	return c.d.WriteTo(w)
+}
+
+func (c closeWrapper) Close() error {
+	c.d.Close()
+	return nil
+}
+
+// DecodeAll decompresses input, which may hold several frames, appending the
+// content to dst. It can be called concurrently, also with a stream in
+// progress.
+func (d *Decoder) DecodeAll(input, dst []byte) ([]byte, error) {
+	if d.closed {
+		return dst, ErrDecoderClosed
+	}
+	if len(input) == 0 {
+		return dst, nil
+	}
+	limit := d.o.maxMemory
+	if d.o.capLimit {
+		limit = uint64(cap(dst) - len(dst))
+	}
+	return appendTo(dst, func(buf []byte) ([]byte, error) {
+		if d.o.dict == nil && limit > 0 {
+			maxSize := maxInt
+			if limit < uint64(maxInt) {
+				maxSize = int(limit)
+			}
+			return zstd.DecompressWithOptions(buf, input, zstd.DecompressOptions{
+				MaxWindowLog: windowLog(d.o.maxWindow),
+				MaxSize:      maxSize,
+				MaxFrames:    -1,
+			})
+		}
+		// A limit of 0 is no limit for DecompressWithOptions
+		return d.decodeStream(buf, input, limit)
+	})
+}
+
+// decodeStream decompresses input to buf with a zstd.Reader, failing with
+// ErrDecoderSizeExceeded past limit bytes.
+func (d *Decoder) decodeStream(buf, input []byte, limit uint64) ([]byte, error) {
+	zr, err := d.newReader(bytes.NewReader(input), windowLog(d.o.maxWindow))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	w := bytes.NewBuffer(buf)
+	n, err := io.Copy(w, io.LimitReader(zr, int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) == limit {
+		// The content may still go on
+		if m, err := io.CopyN(ioutil.Discard, zr, 1); m > 0 {
+			return nil, ErrDecoderSizeExceeded
+		} else if err != io.EOF {
+			return nil, err
+		}
+	}
+	return w.Bytes(), nil
+}
@@ -0,0 +1,168 @@
+//go:build cgo
+// +build cgo
+
+package zstdcompat
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/colinlyguo/zstd"
+	kzstd "github.com/klauspost/compress/zstd"
+)
+
+func newDecoder(t *testing.T, opts ...DOption) *Decoder {
+	t.Helper()
+	d, err := NewReader(nil, opts...)
+	failOnError(t, "Error while creating the decoder", err)
+	return d
+}
+
+func TestDecodeAll(t *testing.T) {
+	ke, err := kzstd.NewWriter(nil)
+	failOnError(t, "Error while creating the klauspost encoder", err)
+	compressed := ke.EncodeAll(payload, nil)
+	// Several frames decode to their concatenation
+	compressed = ke.EncodeAll(payload[:10], compressed)
+
+	d := newDecoder(t)
+	defer d.Close()
+	out, err := d.DecodeAll(compressed, []byte("prefix"))
+	failOnError(t, "Error while decompressing", err)
+	if !bytes.Equal(out, append([]byte("prefix"), append(payload, payload[:10]...)...)) {
+		t.Fatalf("Expected the content appended to dst")
+	}
+	if out, err := d.DecodeAll(nil, []byte("dst")); err != nil || string(out) != "dst" {
+		t.Fatalf("Expected dst for an empty input, got %q, %v", out, err)
+	}
+
+	// A corrupted checksum fails
+	frame := ke.EncodeAll(payload, nil)
+	frame[len(frame)-1] ^= 0xFF
+	if _, err := d.DecodeAll(frame, nil); !errors.Is(err, ErrCRCMismatch) {
+		t.Fatalf("Expected ErrCRCMismatch, got %v", err)
+	}
+
+	dd := newDecoder(t, WithDecoderDicts(dict))
+	defer dd.Close()
+	withDict := newEncoder(t, WithEncoderDict(dict)).EncodeAll(payload, nil)
+	out, err = dd.DecodeAll(withDict, nil)
+	failOnError(t, "Error while decompressing with the dictionary", err)
+	if !bytes.Equal(out, payload) {
+		t.Fatalf("Dictionary round trip mismatch")
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	compressed, err := zstd.Compress(nil, payload)
+	failOnError(t, "Error while compressing", err)
+
+	d := newDecoder(t, WithDecoderMaxMemory(uint64(len(payload)-1)))
+	if _, err := d.DecodeAll(compressed, nil); err != ErrDecoderSizeExceeded {
+		t.Fatalf("Expected ErrDecoderSizeExceeded, got %v", err)
+	}
+	d = newDecoder(t, WithDecoderMaxMemory(uint64(len(payload))))
+	if _, err := d.DecodeAll(compressed, nil); err != nil {
+		t.Fatalf("Expected a limit equal to the size to pass, got %v", err)
+	}
+
+	d = newDecoder(t, WithDecodeAllCapLimit(true))
+	if _, err := d.DecodeAll(compressed, make([]byte, 0, len(payload)-1)); err != ErrDecoderSizeExceeded {
+		t.Fatalf("Expected ErrDecoderSizeExceeded past the capacity, got %v", err)
+	}
+	if _, err := d.DecodeAll(compressed, nil); err != ErrDecoderSizeExceeded {
+		t.Fatalf("Expected ErrDecoderSizeExceeded without capacity, got %v", err)
+	}
+	dst := make([]byte, 0, len(payload))
+	out, err := d.DecodeAll(compressed, dst)
+	failOnError(t, "Error while decompressing within the capacity", err)
+	if &out[0] != &dst[:1][0] || !bytes.Equal(out, payload) {
+		t.Fatalf("Expected the content in the capacity of dst")
+	}
+
+	// A stream does not declare its content size, its window is the 1MB
+	// requested
+	var buf bytes.Buffer
+	e, err := NewWriter(&buf, WithWindowSize(1<<20))
+	failOnError(t, "Error while creating the encoder", err)
+	_, err = e.Write(payload)
+	failOnError(t, "Error while writing", err)
+	failOnError(t, "Error while closing", e.Close())
+	large := buf.Bytes()
+	d = newDecoder(t, WithDecoderMaxWindow(1<<15))
+	if _, err := d.DecodeAll(large, nil); err != ErrWindowSizeExceeded {
+		t.Fatalf("Expected ErrWindowSizeExceeded, got %v", err)
+	}
+	failOnError(t, "Error while resetting", d.Reset(bytes.NewReader(large)))
+	if _, err := ioutil.ReadAll(d); !errors.Is(err, ErrWindowSizeExceeded) {
+		t.Fatalf("Expected ErrWindowSizeExceeded while streaming, got %v", err)
+	}
+	d = newDecoder(t, WithDecoderMaxMemory(1<<16))
+	failOnError(t, "Error while resetting", d.Reset(bytes.NewReader(large)))
+	if _, err := ioutil.ReadAll(d); !errors.Is(err, ErrWindowSizeExceeded) {
+		t.Fatalf("Expected the maximum memory to cap the window, got %v", err)
+	}
+}
+
+func TestDecoderOptionErrors(t *testing.T) {
+	for name, opt := range map[string]DOption{
+		"IgnoreChecksum":     IgnoreChecksum(true),
+		"WithDecoderDictRaw": WithDecoderDictRaw(1, []byte("raw")),
+		"WithDecoderDicts":   WithDecoderDicts(dict, dict),
+	} {
+		if _, err := NewReader(nil, opt); !errors.Is(err, ErrUnsupportedOption) {
+			t.Fatalf("%s: expected ErrUnsupportedOption, got %v", name, err)
+		}
+	}
+	for name, opt := range map[string]DOption{
+		"memory": WithDecoderMaxMemory(0),
+		"huge":   WithDecoderMaxMemory(1<<63 + 1),
+		"window": WithDecoderMaxWindow(512),
+		"dict":   WithDecoderDicts([]byte("not a dictionary")),
+	} {
+		if _, err := NewReader(nil, opt); err == nil || errors.Is(err, ErrUnsupportedOption) {
+			t.Fatalf("%s: expected an invalid option error, got %v", name, err)
+		}
+	}
+	newDecoder(t, IgnoreChecksum(false), WithDecoderConcurrency(4), WithDecoderLowmem(true), WithDecodeBuffersBelow(1<<20))
+}
+
+func TestDecoderStream(t *testing.T) {
+	ke, err := kzstd.NewWriter(nil, kzstd.WithEncoderLevel(kzstd.SpeedBestCompression))
+	failOnError(t, "Error while creating the klauspost encoder", err)
+	compressed := ke.EncodeAll(payload, nil)
+
+	d, err := NewReader(bytes.NewReader(compressed))
+	failOnError(t, "Error while creating the decoder", err)
+	out, err := ioutil.ReadAll(d)
+	failOnError(t, "Error while reading", err)
+	if !bytes.Equal(out, payload) {
+		t.Fatalf("Stream round trip mismatch")
+	}
+
+	failOnError(t, "Error while resetting", d.Reset(bytes.NewReader(compressed)))
+	var buf bytes.Buffer
+	n, err := d.WriteTo(&buf)
+	failOnError(t, "Error while writing to", err)
+	if n != int64(len(payload)) || !bytes.Equal(buf.Bytes(), payload) {
+		t.Fatalf("WriteTo round trip mismatch")
+	}
+	if err := d.Reset(nil); err != ErrDecoderNilInput {
+		t.Fatalf("Expected ErrDecoderNilInput, got %v", err)
+	}
+
+	rc := d.IOReadCloser()
+	failOnError(t, "Error while closing", rc.Close())
+	if _, err := d.Read(make([]byte, 1)); err != ErrDecoderClosed {
+		t.Fatalf("Expected ErrDecoderClosed, got %v", err)
+	}
+	if _, err := d.DecodeAll(compressed, nil); err != ErrDecoderClosed {
+		t.Fatalf("Expected ErrDecoderClosed, got %v", err)
+	}
+
+	if _, err := newDecoder(t).Read(make([]byte, 1)); err != ErrDecoderNilInput {
+		t.Fatalf("Expected ErrDecoderNilInput without a reader, got %v", err)
+	}
+}
@@ -0,0 +1,401 @@
+//go:build cgo
+// +build cgo
+
+// Package zstdcompat exposes the Encoder and Decoder of
+// github.com/klauspost/compress/zstd backed by the zstd package, so that code
+// written against klauspost/compress migrates by changing its import path.
+//
+// The options of klauspost/compress which libzstd cannot honor, such as
+// padding or raw dictionaries, fail with ErrUnsupportedOption rather than
+// being ignored. The options only tuning the speed or memory use of the Go
+// implementation, such as the concurrency, are accepted and have no effect.
+// The output differs from the one of klauspost/compress for the same level,
+// both decode each other's.
+package zstdcompat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/colinlyguo/zstd"
+)
+
+// ErrUnsupportedOption is returned by NewWriter and NewReader for the options
+// of klauspost/compress this package cannot honor.
+var ErrUnsupportedOption = errors.New("Option is not supported")
+
+// unsupported returns ErrUnsupportedOption for the option name.
+func unsupported(name string) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedOption, name)
+}
+
+// Window sizes accepted by WithWindowSize.
+const (
+	MinWindowSize = 1 << 10
+	MaxWindowSize = 1 << 29
+)
+
+// EncoderLevel predefines encoder compression levels, mapped to zstd levels.
+type EncoderLevel int
+
+// Compression levels
+const (
+	speedNotSet EncoderLevel = iota
+
+	// SpeedFastest is zstd level 1
+	SpeedFastest
+
+	// SpeedDefault is zstd level 3, zstd.DefaultCompression
+	SpeedDefault
+
+	// SpeedBetterCompression is zstd level 7
+	SpeedBetterCompression
+
+	// SpeedBestCompression is zstd level 11
+	SpeedBestCompression
+
+	speedLast
+)
+
+// zstdLevels are the zstd levels of the EncoderLevels.
+var zstdLevels = [speedLast]int{
+	SpeedFastest:           zstd.BestSpeed,
+	SpeedDefault:           zstd.DefaultCompression,
+	SpeedBetterCompression: 7,
+	SpeedBestCompression:   11,
+}
+
+// EncoderLevelFromString returns the level whose String is s, ignoring case.
+// If s is not recognized, it returns (false, SpeedDefault).
+func EncoderLevelFromString(s string) (bool, EncoderLevel) {
+	for l := speedNotSet + 1; l < speedLast; l++ {
+		if bytes.EqualFold([]byte(s), []byte(l.String())) {
+			return true, l
+		}
+	}
+	return false, SpeedDefault
+}
+
+// EncoderLevelFromZstd returns the level closest to the zstd level.
+func EncoderLevelFromZstd(level int) EncoderLevel {
+	switch {
+	case level < 3:
+		return SpeedFastest
+	case level < 6:
+		return SpeedDefault
+	case level < 10:
+		return SpeedBetterCompression
+	default:
+		return SpeedBestCompression
+	}
+}
+
+func (e EncoderLevel) String() string {
+	switch e {
+	case SpeedFastest:
+		return "fastest"
+	case SpeedDefault:
+		return "default"
+	case SpeedBetterCompression:
+		return "better"
+	case SpeedBestCompression:
+		return "best"
+	default:
+		return "invalid"
+	}
+}
+
+// EOption is an option for NewWriter.
+type EOption func(*encoderOptions) error
+
+type encoderOptions struct {
+	level      EncoderLevel
+	windowLog  int
+	crc        bool
+	fullZero   bool
+	dict       []byte
+	concurrent int
+}
+
+// params returns the parameters of the Writers and of EncodeAll.
+func (o *encoderOptions) params() zstd.WriterParams {
+	return zstd.WriterParams{
+		CParams: zstd.CParams{Level: zstdLevels[o.level], WindowLog: o.windowLog, Checksum: o.crc},
+		Dict:    o.dict,
+	}
+}
+
+// WithEncoderLevel sets the compression level.
+func WithEncoderLevel(l EncoderLevel) EOption {
+	return func(o *encoderOptions) error {
+		if l <= speedNotSet || l >= speedLast {
+			return fmt.Errorf("unknown encoder level")
+		}
+		o.level = l
+		return nil
+	}
+}
+
+// WithEncoderCRC sets whether frames end with a checksum of their content,
+// which is the default.
+func WithEncoderCRC(b bool) EOption {
+	return func(o *encoderOptions) error {
+		o.crc = b
+		return nil
+	}
+}
+
+// WithWindowSize sets the maximum back-reference distance, a power of two
+// between MinWindowSize and MaxWindowSize. The default depends on the level.
+func WithWindowSize(n int) EOption {
+	return func(o *encoderOptions) error {
+		switch {
+		case n < MinWindowSize:
+			return fmt.Errorf("window size must be at least %d", MinWindowSize)
+		case n > MaxWindowSize:
+			return fmt.Errorf("window size must be at most %d", MaxWindowSize)
+		case n&(n-1) != 0:
+			return errors.New("window size must be a power of 2")
+		}
+		o.windowLog = log2(uint64(n))
+		return nil
+	}
+}
+
+// WithZeroFrames makes empty inputs produce an empty frame instead of no
+// output at all.
+func WithZeroFrames(b bool) EOption {
+	return func(o *encoderOptions) error {
+		o.fullZero = b
+		return nil
+	}
+}
+
+// WithEncoderDict compresses with dict, in the format produced by
+// "zstd --train".
+func WithEncoderDict(dict []byte) EOption {
+	return func(o *encoderOptions) error {
+		if zstd.GetDictIDFromDict(dict) == 0 {
+			return errors.New("invalid dictionary")
+		}
+		o.dict = dict
+		return nil
+	}
+}
+
+// WithEncoderConcurrency is accepted for compatibility, n must be at least 1.
+// EncodeAll can be called concurrently whatever n is, and the streams
+// compress in the calling goroutine.
+func WithEncoderConcurrency(n int) EOption {
+	return func(o *encoderOptions) error {
+		if n <= 0 {
+			return fmt.Errorf("concurrency must be at least 1")
+		}
+		o.concurrent = n
+		return nil
+	}
+}
+
+// WithLowerEncoderMem is accepted for compatibility and has no effect, the
+// memory used by libzstd depends on the level and window size.
+func WithLowerEncoderMem(b bool) EOption {
+	return func(o *encoderOptions) error {
+		return nil
+	}
+}
+
+// WithEncoderPadding is not supported, except for n = 1 which adds no
+// padding.
+func WithEncoderPadding(n int) EOption {
+	return func(o *encoderOptions) error {
+		if n == 1 {
+			return nil
+		}
+		return unsupported("WithEncoderPadding")
+	}
+}
+
+// WithAllLitEntropyCompression is not supported, libzstd decides by itself
+// whether to compress the literals.
+func WithAllLitEntropyCompression(b bool) EOption {
+	return func(o *encoderOptions) error {
+		return unsupported("WithAllLitEntropyCompression")
+	}
+}
+
+// WithNoEntropyCompression is not supported, unless b is false.
+func WithNoEntropyCompression(b bool) EOption {
+	return func(o *encoderOptions) error {
+		if !b {
+			return nil
+		}
+		return unsupported("WithNoEntropyCompression")
+	}
+}
+
+// WithSingleSegment is not supported, libzstd decides by itself whether to
+// set the single segment flag.
+func WithSingleSegment(b bool) EOption {
+	return func(o *encoderOptions) error {
+		return unsupported("WithSingleSegment")
+	}
+}
+
+// WithEncoderDictRaw is not supported.
+func WithEncoderDictRaw(id uint32, content []byte) EOption {
+	return func(o *encoderOptions) error {
+		return unsupported("WithEncoderDictRaw")
+	}
+}
+
+// Encoder compresses streams written to it, like a zstd.Writer, and buffers
+// with EncodeAll.
+type Encoder struct {
+	o  encoderOptions
+	w  io.Writer
+	zw *zstd.Writer
+}
+
+// NewWriter returns an Encoder writing to w, which may be nil if the Encoder
+// is only used for EncodeAll.
+func NewWriter(w io.Writer, opts ...EOption) (*Encoder, error) {
+	e := &Encoder{o: encoderOptions{level: SpeedDefault, crc: true}, w: w}
+	for _, opt := range opts {
+		if err := opt(&e.o); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// writer returns the zstd.Writer of the stream in progress, starting it if
+// needed.
+func (e *Encoder) writer() (*zstd.Writer, error) {
+	if e.zw == nil {
+		if e.w == nil {
+			return nil, errors.New("Encoder has no writer, see Reset")
+		}
+		zw, err := zstd.NewWriterParams(e.w, e.o.params())
+		if err != nil {
+			return nil, err
+		}
+		e.zw = zw
+	}
+	return e.zw, nil
+}
+
+// Write compresses p to the underlying writer.
+func (e *Encoder) Write(p []byte) (int, error) {
+	zw, err := e.writer()
+	if err != nil {
+		return 0, err
+	}
+	return zw.Write(p)
+}
+
+// ReadFrom compresses the content of r until io.EOF, without closing the
+// stream.
+func (e *Encoder) ReadFrom(r io.Reader) (int64, error) {
+	zw, err := e.writer()
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(zw, r)
+}
+
+// Flush writes the data compressed so far to the underlying writer.
+func (e *Encoder) Flush() error {
+	if e.zw == nil {
+		return nil
+	}
+	return e.zw.Flush()
+}
+
+// Close ends the stream, without closing the underlying writer. Nothing is
+// written for an empty stream, unless WithZeroFrames is set. The Encoder can
+// be used again after Reset.
+func (e *Encoder) Close() error {
+	if e.zw == nil && (!e.o.fullZero || e.w == nil) {
+		return nil
+	}
+	zw, err := e.writer()
+	if err != nil {
+		return err
+	}
+	e.zw = nil
+	return zw.Close()
+}
+
+// Reset discards the stream in progress, if any, and starts a new one
+// writing to w.
+func (e *Encoder) Reset(w io.Writer) {
+	if e.zw != nil {
+		e.zw.Abort()
+		e.zw = nil
+	}
+	e.w = w
+}
+
+// EncodeAll compresses src in a single frame appended to dst. Nothing is
+// appended for an empty src, unless WithZeroFrames is set. It can be called
+// concurrently. Like klauspost/compress, it panics if compression fails,
+// which only happens if libzstd cannot allocate its context.
+func (e *Encoder) EncodeAll(src, dst []byte) []byte {
+	if len(src) == 0 && !e.o.fullZero {
+		return dst
+	}
+	params := e.o.params()
+	out, err := appendTo(dst, func(buf []byte) ([]byte, error) {
+		if params.Dict == nil {
+			return zstd.CompressWithParams(buf, src, params.CParams)
+		}
+		w := bytes.NewBuffer(buf)
+		zw, err := zstd.NewWriterParams(w, params)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write(src); err != nil {
+			zw.Close()
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return w.Bytes(), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// MaxEncodedSize returns the maximum size of the output of EncodeAll for an
+// input of size bytes.
+func (e *Encoder) MaxEncodedSize(size int) int {
+	return zstd.CompressBound(size)
+}
+
+// appendTo appends to dst the output of fn, which writes it at the start of
+// the buffer it is given, or allocates another one if it is too small.
+func appendTo(dst []byte, fn func(buf []byte) ([]byte, error)) ([]byte, error) {
+	out, err := fn(dst[len(dst):])
+	if err != nil {
+		return dst, err
+	}
+	if len(out) > 0 && len(out) <= cap(dst)-len(dst) && &dst[:len(dst)+1][len(dst)] == &out[0] {
+		return dst[:len(dst)+len(out)], nil
+	}
+	return append(dst, out...), nil
+}
+
+// log2 returns the log2 of n, rounded down.
+func log2(n uint64) int {
+	log := 0
+	for n > 1 {
+		n >>= 1
+		log++
+	}
+	return log
+}
@@ -0,0 +1,210 @@
+//go:build cgo
+// +build cgo
+
+package zstdcompat
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/colinlyguo/zstd"
+	kzstd "github.com/klauspost/compress/zstd"
+)
+
+var dict []byte
+
+func init() {
+	var err error
+	dict, err = base64.StdEncoding.DecodeString(regexp.MustCompile(`\s+`).ReplaceAllString(`
+	N6Qw7IsuFDIdENCSQjr//////4+QlekuNkmXbUBIkIDiVRX7H4AzAFCgQCFCO9oHAAAEQEuSikaK
+	Dg51OYghBYgBAAAAAAAAAAAAAAAAAAAAANQVpmRQGQAAAAAAAAAAAAAAAAABAAAABAAAAAgAAABo
+	ZWxwIEpvaW4gZW5naW5lZXJzIGVuZ2luZWVycyBmdXR1cmUgbG92ZSB0aGF0IGFyZWlsZGluZyB1
+	c2UgaGVscCBoZWxwIHVzaGVyIEpvaW4gdXNlIGxvdmUgdXMgSm9pbiB1bmQgaW4gdXNoZXIgdXNo
+	ZXIgYSBwbGF0Zm9ybSB1c2UgYW5kIGZ1dHVyZQ==`, ""))
+	if err != nil {
+		panic("failed to create dictionary")
+	}
+}
+
+var payload = []byte(strings.Repeat("We're building a platform that engineers love to use. Join us, and help usher in the future. ", 1000))
+
+func failOnError(t *testing.T, msg string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func newEncoder(t *testing.T, opts ...EOption) *Encoder {
+	t.Helper()
+	e, err := NewWriter(nil, opts...)
+	failOnError(t, "Error while creating the encoder", err)
+	return e
+}
+
+func TestEncodeAll(t *testing.T) {
+	kd, err := kzstd.NewReader(nil)
+	failOnError(t, "Error while creating the klauspost decoder", err)
+	defer kd.Close()
+
+	for l := SpeedFastest; l < speedLast; l++ {
+		e := newEncoder(t, WithEncoderLevel(l))
+		prefix := []byte("prefix")
+		out := e.EncodeAll(payload, prefix)
+		if !bytes.HasPrefix(out, []byte("prefix")) {
+			t.Fatalf("%s: expected the frame to be appended to dst", l)
+		}
+		decoded, err := zstd.Decompress(nil, out[len(prefix):])
+		failOnError(t, "Error while decompressing", err)
+		if !bytes.Equal(decoded, payload) {
+			t.Fatalf("%s: round trip mismatch", l)
+		}
+		decoded, err = kd.DecodeAll(out[len(prefix):], nil)
+		failOnError(t, "Error while decompressing with klauspost", err)
+		if !bytes.Equal(decoded, payload) {
+			t.Fatalf("%s: klauspost round trip mismatch", l)
+		}
+	}
+
+	// The frame is written in place when dst has room for it
+	e := newEncoder(t)
+	dst := make([]byte, 3, e.MaxEncodedSize(len(payload))+3)
+	out := e.EncodeAll(payload, dst)
+	if &out[0] != &dst[0] {
+		t.Fatalf("Expected EncodeAll to reuse the capacity of dst")
+	}
+}
+
+func TestEncodeAllOptions(t *testing.T) {
+	if out := newEncoder(t).EncodeAll(nil, nil); len(out) != 0 {
+		t.Fatalf("Expected no output for an empty input, got %d bytes", len(out))
+	}
+	empty := newEncoder(t, WithZeroFrames(true)).EncodeAll(nil, nil)
+	if info, err := zstd.Info(empty); err != nil || info.DecompressedSize != 0 {
+		t.Fatalf("Expected an empty frame, got %v", err)
+	}
+
+	withCRC, err := zstd.Info(newEncoder(t).EncodeAll(payload, nil))
+	failOnError(t, "Error while parsing the frame", err)
+	withoutCRC, err := zstd.Info(newEncoder(t, WithEncoderCRC(false)).EncodeAll(payload, nil))
+	failOnError(t, "Error while parsing the frame", err)
+	if !withCRC.HasChecksum || withoutCRC.HasChecksum {
+		t.Fatalf("Expected a checksum by default only, got %v and %v", withCRC.HasChecksum, withoutCRC.HasChecksum)
+	}
+
+	out := newEncoder(t, WithEncoderDict(dict)).EncodeAll(payload, nil)
+	info, err := zstd.Info(out)
+	failOnError(t, "Error while parsing the frame", err)
+	if id := info.Frames[0].DictID; id != zstd.GetDictIDFromDict(dict) {
+		t.Fatalf("Expected the dictionary ID in the frame, got %d", id)
+	}
+	kd, err := kzstd.NewReader(nil, kzstd.WithDecoderDicts(dict))
+	failOnError(t, "Error while creating the klauspost decoder", err)
+	defer kd.Close()
+	decoded, err := kd.DecodeAll(out, nil)
+	failOnError(t, "Error while decompressing with klauspost", err)
+	if !bytes.Equal(decoded, payload) {
+		t.Fatalf("Dictionary round trip mismatch")
+	}
+
+	info, err = zstd.Info(newEncoder(t, WithWindowSize(1<<15)).EncodeAll(payload, nil))
+	failOnError(t, "Error while parsing the frame", err)
+	if size := info.Frames[0].WindowSize; size > 1<<15 {
+		t.Fatalf("Expected a window of at most 32KB, got %d", size)
+	}
+}
+
+func TestEncoderOptionErrors(t *testing.T) {
+	for name, opt := range map[string]EOption{
+		"WithEncoderPadding":           WithEncoderPadding(4),
+		"WithAllLitEntropyCompression": WithAllLitEntropyCompression(true),
+		"WithNoEntropyCompression":     WithNoEntropyCompression(true),
+		"WithSingleSegment":            WithSingleSegment(true),
+		"WithEncoderDictRaw":           WithEncoderDictRaw(1, []byte("raw")),
+	} {
+		if _, err := NewWriter(nil, opt); !errors.Is(err, ErrUnsupportedOption) {
+			t.Fatalf("%s: expected ErrUnsupportedOption, got %v", name, err)
+		}
+	}
+	for name, opt := range map[string]EOption{
+		"level":       WithEncoderLevel(speedLast),
+		"window":      WithWindowSize(3000),
+		"small":       WithWindowSize(512),
+		"concurrency": WithEncoderConcurrency(0),
+		"dict":        WithEncoderDict([]byte("not a dictionary")),
+	} {
+		if _, err := NewWriter(nil, opt); err == nil || errors.Is(err, ErrUnsupportedOption) {
+			t.Fatalf("%s: expected an invalid option error, got %v", name, err)
+		}
+	}
+	// Options without effect on libzstd are accepted
+	newEncoder(t, WithEncoderPadding(1), WithNoEntropyCompression(false), WithEncoderConcurrency(4), WithLowerEncoderMem(true))
+}
+
+func TestEncoderLevels(t *testing.T) {
+	for l := SpeedFastest; l < speedLast; l++ {
+		if ok, got := EncoderLevelFromString(strings.ToUpper(l.String())); !ok || got != l {
+			t.Fatalf("Expected %s, got %s", l, got)
+		}
+		if got := EncoderLevelFromZstd(zstdLevels[l]); got != l {
+			t.Fatalf("Expected %s for zstd level %d, got %s", l, zstdLevels[l], got)
+		}
+	}
+	if ok, got := EncoderLevelFromString("fast"); ok || got != SpeedDefault {
+		t.Fatalf("Expected an unknown level, got %v %s", ok, got)
+	}
+}
+
+func TestEncoderStream(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := NewWriter(&buf)
+	failOnError(t, "Error while creating the encoder", err)
+	_, err = e.Write(payload[:100])
+	failOnError(t, "Error while writing", err)
+	failOnError(t, "Error while flushing", e.Flush())
+	_, err = e.ReadFrom(bytes.NewReader(payload[100:]))
+	failOnError(t, "Error while reading from", err)
+	failOnError(t, "Error while closing", e.Close())
+
+	kd, err := kzstd.NewReader(bytes.NewReader(buf.Bytes()))
+	failOnError(t, "Error while creating the klauspost decoder", err)
+	defer kd.Close()
+	var decoded bytes.Buffer
+	_, err = kd.WriteTo(&decoded)
+	failOnError(t, "Error while decompressing with klauspost", err)
+	if !bytes.Equal(decoded.Bytes(), payload) {
+		t.Fatalf("Stream round trip mismatch")
+	}
+
+	// The Encoder is reused after Reset, an unfinished stream is discarded
+	var other bytes.Buffer
+	_, err = e.Write([]byte("discarded"))
+	failOnError(t, "Error while writing", err)
+	e.Reset(&other)
+	_, err = e.Write([]byte("kept"))
+	failOnError(t, "Error while writing", err)
+	failOnError(t, "Error while closing", e.Close())
+	out, err := zstd.Decompress(nil, other.Bytes())
+	failOnError(t, "Error while decompressing", err)
+	if string(out) != "kept" {
+		t.Fatalf("Expected the new stream only, got %q", out)
+	}
+
+	// Empty streams write nothing, unless WithZeroFrames is set
+	var empty bytes.Buffer
+	e.Reset(&empty)
+	failOnError(t, "Error while closing", e.Close())
+	if empty.Len() != 0 {
+		t.Fatalf("Expected no output for an empty stream, got %d bytes", empty.Len())
+	}
+	z, err := NewWriter(&empty, WithZeroFrames(true))
+	failOnError(t, "Error while creating the encoder", err)
+	failOnError(t, "Error while closing", z.Close())
+	if out, err := zstd.Decompress(nil, empty.Bytes()); err != nil || len(out) != 0 {
+		t.Fatalf("Expected an empty frame, got %d bytes: %v", empty.Len(), err)
+	}
+}
@@ -0,0 +1,151 @@
+//go:build cgo
+// +build cgo
+
+// Package zstdgrpc provides a gRPC compressor for the zstd encoding, backed
+// by the zstd package.
+//
+// Register it once, e.g. in an init function, then select it on calls with
+// grpc.UseCompressor(zstdgrpc.Name). Servers answer with the compressor of
+// the request.
+package zstdgrpc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/colinlyguo/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the name of the compressor, as sent in the grpc-encoding header.
+const Name = "zstd"
+
+// maxSizeHint bounds the buffer taken from the pools for the content size
+// declared by an incoming message, which is untrusted. It matches the
+// default maximum message size of gRPC servers.
+const maxSizeHint = 4 << 20
+
+// Compressor implements encoding.Compressor. Messages are buffered and
+// compressed as a single frame when the message is written, so the buffers
+// are taken from the pools of the zstd package.
+type Compressor struct {
+	// Level is the compression level of outgoing messages, 0 means
+	// zstd.DefaultCompression
+	Level int
+
+	// MaxWindowLog bounds the memory needed to decompress incoming messages,
+	// see zstd.DecompressOptions. 0 keeps the default.
+	MaxWindowLog int
+}
+
+// Register registers a Compressor with the default settings. To configure
+// it, register it directly instead:
+//
+//	encoding.RegisterCompressor(&zstdgrpc.Compressor{Level: 3, MaxWindowLog: 23})
+func Register() {
+	encoding.RegisterCompressor(&Compressor{})
+}
+
+// Name implements encoding.Compressor.
+func (c *Compressor) Name() string {
+	return Name
+}
+
+// writerPool holds the writers returned by Compress.
+var writerPool = sync.Pool{
+	New: func() interface{} {
+		return new(writer)
+	},
+}
+
+// Compress implements encoding.Compressor.
+func (c *Compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	zw := writerPool.Get().(*writer)
+	zw.w = w
+	zw.level = c.Level
+	if zw.level == 0 {
+		zw.level = zstd.DefaultCompression
+	}
+	return zw, nil
+}
+
+// writer buffers a message and compresses it on Close.
+type writer struct {
+	w     io.Writer
+	level int
+	buf   bytes.Buffer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *writer) Close() error {
+	defer func() {
+		w.w = nil
+		w.buf.Reset()
+		writerPool.Put(w)
+	}()
+	dst := zstd.GetCompressBuffer(w.buf.Len())
+	defer zstd.PutCompressBuffer(dst)
+	out, err := zstd.CompressLevel(dst, w.buf.Bytes(), w.level)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(out)
+	return err
+}
+
+// Decompress implements encoding.Compressor. The message is decompressed
+// before returning, into a buffer going back to the pools once it is read.
+func (c *Compressor) Decompress(r io.Reader) (io.Reader, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var dst []byte
+	if size := c.DecompressedSize(src); size > 0 && size <= maxSizeHint {
+		dst = zstd.GetDecompressBuffer(size)
+	}
+	out, err := zstd.DecompressWithOptions(dst, src, zstd.DecompressOptions{MaxWindowLog: c.MaxWindowLog})
+	if err != nil {
+		if dst != nil {
+			zstd.PutDecompressBuffer(dst)
+		}
+		return nil, err
+	}
+	return &reader{buf: out}, nil
+}
+
+// DecompressedSize returns the content size declared by the frames of a
+// message, or -1 if unknown. gRPC uses it to reject messages larger than the
+// maximum message size before decompressing them.
+func (c *Compressor) DecompressedSize(buf []byte) int {
+	info, err := zstd.Info(buf)
+	if err != nil || info.DecompressedSize < 0 || info.DecompressedSize > int64(int(^uint(0)>>1)) {
+		return -1
+	}
+	return int(info.DecompressedSize)
+}
+
+// reader reads a decompressed message and gives its buffer back to the
+// pools at EOF.
+type reader struct {
+	buf []byte
+	off int
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.buf == nil {
+		return 0, io.EOF
+	}
+	n := copy(p, r.buf[r.off:])
+	r.off += n
+	if r.off == len(r.buf) {
+		zstd.PutDecompressBuffer(r.buf)
+		r.buf = nil
+	}
+	return n, nil
+}
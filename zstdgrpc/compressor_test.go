@@ -0,0 +1,155 @@
+//go:build cgo
+// +build cgo
+
+package zstdgrpc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/colinlyguo/zstd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func init() {
+	Register()
+}
+
+// echoService is a unary service answering with the request, registered
+// without generated code.
+var echoService = grpc.ServiceDesc{
+	ServiceName: "zstdgrpc.test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Echo",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(wrapperspb.BytesValue)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			return in, nil
+		},
+	}},
+}
+
+// payloadStats records whether all the payloads received by the server were
+// smaller on the wire than decoded.
+type payloadStats struct {
+	received   int32
+	compressed int32
+}
+
+func (s *payloadStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (s *payloadStats) HandleRPC(_ context.Context, st stats.RPCStats) {
+	if in, ok := st.(*stats.InPayload); ok {
+		atomic.AddInt32(&s.received, 1)
+		if in.WireLength < in.Length {
+			atomic.AddInt32(&s.compressed, 1)
+		}
+	}
+}
+
+func (s *payloadStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s *payloadStats) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestLoopback(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	st := new(payloadStats)
+	srv := grpc.NewServer(grpc.StatsHandler(st), grpc.MaxRecvMsgSize(64<<20))
+	srv.RegisterService(&echoService, struct{}{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(Name), grpc.MaxCallRecvMsgSize(64<<20)),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	for _, size := range []int{0, 100, 1 << 20, 32 << 20} {
+		payload := bytes.Repeat([]byte("Hello, World! "), size/14+1)[:size]
+		out := new(wrapperspb.BytesValue)
+		err := conn.Invoke(context.Background(), "/zstdgrpc.test.Echo/Echo", wrapperspb.Bytes(payload), out)
+		if err != nil {
+			t.Fatalf("size %d: echo failed: %v", size, err)
+		}
+		if !bytes.Equal(out.Value, payload) {
+			t.Fatalf("size %d: echoed payload does not match", size)
+		}
+	}
+	if st.received != 4 || st.compressed < 2 {
+		t.Fatalf("expected the large requests to be compressed, %d of %d were", st.compressed, st.received)
+	}
+}
+
+func TestCompressorRoundTrip(t *testing.T) {
+	c := &Compressor{Level: zstd.BestSpeed}
+	payload := bytes.Repeat([]byte("Hello, World! "), 10000)
+
+	var buf bytes.Buffer
+	w, err := c.Compress(&buf)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if size := c.DecompressedSize(buf.Bytes()); size != len(payload) {
+		t.Fatalf("expected a decompressed size of %d, got %d", len(payload), size)
+	}
+
+	r, err := c.Decompress(&buf)
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if !bytes.Equal(out, payload) {
+		t.Fatal("decompressed payload does not match")
+	}
+}
+
+func TestCompressorMaxWindowLog(t *testing.T) {
+	payload := bytes.Repeat([]byte("Hello, World! "), 100000)
+	var buf bytes.Buffer
+	w, err := zstd.NewWriterParams(&buf, zstd.WriterParams{CParams: zstd.CParams{WindowLog: 24}})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	w.Write(payload)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	c := &Compressor{MaxWindowLog: 20}
+	if _, err := c.Decompress(bytes.NewReader(buf.Bytes())); err != zstd.ErrWindowTooLarge {
+		t.Fatalf("expected ErrWindowTooLarge, got %v", err)
+	}
+	if _, err := (&Compressor{}).Decompress(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("failed to decompress without limit: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/colinlyguo/zstd/zstdgrpc
+
+go 1.14
+
+require (
+	github.com/colinlyguo/zstd v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.46.2
+	google.golang.org/protobuf v1.27.1
+)
+
+replace github.com/colinlyguo/zstd => ../
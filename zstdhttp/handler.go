@@ -0,0 +1,221 @@
+//go:build cgo
+// +build cgo
+
+package zstdhttp
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/colinlyguo/zstd"
+)
+
+// DefaultMinSize is the response size under which NewHandler does not
+// compress: the frame overhead is not worth it for tiny bodies.
+const DefaultMinSize = 1024
+
+// NewHandler wraps h so that responses are zstd-compressed at the default
+// level when the client sends Accept-Encoding: zstd.
+func NewHandler(h http.Handler) http.Handler {
+	return NewHandlerLevel(h, zstd.DefaultCompression, DefaultMinSize)
+}
+
+// NewHandlerLevel is like NewHandler but specifies the compression level and
+// the minimum response size to compress. Responses are buffered until
+// minSize bytes are written, the handler returns or the handler flushes.
+func NewHandlerLevel(h http.Handler, level, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !AcceptsZstd(r.Header.Get("Accept-Encoding")) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rw := rwPool.Get().(*responseWriter)
+		rw.ResponseWriter = w
+		rw.level = level
+		rw.minSize = minSize
+		defer func() {
+			rw.Close()
+			rw.reset()
+			rwPool.Put(rw)
+		}()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// AcceptsZstd returns whether an Accept-Encoding header value allows the zstd
+// coding, honoring q=0 exclusions.
+func AcceptsZstd(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding != Encoding && coding != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				accepted = err == nil && q > 0
+			}
+		}
+		if coding == Encoding || accepted {
+			return accepted
+		}
+	}
+	return false
+}
+
+// rwPool keeps responseWriters, and their staging buffers, across requests.
+var rwPool = sync.Pool{
+	New: func() interface{} {
+		return &responseWriter{}
+	},
+}
+
+// responseWriter buffers the start of a response to decide whether it is
+// worth compressing, then either streams it through a zstd.Writer or passes
+// it through untouched.
+type responseWriter struct {
+	http.ResponseWriter
+
+	level       int
+	minSize     int
+	status      int
+	buf         []byte
+	decided     bool
+	zw          *zstd.Writer
+	wroteHeader bool
+}
+
+func (rw *responseWriter) reset() {
+	rw.ResponseWriter = nil
+	rw.status = 0
+	rw.buf = rw.buf[:0]
+	rw.decided = false
+	rw.zw = nil
+	rw.wroteHeader = false
+}
+
+// WriteHeader records the status, it is sent once we know whether the body is
+// compressed since that changes the headers.
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if rw.Header().Get("Content-Type") == "" && !rw.decided {
+		// Sniff on the uncompressed data, as net/http would have done
+		sniff := append(rw.buf, p...)
+		rw.Header().Set("Content-Type", http.DetectContentType(sniff))
+	}
+	if !rw.decided {
+		if len(rw.buf)+len(p) < rw.minSize && bodyAllowed(rw.status) && rw.Header().Get("Content-Encoding") == "" {
+			rw.buf = append(rw.buf, p...)
+			return len(p), nil
+		}
+		if err := rw.decide(len(rw.buf)+len(p) >= rw.minSize); err != nil {
+			return 0, err
+		}
+	}
+	if rw.zw != nil {
+		return rw.zw.Write(p)
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// decide commits to compressing or not, writes the headers and the buffered
+// data.
+func (rw *responseWriter) decide(compress bool) error {
+	rw.decided = true
+	h := rw.Header()
+	if compress && bodyAllowed(rw.status) && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", Encoding)
+		h.Del("Content-Length")
+		rw.zw = zstd.NewWriterLevel(rw.ResponseWriter, rw.level)
+	}
+	rw.writeHeader()
+	if len(rw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if rw.zw != nil {
+		_, err = rw.zw.Write(rw.buf)
+	} else {
+		_, err = rw.ResponseWriter.Write(rw.buf)
+	}
+	rw.buf = rw.buf[:0]
+	return err
+}
+
+func (rw *responseWriter) writeHeader() {
+	if rw.wroteHeader || rw.status == 0 {
+		return
+	}
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(rw.status)
+}
+
+// Flush sends any buffered data to the client. Flushing before minSize bytes
+// were written commits to compression since the response is being streamed.
+func (rw *responseWriter) Flush() {
+	if !rw.decided {
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		if err := rw.decide(true); err != nil {
+			return
+		}
+	}
+	if rw.zw != nil {
+		if err := rw.zw.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets websocket style handlers take over the connection.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Close ends the response: small bodies are sent as is, compressed ones get
+// their frame epilogue.
+func (rw *responseWriter) Close() error {
+	if !rw.decided {
+		if err := rw.decide(false); err != nil {
+			return err
+		}
+	}
+	if rw.zw != nil {
+		return rw.zw.Close()
+	}
+	return nil
+}
+
+// bodyAllowed reports whether a response with the status can carry a body.
+func bodyAllowed(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent || status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
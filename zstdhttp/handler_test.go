@@ -0,0 +1,159 @@
+//go:build cgo
+// +build cgo
+
+package zstdhttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/colinlyguo/zstd"
+)
+
+var largeBody = strings.Repeat("Hello World! ", 10000)
+
+func TestAcceptsZstd(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected bool
+	}{
+		{"", false},
+		{"gzip", false},
+		{"zstd", true},
+		{"gzip, zstd", true},
+		{"gzip, ZSTD;q=0.5", true},
+		{"zstd;q=0", false},
+		{"*", true},
+		{"*;q=0", false},
+		{"zstd;q=0, *", false},
+	}
+	for _, test := range tests {
+		if got := AcceptsZstd(test.header); got != test.expected {
+			t.Errorf("AcceptsZstd(%q) = %v, want %v", test.header, got, test.expected)
+		}
+	}
+}
+
+func TestHandlerCompressesLargeResponses(t *testing.T) {
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "130000")
+		w.Write([]byte(largeBody))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != Encoding {
+		t.Fatalf("Content-Encoding = %q, want %q", enc, Encoding)
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != "" {
+		t.Fatalf("Content-Length should have been removed, got %q", cl)
+	}
+	if rec.Body.Len() >= len(largeBody) {
+		t.Fatalf("body was not compressed: %d bytes", rec.Body.Len())
+	}
+	decompressed, err := zstd.Decompress(nil, rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("failed to decompress body: %s", err)
+	}
+	if string(decompressed) != largeBody {
+		t.Fatalf("decompressed body does not match")
+	}
+}
+
+func TestHandlerSkipsSmallAndUnacceptedResponses(t *testing.T) {
+	body := "tiny"
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(body))
+	}))
+
+	for _, accept := range []string{"zstd", "gzip"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+			t.Fatalf("accept=%s: Content-Encoding = %q, want none", accept, enc)
+		}
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("accept=%s: status = %d, want %d", accept, rec.Code, http.StatusCreated)
+		}
+		if rec.Body.String() != body {
+			t.Fatalf("accept=%s: body = %q, want %q", accept, rec.Body.String(), body)
+		}
+	}
+}
+
+func TestHandlerFlush(t *testing.T) {
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("second"))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if !rec.Flushed {
+		t.Fatal("Flush was not passed through")
+	}
+	if enc := rec.Header().Get("Content-Encoding"); enc != Encoding {
+		t.Fatalf("Content-Encoding = %q, want %q", enc, Encoding)
+	}
+	decompressed, err := zstd.Decompress(nil, rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("failed to decompress body: %s", err)
+	}
+	if string(decompressed) != "firstsecond" {
+		t.Fatalf("decompressed body = %q", decompressed)
+	}
+}
+
+func TestTransportRoundTrip(t *testing.T) {
+	server := httptest.NewServer(NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(largeBody))
+	})))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(nil)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %s", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		t.Fatalf("failed to close body: %s", err)
+	}
+	if !resp.Uncompressed {
+		t.Fatal("response should be marked as uncompressed")
+	}
+	if string(body) != largeBody {
+		t.Fatalf("body does not match (len %d)", len(body))
+	}
+
+	// An explicit Accept-Encoding disables transparent decoding
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	raw, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != Encoding || bytes.Equal(raw, []byte(largeBody)) {
+		t.Fatal("body should have been left compressed")
+	}
+}
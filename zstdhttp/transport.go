@@ -0,0 +1,79 @@
+// Package zstdhttp provides net/http support for the zstd content encoding
+// (RFC 8878): a Handler wrapper compressing responses and a RoundTripper
+// transparently decompressing them.
+package zstdhttp
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/colinlyguo/zstd"
+)
+
+// Encoding is the content coding token used for zstd.
+const Encoding = "zstd"
+
+// Transport is an http.RoundTripper advertising and transparently
+// decompressing zstd encoded responses, like http.Transport does for gzip.
+// Responses are only decoded when the Accept-Encoding header was added by
+// the Transport, requests setting their own Accept-Encoding get the raw body.
+type Transport struct {
+	// Base is the RoundTripper used to send requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+// NewTransport returns a Transport wrapping base.
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	added := false
+	if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
+		// RoundTrippers must not modify the request, work on a copy
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", Encoding)
+		added = true
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil || !added {
+		return resp, err
+	}
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), Encoding) {
+		return resp, nil
+	}
+	resp.Body = &decodingBody{body: resp.Body, zr: zstd.NewReader(resp.Body)}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// decodingBody decompresses a response body, closing both the decoder and
+// the underlying body.
+type decodingBody struct {
+	body io.ReadCloser
+	zr   io.ReadCloser
+}
+
+func (b *decodingBody) Read(p []byte) (int, error) {
+	return b.zr.Read(p)
+}
+
+func (b *decodingBody) Close() error {
+	err := b.zr.Close()
+	if berr := b.body.Close(); err == nil {
+		err = berr
+	}
+	return err
+}
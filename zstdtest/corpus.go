@@ -0,0 +1,95 @@
+// Package zstdtest provides deterministic test corpora, a round-trip
+// assertion and golden frames for the packages built on top of zstd, so that
+// they do not have to reinvent them. It only depends on the standard library
+// and works with both the cgo and the pure-Go backends.
+package zstdtest
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// words are the vocabulary of the compressible corpus.
+var words = []string{"the", "quick", "brown", "fox", "jumps", "over", "lazy", "dog", "zstd", "frame",
+	"block", "window", "literal", "sequence", "match", "offset", "batch", "blob", "scroll", "chunk"}
+
+// Compressible returns n bytes of text drawn from a small vocabulary, which
+// compresses well at any level.
+func Compressible(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	out := make([]byte, 0, n+16)
+	for len(out) < n {
+		out = append(out, words[r.Intn(len(words))]...)
+		out = append(out, ' ')
+	}
+	return out[:n]
+}
+
+// Random returns n random bytes, which do not compress and end up in raw
+// blocks.
+func Random(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	out := make([]byte, n)
+	r.Read(out)
+	return out
+}
+
+// Structured returns n bytes of JSON records sharing their keys but with
+// random values, similar to logs or API payloads.
+func Structured(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	out := make([]byte, 0, n+256)
+	for len(out) < n {
+		out = appendRecord(out, r)
+	}
+	return out[:n]
+}
+
+// Records returns count distinct structured records of exactly size bytes,
+// e.g. for dictionary and batch tests.
+func Records(seed int64, count, size int) [][]byte {
+	r := rand.New(rand.NewSource(seed))
+	records := make([][]byte, count)
+	for i := range records {
+		record := make([]byte, 0, size+256)
+		for len(record) < size {
+			record = appendRecord(record, r)
+		}
+		records[i] = record[:size:size]
+	}
+	return records
+}
+
+func appendRecord(dst []byte, r *rand.Rand) []byte {
+	return append(dst, fmt.Sprintf(`{"id":%d,"user":"user-%d","status":%q,"amount":%d.%02d,"tags":[%q,%q]}`+"\n",
+		r.Int63(), r.Intn(10000), []string{"pending", "settled", "failed"}[r.Intn(3)],
+		r.Intn(100000), r.Intn(100), words[r.Intn(len(words))], words[r.Intn(len(words))])...)
+}
+
+// RLE returns n times the byte b, the pathological input compressed into RLE
+// blocks with the highest ratio.
+func RLE(b byte, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = b
+	}
+	return out
+}
+
+// Corpus is a named test input.
+type Corpus struct {
+	Name string
+	Data []byte
+}
+
+// Corpora returns the empty input and size bytes of each generator, seeded
+// with seed.
+func Corpora(seed int64, size int) []Corpus {
+	return []Corpus{
+		{Name: "empty", Data: []byte{}},
+		{Name: "compressible", Data: Compressible(seed, size)},
+		{Name: "random", Data: Random(seed, size)},
+		{Name: "structured", Data: Structured(seed, size)},
+		{Name: "rle", Data: RLE(byte(seed), size)},
+	}
+}
@@ -0,0 +1,37 @@
+package zstdtest
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGeneratorsDeterministic(t *testing.T) {
+	for _, size := range []int{0, 1, 1000} {
+		a, b := Corpora(42, size), Corpora(42, size)
+		for i := range a {
+			if !bytes.Equal(a[i].Data, b[i].Data) {
+				t.Errorf("Corpus %s is not deterministic", a[i].Name)
+			}
+			if a[i].Name != "empty" && len(a[i].Data) != size {
+				t.Errorf("Expected %d bytes of %s, got %d", size, a[i].Name, len(a[i].Data))
+			}
+		}
+	}
+	if bytes.Equal(Random(1, 100), Random(2, 100)) || bytes.Equal(Structured(1, 100), Structured(2, 100)) {
+		t.Error("Expected different seeds to generate different data")
+	}
+}
+
+func TestRecords(t *testing.T) {
+	records := Records(1, 100, 300)
+	seen := make(map[string]bool)
+	for _, r := range records {
+		if len(r) != 300 || cap(r) != 300 {
+			t.Fatalf("Expected records of 300 bytes, got len %d cap %d", len(r), cap(r))
+		}
+		seen[string(r)] = true
+	}
+	if len(seen) != len(records) {
+		t.Errorf("Expected %d distinct records, got %d", len(records), len(seen))
+	}
+}
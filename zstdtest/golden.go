@@ -0,0 +1,81 @@
+package zstdtest
+
+import (
+	"bytes"
+	"encoding/hex"
+)
+
+// Golden is a frame produced by the reference zstd CLI (v1.5.6) along with
+// the content it decompresses to, for interoperability checks.
+type Golden struct {
+	Name    string
+	Frame   []byte
+	Content []byte
+}
+
+const (
+	helloFrame    = "28b52ffd045871000048656c6c6f2c20576f726c64210af1f98eb6"
+	streamedFrame = "28b52ffd005801010073747265616d656420776974686f7574206120636f6e74656e742073697a650a"
+	randomContent = "2291d8cdc310411e7ec27378a661c935187c07e4d5636e9bc3c400b27244b8cd" +
+		"3a97f11ae651070506a68a02f0e161af37f86cb9078738c370f07e8d3b583bad"
+)
+
+// GoldenFrames returns the golden frames, freshly allocated so that callers
+// may modify them.
+func GoldenFrames() []Golden {
+	hello := []byte("Hello, World!\n")
+	streamed := []byte("streamed without a content size\n")
+	return []Golden{
+		{
+			Name:    "empty",
+			Frame:   mustDecodeHex("28b52ffd240001000099e9d851"),
+			Content: []byte{},
+		},
+		{
+			// Checksummed, with a single raw block
+			Name:    "hello",
+			Frame:   mustDecodeHex(helloFrame),
+			Content: hello,
+		},
+		{
+			Name:    "no-checksum",
+			Frame:   mustDecodeHex("28b52ffd005871000048656c6c6f2c20576f726c64210a"),
+			Content: hello,
+		},
+		{
+			// Compressed from a pipe, the header has no content size
+			Name:    "no-content-size",
+			Frame:   mustDecodeHex(streamedFrame),
+			Content: streamed,
+		},
+		{
+			Name:    "repetitive",
+			Frame:   mustDecodeHex("28b52ffd005855000010616101009b8639c002"),
+			Content: RLE('a', 100000),
+		},
+		{
+			Name:    "incompressible",
+			Frame:   mustDecodeHex("28b52ffd2040010200" + randomContent),
+			Content: mustDecodeHex(randomContent),
+		},
+		{
+			// A skippable frame carrying "meta", then a frame
+			Name:    "skippable",
+			Frame:   mustDecodeHex("502a4d18040000006d657461" + helloFrame),
+			Content: hello,
+		},
+		{
+			Name:    "concatenated",
+			Frame:   mustDecodeHex(helloFrame + streamedFrame),
+			Content: bytes.Join([][]byte{hello, streamed}, nil),
+		},
+	}
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
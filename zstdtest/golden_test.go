@@ -0,0 +1,31 @@
+package zstdtest
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+)
+
+// TestGoldenFrames checks the fixtures against the zstd CLI, when installed.
+func TestGoldenFrames(t *testing.T) {
+	zstd, err := exec.LookPath("zstd")
+	if err != nil {
+		t.Skip("zstd CLI not found")
+	}
+	for _, g := range GoldenFrames() {
+		cmd := exec.Command(zstd, "-d", "-c", "-q")
+		cmd.Stdin = bytes.NewReader(g.Frame)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("Failed to decompress %s: %v", g.Name, err)
+		}
+		if !bytes.Equal(out, g.Content) {
+			t.Errorf("Content of %s does not match", g.Name)
+		}
+	}
+	frames := GoldenFrames()
+	frames[0].Frame[0] = 0
+	if GoldenFrames()[0].Frame[0] == 0 {
+		t.Error("Expected GoldenFrames to return fresh copies")
+	}
+}
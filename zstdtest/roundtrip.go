@@ -0,0 +1,85 @@
+package zstdtest
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// Func is the signature shared by the one-shot compression and decompression
+// functions: they write into dst when its capacity suffices, otherwise
+// allocate, and return the output.
+type Func func(dst, src []byte) ([]byte, error)
+
+// RoundTripSizes are the input sizes checked by RoundTrip, around the 128KB
+// block size and spanning several blocks.
+var RoundTripSizes = []int{1, 100, 4 << 10, 128<<10 + 1, 1<<20 + 3}
+
+// RoundTrip checks that decompress reverts compress on the empty input and on
+// each corpus at each of RoundTripSizes, as subtests. For every input it
+// checks that src is left untouched, and that the output does not depend on
+// dst, whether it is nil, too small, or larger and holding stale data, as
+// when reusing a buffer.
+func RoundTrip(t *testing.T, compress, decompress Func) {
+	t.Run("nil", func(t *testing.T) {
+		checkRoundTrip(t, compress, decompress, nil)
+	})
+	for _, size := range RoundTripSizes {
+		for _, c := range Corpora(int64(size), size) {
+			if len(c.Data) == 0 && size != RoundTripSizes[0] {
+				continue
+			}
+			data := c.Data
+			t.Run(fmt.Sprintf("%s/%d", c.Name, len(data)), func(t *testing.T) {
+				checkRoundTrip(t, compress, decompress, data)
+			})
+		}
+	}
+}
+
+func checkRoundTrip(t *testing.T, compress, decompress Func, src []byte) {
+	orig := append([]byte(nil), src...)
+	compressed, err := compress(nil, src)
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if !bytes.Equal(src, orig) {
+		t.Fatal("Compression modified its input")
+	}
+	compressed = append([]byte(nil), compressed...)
+	for _, dst := range dsts(len(compressed)) {
+		out, err := compress(dst, src)
+		if err != nil {
+			t.Fatalf("Failed to compress into a buffer of capacity %d: %v", cap(dst), err)
+		}
+		if !bytes.Equal(out, compressed) {
+			t.Fatalf("Compression into a buffer of capacity %d does not match", cap(dst))
+		}
+	}
+
+	for _, dst := range append(dsts(len(src)), nil) {
+		out, err := decompress(dst, compressed)
+		if err != nil {
+			t.Fatalf("Failed to decompress into a buffer of capacity %d: %v", cap(dst), err)
+		}
+		if !bytes.Equal(out, src) {
+			t.Fatalf("Decompression into a buffer of capacity %d does not match", cap(dst))
+		}
+		// Decompress again into the previous output, as callers reusing it
+		again, err := decompress(out, compressed)
+		if err != nil {
+			t.Fatalf("Failed to decompress into the previous output: %v", err)
+		}
+		if !bytes.Equal(again, src) {
+			t.Fatal("Decompression into the previous output does not match")
+		}
+	}
+}
+
+// dsts returns the destination buffers to try for an output of n bytes: too
+// small, and twice as large as needed holding stale data.
+func dsts(n int) [][]byte {
+	small := make([]byte, 1)
+	large := RLE(0xAA, 2*n+64)
+	return [][]byte{small, large, large[:0]}
+}
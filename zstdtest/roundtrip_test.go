@@ -0,0 +1,34 @@
+package zstdtest
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"testing"
+)
+
+// flateCompress and flateDecompress follow the conventions of the zstd
+// package on top of compress/flate, to test RoundTrip without depending on
+// it.
+func flateCompress(dst, src []byte) ([]byte, error) {
+	b := bytes.NewBuffer(dst[:0])
+	w, err := flate.NewWriter(b, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func flateDecompress(dst, src []byte) ([]byte, error) {
+	return ioutil.ReadAll(flate.NewReader(bytes.NewReader(src)))
+}
+
+func TestRoundTrip(t *testing.T) {
+	RoundTrip(t, flateCompress, flateDecompress)
+}